@@ -274,6 +274,22 @@ class DatabaseManager:
             logger.error(f"Failed to update heartbeat for node {node_id}: {e}")
             return False
     
+    async def deregister_storage_node(self, node_id: str) -> bool:
+        """Remove a storage node; removing an unknown node succeeds"""
+        try:
+            conn = await self.get_connection()
+            cursor = await conn.execute("""
+                DELETE FROM storage_nodes WHERE node_id = ?
+            """, (node_id,))
+            await conn.commit()
+            
+            if cursor.rowcount == 0:
+                logger.info(f"Deregistration of unknown node {node_id}")
+            return True
+        except Exception as e:
+            logger.error(f"Failed to deregister node {node_id}: {e}")
+            return False
+    
     async def get_healthy_nodes(self) -> List[Dict[str, Any]]:
         """Get list of healthy storage nodes"""
         try:
@@ -340,6 +340,16 @@ async def register_storage_node(node_data: NodeRegistration):
     
     return {"status": "registered", "node_id": node_data.node_id, "node_url": node_data.node_url}
 
+@app.delete("/nodes/{node_id}")
+async def deregister_storage_node(node_id: str):
+    """Deregister a storage node so no new reads or writes are routed to it"""
+    success = await db_manager.deregister_storage_node(node_id)
+    
+    if not success:
+        raise HTTPException(status_code=500, detail="Failed to deregister storage node")
+    
+    return {"status": "deregistered", "node_id": node_id}
+
 @app.get("/nodes/all")
 async def get_all_nodes():
     """Get detailed information about all storage nodes"""
@@ -235,6 +235,25 @@ class TestMetadataService:
         assert summary["healthy"] == 3, "All nodes should be healthy after recovery"
         assert summary["down"] == 0, "No nodes should be down after recovery"
 
+    @pytest.mark.asyncio
+    async def test_node_deregistration(self, db_manager):
+        """Test that a deregistered node is no longer offered as healthy"""
+
+        await db_manager.register_storage_node("http://node1:8080", "node-1", "1.0.0")
+        await db_manager.register_storage_node("http://node2:8080", "node-2", "1.0.0")
+
+        assert await db_manager.deregister_storage_node("node-1"), "Deregistration should succeed"
+        healthy = await db_manager.get_healthy_nodes()
+        assert [node["node_id"] for node in healthy] == ["node-2"], "Only node-2 should remain"
+
+        # Deregistering again, or an unknown node, is not an error
+        assert await db_manager.deregister_storage_node("node-1")
+        assert await db_manager.deregister_storage_node("never-registered")
+
+        # A deregistered node can register again
+        await db_manager.register_storage_node("http://node1:8080", "node-1", "1.0.0")
+        assert len(await db_manager.get_healthy_nodes()) == 2
+
     @pytest.mark.asyncio
     async def test_database_consistency_under_failures(self, db_manager, consensus):
         """Test database consistency under various failure scenarios"""
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminOnly restricts an endpoint to callers presenting ADMIN_TOKEN as a
+// bearer token. Without a configured token the endpoint is disabled, since
+// it exposes details of the node's on-disk layout.
+func (sn *StorageNode) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sn.authorizeAdmin(w, r) {
+			next(w, r)
+		}
+	}
+}
+
+// adminMiddleware applies adminOnly to every route of a router, such as the
+// /admin subrouter
+func (sn *StorageNode) adminMiddleware(next http.Handler) http.Handler {
+	return sn.adminOnly(next.ServeHTTP)
+}
+
+// authorizeAdmin checks a request for the admin bearer token, writing the
+// error response and returning false if it is missing or wrong
+func (sn *StorageNode) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if sn.adminToken == "" {
+		http.Error(w, "Admin endpoint disabled: ADMIN_TOKEN not configured", http.StatusForbidden)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(sn.adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="vstack-admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
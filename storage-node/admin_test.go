@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// adminRequest builds a request carrying the test ADMIN_TOKEN, "secret"
+func adminRequest(method, path string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer secret")
+	return req
+}
+
+func TestAdminRoutesRequireAdmin(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.adminToken = "secret"
+	router := sn.newRouter()
+
+	// Every /admin route, and starting a scrub
+	for _, route := range []struct{ method, path string }{
+		{"POST", "/admin/cache/flush"},
+		{"GET", "/admin/cache/stats"},
+		{"GET", "/admin/counters"},
+		{"POST", "/admin/chunk/admin-missing/relocate"},
+		{"POST", "/admin/superblocks/42/drain"},
+		{"GET", "/admin/superblocks/42/drain"},
+		{"POST", "/admin/flush"},
+		{"POST", "/admin/counters/reset"},
+		{"POST", "/admin/superblocks/42/compact"},
+		{"POST", "/admin/recheck"},
+		{"GET", "/admin/superblocks/checksums"},
+		{"GET", "/admin/manifest"},
+		{"POST", "/scrub"},
+	} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(route.method, route.path, nil))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s %s without ADMIN_TOKEN to be rejected with 401, got %d", route.method, route.path, rr.Code)
+		}
+
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, adminRequest(route.method, route.path, nil))
+		if rr.Code == http.StatusUnauthorized || rr.Code == http.StatusForbidden {
+			t.Errorf("Expected ADMIN_TOKEN to allow %s %s, got %d", route.method, route.path, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Small chunk write batching
+const (
+	SmallChunkThreshold = 4 * 1024 // Chunks up to this size take the batched path
+	MaxSmallChunkBatch  = 64       // Upper bound on chunks flushed per write
+)
+
+// pendingWrite is a chunk waiting to be appended to a superblock
+type pendingWrite struct {
+	chunkID      string
+	data         []byte
+	checksum     string
+	checksumAlgo string // algorithm checksum was computed with, the node's if empty
+	storedBy     string
+	expiresAt    *time.Time
+	meta         map[string]string
+	rewrite      bool // rewritten after failing read-after-write verification
+	done         chan error
+
+	compression string // codec stored was compressed with, "" when stored as is
+	encrypted   bool   // stored was encrypted with the node's ENCRYPTION_KEY
+	stored      []byte // data as written to disk, when compressed or encrypted
+}
+
+// payload returns the bytes written to disk for a chunk
+func (pw *pendingWrite) payload() []byte {
+	if pw.compression != "" || pw.encrypted {
+		return pw.stored
+	}
+	return pw.data
+}
+
+// writeBatcher implements group commit for small chunks: the first writer to
+// arrive becomes the leader and flushes everything queued behind it with one
+// write and one fsync, while followers wait for the shared result.
+type writeBatcher struct {
+	mu       sync.Mutex
+	pending  []*pendingWrite
+	flushing bool
+}
+
+// storeSmallChunk queues a small chunk and returns once it is durably stored
+func (sn *StorageNode) storeSmallChunk(pw *pendingWrite) error {
+	pw.done = make(chan error, 1)
+	b := &sn.smallWrites
+
+	b.mu.Lock()
+	b.pending = append(b.pending, pw)
+	if b.flushing {
+		b.mu.Unlock()
+		return <-pw.done
+	}
+
+	b.flushing = true
+	for len(b.pending) > 0 {
+		batch := b.pending
+		if len(batch) > MaxSmallChunkBatch {
+			batch = batch[:MaxSmallChunkBatch]
+		}
+		b.pending = b.pending[len(batch):]
+		if len(b.pending) == 0 {
+			b.pending = nil
+		}
+		b.mu.Unlock()
+
+		err := sn.appendChunks(batch)
+		for _, p := range batch {
+			p.done <- err
+		}
+
+		b.mu.Lock()
+	}
+	b.flushing = false
+	b.mu.Unlock()
+
+	return <-pw.done
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBatchedSmallChunksReadBack(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.smallChunkBatching = true
+	sn.maxSuperblockSize = 8 * 1024 // Force batches to straddle rotations
+
+	const numWriters = 16
+	const chunksPerWriter = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numWriters*chunksPerWriter)
+	for i := 0; i < numWriters; i++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for j := 0; j < chunksPerWriter; j++ {
+				chunkID := fmt.Sprintf("tiny-%d-%d", writer, j)
+				data := bytes.Repeat([]byte(chunkID), 10+j)
+				if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+					errs <- err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Batched write failed: %v", err)
+	}
+
+	// Every chunk reads back individually with its own bytes
+	for i := 0; i < numWriters; i++ {
+		for j := 0; j < chunksPerWriter; j++ {
+			chunkID := fmt.Sprintf("tiny-%d-%d", i, j)
+			sn.index.mu.RLock()
+			entry, ok := sn.index.chunks[chunkID]
+			sn.index.mu.RUnlock()
+			if !ok {
+				t.Fatalf("Chunk %s missing from index", chunkID)
+			}
+
+			data, err := sn.readChunk(entry)
+			if err != nil {
+				t.Fatalf("Failed to read chunk %s: %v", chunkID, err)
+			}
+			if !bytes.Equal(data, bytes.Repeat([]byte(chunkID), 10+j)) {
+				t.Errorf("Data mismatch for batched chunk %s", chunkID)
+			}
+		}
+	}
+
+	// No two chunks overlap within a superblock, and none exceeds its cap
+	sn.index.mu.RLock()
+	bySuperblock := make(map[int][]ChunkEntry)
+	for _, entry := range sn.index.chunks {
+		bySuperblock[entry.SuperblockID] = append(bySuperblock[entry.SuperblockID], entry)
+	}
+	sn.index.mu.RUnlock()
+
+	for id, entries := range bySuperblock {
+		sort.Slice(entries, func(a, b int) bool { return entries[a].Offset < entries[b].Offset })
+		for k := 1; k < len(entries); k++ {
+			if entries[k-1].Offset+int64(entries[k-1].Size) > entries[k].Offset {
+				t.Errorf("Overlapping chunks in superblock %d: %s and %s", id, entries[k-1].ChunkID, entries[k].ChunkID)
+			}
+		}
+		last := entries[len(entries)-1]
+		if last.Offset+int64(last.Size) > sn.maxSuperblockSize {
+			t.Errorf("Superblock %d exceeds its cap", id)
+		}
+	}
+}
+
+func benchmarkTinyChunkStore(b *testing.B, batching bool) {
+	tempDir := b.TempDir()
+	sn := NewStorageNode(tempDir, "bench-node")
+	if err := sn.Initialize(); err != nil {
+		b.Fatalf("Failed to initialize storage node: %v", err)
+	}
+	sn.smallChunkBatching = batching
+
+	data := bytes.Repeat([]byte("t"), 512)
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+	var seq int64
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := fmt.Sprintf("bench-%d", atomic.AddInt64(&seq, 1))
+			if err := sn.storeChunk(id, data, checksum); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkTinyChunkStore compares the direct write path against the
+// batched small-chunk path under concurrent writers
+func BenchmarkTinyChunkStore(b *testing.B) {
+	b.Run("direct", func(b *testing.B) { benchmarkTinyChunkStore(b, false) })
+	b.Run("batched", func(b *testing.B) { benchmarkTinyChunkStore(b, true) })
+}
+
+func TestFailedBatchUndoesAppend(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := []byte("chunk written before the failure")
+	if err := sn.storeChunk("kept", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	before, _ := sn.getSuperblockSize(sn.currentSuperblock)
+
+	// The write lands half its bytes, then fails
+	writeChunkData = func(file *os.File, buf []byte) (int, error) {
+		n, _ := file.Write(buf[:len(buf)/2])
+		return n, errors.New("injected write failure")
+	}
+	defer func() {
+		writeChunkData = func(file *os.File, buf []byte) (int, error) { return file.Write(buf) }
+	}()
+
+	batch := []*pendingWrite{
+		{chunkID: "lost-a", data: []byte("first chunk in the failed batch")},
+		{chunkID: "lost-b", data: []byte("second chunk in the failed batch")},
+	}
+	if err := sn.appendChunks(batch); err == nil {
+		t.Fatal("Expected the batch to fail")
+	}
+
+	if after, _ := sn.getSuperblockSize(sn.currentSuperblock); after != before {
+		t.Errorf("Expected the partial append to be undone, superblock went from %d to %d bytes", before, after)
+	}
+	if _, ok := sn.lookupChunk("lost-a"); ok {
+		t.Error("Expected a chunk from the failed batch not to be indexed")
+	}
+}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Batch transfer configuration
+const (
+	// BatchContentType selects compact length-prefixed binary framing:
+	// [idLen uint16][id][dataLen uint32][data]... (big endian)
+	BatchContentType = "application/x-vstack-batch"
+
+	MaxBatchItems = 1000
+
+	// missingFrameLength marks a requested chunk that doesn't exist in a
+	// binary batch GET response; no data follows it
+	missingFrameLength = math.MaxUint32
+)
+
+// BatchItemResult reports the outcome of one item in a batch request
+type BatchItemResult struct {
+	ChunkID  string `json:"chunk_id"`
+	Status   int    `json:"status"`
+	Checksum string `json:"checksum,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Code     string `json:"code,omitempty"` // Machine-readable reason, for rejected chunk IDs
+
+	// Set when the chunk was stored despite not matching its X-Chunk-Checksum
+	// (see CHECKSUM_MISMATCH_POLICY); Checksum is the computed one
+	ChecksumMismatch bool `json:"checksum_mismatch,omitempty"`
+}
+
+// BatchPutResponse represents the result of a batch PUT. If the body
+// couldn't be read to the end, Error says why and Results covers only the
+// items before that point, which were stored or rejected as reported.
+type BatchPutResponse struct {
+	Results   []BatchItemResult `json:"results"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// BatchGetRequest lists the chunks to fetch in a batch GET
+type BatchGetRequest struct {
+	ChunkIDs []string `json:"chunk_ids"`
+}
+
+// batchStatus returns the HTTP status of a whole batch and how many items
+// failed: success if no item failed, 207 Multi-Status if only some did, and
+// if all of them did, their common status, or 500 if any was a server error
+// and 400 otherwise. An empty batch succeeds.
+func batchStatus(results []BatchItemResult, success int) (int, int) {
+	failed, serverErrors := 0, 0
+	common := 0
+	for _, result := range results {
+		if result.Status < 400 {
+			continue
+		}
+		failed++
+		if result.Status >= 500 {
+			serverErrors++
+		}
+		if common == 0 || result.Status == common {
+			common = result.Status
+		} else {
+			common = -1
+		}
+	}
+	switch {
+	case failed == 0:
+		return success, 0
+	case failed < len(results):
+		return http.StatusMultiStatus, failed
+	case common > 0:
+		return common, failed
+	case serverErrors > 0:
+		return http.StatusInternalServerError, failed
+	default:
+		return http.StatusBadRequest, failed
+	}
+}
+
+// writeBatchFrame writes a single binary batch frame
+func writeBatchFrame(w io.Writer, chunkID string, data []byte) error {
+	var hdr [2]byte
+	binary.BigEndian.PutUint16(hdr[:], uint16(len(chunkID)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, chunkID); err != nil {
+		return err
+	}
+
+	var size [4]byte
+	if data == nil {
+		binary.BigEndian.PutUint32(size[:], missingFrameLength)
+		_, err := w.Write(size[:])
+		return err
+	}
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// batchFrameReader stream-parses binary batch frames, holding at most one
+// chunk's data in memory at a time
+type batchFrameReader struct {
+	r       *bufio.Reader
+	maxSize int64
+	body    *io.LimitedReader // the last frame's data, drained before the next
+}
+
+func newBatchFrameReader(r io.Reader, maxSize int64) *batchFrameReader {
+	return &batchFrameReader{r: bufio.NewReader(r), maxSize: maxSize}
+}
+
+// Next returns the next frame. data is nil for a missing-chunk frame. io.EOF
+// is returned only at a clean frame boundary. A frame whose data exceeds
+// maxSize is skipped and reported with errChunkTooLarge so parsing can go on.
+func (fr *batchFrameReader) Next() (string, []byte, error) {
+	id, size, body, err := fr.NextReader()
+	if err != nil || body == nil {
+		return id, nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return id, nil, fmt.Errorf("truncated batch frame data: %w", err)
+	}
+	return id, data, nil
+}
+
+// NextReader is Next without reading the frame's data into memory: it
+// returns the data's length and a reader over it, which is only valid until
+// the next call. Unread data is skipped then. body is nil for a missing-chunk
+// frame.
+func (fr *batchFrameReader) NextReader() (string, int64, io.Reader, error) {
+	if fr.body != nil && fr.body.N > 0 {
+		if _, err := io.Copy(io.Discard, fr.body); err != nil {
+			return "", 0, nil, fmt.Errorf("truncated batch frame data: %w", err)
+		}
+		if fr.body.N > 0 {
+			return "", 0, nil, fmt.Errorf("truncated batch frame data: %w", io.ErrUnexpectedEOF)
+		}
+	}
+	fr.body = nil
+
+	var hdr [2]byte
+	if _, err := io.ReadFull(fr.r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return "", 0, nil, fmt.Errorf("truncated batch frame header: %w", err)
+		}
+		return "", 0, nil, err
+	}
+	id := make([]byte, binary.BigEndian.Uint16(hdr[:]))
+	if _, err := io.ReadFull(fr.r, id); err != nil {
+		return "", 0, nil, fmt.Errorf("truncated batch frame ID: %w", err)
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(fr.r, size[:]); err != nil {
+		return string(id), 0, nil, fmt.Errorf("truncated batch frame length: %w", err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n == missingFrameLength {
+		return string(id), 0, nil, nil
+	}
+	if int64(n) > fr.maxSize {
+		if _, err := io.CopyN(io.Discard, fr.r, int64(n)); err != nil {
+			return string(id), 0, nil, fmt.Errorf("truncated batch frame data: %w", err)
+		}
+		return string(id), 0, nil, fmt.Errorf("%w: %d bytes", errChunkTooLarge, n)
+	}
+
+	fr.body = &io.LimitedReader{R: fr.r, N: int64(n)}
+	return string(id), int64(n), fr.body, nil
+}
+
+// putBatchItem validates and stores one chunk of a batch PUT
+func (sn *StorageNode) putBatchItem(chunkID string, data []byte, clientChecksum, storedBy string) BatchItemResult {
+	result := BatchItemResult{ChunkID: chunkID}
+	fail := func(status int, msg string) BatchItemResult {
+		result.Status = status
+		result.Error = msg
+		return result
+	}
+
+	if err := sn.validateChunkID(chunkID); err != nil {
+		result.Code = chunkIDErrorCode(err)
+		return fail(http.StatusBadRequest, err.Error())
+	}
+	if len(data) == 0 {
+		return fail(http.StatusBadRequest, "Empty chunk data")
+	}
+	if int64(len(data)) > sn.maxChunkSize {
+		return fail(http.StatusRequestEntityTooLarge, fmt.Sprintf("Chunk size exceeds maximum allowed (%d bytes)", sn.maxChunkSize))
+	}
+
+	defer sn.beginWrite(chunkID)()
+
+	existing, exists := sn.lookupChunk(chunkID)
+	if exists {
+		result.Status = http.StatusOK
+		result.Checksum = existing.Checksum
+		return result
+	}
+	sn.deleteExpired(chunkID)
+
+	advisory := sn.checksumMismatch == ChecksumMismatchStoreComputed
+	if address, err := sn.contentAddressChecksum(chunkID, clientChecksum, ChecksumSHA256); err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	} else if address != "" {
+		clientChecksum, advisory = address, false
+	}
+
+	checksum, err := computeChecksum(sn.checksumAlgo, data)
+	if err != nil {
+		log.Printf("Checksum error for chunk %s: %v", chunkID, err)
+		return fail(http.StatusInternalServerError, "Internal storage error")
+	}
+	mismatched := false
+	if clientChecksum != "" {
+		expected := checksum
+		if sn.checksumAlgo != ChecksumSHA256 {
+			expected, _ = computeChecksum(ChecksumSHA256, data)
+		}
+		if strings.ToLower(clientChecksum) != expected {
+			if !advisory {
+				return fail(http.StatusBadRequest, sn.mismatchMessage())
+			}
+			mismatched = true
+		}
+	}
+
+	pw := &pendingWrite{chunkID: chunkID, data: data, checksum: checksum, storedBy: storedBy}
+	if err := sn.storePending(pw); err != nil {
+		return fail(batchStoreError(chunkID, err))
+	}
+	if mismatched {
+		sn.noteChecksumMismatch(chunkID, clientChecksum, checksum)
+		result.ChecksumMismatch = true
+	}
+
+	atomic.AddInt64(&sn.chunkPuts, 1)
+	result.Status = http.StatusCreated
+	result.Checksum = checksum
+	return result
+}
+
+// putBatchItemStream stores one chunk of a batch PUT too large to buffer,
+// streaming size bytes from body straight to disk. A body that ends early
+// leaves the rest of the batch unreadable, so it's returned as an error
+// rather than an item result.
+func (sn *StorageNode) putBatchItemStream(chunkID string, body io.Reader, size int64, storedBy string) (BatchItemResult, error) {
+	result := BatchItemResult{ChunkID: chunkID}
+	fail := func(status int, msg string) (BatchItemResult, error) {
+		result.Status = status
+		result.Error = msg
+		return result, nil
+	}
+
+	if err := sn.validateChunkID(chunkID); err != nil {
+		result.Code = chunkIDErrorCode(err)
+		return fail(http.StatusBadRequest, err.Error())
+	}
+
+	defer sn.beginWrite(chunkID)()
+
+	existing, exists := sn.lookupChunk(chunkID)
+	if exists {
+		result.Status = http.StatusOK
+		result.Checksum = existing.Checksum
+		return result, nil
+	}
+	sn.deleteExpired(chunkID)
+
+	var expect *expectedChecksum
+	if sn.contentAddressed {
+		expect = &expectedChecksum{algo: ChecksumSHA256, value: chunkID}
+	}
+	entry, err := sn.storeStream(&pendingWrite{chunkID: chunkID, storedBy: storedBy}, body, size, expect)
+	if errors.Is(err, errShortBody) {
+		return result, err
+	}
+	if errors.Is(err, errChecksumMismatch) {
+		return fail(http.StatusBadRequest, sn.mismatchMessage())
+	}
+	if err != nil {
+		return fail(batchStoreError(chunkID, err))
+	}
+
+	atomic.AddInt64(&sn.chunkPuts, 1)
+	result.Status = http.StatusCreated
+	result.Checksum = entry.Checksum
+	return result, nil
+}
+
+// batchStoreError maps a failure to store a batch item to its status and
+// message
+func batchStoreError(chunkID string, err error) (int, string) {
+	switch {
+	case strings.Contains(err.Error(), "insufficient storage"):
+		return http.StatusInsufficientStorage, ErrInsufficientStorage
+	case isReadOnlyError(err):
+		return http.StatusServiceUnavailable, "Filesystem is read-only"
+	case errors.Is(err, errChunkTooLarge):
+		return http.StatusRequestEntityTooLarge, err.Error()
+	default:
+		log.Printf("Storage error for chunk %s: %v", chunkID, err)
+		return http.StatusInternalServerError, "Internal storage error"
+	}
+}
+
+// handleBatchPut stores many chunks in one request. The body is either
+// multipart (one part per chunk, named by the chunk ID) or, with
+// Content-Type application/x-vstack-batch, binary frames. Items are parsed
+// and stored one at a time so large batches are never buffered whole, and
+// binary frames over STREAM_THRESHOLD_MB are streamed to disk without being
+// buffered at all. Multipart parts carry no length up front, so one over the
+// threshold is rejected with 413.
+// Every item gets its own status (see batchStatus for the overall one); a
+// chunk ID repeated within the batch is rejected with 409 after the first.
+func (sn *StorageNode) handleBatchPut(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, "Invalid Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	storedBy := r.Header.Get("X-Stored-By")
+	if len(storedBy) > MaxStoredByLength {
+		http.Error(w, fmt.Sprintf("X-Stored-By exceeds %d characters", MaxStoredByLength), http.StatusBadRequest)
+		return
+	}
+
+	var results []BatchItemResult
+	// Chunks stored are replicated like single PUTs, including those stored
+	// before a body error cut the batch short
+	defer func() {
+		for _, result := range results {
+			if result.Status == http.StatusCreated {
+				sn.replicateWrite(r, result.ChunkID)
+			}
+		}
+	}()
+	seen := make(map[string]bool)
+	duplicate := func(chunkID string) bool {
+		if seen[chunkID] {
+			results = append(results, BatchItemResult{ChunkID: chunkID, Status: http.StatusConflict, Error: "Duplicate chunk ID in batch"})
+			return true
+		}
+		seen[chunkID] = true
+		return false
+	}
+	put := func(chunkID string, data []byte, clientChecksum string) {
+		if !duplicate(chunkID) {
+			results = append(results, sn.putBatchItem(chunkID, data, clientChecksum, storedBy))
+		}
+	}
+	// Items before a body error were already processed, so they're reported
+	// alongside it for the client to retry only the rest
+	abort := func(status int, msg string) {
+		writeBatchPutResponse(w, status, results, msg)
+	}
+	tooMany := func() bool {
+		if len(results) >= MaxBatchItems {
+			abort(http.StatusRequestEntityTooLarge, fmt.Sprintf("Batch exceeds %d items", MaxBatchItems))
+			return true
+		}
+		return false
+	}
+
+	switch {
+	case mediaType == BatchContentType:
+		frames := newBatchFrameReader(r.Body, sn.maxChunkSize)
+		for {
+			chunkID, size, body, err := frames.NextReader()
+			if err == io.EOF {
+				break
+			}
+			if tooMany() {
+				return
+			}
+			if errors.Is(err, errChunkTooLarge) {
+				seen[chunkID] = true
+				results = append(results, BatchItemResult{ChunkID: chunkID, Status: http.StatusRequestEntityTooLarge, Error: err.Error()})
+				continue
+			}
+			if err != nil {
+				abort(http.StatusBadRequest, fmt.Sprintf("Malformed batch: %v", err))
+				return
+			}
+
+			if body == nil || size <= sn.streamThreshold {
+				var data []byte
+				if body != nil {
+					data = make([]byte, size)
+					if _, err := io.ReadFull(body, data); err != nil {
+						abort(http.StatusBadRequest, fmt.Sprintf("Malformed batch: truncated batch frame data: %v", err))
+						return
+					}
+				}
+				put(chunkID, data, "")
+				continue
+			}
+			if duplicate(chunkID) {
+				continue
+			}
+			result, err := sn.putBatchItemStream(chunkID, body, size, storedBy)
+			if err != nil {
+				abort(http.StatusBadRequest, fmt.Sprintf("Malformed batch: %v", err))
+				return
+			}
+			results = append(results, result)
+		}
+
+	case strings.HasPrefix(mediaType, "multipart/"):
+		parts, err := r.MultipartReader()
+		if err != nil {
+			abort(http.StatusBadRequest, fmt.Sprintf("Malformed multipart body: %v", err))
+			return
+		}
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				abort(http.StatusBadRequest, fmt.Sprintf("Malformed multipart body: %v", err))
+				return
+			}
+			if tooMany() {
+				return
+			}
+
+			chunkID := part.FormName()
+			if chunkID == "" {
+				chunkID = part.Header.Get("X-Chunk-ID")
+			}
+			limit := min(sn.maxChunkSize, sn.streamThreshold)
+			data, err := io.ReadAll(io.LimitReader(part, limit+1))
+			part.Close()
+			if err != nil {
+				abort(http.StatusBadRequest, fmt.Sprintf("Failed to read part %s: %v", chunkID, err))
+				return
+			}
+			if int64(len(data)) > limit && limit < sn.maxChunkSize {
+				if !duplicate(chunkID) {
+					results = append(results, BatchItemResult{ChunkID: chunkID, Status: http.StatusRequestEntityTooLarge,
+						Error: fmt.Sprintf("Multipart chunks over %d bytes must be sent as %s frames or with PUT /chunk", limit, BatchContentType)})
+				}
+				continue
+			}
+			put(chunkID, data, part.Header.Get("X-Chunk-Checksum"))
+		}
+
+	default:
+		http.Error(w, "Batch body must be multipart or "+BatchContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	status, _ := batchStatus(results, http.StatusCreated)
+	log.Printf("Batch PUT of %d chunk(s) completed with status %d", len(results), status)
+	writeBatchPutResponse(w, status, results, "")
+}
+
+// writeBatchPutResponse reports a batch PUT's per-item results. A non-empty
+// errMsg means the batch was cut short with status.
+func writeBatchPutResponse(w http.ResponseWriter, status int, results []BatchItemResult, errMsg string) {
+	resp := BatchPutResponse{Results: results, Error: errMsg}
+	if resp.Results == nil {
+		resp.Results = []BatchItemResult{}
+	}
+	_, resp.Failed = batchStatus(results, status)
+	resp.Succeeded = len(results) - resp.Failed
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode batch response: %v", err)
+	}
+}
+
+// handleBatchGet returns many chunks in one response. The response uses
+// binary frames when the client accepts application/x-vstack-batch and
+// multipart/mixed otherwise. Chunks that don't exist are reported with a
+// missing frame (binary) or an empty part with X-Chunk-Status 404 (multipart).
+// The response status is 200 if every chunk exists, 404 if none do and 207
+// Multi-Status otherwise; a chunk that then fails to read can only be
+// reported in-band.
+func (sn *StorageNode) handleBatchGet(w http.ResponseWriter, r *http.Request) {
+	var req BatchGetRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.ChunkIDs) == 0 {
+		http.Error(w, "chunk_ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.ChunkIDs) > MaxBatchItems {
+		http.Error(w, fmt.Sprintf("Batch exceeds %d items", MaxBatchItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+	for _, chunkID := range req.ChunkIDs {
+		if err := sn.validateChunkID(chunkID); err != nil {
+			writeChunkIDError(w, err)
+			return
+		}
+	}
+
+	// Look every chunk up first so the response status can reflect them
+	entries := make([]ChunkEntry, len(req.ChunkIDs))
+	results := make([]BatchItemResult, len(req.ChunkIDs))
+	for i, chunkID := range req.ChunkIDs {
+		results[i] = BatchItemResult{ChunkID: chunkID, Status: http.StatusOK}
+		if entry, exists := sn.lookupChunk(chunkID); exists {
+			entries[i] = entry
+		} else {
+			results[i].Status = http.StatusNotFound
+		}
+	}
+	overall, _ := batchStatus(results, http.StatusOK)
+
+	binaryFraming := acceptsMediaType(r.Header.Get("Accept"), BatchContentType)
+
+	var parts *multipart.Writer
+	if binaryFraming {
+		w.Header().Set("Content-Type", BatchContentType)
+	} else {
+		parts = multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+parts.Boundary())
+	}
+	w.WriteHeader(overall)
+
+	for i, chunkID := range req.ChunkIDs {
+		entry := entries[i]
+
+		var data []byte
+		status := results[i].Status
+		if status == http.StatusOK {
+			var err error
+			if entry, data, err = sn.fetchChunk(entry); err != nil {
+				if errors.Is(err, errChunkGone) {
+					status = http.StatusNotFound
+				} else {
+					log.Printf("Failed to read chunk %s for batch: %v", chunkID, err)
+					status = http.StatusInternalServerError
+				}
+				data = nil
+			}
+		}
+
+		if data != nil {
+			atomic.AddInt64(&sn.chunkGets, 1)
+		}
+
+		// Headers are already sent; a failing item can only be reported in-band
+		var err error
+		if binaryFraming {
+			err = writeBatchFrame(w, chunkID, data)
+		} else {
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Type", entry.contentType())
+			header.Set("X-Chunk-ID", chunkID)
+			header.Set("X-Chunk-Status", strconv.Itoa(status))
+			if data != nil {
+				header.Set("ETag", entry.Checksum)
+			}
+			var part io.Writer
+			if part, err = parts.CreatePart(header); err == nil && data != nil {
+				_, err = part.Write(data)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to write batch response: %v", err)
+			return
+		}
+	}
+
+	if parts != nil {
+		if err := parts.Close(); err != nil {
+			log.Printf("Failed to finish batch response: %v", err)
+		}
+	}
+}
+
+// acceptsMediaType reports whether an Accept header lists mediaType
+func acceptsMediaType(accept, mediaType string) bool {
+	for _, candidate := range strings.Split(accept, ",") {
+		if t, _, err := mime.ParseMediaType(strings.TrimSpace(candidate)); err == nil && t == mediaType {
+			return true
+		}
+	}
+	return false
+}
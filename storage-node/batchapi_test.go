@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func newBatchTestRouter(sn *StorageNode) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/chunks/batch", sn.handleBatchPut).Methods("POST")
+	r.HandleFunc("/chunks/batch/get", sn.handleBatchGet).Methods("POST")
+	return r
+}
+
+func batchGetBody(t *testing.T, chunkIDs ...string) io.Reader {
+	body, err := json.Marshal(BatchGetRequest{ChunkIDs: chunkIDs})
+	if err != nil {
+		t.Fatalf("Failed to encode batch get request: %v", err)
+	}
+	return bytes.NewReader(body)
+}
+
+func TestBinaryBatchRoundTrip(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	r := newBatchTestRouter(sn)
+
+	chunks := map[string][]byte{
+		"bin-a": []byte("first binary framed chunk"),
+		"bin-b": bytes.Repeat([]byte{0x00, 0xff, '\r', '\n', '-'}, 2000),
+		"bin-c": {0x01},
+	}
+	order := []string{"bin-a", "bin-b", "bin-c"}
+
+	var body bytes.Buffer
+	for _, chunkID := range order {
+		if err := writeBatchFrame(&body, chunkID, chunks[chunkID]); err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/chunks/batch", &body)
+	req.Header.Set("Content-Type", BatchContentType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var putResp BatchPutResponse
+	if err := json.NewDecoder(w.Body).Decode(&putResp); err != nil {
+		t.Fatalf("Failed to decode batch response: %v", err)
+	}
+	if len(putResp.Results) != len(order) {
+		t.Fatalf("Expected %d results, got %d", len(order), len(putResp.Results))
+	}
+	for i, result := range putResp.Results {
+		if result.ChunkID != order[i] || result.Status != http.StatusCreated {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	}
+
+	getReq := httptest.NewRequest("POST", "/chunks/batch/get", batchGetBody(t, "bin-c", "missing", "bin-a", "bin-b"))
+	getReq.Header.Set("Accept", BatchContentType)
+	getW := httptest.NewRecorder()
+	r.ServeHTTP(getW, getReq)
+
+	if getW.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status %d with one chunk missing, got %d", http.StatusMultiStatus, getW.Code)
+	}
+	if ct := getW.Header().Get("Content-Type"); ct != BatchContentType {
+		t.Errorf("Expected Content-Type %s, got %s", BatchContentType, ct)
+	}
+
+	frames := newBatchFrameReader(getW.Body, sn.maxChunkSize)
+	for _, want := range []string{"bin-c", "missing", "bin-a", "bin-b"} {
+		chunkID, data, err := frames.Next()
+		if err != nil {
+			t.Fatalf("Failed to decode frame: %v", err)
+		}
+		if chunkID != want {
+			t.Fatalf("Expected frame for %s, got %s", want, chunkID)
+		}
+		if want == "missing" {
+			if data != nil {
+				t.Errorf("Expected missing frame for %s", chunkID)
+			}
+			continue
+		}
+		if !bytes.Equal(data, chunks[want]) {
+			t.Errorf("Data mismatch for %s", chunkID)
+		}
+	}
+	if _, _, err := frames.Next(); err != io.EOF {
+		t.Errorf("Expected EOF after last frame, got %v", err)
+	}
+}
+
+func TestBinaryBatchRejectsBadFrames(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.maxChunkSize = 1024
+	r := newBatchTestRouter(sn)
+
+	t.Run("oversized_frame_skipped", func(t *testing.T) {
+		var body bytes.Buffer
+		writeBatchFrame(&body, "frame-big", bytes.Repeat([]byte("x"), 2048))
+		writeBatchFrame(&body, "frame-ok", []byte("small"))
+
+		req := httptest.NewRequest("POST", "/chunks/batch", &body)
+		req.Header.Set("Content-Type", BatchContentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var resp BatchPutResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode batch response: %v", err)
+		}
+		if len(resp.Results) != 2 || resp.Results[0].Status != http.StatusRequestEntityTooLarge ||
+			resp.Results[1].Status != http.StatusCreated {
+			t.Errorf("Unexpected results %+v", resp.Results)
+		}
+	})
+
+	t.Run("truncated_frame_rejected", func(t *testing.T) {
+		var body bytes.Buffer
+		writeBatchFrame(&body, "frame-cut", []byte("this frame gets cut short"))
+		truncated := body.Bytes()[:body.Len()-5]
+
+		req := httptest.NewRequest("POST", "/chunks/batch", bytes.NewReader(truncated))
+		req.Header.Set("Content-Type", BatchContentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestMultipartBatchRoundTrip(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	r := newBatchTestRouter(sn)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i := 0; i < 3; i++ {
+		part, err := mw.CreateFormFile(fmt.Sprintf("mp-%d", i), "chunk")
+		if err != nil {
+			t.Fatalf("Failed to create part: %v", err)
+		}
+		fmt.Fprintf(part, "multipart chunk %d", i)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/chunks/batch", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	getReq := httptest.NewRequest("POST", "/chunks/batch/get", batchGetBody(t, "mp-0", "mp-2", "mp-9"))
+	getW := httptest.NewRecorder()
+	r.ServeHTTP(getW, getReq)
+
+	mediaType, params, err := mime.ParseMediaType(getW.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Expected multipart/mixed response, got %q", getW.Header().Get("Content-Type"))
+	}
+
+	mr := multipart.NewReader(getW.Body, params["boundary"])
+	for _, want := range []string{"mp-0", "mp-2", "mp-9"} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("Failed to read part: %v", err)
+		}
+		data, _ := io.ReadAll(part)
+		if got := part.Header.Get("X-Chunk-ID"); got != want {
+			t.Fatalf("Expected part for %s, got %s", want, got)
+		}
+		if want == "mp-9" {
+			if part.Header.Get("X-Chunk-Status") != "404" {
+				t.Errorf("Expected 404 status for missing chunk, got %s", part.Header.Get("X-Chunk-Status"))
+			}
+			continue
+		}
+		if expected := "multipart chunk " + strings.TrimPrefix(want, "mp-"); string(data) != expected {
+			t.Errorf("Expected %q, got %q", expected, data)
+		}
+	}
+}
+
+func TestBatchPartialFailureStatuses(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.maxChunkSize = 1024
+	r := newBatchTestRouter(sn)
+
+	put := func(frames func(body *bytes.Buffer)) (int, BatchPutResponse) {
+		var body bytes.Buffer
+		frames(&body)
+		req := httptest.NewRequest("POST", "/chunks/batch", &body)
+		req.Header.Set("Content-Type", BatchContentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp BatchPutResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode batch response: %v", err)
+		}
+		return w.Code, resp
+	}
+
+	code, resp := put(func(body *bytes.Buffer) {
+		writeBatchFrame(body, "mixed-ok", []byte("valid chunk"))
+		writeBatchFrame(body, "mixed-big", bytes.Repeat([]byte("x"), 2048))
+		writeBatchFrame(body, "mixed-ok", []byte("valid chunk"))
+		writeBatchFrame(body, "mixed-ok-2", []byte("another valid chunk"))
+	})
+	if code != http.StatusMultiStatus {
+		t.Errorf("Expected %d for a partly failed batch, got %d", http.StatusMultiStatus, code)
+	}
+	want := []BatchItemResult{
+		{ChunkID: "mixed-ok", Status: http.StatusCreated},
+		{ChunkID: "mixed-big", Status: http.StatusRequestEntityTooLarge},
+		{ChunkID: "mixed-ok", Status: http.StatusConflict},
+		{ChunkID: "mixed-ok-2", Status: http.StatusCreated},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("Expected %d results, got %+v", len(want), resp.Results)
+	}
+	for i, result := range resp.Results {
+		if result.ChunkID != want[i].ChunkID || result.Status != want[i].Status {
+			t.Errorf("Item %d: expected %s %d, got %s %d", i, want[i].ChunkID, want[i].Status, result.ChunkID, result.Status)
+		}
+		if (result.Status >= 400) != (result.Error != "") {
+			t.Errorf("Item %d: expected a message exactly for failures, got %q", i, result.Error)
+		}
+	}
+	if resp.Succeeded != 2 || resp.Failed != 2 {
+		t.Errorf("Expected 2 succeeded and 2 failed, got %d and %d", resp.Succeeded, resp.Failed)
+	}
+
+	// Retrying the same batch succeeds for everything already stored
+	code, resp = put(func(body *bytes.Buffer) {
+		writeBatchFrame(body, "mixed-ok", []byte("valid chunk"))
+		writeBatchFrame(body, "mixed-ok-2", []byte("another valid chunk"))
+	})
+	if code != http.StatusCreated || resp.Failed != 0 || resp.Results[0].Status != http.StatusOK {
+		t.Errorf("Expected a retry of stored chunks to succeed, got %d %+v", code, resp.Results)
+	}
+
+	// All failing is distinct from some failing
+	code, resp = put(func(body *bytes.Buffer) {
+		writeBatchFrame(body, "all-big-1", bytes.Repeat([]byte("x"), 2048))
+		writeBatchFrame(body, "all-big-2", bytes.Repeat([]byte("x"), 2048))
+	})
+	if code != http.StatusRequestEntityTooLarge || resp.Succeeded != 0 || resp.Failed != 2 {
+		t.Errorf("Expected %d with every item failed, got %d (%+v)", http.StatusRequestEntityTooLarge, code, resp)
+	}
+}
+
+func TestBatchStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int
+	}{
+		{"empty", nil, http.StatusCreated},
+		{"all_succeeded", []int{201, 200}, http.StatusCreated},
+		{"some_failed", []int{201, 404}, http.StatusMultiStatus},
+		{"all_failed_alike", []int{413, 413}, http.StatusRequestEntityTooLarge},
+		{"all_failed_client", []int{400, 409}, http.StatusBadRequest},
+		{"all_failed_server", []int{409, 507}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []BatchItemResult
+			for _, status := range tt.statuses {
+				results = append(results, BatchItemResult{Status: status})
+			}
+			if got, _ := batchStatus(results, http.StatusCreated); got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
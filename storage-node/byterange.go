@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// MaxRangesPerRequest caps the parts of a multipart/byteranges response, so
+// a request for thousands of tiny ranges can't multiply per-part overhead
+const MaxRangesPerRequest = 16
+
+var (
+	errRangeUnsatisfiable = errors.New("range not satisfiable")
+	errTooManyRanges      = errors.New("too many ranges")
+)
+
+// byteRange is a validated range within a chunk
+type byteRange struct {
+	start, length int64
+}
+
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size)
+}
+
+// parseRange parses a Range header against a chunk of size bytes. Ends past
+// the chunk are clamped to it and ranges starting past it are dropped. A nil
+// result with no error means the header should be ignored and the whole
+// chunk served: it is malformed, or its ranges add up to more than the chunk
+// (overlaps), which would otherwise let a client amplify one read into an
+// arbitrarily large response.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	var total int64
+	parts := strings.Split(spec, ",")
+	if len(parts) > MaxRangesPerRequest {
+		return nil, fmt.Errorf("%w: %d requested, at most %d allowed", errTooManyRanges, len(parts), MaxRangesPerRequest)
+	}
+	for _, part := range parts {
+		first, last, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, nil
+		}
+
+		var br byteRange
+		if first == "" {
+			// Suffix range: the last n bytes
+			n, err := parseRangeBound(last)
+			if err != nil {
+				return nil, nil
+			}
+			if n == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			br = byteRange{start: size - n, length: n}
+		} else {
+			start, err := parseRangeBound(first)
+			if err != nil {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				if end, err = parseRangeBound(last); err != nil || end < start {
+					return nil, nil
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			if start >= size {
+				continue
+			}
+			br = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, br)
+		total += br.length
+	}
+
+	if len(ranges) == 0 {
+		return nil, errRangeUnsatisfiable
+	}
+	if total > size {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// parseRangeBound parses a range position. Values too large for an int64
+// saturate rather than fail, since they are clamped to the chunk anyway.
+func parseRangeBound(s string) (int64, error) {
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, errors.New("invalid range bound")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return math.MaxInt64, nil
+	}
+	return n, err
+}
+
+// writeRanges serves the requested ranges of a chunk of the given size as a
+// 206 response, as a single part or multipart/byteranges. parts holds the
+// bytes of each range.
+func writeRanges(w http.ResponseWriter, ranges []byteRange, parts [][]byte, size int64, contentType string) error {
+	if len(ranges) == 1 {
+		br := ranges[0]
+		w.Header().Set("Content-Range", br.contentRange(size))
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(br.length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		_, err := w.Write(parts[0])
+		return err
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+	for i, br := range ranges {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {br.contentRange(size)},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(parts[i]); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// fetchRanges returns the bytes of each range of a chunk, sliced from the
+// read cache or else read from just those offsets of the superblock.
+//
+// Ranges read from disk are not checksum-verified: the checksum covers the
+// whole chunk, and reading all of it to serve a few bytes would defeat the
+// purpose of a range request. Clients that need verified bytes fetch the
+// whole chunk. As with unverified full reads, the bytes are only returned
+// if the index still points where they were read from.
+func (sn *StorageNode) fetchRanges(entry ChunkEntry, ranges []byteRange) (ChunkEntry, [][]byte, error) {
+	parts := make([][]byte, len(ranges))
+
+	// Chunks compressed or encrypted at rest can only be decoded whole
+	if entry.encoded() {
+		entry, data, err := sn.fetchChunk(entry)
+		if err != nil {
+			return entry, nil, err
+		}
+		for i, br := range ranges {
+			parts[i] = data[br.start : br.start+br.length]
+		}
+		return entry, parts, nil
+	}
+
+	if data, ok := sn.readCache.Get(entry.ChunkID, entry.Checksum); ok {
+		for i, br := range ranges {
+			parts[i] = data[br.start : br.start+br.length]
+		}
+		return entry, parts, nil
+	}
+
+	for attempt := 0; attempt < MaxChunkReadAttempts; attempt++ {
+		err := sn.readChunkRanges(entry, ranges, parts)
+
+		sn.index.mu.RLock()
+		current, exists := sn.index.chunks[entry.ChunkID]
+		sn.index.mu.RUnlock()
+		if !exists {
+			return entry, nil, errChunkGone
+		}
+		if current.SuperblockID == entry.SuperblockID && current.Offset == entry.Offset && current.Checksum == entry.Checksum {
+			return entry, parts, err
+		}
+		entry = current // Moved while being read; retry at its new location
+	}
+	return entry, nil, fmt.Errorf("chunk %s moved %d times while being read", entry.ChunkID, MaxChunkReadAttempts)
+}
+
+// readChunkRanges reads ranges of a chunk into parts, seeking to each
+// range's offset within the superblock
+func (sn *StorageNode) readChunkRanges(entry ChunkEntry, ranges []byteRange, parts [][]byte) error {
+	handle, err := sn.handles.acquire(entry.SuperblockID, sn.getSuperblockPath(entry.SuperblockID))
+	if err != nil {
+		return fmt.Errorf("failed to open superblock: %w", err)
+	}
+	defer sn.handles.release(handle)
+	file := handle.file
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat superblock: %w", err)
+	}
+	if entry.Offset+int64(entry.Size) > info.Size() {
+		return fmt.Errorf("%w: chunk ends at %d, superblock %d is %d bytes",
+			errChunkTruncated, entry.Offset+int64(entry.Size), entry.SuperblockID, info.Size())
+	}
+
+	for i, br := range ranges {
+		parts[i] = make([]byte, br.length)
+		if _, err := file.ReadAt(parts[i], entry.Offset+br.start); err != nil {
+			return fmt.Errorf("failed to read chunk range: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []byteRange
+		err    error
+	}{
+		{"bytes=0-9", []byteRange{{0, 10}}, nil},
+		{"bytes=90-", []byteRange{{90, 10}}, nil},
+		{"bytes=-5", []byteRange{{95, 5}}, nil},
+		{"bytes=-500", []byteRange{{0, 100}}, nil},
+		{"bytes=50-5000", []byteRange{{50, 50}}, nil},
+		{"bytes=90-99999999999999999999999", []byteRange{{90, 10}}, nil},
+		{"bytes=0-1,10-11", []byteRange{{0, 2}, {10, 2}}, nil},
+		{"bytes=0-1,500-600", []byteRange{{0, 2}}, nil},
+		{"bytes=100-200", nil, errRangeUnsatisfiable},
+		{"bytes=-0", nil, errRangeUnsatisfiable},
+		{"bytes=" + strings.Repeat("0-0,", MaxRangesPerRequest) + "0-0", nil, errTooManyRanges},
+		{"bytes=0-99,0-99", nil, nil}, // overlaps exceed the chunk
+		{"bytes=9-0", nil, nil},
+		{"bytes=abc", nil, nil},
+		{"bytes=+1-2", nil, nil},
+		{"items=0-1", nil, nil},
+	}
+	for _, tc := range tests {
+		got, err := parseRange(tc.header, 100)
+		if tc.err != nil {
+			if err == nil || !strings.Contains(err.Error(), tc.err.Error()) {
+				t.Errorf("%s: expected error %v, got %v", tc.header, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: expected %v, got %v (%v)", tc.header, tc.want, got, err)
+		}
+	}
+}
+
+func TestRangeRequests(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte('a' + i%26)
+	}
+	if err := sn.storeChunk("ranged", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+
+	get := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/chunk/ranged", nil)
+		req.Header.Set("Range", rangeHeader)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("out_of_bounds", func(t *testing.T) {
+		rr := get("bytes=200-300")
+		if rr.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Fatalf("Expected 416, got %d", rr.Code)
+		}
+		if got := rr.Header().Get("Content-Range"); got != "bytes */100" {
+			t.Errorf("Expected Content-Range bytes */100, got %q", got)
+		}
+	})
+
+	t.Run("too_many_ranges", func(t *testing.T) {
+		var parts []string
+		for i := 0; i <= MaxRangesPerRequest; i++ {
+			parts = append(parts, fmt.Sprintf("%d-%d", i, i))
+		}
+		if rr := get("bytes=" + strings.Join(parts, ",")); rr.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Errorf("Expected 416 above %d ranges, got %d", MaxRangesPerRequest, rr.Code)
+		}
+	})
+
+	t.Run("overlapping_ranges_serve_whole_chunk", func(t *testing.T) {
+		rr := get("bytes=0-99,0-99,0-99")
+		if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), data) {
+			t.Errorf("Expected the whole chunk once, got %d with %d bytes", rr.Code, rr.Body.Len())
+		}
+	})
+
+	t.Run("clamped_range", func(t *testing.T) {
+		rr := get("bytes=90-18446744073709551615")
+		if rr.Code != http.StatusPartialContent {
+			t.Fatalf("Expected 206, got %d", rr.Code)
+		}
+		if got := rr.Header().Get("Content-Range"); got != "bytes 90-99/100" {
+			t.Errorf("Expected Content-Range bytes 90-99/100, got %q", got)
+		}
+		if !bytes.Equal(rr.Body.Bytes(), data[90:]) {
+			t.Errorf("Expected the last 10 bytes, got %q", rr.Body.Bytes())
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		rr := get("bytes=0-4,50-54")
+		if rr.Code != http.StatusPartialContent {
+			t.Fatalf("Expected 206, got %d", rr.Code)
+		}
+		mediaType, params, err := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+		if err != nil || mediaType != "multipart/byteranges" {
+			t.Fatalf("Expected multipart/byteranges, got %q", rr.Header().Get("Content-Type"))
+		}
+		mr := multipart.NewReader(rr.Body, params["boundary"])
+		for _, want := range []struct {
+			contentRange string
+			body         []byte
+		}{{"bytes 0-4/100", data[0:5]}, {"bytes 50-54/100", data[50:55]}} {
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Fatalf("Failed to read part: %v", err)
+			}
+			body, _ := io.ReadAll(part)
+			if part.Header.Get("Content-Range") != want.contentRange || !bytes.Equal(body, want.body) {
+				t.Errorf("Expected part %s %q, got %s %q", want.contentRange, want.body, part.Header.Get("Content-Range"), body)
+			}
+		}
+	})
+	// Runs last: it corrupts the chunk outside the requested range
+	t.Run("reads_only_requested_bytes", func(t *testing.T) {
+		entry, _ := sn.lookupChunk("ranged")
+		file, err := os.OpenFile(sn.getSuperblockPath(entry.SuperblockID), os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Failed to open superblock: %v", err)
+		}
+		if _, err := file.WriteAt([]byte("XXXXXXXXXX"), entry.Offset); err != nil {
+			t.Fatalf("Failed to corrupt chunk: %v", err)
+		}
+		file.Close()
+		sn.readCache.Remove("ranged")
+
+		rr := get("bytes=50-59")
+		if rr.Code != http.StatusPartialContent {
+			t.Fatalf("Expected 206, got %d", rr.Code)
+		}
+		if got := rr.Header().Get("Content-Range"); got != "bytes 50-59/100" {
+			t.Errorf("Expected Content-Range bytes 50-59/100, got %q", got)
+		}
+		if !bytes.Equal(rr.Body.Bytes(), data[50:60]) {
+			t.Errorf("Expected bytes 50-59, got %q", rr.Body.Bytes())
+		}
+	})
+}
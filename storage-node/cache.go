@@ -0,0 +1,186 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// readCache is a byte-bounded LRU cache of checksum-verified chunk payloads.
+// A cache with maxBytes <= 0 is disabled and never stores anything.
+type readCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+
+	hits   int64 // atomic
+	misses int64 // atomic
+}
+
+type readCacheItem struct {
+	chunkID  string
+	checksum string
+	data     []byte
+}
+
+// CacheStats represents the read cache statistics response
+type CacheStats struct {
+	Enabled  bool    `json:"enabled"`
+	Entries  int     `json:"entries"`
+	Bytes    int64   `json:"bytes"`
+	MaxBytes int64   `json:"max_bytes"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// CacheFlushResponse represents the result of flushing the read cache
+type CacheFlushResponse struct {
+	EntriesFreed int   `json:"entries_freed"`
+	BytesFreed   int64 `json:"bytes_freed"`
+}
+
+func newReadCache(maxBytes int64) *readCache {
+	return &readCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *readCache) enabled() bool {
+	return c.maxBytes > 0
+}
+
+// Get returns the cached payload for chunkID if present and still matching
+// the checksum currently recorded in the index.
+func (c *readCache) Get(chunkID, checksum string) ([]byte, bool) {
+	if !c.enabled() {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[chunkID]
+	if !ok {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+
+	item := elem.Value.(*readCacheItem)
+	if item.checksum != checksum {
+		// Stale entry (chunk was replaced), drop it
+		c.removeElement(elem)
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(elem)
+	atomic.AddInt64(&c.hits, 1)
+	return item.data, true
+}
+
+// Add inserts a verified payload, evicting least recently used entries as needed.
+func (c *readCache) Add(chunkID, checksum string, data []byte) {
+	if !c.enabled() || int64(len(data)) > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[chunkID]; ok {
+		c.removeElement(elem)
+	}
+
+	elem := c.ll.PushFront(&readCacheItem{chunkID: chunkID, checksum: checksum, data: data})
+	c.items[chunkID] = elem
+	c.curBytes += int64(len(data))
+
+	for c.curBytes > c.maxBytes {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.removeElement(oldest)
+	}
+}
+
+// Remove drops a single chunk from the cache
+func (c *readCache) Remove(chunkID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[chunkID]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// Flush clears the cache and returns the number of entries and bytes freed
+func (c *readCache) Flush() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, freed := len(c.items), c.curBytes
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.curBytes = 0
+	return entries, freed
+}
+
+func (c *readCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries, size := len(c.items), c.curBytes
+	c.mu.Unlock()
+
+	hits := atomic.LoadInt64(&c.hits)
+	misses := atomic.LoadInt64(&c.misses)
+	ratio := 0.0
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses)
+	}
+
+	return CacheStats{
+		Enabled:  c.enabled(),
+		Entries:  entries,
+		Bytes:    size,
+		MaxBytes: c.maxBytes,
+		Hits:     hits,
+		Misses:   misses,
+		HitRatio: ratio,
+	}
+}
+
+// removeElement must be called with c.mu held
+func (c *readCache) removeElement(elem *list.Element) {
+	item := elem.Value.(*readCacheItem)
+	c.ll.Remove(elem)
+	delete(c.items, item.chunkID)
+	c.curBytes -= int64(len(item.data))
+}
+
+func (sn *StorageNode) handleCacheFlush(w http.ResponseWriter, r *http.Request) {
+	entries, freed := sn.readCache.Flush()
+	log.Printf("Read cache flushed: %d entries, %d bytes freed", entries, freed)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(CacheFlushResponse{EntriesFreed: entries, BytesFreed: freed}); err != nil {
+		log.Printf("Failed to encode cache flush response: %v", err)
+	}
+}
+
+func (sn *StorageNode) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(sn.readCache.Stats()); err != nil {
+		log.Printf("Failed to encode cache stats response: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestReadCacheLRUEviction(t *testing.T) {
+	c := newReadCache(10)
+
+	c.Add("a", "sum-a", []byte("aaaa"))
+	c.Add("b", "sum-b", []byte("bbbb"))
+
+	// Touch "a" so "b" becomes least recently used
+	if _, ok := c.Get("a", "sum-a"); !ok {
+		t.Fatal("Expected cache hit for a")
+	}
+
+	c.Add("c", "sum-c", []byte("cccc"))
+
+	if _, ok := c.Get("b", "sum-b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	if _, ok := c.Get("a", "sum-a"); !ok {
+		t.Error("Expected a to remain cached")
+	}
+	if _, ok := c.Get("a", "other-sum"); ok {
+		t.Error("Expected stale checksum to miss")
+	}
+
+	stats := c.Stats()
+	if stats.Bytes > 10 {
+		t.Errorf("Cache exceeded max bytes: %d", stats.Bytes)
+	}
+}
+
+func TestCacheFlushEndpoint(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.readCache = newReadCache(1024 * 1024)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+	r.HandleFunc("/admin/cache/flush", sn.handleCacheFlush).Methods("POST")
+	r.HandleFunc("/admin/cache/stats", sn.handleCacheStats).Methods("GET")
+
+	testData := []byte("cached chunk data")
+	chunkIDs := []string{"cache-001", "cache-002"}
+
+	for _, chunkID := range chunkIDs {
+		putReq := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader(testData))
+		putW := httptest.NewRecorder()
+		r.ServeHTTP(putW, putReq)
+		if putW.Code != http.StatusCreated {
+			t.Fatalf("Failed to store chunk %s: %d", chunkID, putW.Code)
+		}
+
+		// First GET populates the cache, second one hits it
+		for i := 0; i < 2; i++ {
+			getReq := httptest.NewRequest("GET", "/chunk/"+chunkID, nil)
+			getW := httptest.NewRecorder()
+			r.ServeHTTP(getW, getReq)
+			if getW.Code != http.StatusOK || !bytes.Equal(getW.Body.Bytes(), testData) {
+				t.Fatalf("Unexpected GET result for %s: %d", chunkID, getW.Code)
+			}
+		}
+	}
+
+	stats := sn.readCache.Stats()
+	if stats.Entries != 2 || stats.Hits != 2 || stats.Misses != 2 {
+		t.Fatalf("Unexpected stats before flush: %+v", stats)
+	}
+
+	flushReq := httptest.NewRequest("POST", "/admin/cache/flush", nil)
+	flushW := httptest.NewRecorder()
+	r.ServeHTTP(flushW, flushReq)
+
+	if flushW.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, flushW.Code)
+	}
+
+	var flushed CacheFlushResponse
+	if err := json.NewDecoder(flushW.Body).Decode(&flushed); err != nil {
+		t.Fatalf("Failed to decode flush response: %v", err)
+	}
+	if flushed.EntriesFreed != 2 || flushed.BytesFreed != int64(2*len(testData)) {
+		t.Errorf("Unexpected flush result: %+v", flushed)
+	}
+
+	// Next read must be a miss
+	getReq := httptest.NewRequest("GET", "/chunk/"+chunkIDs[0], nil)
+	getW := httptest.NewRecorder()
+	r.ServeHTTP(getW, getReq)
+	if getW.Code != http.StatusOK {
+		t.Fatalf("Failed to read chunk after flush: %d", getW.Code)
+	}
+
+	statsReq := httptest.NewRequest("GET", "/admin/cache/stats", nil)
+	statsW := httptest.NewRecorder()
+	r.ServeHTTP(statsW, statsReq)
+
+	var after CacheStats
+	if err := json.NewDecoder(statsW.Body).Decode(&after); err != nil {
+		t.Fatalf("Failed to decode stats response: %v", err)
+	}
+	if after.Misses != 3 || after.Hits != 2 {
+		t.Errorf("Expected read after flush to be a miss, got stats %+v", after)
+	}
+	if after.Entries != 1 {
+		t.Errorf("Expected 1 entry after re-population, got %d", after.Entries)
+	}
+}
+
+func TestCacheFlushConcurrentReads(t *testing.T) {
+	c := newReadCache(1024)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				id := fmt.Sprintf("chunk-%d", j%16)
+				if _, ok := c.Get(id, "sum"); !ok {
+					c.Add(id, "sum", []byte("payload"))
+				}
+				if n == 0 && j%50 == 0 {
+					c.Flush()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Bytes != int64(stats.Entries*len("payload")) {
+		t.Errorf("Inconsistent cache accounting: %+v", stats)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestChunkCacheHeaders(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.chunkCacheMaxAge = 86400
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleHeadChunk).Methods("HEAD")
+
+	put := func(chunkID, ttl string) int {
+		req := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader([]byte("cacheable "+chunkID)))
+		if ttl != "" {
+			req.Header.Set("X-Chunk-TTL", ttl)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	do := func(method, chunkID string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/chunk/"+chunkID, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if code := put("forever", ""); code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, code)
+	}
+	if code := put("short-lived", "3600"); code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, code)
+	}
+
+	for _, method := range []string{"GET", "HEAD"} {
+		if got := do(method, "forever", nil).Header().Get("Cache-Control"); got != "public, max-age=86400, immutable" {
+			t.Errorf("%s: expected immutable caching for chunk without TTL, got %q", method, got)
+		}
+		if got := do(method, "short-lived", nil).Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("%s: expected no-store for chunk with TTL, got %q", method, got)
+		}
+	}
+
+	// Pinning a chunk with a TTL makes it cacheable again
+	if code := put("pinned", "3600"); code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, code)
+	}
+	sn.index.mu.Lock()
+	pinned := sn.index.chunks["pinned"]
+	pinned.Pinned = true
+	sn.index.set(pinned)
+	sn.index.mu.Unlock()
+	for _, method := range []string{"GET", "HEAD"} {
+		if got := do(method, "pinned", nil).Header().Get("Cache-Control"); got != "public, max-age=86400, immutable" {
+			t.Errorf("%s: expected immutable caching for pinned chunk with TTL, got %q", method, got)
+		}
+	}
+
+	t.Run("conditional_get", func(t *testing.T) {
+		etag := do("GET", "forever", nil).Header().Get("ETag")
+		w := do("GET", "forever", http.Header{"If-None-Match": {`"` + etag + `"`}})
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("Expected empty %d, got %d with %d bytes", http.StatusNotModified, w.Code, w.Body.Len())
+		}
+
+		w = do("GET", "forever", http.Header{"If-None-Match": {"stale-etag"}})
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status %d for a stale ETag, got %d", http.StatusOK, w.Code)
+		}
+	})
+
+	t.Run("invalid_ttl_rejected", func(t *testing.T) {
+		if code := put("bad-ttl", "soon"); code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+		}
+	})
+
+	t.Run("expired_chunk_not_served", func(t *testing.T) {
+		sn.index.mu.Lock()
+		entry := sn.index.chunks["short-lived"]
+		past := time.Now().Add(-time.Second)
+		entry.ExpiresAt = &past
+		sn.index.chunks["short-lived"] = entry
+		sn.index.mu.Unlock()
+
+		if w := do("GET", "short-lived", nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d for expired chunk, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxCheckpointAge bounds how long index mutations may stay
+// unpersisted on an idle node (see MAX_CHECKPOINT_AGE)
+const DefaultMaxCheckpointAge = 5 * time.Minute
+
+// DefaultIndexSaveDelay is how long index persistence after a write is
+// deferred so a burst of writes shares one index write (see
+// INDEX_SAVE_DELAY). A crash loses the index entries of chunks written in
+// the last window; their data stays in the superblocks until compacted. The
+// default saves the index before every write is acknowledged, which
+// FSYNC_POLICY=always promises; a delay is opt-in.
+const DefaultIndexSaveDelay = 0
+
+// uncheckpointed reports whether the index has mutations not yet persisted
+func (sn *StorageNode) uncheckpointed() bool {
+	sn.index.mu.RLock()
+	gen := sn.index.gen
+	sn.index.mu.RUnlock()
+	return gen != atomic.LoadUint64(&sn.checkpointGen)
+}
+
+// checkpointAge returns how long ago the index was last persisted
+func (sn *StorageNode) checkpointAge() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&sn.lastCheckpoint)))
+}
+
+// checkpointIfStale persists the index when it has mutations and the last
+// save is older than MAX_CHECKPOINT_AGE. Index saves normally ride on writes
+// and are best effort, so without this a save that failed just before the
+// node went idle would not be retried until the next write or shutdown.
+func (sn *StorageNode) checkpointIfStale(ctx context.Context) {
+	if !sn.uncheckpointed() || sn.checkpointAge() < sn.maxCheckpointAge {
+		return
+	}
+	age := sn.checkpointAge()
+	if err := sn.saveIndex(); err != nil {
+		log.Printf("Warning: forced index checkpoint failed (last checkpoint %v ago): %v", age.Round(time.Second), err)
+		return
+	}
+	log.Printf("Forced index checkpoint after %v without one", age.Round(time.Second))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdleIndexIsCheckpointed(t *testing.T) {
+	t.Setenv("MAX_CHECKPOINT_AGE", "100ms")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	defer sn.Shutdown()
+
+	// Mutations whose index save never happened, e.g. because it failed
+	sn.index.mu.Lock()
+	for _, chunkID := range []string{"idle-a", "idle-b", "idle-c"} {
+		sn.index.set(ChunkEntry{ChunkID: chunkID, Size: 1, Checksum: chunkID, StoredAt: time.Now()})
+	}
+	sn.index.mu.Unlock()
+	if !sn.uncheckpointed() {
+		t.Fatal("Expected index to have un-checkpointed mutations")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sn.uncheckpointed() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a forced checkpoint after MAX_CHECKPOINT_AGE")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	data, err := os.ReadFile(sn.indexFile)
+	if err != nil {
+		t.Fatalf("Failed to read index file: %v", err)
+	}
+	var chunks map[string]ChunkEntry
+	if err := json.Unmarshal(data, &chunks); err != nil {
+		t.Fatalf("Failed to decode index file: %v", err)
+	}
+	if len(chunks) != 3 {
+		t.Errorf("Expected 3 chunks in the checkpoint, got %d", len(chunks))
+	}
+
+	// An idle node with nothing new to persist doesn't rewrite the index
+	last := atomic.LoadInt64(&sn.lastCheckpoint)
+	time.Sleep(300 * time.Millisecond)
+	if atomic.LoadInt64(&sn.lastCheckpoint) != last {
+		t.Error("Expected no checkpoint without new mutations")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"math/rand"
+	"strings"
+)
+
+// Supported checksum algorithms
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumCRC32C = "crc32c"
+
+	DefaultChecksumAlgorithm = ChecksumSHA256
+)
+
+// Policies for a client-supplied checksum that doesn't match the data it
+// came with (see CHECKSUM_MISMATCH_POLICY)
+const (
+	ChecksumMismatchReject        = "reject"         // fail the write, storing nothing
+	ChecksumMismatchStoreComputed = "store-computed" // treat the client's checksum as advisory
+
+	DefaultChecksumMismatchPolicy = ChecksumMismatchReject
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// parseChecksumAlgorithm normalizes and validates a checksum algorithm name
+func parseChecksumAlgorithm(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "sha256", "sha-256":
+		return ChecksumSHA256, nil
+	case "crc32c":
+		return ChecksumCRC32C, nil
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm %q", name)
+	}
+}
+
+func parseChecksumMismatchPolicy(name string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(name)); policy {
+	case ChecksumMismatchReject, ChecksumMismatchStoreComputed:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown checksum mismatch policy %q (want %s or %s)", name, ChecksumMismatchReject, ChecksumMismatchStoreComputed)
+	}
+}
+
+// computeChecksum returns the hex-encoded checksum of data
+func computeChecksum(algo string, data []byte) (string, error) {
+	switch algo {
+	case ChecksumSHA256:
+		hash := sha256.Sum256(data)
+		return hex.EncodeToString(hash[:]), nil
+	case ChecksumCRC32C:
+		var sum [4]byte
+		binary.BigEndian.PutUint32(sum[:], crc32.Checksum(data, crc32cTable))
+		return hex.EncodeToString(sum[:]), nil
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+}
+
+// newChecksumHash returns a hash computing algo incrementally; its hex-encoded
+// Sum matches computeChecksum
+func newChecksumHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumCRC32C:
+		return crc32.New(crc32cTable), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+}
+
+// checksumAlgorithm returns the algorithm an entry's checksum was computed
+// with. Entries written before algorithms were recorded are SHA-256.
+func (e ChunkEntry) checksumAlgorithm() string {
+	if e.ChecksumAlgo == "" {
+		return ChecksumSHA256
+	}
+	return e.ChecksumAlgo
+}
+
+// sampleVerification decides whether the current read verifies its checksum
+func (sn *StorageNode) sampleVerification() bool {
+	switch {
+	case sn.verifySampleRate >= 1:
+		return true
+	case sn.verifySampleRate <= 0:
+		return false
+	default:
+		return rand.Float64() < sn.verifySampleRate
+	}
+}
+
+// shortChecksum abbreviates a checksum for log messages
+func shortChecksum(checksum string) string {
+	if len(checksum) <= 16 {
+		return checksum
+	}
+	return checksum[:16] + "..."
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestClientChecksumAlgorithm(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+
+	data := []byte("chunk with a client-computed crc32c")
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	clientCRC := hex.EncodeToString(sum[:])
+
+	put := func(chunkID, checksum, algo string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader(data))
+		if checksum != "" {
+			req.Header.Set("X-Chunk-Checksum", checksum)
+		}
+		if algo != "" {
+			req.Header.Set("X-Chunk-Checksum-Algo", algo)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("valid_crc32c_accepted", func(t *testing.T) {
+		w := put("crc-ok", clientCRC, "crc32c")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+		}
+
+		// Stored under the node's algorithm, not the client's
+		sn.index.mu.RLock()
+		entry := sn.index.chunks["crc-ok"]
+		sn.index.mu.RUnlock()
+
+		expected, _ := computeChecksum(ChecksumSHA256, data)
+		if entry.Checksum != expected || entry.ChecksumAlgo != ChecksumSHA256 {
+			t.Errorf("Expected entry stored with sha256 %s, got %s (%s)", expected, entry.Checksum, entry.ChecksumAlgo)
+		}
+		if etag := w.Header().Get("ETag"); etag != expected {
+			t.Errorf("Expected ETag %s, got %s", expected, etag)
+		}
+	})
+
+	t.Run("wrong_crc32c_rejected", func(t *testing.T) {
+		w := put("crc-bad", "deadbeef", "crc32c")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("crc32c_value_without_algo_rejected", func(t *testing.T) {
+		// Without the algo header the value is compared against SHA-256
+		w := put("crc-noalgo", clientCRC, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("unsupported_algo_rejected", func(t *testing.T) {
+		w := put("crc-md5", clientCRC, "md5")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestNodeChecksumAlgorithm(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.checksumAlgo = ChecksumCRC32C
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+
+	data := []byte("chunk stored with crc32c")
+	req := httptest.NewRequest("PUT", "/chunk/node-crc", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	getReq := httptest.NewRequest("GET", "/chunk/node-crc", nil)
+	getW := httptest.NewRecorder()
+	r.ServeHTTP(getW, getReq)
+
+	if getW.Code != http.StatusOK || !bytes.Equal(getW.Body.Bytes(), data) {
+		t.Fatalf("Expected verified read with crc32c, got %d", getW.Code)
+	}
+	if etag := getW.Header().Get("ETag"); len(etag) != 8 {
+		t.Errorf("Expected 8-char crc32c ETag, got %q", etag)
+	}
+}
+
+func TestVerifySampleRate(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := []byte("chunk read with sampled verification")
+	checksum, _ := computeChecksum(ChecksumSHA256, data)
+	if err := sn.storeChunk("sampled", data, checksum); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	sn.index.mu.RLock()
+	entry := sn.index.chunks["sampled"]
+	sn.index.mu.RUnlock()
+
+	t.Run("fraction_verified", func(t *testing.T) {
+		sn.verifySampleRate = 0.25
+		atomic.StoreInt64(&sn.verifiedReads, 0)
+
+		const reads = 4000
+		for i := 0; i < reads; i++ {
+			if _, _, err := sn.fetchChunk(entry); err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+		}
+
+		fraction := float64(atomic.LoadInt64(&sn.verifiedReads)) / reads
+		if fraction < 0.2 || fraction > 0.3 {
+			t.Errorf("Expected roughly 25%% of reads verified, got %.1f%%", fraction*100)
+		}
+	})
+
+	// Corrupt the chunk on disk
+	file, err := os.OpenFile(sn.getSuperblockPath(entry.SuperblockID), os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open superblock: %v", err)
+	}
+	file.WriteAt([]byte("X"), entry.Offset)
+	file.Close()
+
+	t.Run("disabled_skips_verification", func(t *testing.T) {
+		sn.verifySampleRate = 0
+		if _, _, err := sn.fetchChunk(entry); err != nil {
+			t.Errorf("Expected unverified read to succeed, got %v", err)
+		}
+	})
+
+	t.Run("full_rate_detects_corruption", func(t *testing.T) {
+		sn.verifySampleRate = 1
+		if _, _, err := sn.fetchChunk(entry); !errors.Is(err, errChunkCorrupt) {
+			t.Errorf("Expected errChunkCorrupt, got %v", err)
+		}
+		if failures := atomic.LoadInt64(&sn.verifyFailures); failures != 1 {
+			t.Errorf("Expected 1 verification failure, got %d", failures)
+		}
+	})
+
+	t.Run("metrics_exposed", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+		sn.handleMetrics(w, req)
+
+		body := w.Body.String()
+		for _, line := range []string{"vstack_verify_sample_rate 1\n", "vstack_verify_failures_total 1\n"} {
+			if !strings.Contains(body, line) {
+				t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+			}
+		}
+	})
+}
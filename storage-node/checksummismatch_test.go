@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChecksumMismatchPolicy(t *testing.T) {
+	wrong := fmt.Sprintf("%x", sha256.Sum256([]byte("some other data")))
+	bodies := map[string][]byte{
+		"buffered": []byte("small chunk with a wrong checksum"),
+		"streamed": bytes.Repeat([]byte("large chunk with a wrong checksum "), 256), // above SmallChunkThreshold
+	}
+
+	for _, policy := range []string{ChecksumMismatchReject, ChecksumMismatchStoreComputed} {
+		t.Run(policy, func(t *testing.T) {
+			t.Setenv("CHECKSUM_MISMATCH_POLICY", policy)
+			sn, tempDir := setupTestStorageNode(t)
+			defer cleanupTestStorageNode(tempDir)
+			router := sn.newRouter()
+
+			for path, data := range bodies {
+				chunkID := "mismatch-" + path
+				req := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader(data))
+				req.Header.Set("X-Chunk-Checksum", wrong)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				entry, stored := sn.lookupChunk(chunkID)
+				if policy == ChecksumMismatchReject {
+					if rr.Code != http.StatusBadRequest || stored {
+						t.Errorf("%s: expected 400 and nothing stored, got %d (stored: %v)", path, rr.Code, stored)
+					}
+					if rr.Header().Get("X-Checksum-Mismatch") != "" {
+						t.Errorf("%s: expected no X-Checksum-Mismatch on a rejected PUT", path)
+					}
+					continue
+				}
+
+				computed := fmt.Sprintf("%x", sha256.Sum256(data))
+				if rr.Code != http.StatusCreated {
+					t.Fatalf("%s: expected 201, got %d: %s", path, rr.Code, rr.Body.String())
+				}
+				if rr.Header().Get("X-Checksum-Mismatch") != "true" || rr.Header().Get("ETag") != computed {
+					t.Errorf("%s: expected the computed ETag with X-Checksum-Mismatch, got %q (%q)",
+						path, rr.Header().Get("ETag"), rr.Header().Get("X-Checksum-Mismatch"))
+				}
+				if !stored || entry.Checksum != computed {
+					t.Errorf("%s: expected the chunk stored with its computed checksum, got %q", path, entry.Checksum)
+				}
+				got, err := sn.readChunk(entry)
+				if err != nil || !bytes.Equal(got, data) {
+					t.Errorf("%s: expected the chunk to read back intact (%v)", path, err)
+				}
+			}
+
+			// A matching checksum is never flagged
+			data := []byte("chunk with the right checksum")
+			req := httptest.NewRequest("PUT", "/chunk/mismatch-none", bytes.NewReader(data))
+			req.Header.Set("X-Chunk-Checksum", fmt.Sprintf("%x", sha256.Sum256(data)))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusCreated || rr.Header().Get("X-Checksum-Mismatch") != "" {
+				t.Errorf("Expected a plain 201 for a matching checksum, got %d (%q)", rr.Code, rr.Header().Get("X-Checksum-Mismatch"))
+			}
+
+			// Batch items follow the same policy
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			part, _ := mw.CreatePart(map[string][]string{
+				"Content-Disposition": {`form-data; name="mismatch-batch"`},
+				"X-Chunk-Checksum":    {wrong},
+			})
+			part.Write(data)
+			mw.Close()
+			req = httptest.NewRequest("POST", "/chunks/batch", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			rr = httptest.NewRecorder()
+			newBatchTestRouter(sn).ServeHTTP(rr, req)
+			var resp BatchPutResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || len(resp.Results) != 1 {
+				t.Fatalf("Failed to decode batch response (%v)", err)
+			}
+			result := resp.Results[0]
+			if policy == ChecksumMismatchReject {
+				if result.Status != http.StatusBadRequest || result.ChecksumMismatch {
+					t.Errorf("Expected the batch item rejected, got %+v", result)
+				}
+			} else if result.Status != http.StatusCreated || !result.ChecksumMismatch || result.Checksum != fmt.Sprintf("%x", sha256.Sum256(data)) {
+				t.Errorf("Expected the batch item stored with its computed checksum and flagged, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestInvalidChecksumMismatchPolicy(t *testing.T) {
+	t.Setenv("CHECKSUM_MISMATCH_POLICY", "ignore")
+	if sn := NewStorageNode(t.TempDir(), "test-node"); sn.checksumMismatch != ChecksumMismatchReject {
+		t.Errorf("Expected an invalid policy to fall back to %s, got %s", ChecksumMismatchReject, sn.checksumMismatch)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestChunkAgeHeaders(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleHeadChunk).Methods("HEAD")
+
+	put := func(chunkID, ttl string) {
+		req := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader([]byte("aging "+chunkID)))
+		if ttl != "" {
+			req.Header.Set("X-Chunk-TTL", ttl)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("PUT %s: expected status %d, got %d", chunkID, http.StatusCreated, w.Code)
+		}
+	}
+	headers := func(method, chunkID string) http.Header {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/chunk/"+chunkID, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected status %d, got %d", method, chunkID, http.StatusOK, w.Code)
+		}
+		return w.Header()
+	}
+	seconds := func(h http.Header, name string) int {
+		n, err := strconv.Atoi(h.Get(name))
+		if err != nil {
+			t.Fatalf("Expected integer %s, got %q", name, h.Get(name))
+		}
+		return n
+	}
+	// age moves a chunk's stored and expiry times back, as if d had passed
+	age := func(chunkID string, d time.Duration) {
+		sn.index.mu.Lock()
+		entry := sn.index.chunks[chunkID]
+		entry.StoredAt = entry.StoredAt.Add(-d)
+		if entry.ExpiresAt != nil {
+			expires := entry.ExpiresAt.Add(-d)
+			entry.ExpiresAt = &expires
+		}
+		sn.index.chunks[chunkID] = entry
+		sn.index.mu.Unlock()
+	}
+
+	put("expiring", "3600")
+	put("forever", "")
+
+	for _, method := range []string{"GET", "HEAD"} {
+		h := headers(method, "expiring")
+		if got := seconds(h, "X-Chunk-Age-Seconds"); got != 0 {
+			t.Errorf("%s: expected age 0 for a new chunk, got %d", method, got)
+		}
+		if got := seconds(h, "X-Chunk-TTL-Remaining"); got < 3599 || got > 3600 {
+			t.Errorf("%s: expected about 3600s of TTL remaining, got %d", method, got)
+		}
+
+		h = headers(method, "forever")
+		if h.Get("X-Chunk-Age-Seconds") == "" {
+			t.Errorf("%s: expected X-Chunk-Age-Seconds for a chunk without a TTL", method)
+		}
+		if got := h.Get("X-Chunk-TTL-Remaining"); got != "" {
+			t.Errorf("%s: expected no X-Chunk-TTL-Remaining without a TTL, got %q", method, got)
+		}
+	}
+
+	before := headers("GET", "expiring")
+	age("expiring", 90*time.Second)
+	get, head := headers("GET", "expiring"), headers("HEAD", "expiring")
+
+	if got := seconds(get, "X-Chunk-Age-Seconds"); got < 90 || got > 91 {
+		t.Errorf("Expected age of about 90s, got %d", got)
+	}
+	if got, was := seconds(get, "X-Chunk-TTL-Remaining"), seconds(before, "X-Chunk-TTL-Remaining"); got > was-90 {
+		t.Errorf("Expected TTL remaining to drop by 90s from %d, got %d", was, got)
+	}
+	for _, name := range []string{"X-Chunk-Age-Seconds", "X-Chunk-TTL-Remaining"} {
+		if g, h := seconds(get, name), seconds(head, name); g-h > 1 || h-g > 1 {
+			t.Errorf("GET and HEAD disagree on %s: %d vs %d", name, g, h)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// MaxChunkIDLength is the longest chunk ID accepted
+const MaxChunkIDLength = 64
+
+// Machine-readable codes for rejected chunk IDs, sent in the code field of
+// 400 responses, also copied to X-Error-Code, and of batch item results
+const (
+	ErrorCodeHeader = "X-Error-Code"
+
+	ChunkIDEmpty             = "chunk_id_empty"
+	ChunkIDTooLong           = "chunk_id_too_long"
+	ChunkIDIllegalCharacters = "chunk_id_illegal_characters"
+	ChunkIDNotContentAddress = "chunk_id_not_content_address"
+)
+
+// chunkIDError explains why a chunk ID was rejected
+type chunkIDError struct {
+	Code string
+	msg  string
+}
+
+func (e *chunkIDError) Error() string {
+	return e.msg
+}
+
+// validateChunkID validates the format of a chunk ID: 1 to MaxChunkIDLength
+// letters, digits, underscores and hyphens
+func validateChunkID(id string) error {
+	if id == "" {
+		return &chunkIDError{Code: ChunkIDEmpty, msg: "chunk ID is empty"}
+	}
+	if len(id) > MaxChunkIDLength {
+		return &chunkIDError{Code: ChunkIDTooLong, msg: fmt.Sprintf("chunk ID too long: max %d characters, got %d", MaxChunkIDLength, len(id))}
+	}
+
+	var illegal []string
+	seen := make(map[rune]bool)
+	for _, c := range id {
+		if isChunkIDRune(c) || seen[c] {
+			continue
+		}
+		seen[c] = true
+		illegal = append(illegal, fmt.Sprintf("%q", c))
+	}
+	if len(illegal) > 0 {
+		return &chunkIDError{
+			Code: ChunkIDIllegalCharacters,
+			msg:  fmt.Sprintf("chunk ID contains illegal characters: %s (allowed: letters, digits, '_' and '-')", strings.Join(illegal, ", ")),
+		}
+	}
+	return nil
+}
+
+func isChunkIDRune(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// chunkIDErrorCode returns the code for a chunk ID validation error
+func chunkIDErrorCode(err error) string {
+	var idErr *chunkIDError
+	if errors.As(err, &idErr) {
+		return idErr.Code
+	}
+	return ""
+}
+
+// ErrorResponse is the JSON body of a rejected chunk ID
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// writeChunkIDError rejects a request for an invalid chunk ID with 400,
+// naming what's wrong with it in a JSON ErrorResponse
+func writeChunkIDError(w http.ResponseWriter, err error) {
+	code := chunkIDErrorCode(err)
+	if code != "" {
+		w.Header().Set(ErrorCodeHeader, code)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error(), Code: code}); err != nil {
+		log.Printf("Failed to encode chunk ID error: %v", err)
+	}
+}
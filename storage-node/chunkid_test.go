@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestChunkIDValidationErrors(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	tests := []struct {
+		name    string
+		chunkID string
+		code    string
+		message string
+	}{
+		{"too long", strings.Repeat("a", MaxChunkIDLength+1), ChunkIDTooLong, fmt.Sprintf("chunk ID too long: max %d", MaxChunkIDLength)},
+		{"space", "has space", ChunkIDIllegalCharacters, `chunk ID contains illegal characters: ' '`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/"+url.PathEscape(tc.chunkID), bytes.NewReader([]byte("data"))))
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected 400, got %d", rr.Code)
+			}
+			var errResp ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&errResp); err != nil {
+				t.Fatalf("Expected a JSON error body: %v", err)
+			}
+			if errResp.Code != tc.code || rr.Header().Get(ErrorCodeHeader) != tc.code {
+				t.Errorf("Expected error code %s, got %q", tc.code, errResp.Code)
+			}
+			if !strings.Contains(errResp.Error, tc.message) {
+				t.Errorf("Expected message containing %q, got %q", tc.message, errResp.Error)
+			}
+
+			// Reads and deletes validate the ID before looking it up
+			for _, method := range []string{"GET", "HEAD", "DELETE"} {
+				rr = httptest.NewRecorder()
+				router.ServeHTTP(rr, httptest.NewRequest(method, "/chunk/"+url.PathEscape(tc.chunkID), nil))
+				if rr.Code != http.StatusBadRequest || rr.Header().Get(ErrorCodeHeader) != tc.code {
+					t.Errorf("Expected %s to fail with 400 and code %s, got %d %q", method, tc.code, rr.Code, rr.Header().Get(ErrorCodeHeader))
+				}
+			}
+
+			// Batch items report the same code
+			rr = httptest.NewRecorder()
+			body, _ := json.Marshal(BatchDeleteRequest{ChunkIDs: []string{tc.chunkID}})
+			router.ServeHTTP(rr, httptest.NewRequest("POST", "/chunks/batch/delete", bytes.NewReader(body)))
+			var resp BatchDeleteResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || len(resp.Results) != 1 {
+				t.Fatalf("Failed to decode batch delete response: %v", err)
+			}
+			if result := resp.Results[0]; result.Status != http.StatusBadRequest || result.Code != tc.code {
+				t.Errorf("Expected a 400 item with code %s, got %+v", tc.code, result)
+			}
+		})
+	}
+
+	// Each illegal character is named once
+	err := validateChunkID("a b/c d")
+	if err == nil || !strings.Contains(err.Error(), `' ', '/'`) || strings.Count(err.Error(), `' '`) != 1 {
+		t.Errorf("Expected each illegal character listed once, got %v", err)
+	}
+	if err := validateChunkID(strings.Repeat("a", MaxChunkIDLength)); err != nil {
+		t.Errorf("Expected a %d character ID to be valid, got %v", MaxChunkIDLength, err)
+	}
+}
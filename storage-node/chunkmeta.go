@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxChunkMetaPatchSize bounds PATCH /chunk/{id}/meta request bodies
+const MaxChunkMetaPatchSize = 64 * 1024
+
+// immutableChunkFields are ChunkEntry fields tied to the stored bytes, which
+// a metadata update must not change
+var immutableChunkFields = []string{
+	"chunk_id", "superblock_id", "offset", "size", "checksum", "checksum_algo", "stored_at",
+}
+
+// ChunkMetaPatch lists the mutable chunk metadata. Absent fields are left
+// unchanged. TTL is in seconds from now; 0 removes the expiry.
+type ChunkMetaPatch struct {
+	TTL         *int64  `json:"ttl"`
+	Pinned      *bool   `json:"pinned"`
+	ContentType *string `json:"content_type"`
+	StoredBy    *string `json:"stored_by"`
+}
+
+// apply validates the patch and applies it to entry
+func (p ChunkMetaPatch) apply(entry *ChunkEntry, now time.Time) error {
+	if p.TTL != nil {
+		switch {
+		case *p.TTL < 0:
+			return fmt.Errorf("ttl must be a non-negative number of seconds")
+		case *p.TTL == 0:
+			entry.ExpiresAt = nil
+		default:
+			expiry := now.Add(time.Duration(*p.TTL) * time.Second)
+			entry.ExpiresAt = &expiry
+		}
+	}
+	if p.Pinned != nil {
+		entry.Pinned = *p.Pinned
+	}
+	if p.ContentType != nil {
+		if *p.ContentType != "" {
+			if _, _, err := mime.ParseMediaType(*p.ContentType); err != nil {
+				return fmt.Errorf("invalid content_type: %w", err)
+			}
+		}
+		entry.ContentType = *p.ContentType
+	}
+	if p.StoredBy != nil {
+		if len(*p.StoredBy) > MaxStoredByLength {
+			return fmt.Errorf("stored_by exceeds %d characters", MaxStoredByLength)
+		}
+		entry.StoredBy = *p.StoredBy
+	}
+	return nil
+}
+
+// decodeChunkMetaPatch parses a metadata patch, rejecting attempts to change
+// fields tied to the stored bytes as well as unknown fields
+func decodeChunkMetaPatch(body []byte) (ChunkMetaPatch, error) {
+	var patch ChunkMetaPatch
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return patch, fmt.Errorf("invalid JSON body: %w", err)
+	}
+	for _, name := range immutableChunkFields {
+		if _, ok := fields[name]; ok {
+			return patch, fmt.Errorf("field %q is immutable", name)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		return patch, fmt.Errorf("invalid metadata patch: %w", err)
+	}
+	return patch, nil
+}
+
+// handlePatchChunkMeta updates a chunk's mutable metadata in place and
+// persists the index, leaving the stored bytes untouched
+func (sn *StorageNode) handlePatchChunkMeta(w http.ResponseWriter, r *http.Request) {
+	chunkID := mux.Vars(r)["chunk_id"]
+	if err := sn.validateChunkID(chunkID); err != nil {
+		writeChunkIDError(w, err)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxChunkMetaPatchSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > MaxChunkMetaPatchSize {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	patch, err := decodeChunkMetaPatch(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	sn.index.mu.Lock()
+	entry, exists := sn.index.chunks[chunkID]
+	if !exists || entry.expired(now) {
+		sn.index.mu.Unlock()
+		http.Error(w, ErrChunkNotFound, http.StatusNotFound)
+		return
+	}
+	if err := patch.apply(&entry, now); err != nil {
+		sn.index.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sn.index.set(entry)
+	sn.index.mu.Unlock()
+
+	if err := sn.saveIndex(); err != nil {
+		log.Printf("Failed to save index after updating chunk %s metadata: %v", chunkID, err)
+		http.Error(w, "Failed to persist metadata", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entry); err != nil {
+		log.Printf("Failed to encode chunk metadata: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPatchChunkMetaExtendsTTL(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	r := sn.newRouter()
+
+	data := []byte("short-lived chunk")
+	req := httptest.NewRequest("PUT", "/chunk/ttl-patch", bytes.NewReader(data))
+	req.Header.Set("X-Chunk-Checksum", fmt.Sprintf("%x", sha256.Sum256(data)))
+	req.Header.Set("X-Chunk-TTL", "60")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	before, _ := sn.lookupChunk("ttl-patch")
+	oldExpiry := *before.ExpiresAt
+
+	patch := `{"ttl": 86400, "content_type": "text/plain", "stored_by": "reaper"}`
+	req = httptest.NewRequest("PATCH", "/chunk/ttl-patch/meta", strings.NewReader(patch))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	after, ok := sn.lookupChunk("ttl-patch")
+	if !ok {
+		t.Fatal("Expected chunk to exist after PATCH")
+	}
+	if after.expired(oldExpiry.Add(time.Second)) {
+		t.Error("Expected chunk to outlive its original expiry")
+	}
+	if !after.expired(time.Now().Add(25 * time.Hour)) {
+		t.Error("Expected chunk to still expire at its new TTL")
+	}
+	if after.Offset != before.Offset || after.Checksum != before.Checksum || after.Size != before.Size {
+		t.Errorf("Expected data location unchanged, got %+v (was %+v)", after, before)
+	}
+
+	// The update is persisted
+	reloaded := NewStorageNode(tempDir, "test-node")
+	if err := reloaded.Initialize(); err != nil {
+		t.Fatalf("Failed to reinitialize storage node: %v", err)
+	}
+	if entry, _ := reloaded.lookupChunk("ttl-patch"); entry.ExpiresAt == nil || !entry.ExpiresAt.Equal(*after.ExpiresAt) ||
+		entry.StoredBy != "reaper" {
+		t.Errorf("Expected patched metadata to survive restart, got %+v", entry)
+	}
+
+	req = httptest.NewRequest("GET", "/chunk/ttl-patch", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("Expected patched Content-Type, got %q", ct)
+	}
+	if !bytes.Equal(w.Body.Bytes(), data) {
+		t.Error("Expected chunk data to be untouched")
+	}
+}
+
+func TestPatchChunkMetaRejectsInvalidUpdates(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	r := sn.newRouter()
+
+	data := []byte("immutable bytes")
+	if err := sn.storeChunk("meta-locked", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"size", "/chunk/meta-locked/meta", `{"size": 1}`, http.StatusBadRequest},
+		{"checksum", "/chunk/meta-locked/meta", `{"checksum": "abc"}`, http.StatusBadRequest},
+		{"offset", "/chunk/meta-locked/meta", `{"offset": 0, "pinned": true}`, http.StatusBadRequest},
+		{"unknown_field", "/chunk/meta-locked/meta", `{"colour": "red"}`, http.StatusBadRequest},
+		{"negative_ttl", "/chunk/meta-locked/meta", `{"ttl": -5}`, http.StatusBadRequest},
+		{"bad_content_type", "/chunk/meta-locked/meta", `{"content_type": "not a type"}`, http.StatusBadRequest},
+		{"missing_chunk", "/chunk/meta-missing/meta", `{"pinned": true}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	entry, _ := sn.lookupChunk("meta-locked")
+	if entry.Pinned {
+		t.Error("Expected rejected patch to leave metadata unchanged")
+	}
+	body, _ := json.Marshal(entry)
+	if strings.Contains(string(body), "content_type") {
+		t.Errorf("Unexpected metadata after rejected patches: %s", body)
+	}
+}
+
+func TestPinnedChunkDoesNotExpire(t *testing.T) {
+	expiry := time.Now().Add(-time.Minute)
+	entry := ChunkEntry{ChunkID: "pinned", ExpiresAt: &expiry}
+	if !entry.expired(time.Now()) {
+		t.Fatal("Expected unpinned chunk past its TTL to be expired")
+	}
+	entry.Pinned = true
+	if entry.expired(time.Now()) {
+		t.Error("Expected pinned chunk not to expire")
+	}
+}
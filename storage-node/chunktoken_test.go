@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChunkTokens(t *testing.T) {
+	t.Setenv("CHUNK_TOKEN_SECRET", "shared-secret")
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+	secret := []byte("shared-secret")
+
+	do := func(method, path, token string, body []byte) int {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set(ChunkTokenHeader, token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	future := time.Now().Add(time.Minute)
+
+	data := []byte("tenant chunk")
+	if code := do("PUT", "/chunk/tenant", SignChunkToken(secret, "PUT", "tenant", future), data); code != http.StatusCreated {
+		t.Fatalf("Expected a valid token to allow PUT, got %d", code)
+	}
+
+	valid := SignChunkToken(secret, "GET", "tenant", future)
+	expiry, sig, _ := strings.Cut(valid, ".")
+	tampered := sig[:len(sig)-1] + string("0123456789abcdef"[(strings.IndexByte("0123456789abcdef", sig[len(sig)-1])+1)%16])
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"valid", "GET", "/chunk/tenant", valid, http.StatusOK},
+		{"valid for HEAD", "HEAD", "/chunk/tenant", valid, http.StatusOK},
+		{"valid for metadata", "GET", "/chunk/tenant/metadata", valid, http.StatusOK},
+		{"missing", "GET", "/chunk/tenant", "", http.StatusForbidden},
+		{"expired", "GET", "/chunk/tenant", SignChunkToken(secret, "GET", "tenant", time.Now().Add(-time.Second)), http.StatusForbidden},
+		{"tampered signature", "GET", "/chunk/tenant", expiry + "." + tampered, http.StatusForbidden},
+		{"extended expiry", "GET", "/chunk/tenant", "9999999999." + sig, http.StatusForbidden},
+		{"other secret", "GET", "/chunk/tenant", SignChunkToken([]byte("guess"), "GET", "tenant", future), http.StatusForbidden},
+		{"other chunk", "GET", "/chunk/tenant", SignChunkToken(secret, "GET", "other", future), http.StatusForbidden},
+		{"other method", "DELETE", "/chunk/tenant", valid, http.StatusForbidden},
+		{"malformed", "GET", "/chunk/tenant", "not-a-token", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if code := do(tt.method, tt.path, tt.token, nil); code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, code)
+		}
+	}
+
+	// Multi-chunk endpoints need the admin token, which also bypasses chunk tokens
+	if code := do("GET", "/chunks", valid, nil); code != http.StatusForbidden {
+		t.Errorf("Expected GET /chunks without ADMIN_TOKEN to be rejected, got %d", code)
+	}
+	for _, path := range []string{"/chunks", "/chunk/tenant"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected ADMIN_TOKEN to allow GET %s, got %d", path, rr.Code)
+		}
+	}
+
+	// Routes not naming chunks stay open
+	if code := do("GET", "/health", "", nil); code != http.StatusOK {
+		t.Errorf("Expected /health to need no token, got %d", code)
+	}
+}
+
+func TestChunkTokensOffByDefault(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/open", bytes.NewReader([]byte("open chunk"))))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected chunk routes to be open without CHUNK_TOKEN_SECRET, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer can't spoof", "203.0.113.7:5000", map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "1.2.3.4"}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:5000", map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"trusted bare IP", "192.168.1.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"prepended hop ignored", "10.1.2.3:5000", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.9, 10.9.9.9"}, "198.51.100.9"},
+		{"real IP fallback", "10.1.2.3:5000", map[string]string{"X-Real-IP": "198.51.100.10"}, "198.51.100.10"},
+		{"trusted proxy without headers", "10.1.2.3:5000", nil, "10.1.2.3"},
+		{"garbage header", "10.1.2.3:5000", map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.1.2.3"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ping", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			if got := sn.resolveClientIP(req); got != tc.want {
+				t.Errorf("Expected client %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestClientIPReachesHandlers(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	var seen string
+	handler := sn.clientIPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = clientIP(r)
+	}))
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.RemoteAddr = "10.0.0.5:4000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.9")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if seen != "198.51.100.9" {
+		t.Errorf("Expected handlers to see the forwarded client, got %s", seen)
+	}
+}
+
+func TestInvalidTrustedProxiesFailsStartup(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,proxy.internal")
+	sn := NewStorageNode(t.TempDir(), "test-node")
+	err := sn.Initialize()
+	if err == nil || !strings.Contains(err.Error(), "TRUSTED_PROXIES") {
+		t.Fatalf("Expected a TRUSTED_PROXIES error, got %v", err)
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var errActiveSuperblock = errors.New("cannot compact the active superblock")
+
+// compactCopied runs between a compaction's copy and its swap; tests swap it
+// to write to the superblock meanwhile
+var compactCopied = func(id int) {}
+
+// CompactResult reports the outcome of compacting a superblock
+type CompactResult struct {
+	SuperblockID   int   `json:"superblock_id"`
+	LiveChunks     int   `json:"live_chunks"`
+	BytesBefore    int64 `json:"bytes_before"`
+	BytesAfter     int64 `json:"bytes_after"`
+	BytesReclaimed int64 `json:"bytes_reclaimed"`
+	DurationMs     int64 `json:"duration_ms"`
+}
+
+// compactionMap is persisted while a compacted superblock is swapped in, so
+// a crash between the swap and the index save can be rolled forward
+type compactionMap struct {
+	SuperblockID int                 `json:"superblock_id"`
+	Moves        map[string][2]int64 `json:"moves"` // chunk ID -> old, new offset
+}
+
+func (sn *StorageNode) compactPath(id int) string {
+	return sn.getSuperblockPath(id) + ".compact"
+}
+
+func (sn *StorageNode) compactMapPath(id int) string {
+	return sn.getSuperblockPath(id) + ".compact.map"
+}
+
+// CompactSuperblock rewrites a superblock with only the chunks still in the
+// index, reclaiming the space of deleted and relocated ones. The live chunks
+// are copied to superblock_<id>.dat.compact without holding sn.mu, so writes
+// carry on meanwhile. sn.mu is then taken only to copy chunks relocated into
+// or deduplicated against the superblock during the copy, and to rename the
+// compacted file over the original while the index is repointed, so reads
+// keep being served: a read racing the swap sees the entry change and
+// retries at the new offset. The active superblock is never compacted.
+func (sn *StorageNode) CompactSuperblock(id int) (CompactResult, error) {
+	start := time.Now()
+	result := CompactResult{SuperblockID: id}
+
+	// Nothing to copy; drop the superblock instead
+	if len(sn.chunksInSuperblock(id)) == 0 {
+		info, err := os.Stat(sn.getSuperblockPath(id))
+		if err != nil {
+			return result, fmt.Errorf("%w: %d", errInvalidTarget, id)
+		}
+		if sn.isActiveSuperblock(id) {
+			return result, errActiveSuperblock
+		}
+		if err := sn.removeSuperblock(id); err == nil {
+			result.BytesBefore, result.BytesReclaimed = info.Size(), info.Size()
+			result.DurationMs = time.Since(start).Milliseconds()
+			return result, nil
+		}
+		// A chunk moved in meanwhile; compact normally
+	}
+
+	// Checked again before the swap, in case of a rotation meanwhile
+	if sn.isActiveSuperblock(id) {
+		return result, errActiveSuperblock
+	}
+	path := sn.getSuperblockPath(id)
+	src, err := os.Open(path)
+	if err != nil {
+		return result, fmt.Errorf("%w: %d", errInvalidTarget, id)
+	}
+	defer src.Close()
+
+	// The compacted file is always in the current format, upgrading
+	// legacy superblocks
+	hdr := SuperblockHeader{Version: SuperblockVersion, CreatedAt: time.Now()}
+	old, err := sn.readSuperblockHeader(id)
+	if err == nil && !old.CreatedAt.IsZero() {
+		hdr.CreatedAt = old.CreatedAt
+	}
+	tempPath := sn.compactPath(id)
+	dst, err := os.Create(tempPath)
+	if err != nil {
+		return result, fmt.Errorf("failed to create compacted superblock: %w", err)
+	}
+	fail := func(err error) (CompactResult, error) {
+		dst.Close()
+		os.Remove(tempPath)
+		return result, err
+	}
+	if _, err := dst.Seek(SuperblockHeaderSize, io.SeekStart); err != nil {
+		return fail(fmt.Errorf("failed to seek past compacted superblock header: %w", err))
+	}
+	c := &compactCopy{
+		src:       src,
+		dst:       dst,
+		srcFramed: old.Version >= SuperblockVersion,
+		offset:    SuperblockHeaderSize,
+		blobs:     make(map[int64]int64),
+		promoted:  make(map[string]bool),
+	}
+	if err := c.copyBlobs(sn.superblockEntries(id)); err != nil {
+		return fail(err)
+	}
+	if err := dst.Sync(); err != nil {
+		return fail(fmt.Errorf("failed to sync compacted superblock: %w", err))
+	}
+	compactCopied(id)
+
+	// Writers, relocations, dedup links and drains all hold sn.mu, so while
+	// it is held nothing new can land in the superblock
+	sn.mu.Lock()
+	if sn.appendingTo(id) {
+		sn.mu.Unlock()
+		return fail(errActiveSuperblock)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		sn.mu.Unlock()
+		return fail(fmt.Errorf("%w: %d", errInvalidTarget, id))
+	}
+	result.BytesBefore = info.Size()
+
+	// Catch up on chunks that arrived during the copy
+	entries := sn.superblockEntries(id)
+	var late []ChunkEntry
+	for _, entry := range entries {
+		if _, ok := c.blobs[entry.Offset]; !ok {
+			late = append(late, entry)
+		}
+	}
+	if err := c.copyBlobs(late); err != nil {
+		sn.mu.Unlock()
+		return fail(err)
+	}
+	hdr.ChunkCount, hdr.NextOffset = uint32(len(c.blobs)), c.offset
+	if _, err := dst.WriteAt(hdr.encode(), 0); err != nil {
+		sn.mu.Unlock()
+		return fail(fmt.Errorf("failed to write compacted superblock header: %w", err))
+	}
+	if err := dst.Sync(); err != nil {
+		sn.mu.Unlock()
+		return fail(fmt.Errorf("failed to sync compacted superblock: %w", err))
+	}
+	dst.Close()
+
+	moves := make(map[string][2]int64, len(entries))
+	for _, entry := range entries {
+		moves[entry.ChunkID] = [2]int64{entry.Offset, c.blobs[entry.Offset]}
+	}
+	if err := sn.writeCompactionMap(compactionMap{SuperblockID: id, Moves: moves}); err != nil {
+		sn.mu.Unlock()
+		os.Remove(tempPath)
+		return result, err
+	}
+
+	// Swap the file and repoint the index together. Chunks deleted since
+	// the copy stay behind as dead bytes in the new file.
+	sn.index.mu.Lock()
+	if err := renameFile(tempPath, path); err != nil {
+		sn.index.mu.Unlock()
+		sn.mu.Unlock()
+		os.Remove(tempPath)
+		os.Remove(sn.compactMapPath(id))
+		return result, fmt.Errorf("failed to swap in compacted superblock: %w", err)
+	}
+	sn.handles.invalidate(id)
+	os.Remove(sn.getSuperblockHeaderPath(id)) // Superseded by the header in the file
+	var liveBytes int64
+	counted := make(map[int64]bool)
+	for chunkID, move := range moves {
+		entry, ok := sn.index.chunks[chunkID]
+		if !ok || entry.SuperblockID != id || entry.Offset != move[0] {
+			continue
+		}
+		entry.Offset = move[1]
+		if c.promoted[chunkID] {
+			entry.Deduplicated = false
+		}
+		sn.index.set(entry)
+		result.LiveChunks++
+		if !counted[move[1]] {
+			counted[move[1]] = true
+			liveBytes += int64(entry.Size)
+		}
+	}
+	sn.index.mu.Unlock()
+
+	sn.invalidateSuperblockChecksum(id)
+	sn.deadMu.Lock()
+	sn.deadBytes[id] = c.copied - liveBytes
+	sn.deadMu.Unlock()
+	sn.mu.Unlock()
+
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		log.Printf("Warning: failed to sync directory after compacting superblock %d: %v", id, err)
+	}
+	if err := sn.saveIndex(); err != nil {
+		// The map stays so the next start repoints the index
+		return result, fmt.Errorf("compacted superblock %d but failed to persist index: %w", id, err)
+	}
+	os.Remove(sn.compactMapPath(id))
+
+	result.BytesAfter = c.offset
+	result.BytesReclaimed = result.BytesBefore - c.offset
+	result.DurationMs = time.Since(start).Milliseconds()
+	log.Printf("Compacted superblock %d: %d live chunk(s), %d -> %d bytes", id, result.LiveChunks, result.BytesBefore, result.BytesAfter)
+	return result, nil
+}
+
+// superblockEntries returns the index entries in a superblock in offset
+// order, chunks sharing deduplicated bytes together
+func (sn *StorageNode) superblockEntries(id int) []ChunkEntry {
+	var entries []ChunkEntry
+	sn.index.mu.RLock()
+	for _, entry := range sn.index.chunks {
+		if entry.SuperblockID == id {
+			entries = append(entries, entry)
+		}
+	}
+	sn.index.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Offset != entries[j].Offset {
+			return entries[i].Offset < entries[j].Offset
+		}
+		return entries[i].ChunkID < entries[j].ChunkID
+	})
+	return entries
+}
+
+// compactCopy is a compacted superblock being written
+type compactCopy struct {
+	src, dst  *os.File
+	srcFramed bool
+	offset    int64           // where the next frame goes in dst
+	blobs     map[int64]int64 // old offset -> new offset of each copied chunk's bytes
+	promoted  map[string]bool // deduplicated chunks now framed under their own ID
+	copied    int64           // chunk bytes copied
+}
+
+// copyBlobs appends the chunks of entries, sorted by offset, to the
+// compacted file, bytes shared by deduplicated chunks once
+func (c *compactCopy) copyBlobs(entries []ChunkEntry) error {
+	for i := 0; i < len(entries); {
+		j := i + 1
+		for j < len(entries) && entries[j].Offset == entries[i].Offset {
+			j++
+		}
+		sharing := entries[i:j]
+		i = j
+
+		// The bytes keep the frame of the chunk they were written as. If
+		// only deduplicated chunks are left, the first one gets a frame.
+		entry := sharing[0]
+		for _, e := range sharing {
+			if !e.Deduplicated {
+				entry = e
+				break
+			}
+		}
+		if entry.Deduplicated {
+			c.promoted[entry.ChunkID] = true
+		}
+
+		// Frames are copied along with their chunks, keeping their written-at
+		// times; chunks from a legacy superblock get one built from the index
+		framed := frameSize(entry.ChunkID) + int64(entry.Size)
+		var err error
+		if c.srcFramed && !entry.Deduplicated {
+			_, err = io.Copy(c.dst, io.NewSectionReader(c.src, entry.Offset-frameSize(entry.ChunkID), framed))
+		} else {
+			var frame []byte
+			frame, err = chunkFrame{ChunkID: entry.ChunkID, Size: entry.Size, Checksum: entry.Checksum, ChecksumAlgo: entry.checksumAlgorithm(), Compression: entry.Compression, Encrypted: entry.Encrypted, WrittenAt: entry.StoredAt}.encode()
+			if err == nil {
+				if _, err = c.dst.Write(frame); err == nil {
+					_, err = io.Copy(c.dst, io.NewSectionReader(c.src, entry.Offset, int64(entry.Size)))
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy chunk %s: %w", entry.ChunkID, err)
+		}
+		c.blobs[entry.Offset] = c.offset + frameSize(entry.ChunkID)
+		c.offset += framed
+		c.copied += int64(entry.Size)
+	}
+	return nil
+}
+
+// isActiveSuperblock reports whether new chunks are being appended to id
+func (sn *StorageNode) isActiveSuperblock(id int) bool {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	return sn.appendingTo(id)
+}
+
+// appendingTo is isActiveSuperblock for callers already holding sn.mu. A
+// superblock rotated away from still counts while a chunk streams into it.
+func (sn *StorageNode) appendingTo(id int) bool {
+	return id == sn.currentSuperblock || (sn.fastTierDir != "" && id == sn.currentFastSuperblock) || sn.streaming[id] > 0
+}
+
+func (sn *StorageNode) writeCompactionMap(m compactionMap) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode compaction map: %w", err)
+	}
+	path := sn.compactMapPath(m.SuperblockID)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create compaction map: %w", err)
+	}
+	if _, err := file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write compaction map: %w", err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// recoverCompactions finishes or discards compactions interrupted by a
+// crash. If the compacted file was never swapped in it is discarded;
+// otherwise the persisted index is repointed at the new offsets.
+func (sn *StorageNode) recoverCompactions() {
+	dirs := []string{filepath.Join(sn.dataDir, "data")}
+	if sn.fastTierDir != "" {
+		dirs = append(dirs, sn.fastTierDir)
+	}
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "superblock_*.dat.compact.map"))
+		for _, mapPath := range matches {
+			data, err := os.ReadFile(mapPath)
+			var m compactionMap
+			if err == nil {
+				err = json.Unmarshal(data, &m)
+			}
+			if err != nil {
+				log.Printf("Warning: ignoring unreadable compaction map %s: %v", mapPath, err)
+				continue
+			}
+
+			if _, err := os.Stat(sn.compactPath(m.SuperblockID)); err == nil {
+				log.Printf("Discarding unfinished compaction of superblock %d", m.SuperblockID)
+				os.Remove(sn.compactPath(m.SuperblockID))
+				os.Remove(mapPath)
+				continue
+			}
+
+			repointed := 0
+			sn.index.mu.Lock()
+			for chunkID, move := range m.Moves {
+				if entry, ok := sn.index.chunks[chunkID]; ok && entry.SuperblockID == m.SuperblockID && entry.Offset == move[0] {
+					entry.Offset = move[1]
+					sn.index.set(entry)
+					repointed++
+				}
+			}
+			sn.index.mu.Unlock()
+			if err := sn.saveIndex(); err != nil {
+				log.Printf("Warning: failed to persist index after recovering compaction of superblock %d: %v", m.SuperblockID, err)
+				continue
+			}
+			os.Remove(mapPath)
+			log.Printf("Recovered compaction of superblock %d (%d entries repointed)", m.SuperblockID, repointed)
+		}
+	}
+	// Compacted files without a map were never swapped in
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "superblock_*.dat.compact"))
+		for _, path := range matches {
+			if _, err := os.Stat(path + ".map"); os.IsNotExist(err) {
+				os.Remove(path)
+			}
+		}
+	}
+}
+
+func (sn *StorageNode) handleCompactSuperblock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 0 {
+		http.Error(w, "Invalid superblock ID", http.StatusBadRequest)
+		return
+	}
+
+	// Compaction runs inline, so rather than hold the request open behind
+	// other maintenance it is refused while the gate is full
+	release := sn.maintenance.tryAcquire(MaintenanceCompact)
+	if release == nil {
+		http.Error(w, "Other maintenance is running, retry once it finishes", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	result, err := sn.CompactSuperblock(id)
+	switch {
+	case err == nil:
+	case errors.Is(err, errInvalidTarget):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errActiveSuperblock):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		log.Printf("Failed to compact superblock %d: %v", id, err)
+		http.Error(w, "Failed to compact superblock", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Failed to encode compact response: %v", err)
+	}
+}
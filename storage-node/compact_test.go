@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// seedCompactable stores chunks in superblock 0, rotates away from it and
+// deletes every other chunk, returning the surviving chunks' data
+func seedCompactable(t *testing.T, sn *StorageNode, n int) map[string][]byte {
+	live := make(map[string][]byte)
+	for i := 0; i < n; i++ {
+		chunkID := fmt.Sprintf("compact-%02d", i)
+		data := bytes.Repeat([]byte{byte('a' + i%26)}, 1000+i)
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+		live[chunkID] = data
+	}
+	sn.mu.Lock()
+	sn.currentSuperblock++
+	sn.mu.Unlock()
+
+	for i := 0; i < n; i += 2 {
+		chunkID := fmt.Sprintf("compact-%02d", i)
+		sn.deleteChunk(chunkID)
+		delete(live, chunkID)
+	}
+	return live
+}
+
+func assertChunksReadable(t *testing.T, sn *StorageNode, live map[string][]byte) {
+	t.Helper()
+	for chunkID, data := range live {
+		entry, ok := sn.lookupChunk(chunkID)
+		if !ok {
+			t.Errorf("Chunk %s missing after compaction", chunkID)
+			continue
+		}
+		if _, got, err := sn.readVerifiedChunk(entry); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Chunk %s unreadable after compaction: %v", chunkID, err)
+		}
+	}
+}
+
+func TestCompactSuperblock(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	live := seedCompactable(t, sn, 20)
+	before, _ := sn.getSuperblockSize(0)
+
+	// Readers keep going throughout the compaction
+	stop := make(chan struct{})
+	var readErrors int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for chunkID, data := range live {
+					entry, _ := sn.lookupChunk(chunkID)
+					if _, got, err := sn.readVerifiedChunk(entry); err != nil || !bytes.Equal(got, data) {
+						atomic.AddInt64(&readErrors, 1)
+					}
+				}
+			}
+		}()
+	}
+
+	result, err := sn.CompactSuperblock(0)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("Failed to compact superblock: %v", err)
+	}
+
+	liveBytes := int64(SuperblockHeaderSize)
+	for chunkID, data := range live {
+		liveBytes += frameSize(chunkID) + int64(len(data))
+	}
+	if result.LiveChunks != len(live) || result.BytesBefore != before || result.BytesAfter != liveBytes {
+		t.Errorf("Unexpected result %+v, want %d chunks and %d -> %d bytes", result, len(live), before, liveBytes)
+	}
+	if size, _ := sn.getSuperblockSize(0); size != liveBytes {
+		t.Errorf("Expected superblock of %d bytes, got %d", liveBytes, size)
+	}
+	if hdr, err := sn.readSuperblockHeader(0); err != nil || hdr.ChunkCount != uint32(len(live)) || hdr.NextOffset != liveBytes {
+		t.Errorf("Expected compacted header for %d chunks ending at %d, got %+v (%v)", len(live), liveBytes, hdr, err)
+	}
+	if dead := sn.getDeadBytes(0); dead != 0 {
+		t.Errorf("Expected no dead bytes after compaction, got %d", dead)
+	}
+	if n := atomic.LoadInt64(&readErrors); n != 0 {
+		t.Errorf("Expected reads to succeed during compaction, got %d failures", n)
+	}
+	assertChunksReadable(t, sn, live)
+
+	// The compacted offsets are persisted
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart storage node: %v", err)
+	}
+	assertChunksReadable(t, sn2, live)
+}
+
+func TestCompactSuperblockCatchesUpWrites(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	live := seedCompactable(t, sn, 10)
+	moved := []byte("chunk relocated in during the copy")
+	if err := sn.storeChunk("moved-in", moved, fmt.Sprintf("%x", sha256.Sum256(moved))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	live["moved-in"] = moved
+
+	// sn.mu isn't held during the copy: writes go on, and a chunk moved into
+	// the superblock meanwhile is copied before the swap
+	defer func(orig func(int)) { compactCopied = orig }(compactCopied)
+	compactCopied = func(id int) {
+		written := []byte("written during the copy")
+		if err := sn.storeChunk("during-copy", written, fmt.Sprintf("%x", sha256.Sum256(written))); err != nil {
+			t.Errorf("Failed to store chunk during compaction: %v", err)
+		}
+		live["during-copy"] = written
+		if _, _, err := sn.relocateChunk("moved-in", id); err != nil {
+			t.Errorf("Failed to relocate chunk during compaction: %v", err)
+		}
+	}
+
+	result, err := sn.CompactSuperblock(0)
+	if err != nil {
+		t.Fatalf("Failed to compact superblock: %v", err)
+	}
+	if result.LiveChunks != len(live)-1 {
+		t.Errorf("Expected %d live chunks including the relocated one, got %d", len(live)-1, result.LiveChunks)
+	}
+	if entry, _ := sn.lookupChunk("moved-in"); entry.SuperblockID != 0 {
+		t.Errorf("Expected the relocated chunk in superblock 0, got %d", entry.SuperblockID)
+	}
+	assertChunksReadable(t, sn, live)
+
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart storage node: %v", err)
+	}
+	assertChunksReadable(t, sn2, live)
+}
+
+func TestCompactSuperblockRefusals(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := []byte("chunk in the active superblock")
+	if err := sn.storeChunk("active-chunk", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	if _, err := sn.CompactSuperblock(sn.currentSuperblock); !errors.Is(err, errActiveSuperblock) {
+		t.Errorf("Expected errActiveSuperblock, got %v", err)
+	}
+	if _, err := sn.CompactSuperblock(42); !errors.Is(err, errInvalidTarget) {
+		t.Errorf("Expected errInvalidTarget, got %v", err)
+	}
+}
+
+func TestCompactSuperblockRecovery(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	live := seedCompactable(t, sn, 10)
+	if err := sn.saveIndex(); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	// Crash after the swap: the index save fails and the old offsets stay on disk
+	atomic.StoreInt32(&sn.readOnly, 1)
+	if _, err := sn.CompactSuperblock(0); err == nil {
+		t.Fatal("Expected the compaction to report the failed index save")
+	}
+	if _, err := os.Stat(sn.compactMapPath(0)); err != nil {
+		t.Fatalf("Expected the compaction map to be kept: %v", err)
+	}
+
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart storage node: %v", err)
+	}
+	assertChunksReadable(t, sn2, live)
+	if _, err := os.Stat(sn2.compactMapPath(0)); !os.IsNotExist(err) {
+		t.Errorf("Expected the compaction map to be removed after recovery, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Response compression configuration
+const (
+	ResponseCompressionOff  = "off"
+	ResponseCompressionGzip = "gzip"
+	ResponseCompressionZstd = "zstd"
+
+	DefaultResponseCompressionMinSize = 1024 // Smaller chunks aren't worth the CPU
+)
+
+// Compression of chunks at rest (see COMPRESSION)
+const (
+	ChunkCompressionNone = "none"
+	ChunkCompressionGzip = "gzip"
+	ChunkCompressionZstd = "zstd"
+)
+
+// Compression codes in chunk frames
+var frameCompressions = []string{1: ChunkCompressionGzip, 2: ChunkCompressionZstd}
+
+var (
+	gzipWriterPool = sync.Pool{
+		New: func() interface{} { return gzip.NewWriter(nil) },
+	}
+
+	// zstdEncoder is safe for concurrent use via EncodeAll
+	zstdEncoder, _ = zstd.NewWriter(nil)
+
+	// zstdDecoder is safe for concurrent use via DecodeAll
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// parseResponseCompression validates a RESPONSE_COMPRESSION value
+func parseResponseCompression(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", ResponseCompressionOff:
+		return ResponseCompressionOff, nil
+	case ResponseCompressionGzip:
+		return ResponseCompressionGzip, nil
+	case ResponseCompressionZstd:
+		return ResponseCompressionZstd, nil
+	default:
+		return "", fmt.Errorf("unsupported response compression %q (want zstd, gzip or off)", value)
+	}
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header allows the given
+// content coding, honoring q=0 exclusions and the "*" wildcard.
+func acceptsEncoding(header, coding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		switch name {
+		case coding:
+			return q > 0
+		case "*":
+			wildcard = q > 0
+		}
+	}
+	return wildcard
+}
+
+// negotiateResponseEncoding returns the content coding to apply to a GET
+// response body of the given size, or "" to send it uncompressed.
+func (sn *StorageNode) negotiateResponseEncoding(r *http.Request, size int) string {
+	if sn.responseCompression == ResponseCompressionOff || size < sn.responseCompressionMinSize {
+		return ""
+	}
+	if !acceptsEncoding(r.Header.Get("Accept-Encoding"), sn.responseCompression) {
+		return ""
+	}
+	return sn.responseCompression
+}
+
+// compressResponse encodes data with the given content coding
+func compressResponse(coding string, data []byte) ([]byte, error) {
+	switch coding {
+	case ResponseCompressionGzip:
+		var buf bytes.Buffer
+		zw := gzipWriterPool.Get().(*gzip.Writer)
+		defer gzipWriterPool.Put(zw)
+		zw.Reset(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case ResponseCompressionZstd:
+		return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content coding %q", coding)
+	}
+}
+
+// parseChunkCompression validates a COMPRESSION value
+func parseChunkCompression(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", ChunkCompressionNone:
+		return ChunkCompressionNone, nil
+	case ChunkCompressionGzip:
+		return ChunkCompressionGzip, nil
+	case ChunkCompressionZstd:
+		return ChunkCompressionZstd, nil
+	default:
+		return "", fmt.Errorf("unsupported compression %q (want zstd, gzip or none)", value)
+	}
+}
+
+// compressChunk compresses chunk data for storage, returning nil when that
+// wouldn't make it any smaller
+func compressChunk(codec string, data []byte) ([]byte, error) {
+	compressed, err := compressResponse(codec, data)
+	if err != nil || len(compressed) >= len(data) {
+		return nil, err
+	}
+	return compressed, nil
+}
+
+// decompressChunk restores the data of a chunk compressed at rest. Data
+// that doesn't decompress is reported as corrupt.
+func decompressChunk(codec string, stored []byte) ([]byte, error) {
+	var data []byte
+	var err error
+	switch codec {
+	case ChunkCompressionGzip:
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(stored)); err == nil {
+			data, err = io.ReadAll(zr)
+		}
+	case ChunkCompressionZstd:
+		data, err = zstdDecoder.DecodeAll(stored, nil)
+	default:
+		return nil, fmt.Errorf("unsupported chunk compression %q", codec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to %s-decompress: %v", errChunkCorrupt, codec, err)
+	}
+	return data, nil
+}
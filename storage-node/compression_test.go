@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	testCases := []struct {
+		header string
+		coding string
+		want   bool
+	}{
+		{"gzip, deflate", "gzip", true},
+		{"zstd;q=0.5, gzip", "zstd", true},
+		{"gzip;q=0", "gzip", false},
+		{"*", "zstd", true},
+		{"*, zstd;q=0", "zstd", false},
+		{"", "gzip", false},
+		{"br", "gzip", false},
+	}
+
+	for _, tc := range testCases {
+		if got := acceptsEncoding(tc.header, tc.coding); got != tc.want {
+			t.Errorf("acceptsEncoding(%q, %q) = %v, want %v", tc.header, tc.coding, got, tc.want)
+		}
+	}
+}
+
+func TestResponseCompression(t *testing.T) {
+	large := bytes.Repeat([]byte("highly compressible log line\n"), 2048)
+	tiny := []byte("tiny chunk")
+
+	decoders := map[string]func([]byte) ([]byte, error){
+		ResponseCompressionGzip: func(b []byte) ([]byte, error) {
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(zr)
+		},
+		ResponseCompressionZstd: func(b []byte) ([]byte, error) {
+			zr, err := zstd.NewReader(nil)
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			return zr.DecodeAll(b, nil)
+		},
+	}
+
+	for coding, decode := range decoders {
+		t.Run(coding, func(t *testing.T) {
+			sn, tempDir := setupTestStorageNode(t)
+			defer cleanupTestStorageNode(tempDir)
+			sn.responseCompression = coding
+			sn.responseCompressionMinSize = 1024
+
+			r := mux.NewRouter()
+			r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
+			r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+
+			for chunkID, data := range map[string][]byte{"large": large, "tiny": tiny} {
+				putReq := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader(data))
+				putW := httptest.NewRecorder()
+				r.ServeHTTP(putW, putReq)
+				if putW.Code != http.StatusCreated {
+					t.Fatalf("Failed to store chunk %s: %d", chunkID, putW.Code)
+				}
+			}
+
+			t.Run("large_chunk_compressed", func(t *testing.T) {
+				req := httptest.NewRequest("GET", "/chunk/large", nil)
+				req.Header.Set("Accept-Encoding", "gzip, zstd")
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				if w.Code != http.StatusOK {
+					t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+				}
+				if got := w.Header().Get("Content-Encoding"); got != coding {
+					t.Fatalf("Expected Content-Encoding %s, got %q", coding, got)
+				}
+				if w.Body.Len() >= len(large) {
+					t.Errorf("Expected compressed body smaller than %d bytes, got %d", len(large), w.Body.Len())
+				}
+
+				decoded, err := decode(w.Body.Bytes())
+				if err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if !bytes.Equal(decoded, large) {
+					t.Error("Decompressed data doesn't match original")
+				}
+			})
+
+			t.Run("tiny_chunk_not_compressed", func(t *testing.T) {
+				req := httptest.NewRequest("GET", "/chunk/tiny", nil)
+				req.Header.Set("Accept-Encoding", "gzip, zstd")
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				if got := w.Header().Get("Content-Encoding"); got != "" {
+					t.Errorf("Expected no Content-Encoding for tiny chunk, got %q", got)
+				}
+				if !bytes.Equal(w.Body.Bytes(), tiny) {
+					t.Error("Tiny chunk body doesn't match original")
+				}
+			})
+
+			t.Run("client_without_support_gets_identity", func(t *testing.T) {
+				req := httptest.NewRequest("GET", "/chunk/large", nil)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				if got := w.Header().Get("Content-Encoding"); got != "" {
+					t.Errorf("Expected no Content-Encoding without Accept-Encoding, got %q", got)
+				}
+				if !bytes.Equal(w.Body.Bytes(), large) {
+					t.Error("Identity body doesn't match original")
+				}
+			})
+		})
+	}
+}
+
+func TestCompressionAtRest(t *testing.T) {
+	for _, codec := range []string{ChunkCompressionGzip, ChunkCompressionZstd} {
+		t.Run(codec, func(t *testing.T) {
+			t.Setenv("COMPRESSION", codec)
+			t.Setenv("INDEX_SAVE_DELAY", "0") // one index save per write
+			sn, tempDir := setupTestStorageNode(t)
+			defer cleanupTestStorageNode(tempDir)
+			router := sn.newRouter()
+
+			data := bytes.Repeat([]byte("2026-10-16T03:00:00Z INFO request served in 3ms\n"), 1000)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/logs", bytes.NewReader(data)))
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("Expected 201, got %d", rr.Code)
+			}
+			entry, _ := sn.lookupChunk("logs")
+			if entry.Compression != codec || int(entry.RawSize) != len(data) || int(entry.Size) >= len(data) {
+				t.Fatalf("Expected a %s-compressed entry, got %+v", codec, entry)
+			}
+
+			get := func(method string, header http.Header) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, "/chunk/logs", nil)
+				for name, values := range header {
+					req.Header[name] = values
+				}
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+				return rr
+			}
+			rr = get("GET", nil)
+			if !bytes.Equal(rr.Body.Bytes(), data) {
+				t.Fatalf("Expected GET to return the original bytes")
+			}
+			if etag := rr.Header().Get("ETag"); etag != fmt.Sprintf("%x", sha256.Sum256(data)) {
+				t.Errorf("Expected the ETag to be the checksum of the original data, got %s", etag)
+			}
+			if got := rr.Header().Get("X-Chunk-Size"); got != strconv.Itoa(len(data)) {
+				t.Errorf("Expected X-Chunk-Size %d, got %s", len(data), got)
+			}
+			if got := rr.Header().Get("X-Stored-Size"); got != strconv.Itoa(int(entry.Size)) {
+				t.Errorf("Expected X-Stored-Size %d, got %s", entry.Size, got)
+			}
+			if got := get("HEAD", nil).Header().Get("Content-Length"); got != strconv.Itoa(len(data)) {
+				t.Errorf("Expected HEAD Content-Length %d, got %s", len(data), got)
+			}
+			rr = get("GET", http.Header{"Range": {"bytes=100-199"}})
+			if rr.Code != http.StatusPartialContent || !bytes.Equal(rr.Body.Bytes(), data[100:200]) {
+				t.Errorf("Expected the range to come from the original data, got %d", rr.Code)
+			}
+
+			// Data that doesn't shrink is stored as is
+			random := make([]byte, 4096)
+			rand.Read(random)
+			if err := sn.storeChunk("random", random, fmt.Sprintf("%x", sha256.Sum256(random))); err != nil {
+				t.Fatalf("Failed to store chunk: %v", err)
+			}
+			if entry, _ := sn.lookupChunk("random"); entry.Compression != "" {
+				t.Errorf("Expected incompressible data to be stored uncompressed, got %s", entry.Compression)
+			}
+
+			// Relocation moves the compressed bytes, and the frame lets a
+			// rebuild recover the chunk
+			sn.mu.Lock()
+			sn.currentSuperblock++
+			sn.mu.Unlock()
+			if _, moved, err := sn.relocateChunk("logs", sn.currentSuperblock); err != nil || moved.Size != entry.Size {
+				t.Fatalf("Failed to relocate chunk: %v", err)
+			}
+			if err := sn.RebuildIndex(); err != nil {
+				t.Fatalf("Rebuild failed: %v", err)
+			}
+			rebuilt, _ := sn.lookupChunk("logs")
+			if rebuilt.Compression != codec || rebuilt.RawSize != entry.RawSize {
+				t.Errorf("Expected the rebuilt entry to be %s-compressed, got %+v", codec, rebuilt)
+			}
+			if _, got, err := sn.readVerifiedChunk(rebuilt); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("Expected the rebuilt chunk to read back: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestInconsistentChunkAndSuperblockSize(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "storage_node_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer cleanupTestStorageNode(tempDir)
+
+	t.Setenv("MAX_SUPERBLOCK_SIZE_MB", "1")
+	t.Setenv("MAX_CHUNK_SIZE_MB", "4")
+
+	sn := NewStorageNode(tempDir, "test-node")
+	err = sn.Initialize()
+	if err == nil {
+		t.Fatal("Expected Initialize to fail when max chunk size exceeds superblock size")
+	}
+	if !strings.Contains(err.Error(), "max chunk size") {
+		t.Errorf("Expected error naming the chunk size limit, got: %v", err)
+	}
+}
+
+func TestStoreChunkLargerThanSuperblock(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	// Simulate a runtime reconfiguration that bypassed startup validation
+	sn.maxSuperblockSize = 512
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
+
+	data := bytes.Repeat([]byte("x"), 1024)
+	if err := sn.storeChunk("too-big", data, "unused"); !errors.Is(err, errChunkTooLarge) {
+		t.Errorf("Expected errChunkTooLarge, got %v", err)
+	}
+
+	req := httptest.NewRequest("PUT", "/chunk/too-big", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	if _, err := os.Stat(sn.getSuperblockPath(1)); !os.IsNotExist(err) {
+		t.Error("Expected no superblock rotation for a chunk that can never fit")
+	}
+}
+
+func TestServerMaxHeaderBytes(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	t.Setenv("SERVER_MAX_HEADER_BYTES", "1024")
+	t.Setenv("SERVER_DISABLE_KEEPALIVE", "true")
+
+	ts := httptest.NewUnstartedServer(sn.newRouter())
+	srv := newHTTPServer("", ts.Config.Handler)
+	if srv.MaxHeaderBytes != 1024 {
+		t.Fatalf("Expected MaxHeaderBytes 1024, got %d", srv.MaxHeaderBytes)
+	}
+	ts.Config = srv
+	ts.Start()
+	defer ts.Close()
+
+	t.Run("small_headers_accepted", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/ping")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if !resp.Close {
+			t.Error("Expected connection to be closed with keep-alives disabled")
+		}
+	})
+
+	t.Run("oversized_headers_rejected", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", ts.URL+"/ping", nil)
+		// net/http allows 4KB of slack on top of MaxHeaderBytes
+		req.Header.Set("X-Large-Header", strings.Repeat("h", 8*1024))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+			t.Errorf("Expected status %d, got %d", http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+		}
+	})
+
+	t.Run("invalid_limit_uses_default", func(t *testing.T) {
+		t.Setenv("SERVER_MAX_HEADER_BYTES", "12")
+		if srv := newHTTPServer("", nil); srv.MaxHeaderBytes != DefaultServerMaxHeaderBytes {
+			t.Errorf("Expected default MaxHeaderBytes %d, got %d", DefaultServerMaxHeaderBytes, srv.MaxHeaderBytes)
+		}
+	})
+}
+
+func TestListenAddress(t *testing.T) {
+	t.Run("default_all_interfaces", func(t *testing.T) {
+		t.Setenv("LISTEN_ADDR", "")
+		if addr, err := listenAddress(8081); err != nil || addr != ":8081" {
+			t.Errorf("Expected :8081, got %q (%v)", addr, err)
+		}
+	})
+
+	t.Run("ipv6", func(t *testing.T) {
+		t.Setenv("LISTEN_ADDR", "[::1]")
+		if addr, err := listenAddress(8081); err != nil || addr != "[::1]:8081" {
+			t.Errorf("Expected [::1]:8081, got %q (%v)", addr, err)
+		}
+	})
+
+	t.Run("invalid_rejected", func(t *testing.T) {
+		t.Setenv("LISTEN_ADDR", "not an address")
+		if _, err := listenAddress(8081); err == nil {
+			t.Error("Expected invalid LISTEN_ADDR to be rejected")
+		}
+	})
+
+	t.Run("loopback_only", func(t *testing.T) {
+		t.Setenv("LISTEN_ADDR", "127.0.0.1")
+		addr, err := listenAddress(0)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to listen on %s: %v", addr, err)
+		}
+		defer ln.Close()
+		go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		port := ln.Addr().(*net.TCPAddr).Port
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("Expected listener reachable on loopback: %v", err)
+		}
+		conn.Close()
+
+		// Find another interface address to probe
+		var other net.IP
+		addrs, _ := net.InterfaceAddrs()
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.To4() != nil && !ipNet.IP.IsLoopback() {
+				other = ipNet.IP
+				break
+			}
+		}
+		if other == nil {
+			t.Skip("No non-loopback interface to probe")
+		}
+
+		conn, err = net.DialTimeout("tcp", net.JoinHostPort(other.String(), strconv.Itoa(port)), time.Second)
+		if err == nil {
+			conn.Close()
+			t.Errorf("Expected listener bound to 127.0.0.1 to be unreachable on %s", other)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// limitListener caps the connections open from a listener at once, as
+// golang.org/x/net/netutil.LimitListener does. Once MAX_CONNECTIONS are open
+// Accept waits for one to close, so excess connections sit unaccepted in the
+// kernel backlog (and are refused once it fills) instead of each costing a
+// goroutine and buffers. Listeners share one limit and one count.
+type limitListener struct {
+	net.Listener
+	slots     chan struct{} // nil when unlimited
+	open      *int64
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// limitListener wraps ln to count its connections in sn.openConnections and
+// hold them to MAX_CONNECTIONS
+func (sn *StorageNode) limitListener(ln net.Listener) net.Listener {
+	return &limitListener{
+		Listener: ln,
+		slots:    sn.connSlots,
+		open:     &sn.openConnections,
+		done:     make(chan struct{}),
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-l.done:
+			return nil, net.ErrClosed
+		}
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+	atomic.AddInt64(l.open, 1)
+	return &limitConn{Conn: c, listener: l}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+func (l *limitListener) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// limitConn frees its listener slot when first closed
+type limitConn struct {
+	net.Conn
+	listener  *limitListener
+	closeOnce sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		atomic.AddInt64(c.listener.open, -1)
+		c.listener.release()
+	})
+	return err
+}
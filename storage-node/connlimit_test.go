@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxConnections(t *testing.T) {
+	t.Setenv("MAX_CONNECTIONS", "2")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ln := sn.limitListener(raw)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 3)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	// The kernel completes all three handshakes; the node accepts only two
+	for i := 0; i < 3; i++ {
+		c, err := net.Dial("tcp", raw.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		defer c.Close()
+	}
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		select {
+		case c := <-accepted:
+			conns = append(conns, c)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected connection %d to be accepted", i+1)
+		}
+	}
+	select {
+	case <-accepted:
+		t.Fatal("Expected the connection over MAX_CONNECTIONS not to be accepted")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := atomic.LoadInt64(&sn.openConnections); n != 2 {
+		t.Errorf("Expected 2 open connections, got %d", n)
+	}
+
+	rr := httptest.NewRecorder()
+	sn.handleMetrics(rr, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{"vstack_open_connections 2", "vstack_connection_limit 2"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+
+	// Closing one, even twice, frees exactly one slot
+	conns[0].Close()
+	conns[0].Close()
+	select {
+	case c := <-accepted:
+		defer c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the waiting connection to be accepted once a slot freed")
+	}
+	if n := atomic.LoadInt64(&sn.openConnections); n != 2 {
+		t.Errorf("Expected 2 open connections, got %d", n)
+	}
+	conns[1].Close()
+}
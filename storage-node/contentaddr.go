@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Errors specific to CONTENT_ADDRESSED mode
+const (
+	ErrInvalidContentAddress  = "Chunk ID must be the lowercase hex SHA-256 of the chunk data"
+	ErrContentAddressMismatch = "Chunk ID is not the SHA-256 of the chunk data"
+)
+
+// contentAddress matches chunk IDs in CONTENT_ADDRESSED mode
+var contentAddress = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// validateChunkID validates a chunk ID from a request. In CONTENT_ADDRESSED
+// mode it must be a lowercase hex SHA-256, so each content has exactly one
+// ID. Chunks read back from superblocks are checked with the package-level
+// validateChunkID, as they may predate the mode.
+func (sn *StorageNode) validateChunkID(id string) error {
+	if sn.contentAddressed && !contentAddress.MatchString(id) {
+		return &chunkIDError{Code: ChunkIDNotContentAddress, msg: ErrInvalidContentAddress}
+	}
+	return validateChunkID(id)
+}
+
+// contentAddressChecksum returns the SHA-256 a PUT's data must match in
+// CONTENT_ADDRESSED mode, which is its chunk ID. A client checksum must then
+// be that same SHA-256. Returns "" outside the mode.
+func (sn *StorageNode) contentAddressChecksum(chunkID, clientChecksum, clientAlgo string) (string, error) {
+	if !sn.contentAddressed {
+		return "", nil
+	}
+	if clientChecksum != "" && (clientAlgo != ChecksumSHA256 || strings.ToLower(clientChecksum) != chunkID) {
+		return "", fmt.Errorf("X-Chunk-Checksum must be the SHA-256 chunk ID in content-addressed mode")
+	}
+	return chunkID, nil
+}
+
+// mismatchMessage is the error for data that doesn't match its expected
+// checksum
+func (sn *StorageNode) mismatchMessage() string {
+	if sn.contentAddressed {
+		return ErrContentAddressMismatch
+	}
+	return ErrChecksumMismatch
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentAddressedPut(t *testing.T) {
+	t.Setenv("CONTENT_ADDRESSED", "true")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	small := []byte("content-addressed chunk")
+	large := bytes.Repeat([]byte("streamed content-addressed chunk "), 256) // above SmallChunkThreshold
+	address := func(data []byte) string { return fmt.Sprintf("%x", sha256.Sum256(data)) }
+	put := func(chunkID string, data []byte, checksum string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader(data))
+		if checksum != "" {
+			req.Header.Set("X-Chunk-Checksum", checksum)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name     string
+		chunkID  string
+		data     []byte
+		checksum string
+		status   int
+	}{
+		{"matching", address(small), small, "", http.StatusCreated},
+		{"matching streamed", address(large), large, "", http.StatusCreated},
+		{"mismatched", address([]byte("never stored")), small, "", http.StatusBadRequest},
+		{"mismatched streamed", address([]byte("never stored")), large, "", http.StatusBadRequest},
+		{"not hex", "chunk-1", small, "", http.StatusBadRequest},
+		{"uppercase", strings.ToUpper(address(small)), small, "", http.StatusBadRequest},
+		{"disagreeing checksum", address([]byte("other")), []byte("other"), address(small), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rr := put(tt.chunkID, tt.data, tt.checksum); rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+	if _, ok := sn.lookupChunk(address(small)); !ok {
+		t.Error("Expected the matching chunk to be stored")
+	}
+	if rr := put(address(small), large, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the existing chunk to be reported with 200, got %d", rr.Code)
+	}
+
+	// Batch items, buffered and streamed, are held to the same rule
+	sn.streamThreshold = int64(len(large) - 1)
+	var body bytes.Buffer
+	writeBatchFrame(&body, address([]byte("never stored")), small)
+	writeBatchFrame(&body, address([]byte("never stored either")), large)
+	writeBatchFrame(&body, address([]byte("batched")), []byte("batched"))
+	req := httptest.NewRequest("POST", "/chunks/batch", &body)
+	req.Header.Set("Content-Type", BatchContentType)
+	rr := httptest.NewRecorder()
+	newBatchTestRouter(sn).ServeHTTP(rr, req)
+	var resp BatchPutResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || len(resp.Results) != 3 {
+		t.Fatalf("Failed to decode batch response (%v)", err)
+	}
+	for i, want := range []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusCreated} {
+		if got := resp.Results[i]; got.Status != want {
+			t.Errorf("Expected batch item %d to get %d, got %+v", i, want, got)
+		}
+	}
+}
+
+func TestContentAddressingOffByDefault(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/chunk-1", bytes.NewReader([]byte("any data"))))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected arbitrary chunk IDs to be accepted by default, got %d", rr.Code)
+	}
+}
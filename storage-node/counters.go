@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// CountersResponse represents the /admin/counters response. POST
+// /admin/counters/reset returns the counters as they were when zeroed, so a
+// test window can be measured with a single reset at each end.
+type CountersResponse struct {
+	Counters  map[string]int64 `json:"counters"`
+	Rotations map[string]int64 `json:"rotations"` // Superblock rotations by reason
+	Requests  map[string]int64 `json:"requests"`  // "METHOD route" -> requests
+	Since     time.Time        `json:"since"`     // Startup or the last reset
+}
+
+// softCounters lists the counters /admin/counters/reset may zero. Counters
+// describing persistent state, such as index size or failed index saves
+// that are still unpersisted, are not soft and stay out of this list.
+func (sn *StorageNode) softCounters() map[string]*int64 {
+	return map[string]*int64{
+		"chunk_puts":             &sn.chunkPuts,
+		"chunk_gets":             &sn.chunkGets,
+		"chunk_deletes":          &sn.chunkDeletes,
+		"verified_reads":         &sn.verifiedReads,
+		"verify_failures":        &sn.verifyFailures,
+		"scrub_corruptions":      &sn.scrub.corruptions,
+		"panics":                 &sn.panics,
+		"large_reads":            &sn.largeReads,
+		"rejected_reads":         &sn.rejectedReads,
+		"writes_shed":            &sn.writesShed,
+		"rate_limited":           &sn.rateLimited,
+		"checksum_mismatches":    &sn.checksumMismatches,
+		"replica_copies":         &sn.replicaCopies,
+		"replica_copy_failures":  &sn.replicaCopyFailures,
+		"replications":           &sn.replicationSuccesses,
+		"replication_failures":   &sn.replicationFailures,
+		"read_repairs":           &sn.readRepairs,
+		"read_repair_failures":   &sn.readRepairFailures,
+		"superblocks_sealed_age": &sn.superblocksSealedAge,
+		"index_saves":            &sn.indexSaves,
+		"dedup_hits":             &sn.dedupHits,
+		"dedup_bytes_saved":      &sn.dedupBytesSaved,
+	}
+}
+
+// counters returns the soft counters, zeroing them if reset is set
+func (sn *StorageNode) counters(reset bool) CountersResponse {
+	load := atomic.LoadInt64
+	if reset {
+		load = func(p *int64) int64 { return atomic.SwapInt64(p, 0) }
+	}
+
+	resp := CountersResponse{
+		Counters:  make(map[string]int64),
+		Rotations: make(map[string]int64),
+		Requests:  make(map[string]int64),
+		Since:     sn.startTime.UTC(),
+	}
+	if since := atomic.LoadInt64(&sn.countersSince); since != 0 {
+		resp.Since = time.Unix(0, since).UTC()
+	}
+	for name, counter := range sn.softCounters() {
+		resp.Counters[name] = load(counter)
+	}
+
+	sn.rotations.mu.Lock()
+	for reason, n := range sn.rotations.byReason {
+		resp.Rotations[reason] = n
+	}
+	if reset {
+		sn.rotations.byReason = nil
+	}
+	sn.rotations.mu.Unlock()
+
+	sn.routeStatsMu.Lock()
+	for key, stats := range sn.routeStats {
+		resp.Requests[key] = stats.requests
+	}
+	if reset {
+		sn.routeStats = make(map[string]*routeStats)
+	}
+	sn.routeStatsMu.Unlock()
+
+	if reset {
+		// A reset panic count shouldn't leave health warning about it
+		atomic.StoreInt64(&sn.lastPanic, 0)
+		sn.panicMu.Lock()
+		sn.panicsByRoute = make(map[string]int64)
+		sn.panicMu.Unlock()
+		sn.readLatency.reset()
+		sn.writeLatency.reset()
+		atomic.StoreInt64(&sn.countersSince, time.Now().UnixNano())
+	}
+	return resp
+}
+
+func (sn *StorageNode) handleCounters(w http.ResponseWriter, r *http.Request) {
+	writeCounters(w, sn.counters(false))
+}
+
+func (sn *StorageNode) handleResetCounters(w http.ResponseWriter, r *http.Request) {
+	resp := sn.counters(true)
+	log.Printf("Counters reset (%d chunk GETs, %d PUTs since %s)",
+		resp.Counters["chunk_gets"], resp.Counters["chunk_puts"], resp.Since.Format(time.RFC3339))
+	writeCounters(w, resp)
+}
+
+func writeCounters(w http.ResponseWriter, resp CountersResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode counters response: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountersReset(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.adminToken = "secret"
+	router := sn.newRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/counted", bytes.NewReader([]byte("counted chunk"))))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", rr.Code)
+	}
+	for i := 0; i < 3; i++ {
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/counted", nil))
+	}
+
+	counters := func(method, path string) CountersResponse {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, adminRequest(method, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200 from %s %s, got %d", method, path, rr.Code)
+		}
+		var resp CountersResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode counters: %v", err)
+		}
+		return resp
+	}
+
+	before := counters("GET", "/admin/counters")
+	if before.Counters["chunk_gets"] != 3 || before.Counters["chunk_puts"] != 1 {
+		t.Errorf("Expected 3 GETs and 1 PUT counted, got %v", before.Counters)
+	}
+	if before.Requests["GET /chunk/{chunk_id}"] != 3 {
+		t.Errorf("Expected 3 requests to GET /chunk/{chunk_id}, got %v", before.Requests)
+	}
+
+	// The reset reports what it zeroed
+	reset := counters("POST", "/admin/counters/reset")
+	if reset.Counters["chunk_gets"] != 3 {
+		t.Errorf("Expected the reset to report 3 GETs, got %d", reset.Counters["chunk_gets"])
+	}
+
+	after := counters("GET", "/admin/counters")
+	for name, n := range after.Counters {
+		if n != 0 {
+			t.Errorf("Expected %s to be zero after reset, got %d", name, n)
+		}
+	}
+	if n := after.Requests["GET /chunk/{chunk_id}"]; n != 0 {
+		t.Errorf("Expected request counts to be reset, got %d", n)
+	}
+	if !after.Since.After(before.Since) {
+		t.Errorf("Expected since to move to the reset, got %v then %v", before.Since, after.Since)
+	}
+	if sn.readLatency.percentiles() != nil {
+		t.Error("Expected the read latency histogram to be reset")
+	}
+
+	// Persistent state is untouched
+	if health := sn.health(); health.ChunkCount != 1 {
+		t.Errorf("Expected the chunk to still be counted, got %d", health.ChunkCount)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// blobRef identifies stored chunk bytes, which DEDUP lets several chunk IDs
+// share
+type blobRef struct {
+	superblockID int
+	offset       int64
+}
+
+func (e ChunkEntry) blob() blobRef {
+	return blobRef{superblockID: e.SuperblockID, offset: e.Offset}
+}
+
+// unref drops an entry's reference to its bytes. Caller must hold mu for
+// writing.
+func (ci *ChunkIndex) unref(entry ChunkEntry) {
+	ref := entry.blob()
+	if ci.refs[ref] <= 1 {
+		delete(ci.refs, ref)
+		return
+	}
+	ci.refs[ref]--
+}
+
+// referenced reports whether any chunk still references an entry's bytes,
+// which must then not be reclaimed. Caller must hold mu.
+func (ci *ChunkIndex) referenced(entry ChunkEntry) bool {
+	return ci.refs[entry.blob()] > 0
+}
+
+// storeDuplicates indexes chunks whose content is already stored under
+// another ID against the existing bytes instead of writing them again,
+// returning the chunks still to be written. Candidates are found by
+// checksum, then read back and compared byte for byte, so neither a
+// checksum collision nor a damaged copy is ever shared. Caller must hold
+// sn.mu, which keeps compaction and relocation from moving the bytes.
+func (sn *StorageNode) storeDuplicates(batch []*pendingWrite) []*pendingWrite {
+	if !sn.dedup {
+		return batch
+	}
+
+	rest := batch[:0:0]
+	deduped := 0
+	now := time.Now()
+	for _, pw := range batch {
+		existing, ok := sn.findDuplicate(pw)
+		if ok {
+			_, ok = sn.linkDuplicate(pw, existing, now)
+		}
+		if !ok {
+			rest = append(rest, pw)
+			continue
+		}
+		deduped++
+	}
+
+	// Otherwise the index is saved along with the chunks still written
+	if deduped > 0 && len(rest) == 0 {
+		if err := sn.deferIndexSave(sn.indexSaveDelay); err != nil {
+			log.Printf("Warning: failed to persist index after deduplicating %d chunk(s) (first: %s): %v", deduped, batch[0].chunkID, err)
+		}
+	}
+	return rest
+}
+
+// linkDuplicate indexes pw against the bytes of existing, a stored chunk with
+// the same content, returning the new entry. It fails if existing's bytes
+// lost their last reference meanwhile. Caller must hold sn.mu.
+func (sn *StorageNode) linkDuplicate(pw *pendingWrite, existing ChunkEntry, now time.Time) (ChunkEntry, bool) {
+	entry := ChunkEntry{
+		ChunkID:      pw.chunkID,
+		SuperblockID: existing.SuperblockID,
+		Offset:       existing.Offset,
+		Size:         existing.Size,
+		Checksum:     existing.Checksum,
+		ChecksumAlgo: existing.checksumAlgorithm(),
+		StoredAt:     now,
+		StoredBy:     pw.storedBy,
+		ExpiresAt:    pw.expiresAt,
+		Meta:         pw.meta,
+		Deduplicated: existing.Deduplicated || existing.ChunkID != pw.chunkID,
+		Compression:  existing.Compression,
+		Encrypted:    existing.Encrypted,
+		RawSize:      existing.RawSize,
+	}
+
+	// Deletes drop references under the index lock, so bytes still
+	// referenced here can't be reclaimed before the new entry lands
+	sn.index.mu.Lock()
+	if !sn.index.referenced(existing) {
+		sn.index.mu.Unlock()
+		return ChunkEntry{}, false
+	}
+	sn.index.set(entry)
+	sn.recordEvents(MutationEvent{Op: EventStore, ChunkID: entry.ChunkID, Checksum: entry.Checksum, Size: entry.logicalSize(), Timestamp: now})
+	sn.index.mu.Unlock()
+	sn.flushEvents()
+	if err := sn.appendDedupLinks([]ChunkEntry{entry}); err != nil {
+		log.Printf("Warning: failed to record deduplicated chunk %s; an index rebuild won't recover it: %v", entry.ChunkID, err)
+	}
+
+	atomic.AddInt64(&sn.dedupHits, 1)
+	atomic.AddInt64(&sn.dedupBytesSaved, int64(entry.Size)+frameSize(entry.ChunkID))
+	return entry, true
+}
+
+// findDuplicate returns a stored chunk with exactly pw's content. Chunks
+// rewritten after failing verification are always written afresh.
+func (sn *StorageNode) findDuplicate(pw *pendingWrite) (ChunkEntry, bool) {
+	if pw.rewrite {
+		return ChunkEntry{}, false
+	}
+	algo := pw.checksumAlgo
+	if algo == "" {
+		algo = sn.checksumAlgo
+	}
+
+	sn.index.mu.RLock()
+	existing, ok := sn.index.lookupChecksum(pw.checksum)
+	sn.index.mu.RUnlock()
+	if !ok || existing.checksumAlgorithm() != algo || int(existing.logicalSize()) != len(pw.data) {
+		return ChunkEntry{}, false
+	}
+
+	data, release, err := sn.readChunkView(existing)
+	defer release()
+	if err != nil || !bytes.Equal(data, pw.data) {
+		return ChunkEntry{}, false
+	}
+	return existing, true
+}
+
+// storeStreamedDuplicate indexes a chunk streamed into res against an
+// existing copy of its content, if there is one, and gives up the
+// reservation. Caller must hold sn.mu.
+func (sn *StorageNode) storeStreamedDuplicate(pw *pendingWrite, res *streamReservation, checksum string) (ChunkEntry, bool) {
+	if !sn.dedup {
+		return ChunkEntry{}, false
+	}
+	existing, ok := sn.findStreamedDuplicate(pw, res, checksum)
+	if !ok {
+		return ChunkEntry{}, false
+	}
+	entry, ok := sn.linkDuplicate(pw, existing, time.Now())
+	if !ok {
+		return ChunkEntry{}, false
+	}
+	sn.releaseStream(res)
+	if err := sn.deferIndexSave(sn.indexSaveDelay); err != nil {
+		log.Printf("Warning: failed to persist index after deduplicating chunk %s: %v", pw.chunkID, err)
+	}
+	return entry, true
+}
+
+// findStreamedDuplicate is findDuplicate for a chunk streamed into res with
+// the given checksum. Its data was never held in memory, so it is compared
+// where it was written, a buffer at a time, and only against copies stored
+// unencoded. Caller must hold sn.mu.
+func (sn *StorageNode) findStreamedDuplicate(pw *pendingWrite, res *streamReservation, checksum string) (ChunkEntry, bool) {
+	if pw.rewrite {
+		return ChunkEntry{}, false
+	}
+	size := res.end - res.payload
+
+	sn.index.mu.RLock()
+	existing, ok := sn.index.lookupChecksum(checksum)
+	sn.index.mu.RUnlock()
+	if !ok || existing.encoded() || existing.checksumAlgorithm() != sn.checksumAlgo || int64(existing.Size) != size {
+		return ChunkEntry{}, false
+	}
+
+	handle, err := sn.handles.acquire(existing.SuperblockID, sn.getSuperblockPath(existing.SuperblockID))
+	if err != nil {
+		return ChunkEntry{}, false
+	}
+	defer sn.handles.release(handle)
+	stored := io.NewSectionReader(handle.file, existing.Offset, size)
+	if !sameContent(stored, io.NewSectionReader(res.file, res.payload, size)) {
+		return ChunkEntry{}, false
+	}
+	return existing, true
+}
+
+// sameContent reports whether two readers yield the same bytes
+func sameContent(a, b io.Reader) bool {
+	bufA, bufB := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		n, errA := io.ReadFull(a, bufA)
+		m, errB := io.ReadFull(b, bufB)
+		if n != m || !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false
+		}
+		if errA != nil || errB != nil {
+			return errA == errB && (errA == io.EOF || errA == io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+// DedupLink is a line of index/dedup_links.log. A deduplicated chunk has no
+// frame of its own for RebuildIndex to find, so each one is recorded here
+// with the checksum of the content it shares.
+type DedupLink struct {
+	ChunkID      string    `json:"chunk_id"`
+	Checksum     string    `json:"checksum"`
+	ChecksumAlgo string    `json:"checksum_algo"`
+	StoredAt     time.Time `json:"stored_at"`
+}
+
+func (sn *StorageNode) dedupLinksPath() string {
+	return filepath.Join(filepath.Dir(sn.indexFile), "dedup_links.log")
+}
+
+func dedupLink(entry ChunkEntry) DedupLink {
+	return DedupLink{ChunkID: entry.ChunkID, Checksum: entry.Checksum, ChecksumAlgo: entry.checksumAlgorithm(), StoredAt: entry.StoredAt}
+}
+
+// appendDedupLinks records deduplicated chunks in the dedup link log
+func (sn *StorageNode) appendDedupLinks(entries []ChunkEntry) error {
+	var lines []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(dedupLink(entry))
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	file, err := os.OpenFile(sn.dedupLinksPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(lines); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// compactDedupLinks rewrites the dedup link log with just the chunks the
+// index still holds as deduplicated, so it doesn't grow without bound
+func (sn *StorageNode) compactDedupLinks() error {
+	path := sn.dedupLinksPath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	var entries []ChunkEntry
+	sn.index.mu.RLock()
+	for _, entry := range sn.index.chunks {
+		if entry.Deduplicated {
+			entries = append(entries, entry)
+		}
+	}
+	sn.index.mu.RUnlock()
+
+	tempFile := sn.tempPath(path)
+	file, err := os.Create(tempFile)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err = enc.Encode(dedupLink(entry)); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err == nil {
+		err = sn.replaceFile(tempFile, path)
+	}
+	if err != nil {
+		os.Remove(tempFile)
+	}
+	return err
+}
+
+// restoreDedupLinks adds the deduplicated chunks recorded in the dedup link
+// log to an index rebuilt from chunk frames, pointing each at a rebuilt
+// chunk with the same content. A chunk ID framed more recently than its
+// link was written afresh since and keeps its frame. It returns how many
+// links were restored.
+func (sn *StorageNode) restoreDedupLinks(chunks map[string]ChunkEntry) int {
+	file, err := os.Open(sn.dedupLinksPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: index rebuild: deduplicated chunks not recovered: %v", err)
+		}
+		return 0
+	}
+	defer file.Close()
+
+	// Later lines supersede earlier ones for the same chunk ID
+	links := make(map[string]DedupLink)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var link DedupLink
+		if err := json.Unmarshal(scanner.Bytes(), &link); err != nil {
+			log.Printf("Warning: index rebuild: skipping unreadable dedup link: %v", err)
+			continue
+		}
+		links[link.ChunkID] = link
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Warning: index rebuild: failed to read dedup links: %v", err)
+	}
+
+	byContent := make(map[[2]string]ChunkEntry)
+	for _, entry := range chunks {
+		key := [2]string{entry.checksumAlgorithm(), entry.Checksum}
+		if existing, ok := byContent[key]; !ok || entry.ChunkID < existing.ChunkID {
+			byContent[key] = entry
+		}
+	}
+
+	restored := 0
+	for chunkID, link := range links {
+		if framed, ok := chunks[chunkID]; ok && !framed.StoredAt.Before(link.StoredAt) {
+			continue
+		}
+		target, ok := byContent[[2]string{link.ChecksumAlgo, link.Checksum}]
+		if !ok {
+			log.Printf("Warning: index rebuild: no stored copy of deduplicated chunk %s", chunkID)
+			continue
+		}
+		entry := target
+		entry.ChunkID, entry.StoredAt, entry.Deduplicated = chunkID, link.StoredAt, true
+		chunks[chunkID] = entry
+		restored++
+	}
+	return restored
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func storeTestChunk(t *testing.T, sn *StorageNode, chunkID string, data []byte) {
+	t.Helper()
+	if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+	}
+}
+
+func TestDedupOnWrite(t *testing.T) {
+	t.Setenv("DEDUP", "true")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := bytes.Repeat([]byte("shared content "), 100)
+	storeTestChunk(t, sn, "original", data)
+	before, _ := sn.getSuperblockSize(sn.currentSuperblock)
+	storeTestChunk(t, sn, "copy", data)
+	storeTestChunk(t, sn, "other", bytes.Repeat([]byte("different bytes"), 100))
+
+	original, _ := sn.lookupChunk("original")
+	copied, ok := sn.lookupChunk("copy")
+	if !ok || copied.blob() != original.blob() || !copied.Deduplicated || original.Deduplicated {
+		t.Fatalf("Expected the copy to share the original's bytes, got %+v and %+v", original, copied)
+	}
+	if other, _ := sn.lookupChunk("other"); other.blob() == original.blob() {
+		t.Error("Expected different content of the same size to be written")
+	}
+	if after, _ := sn.getSuperblockSize(sn.currentSuperblock); after <= before || sn.dedupHits != 1 {
+		t.Errorf("Expected only the different chunk to be written (%d -> %d bytes, %d dedup hits)", before, after, sn.dedupHits)
+	}
+
+	// The original's bytes outlive it while the copy references them
+	sn.deleteChunk("original")
+	if got := sn.getDeadBytes(original.SuperblockID); got != 0 {
+		t.Errorf("Expected shared bytes to stay live, got %d dead bytes", got)
+	}
+	if _, got, err := sn.readVerifiedChunk(copied); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Expected the copy to stay readable: %v", err)
+	}
+	sn.deleteChunk("copy")
+	if got := sn.getDeadBytes(original.SuperblockID); got != int64(len(data)) {
+		t.Errorf("Expected %d dead bytes once unreferenced, got %d", len(data), got)
+	}
+	if len(sn.index.refs) != 1 {
+		t.Errorf("Expected only the other chunk's bytes to be referenced, got %v", sn.index.refs)
+	}
+
+	// Once unreferenced, the bytes are never shared again
+	storeTestChunk(t, sn, "revived", data)
+	if revived, _ := sn.lookupChunk("revived"); revived.blob() == original.blob() {
+		t.Error("Expected unreferenced bytes to be written afresh")
+	}
+}
+
+func TestDedupStreamedPut(t *testing.T) {
+	t.Setenv("DEDUP", "true")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	// Well over SmallChunkThreshold, so each PUT is streamed
+	data := bytes.Repeat([]byte("streamed shared content "), 100*1024/24)
+	put := func(chunkID string, body []byte) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader(body)))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected 201 storing %s, got %d: %s", chunkID, rr.Code, rr.Body.String())
+		}
+	}
+
+	put("streamed-original", data)
+	before, _ := sn.getSuperblockSize(sn.currentSuperblock)
+	put("streamed-copy", data)
+
+	original, _ := sn.lookupChunk("streamed-original")
+	copied, ok := sn.lookupChunk("streamed-copy")
+	if !ok || copied.blob() != original.blob() || !copied.Deduplicated {
+		t.Fatalf("Expected the copy to share the original's bytes, got %+v and %+v", original, copied)
+	}
+	if after, _ := sn.getSuperblockSize(sn.currentSuperblock); after != before || sn.dedupHits != 1 {
+		t.Errorf("Expected the copy's reservation to be truncated away (%d -> %d bytes, %d dedup hits)", before, after, sn.dedupHits)
+	}
+	if _, got, err := sn.readVerifiedChunk(copied); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected the copy to be readable: %v", err)
+	}
+
+	// Same size, different bytes: written afresh
+	different := bytes.Clone(data)
+	different[len(different)-1] ^= 0xff
+	put("streamed-other", different)
+	if other, _ := sn.lookupChunk("streamed-other"); other.blob() == original.blob() {
+		t.Error("Expected different content of the same size to be written")
+	}
+}
+
+func TestDedupCompaction(t *testing.T) {
+	t.Setenv("DEDUP", "true")
+	t.Setenv("INDEX_SAVE_DELAY", "0") // one index save per write
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	shared := bytes.Repeat([]byte("deduplicated "), 200)
+	owned := bytes.Repeat([]byte("framed under its own ID "), 100)
+	storeTestChunk(t, sn, "dead", bytes.Repeat([]byte("x"), 5000))
+	storeTestChunk(t, sn, "owner", shared)
+	storeTestChunk(t, sn, "alias-b", shared)
+	storeTestChunk(t, sn, "alias-a", shared)
+	storeTestChunk(t, sn, "owned", owned)
+	storeTestChunk(t, sn, "owned-alias", owned)
+	sn.mu.Lock()
+	sn.currentSuperblock++
+	sn.mu.Unlock()
+	sn.deleteChunk("dead")
+	sn.deleteChunk("owner")
+
+	result, err := sn.CompactSuperblock(0)
+	if err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	framed := frameSize("alias-a") + int64(len(shared)) + frameSize("owned") + int64(len(owned))
+	if want := SuperblockHeaderSize + framed; result.BytesAfter != want || result.LiveChunks != 4 {
+		t.Errorf("Expected shared bytes copied once (%d bytes, 4 chunks), got %+v", want, result)
+	}
+	if got := sn.getDeadBytes(0); got != 0 {
+		t.Errorf("Expected no dead bytes after compaction, got %d", got)
+	}
+	assertChunksReadable(t, sn, map[string][]byte{"alias-a": shared, "alias-b": shared, "owned": owned, "owned-alias": owned})
+
+	// The first remaining alias took over the frame
+	a, _ := sn.lookupChunk("alias-a")
+	b, _ := sn.lookupChunk("alias-b")
+	if a.blob() != b.blob() || a.Deduplicated || !b.Deduplicated {
+		t.Errorf("Expected alias-a to own the shared bytes, got %+v and %+v", a, b)
+	}
+	if err := sn.RebuildIndex(); err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	for _, chunkID := range []string{"alias-a", "owned"} {
+		if _, ok := sn.lookupChunk(chunkID); !ok {
+			t.Errorf("Expected %s to be recovered from its frame", chunkID)
+		}
+	}
+	// Links name content, not locations, so they survive the compaction
+	assertChunksReadable(t, sn, map[string][]byte{"alias-b": shared, "owned-alias": owned})
+}
+
+func TestDedupOffByDefault(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := []byte("stored twice")
+	storeTestChunk(t, sn, "first", data)
+	storeTestChunk(t, sn, "second", data)
+	first, _ := sn.lookupChunk("first")
+	second, _ := sn.lookupChunk("second")
+	if first.blob() == second.blob() {
+		t.Error("Expected identical chunks to be stored separately without DEDUP")
+	}
+}
+
+func TestRebuildIndexRestoresDedupLinks(t *testing.T) {
+	t.Setenv("DEDUP", "true")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	shared := bytes.Repeat([]byte("shared across a rebuild "), 100)
+	storeTestChunk(t, sn, "linked-owner", shared)
+	storeTestChunk(t, sn, "linked-alias", shared)
+	if alias, _ := sn.lookupChunk("linked-alias"); !alias.Deduplicated {
+		t.Fatal("Expected the second chunk to be deduplicated")
+	}
+
+	if err := sn.RebuildIndex(); err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	alias, ok := sn.lookupChunk("linked-alias")
+	if !ok || !alias.Deduplicated {
+		t.Fatalf("Expected the rebuilt index to hold the deduplicated chunk, got %+v", alias)
+	}
+	assertChunksReadable(t, sn, map[string][]byte{"linked-owner": shared, "linked-alias": shared})
+
+	// Restarting compacts the log down to the chunks still deduplicated
+	sn.deleteChunk("linked-alias")
+	if err := sn.compactDedupLinks(); err != nil {
+		t.Fatalf("Failed to compact dedup links: %v", err)
+	}
+	if links, _ := os.ReadFile(sn.dedupLinksPath()); len(links) != 0 {
+		t.Errorf("Expected no links left after deleting the alias, got %s", links)
+	}
+}
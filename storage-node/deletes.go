@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDeleteCoalesceWindow is how long index persistence after a DELETE
+// is deferred so that a storm of deletes shares one index write (see
+// DELETE_COALESCE_WINDOW). Each save rewrites the whole index, so saving per
+// delete makes mass deletions quadratic.
+const DefaultDeleteCoalesceWindow = 50 * time.Millisecond
+
+// BatchDeleteRequest lists the chunks to delete in a batch DELETE
+type BatchDeleteRequest struct {
+	ChunkIDs []string `json:"chunk_ids"`
+}
+
+// BatchDeleteResponse represents the result of a batch DELETE
+type BatchDeleteResponse struct {
+	Results   []BatchItemResult `json:"results"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+}
+
+// deleteChunk removes a chunk from the index without persisting it. The
+// bytes stay in the superblock until it is compacted, unless the chunk was
+// the last one appended to the active superblock. Bytes deduplicated chunks
+// still share stay live.
+func (sn *StorageNode) deleteChunk(chunkID string) bool {
+	return sn.deleteChunkIf(chunkID, nil)
+}
+
+// deleteChunkIf deletes a chunk as deleteChunk does, but only if match is nil
+// or reports true for its current entry
+func (sn *StorageNode) deleteChunkIf(chunkID string, match func(ChunkEntry) bool) bool {
+	sn.index.mu.Lock()
+	entry, exists := sn.index.chunks[chunkID]
+	if exists && (match == nil || match(entry)) {
+		sn.index.remove(chunkID)
+	} else {
+		exists = false
+	}
+	shared := exists && sn.index.referenced(entry)
+	if exists {
+		sn.recordEvents(MutationEvent{Op: EventDelete, ChunkID: chunkID, Checksum: entry.Checksum, Size: entry.logicalSize(), Timestamp: time.Now()})
+	}
+	sn.index.mu.Unlock()
+	sn.flushEvents()
+	sn.readCache.Remove(chunkID)
+	if exists {
+		atomic.AddInt64(&sn.chunkDeletes, 1)
+	}
+	if exists && !shared {
+		sn.markDead(entry.SuperblockID, int64(entry.Size))
+		sn.reclaimTail(entry)
+	}
+	return exists
+}
+
+// reclaimTail shrinks the active superblock when a deleted chunk was the
+// last thing appended to it, so "write then delete the latest" workloads get
+// their space back without compaction. sn.mu keeps writers from appending
+// meanwhile. The delete is persisted before anything is truncated, so a
+// crash can't leave the saved index pointing past the end of the superblock;
+// if it can't be persisted, or the superblock header can't be read to tell
+// where the chunk's frame starts, the space is left for compaction.
+//
+// Under READ_MODE=mmap nothing is truncated: a reader still holding the
+// deleted entry would fault touching mapped pages past the new end of file.
+// Compaction reclaims the space instead, as it does for a deduplicated
+// chunk, whose frame was written under another chunk ID.
+func (sn *StorageNode) reclaimTail(entry ChunkEntry) {
+	if sn.handles.mmap || entry.Deduplicated {
+		return
+	}
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	if entry.SuperblockID != sn.currentSuperblock && (sn.fastTierDir == "" || entry.SuperblockID != sn.currentFastSuperblock) {
+		return
+	}
+	size, err := sn.getSuperblockSize(entry.SuperblockID)
+	if err != nil || entry.Offset+int64(entry.Size) != size {
+		return
+	}
+	// The chunk's frame goes too, unless the superblock predates framing. A
+	// legacy superblock may have no header yet; any other failure to read it
+	// leaves the frame's extent unknown.
+	start := entry.Offset
+	hdr, hdrErr := sn.readSuperblockHeader(entry.SuperblockID)
+	if hdrErr != nil && !os.IsNotExist(hdrErr) {
+		log.Printf("Warning: not reclaiming the tail of superblock %d: %v", entry.SuperblockID, hdrErr)
+		return
+	}
+	framed := hdrErr == nil && hdr.Version >= SuperblockVersion
+	if framed {
+		start -= frameSize(entry.ChunkID)
+	}
+
+	if err := sn.deferIndexSave(0); err != nil {
+		log.Printf("Warning: not reclaiming the tail of superblock %d, deleting chunk %s wasn't persisted: %v", entry.SuperblockID, entry.ChunkID, err)
+		return
+	}
+	if err := os.Truncate(sn.getSuperblockPath(entry.SuperblockID), start); err != nil {
+		log.Printf("Warning: failed to truncate superblock %d after deleting chunk %s: %v", entry.SuperblockID, entry.ChunkID, err)
+		return
+	}
+	if framed {
+		if hdr.ChunkCount > 0 {
+			hdr.ChunkCount--
+		}
+		hdr.NextOffset = start
+		if err := sn.writeSuperblockHeader(entry.SuperblockID, hdr); err != nil {
+			log.Printf("Warning: failed to update superblock %d header after reclaiming its tail: %v", entry.SuperblockID, err)
+		}
+	}
+	sn.invalidateSuperblockChecksum(entry.SuperblockID)
+	sn.markDead(entry.SuperblockID, -int64(entry.Size))
+	atomic.AddInt64(&sn.tailReclaimedBytes, size-start)
+}
+
+// deferIndexSave schedules an index save within window unless one is
+// already due by then, so every mutation in the window shares it. A pending
+// save due later is brought forward, letting deletes keep their shorter
+// window when writes are pending. With no window the index is saved
+// immediately and the error returned. With the index WAL the mutations are
+// already logged, so the WAL is synced instead.
+func (sn *StorageNode) deferIndexSave(window time.Duration) error {
+	if sn.index.wal != nil {
+		return sn.syncIndexWAL()
+	}
+	if window <= 0 {
+		return sn.saveIndex()
+	}
+
+	sn.saveTimerMu.Lock()
+	defer sn.saveTimerMu.Unlock()
+	due := time.Now().Add(window)
+	if sn.saveTimer == nil {
+		sn.saveTimer = time.AfterFunc(window, sn.flushDeferredSave)
+		sn.saveDue, sn.saveWindow = due, window
+	} else if due.Before(sn.saveDue) && sn.saveTimer.Stop() {
+		sn.saveTimer.Reset(window)
+		sn.saveDue, sn.saveWindow = due, window
+	}
+	return nil
+}
+
+func (sn *StorageNode) flushDeferredSave() {
+	err := sn.saveIndex()
+	if err != nil {
+		log.Printf("Warning: failed to persist deferred index save: %v", err)
+	}
+
+	// The timer stays set during the save so saves never overlap. Mutations
+	// that landed after the save's snapshot schedule the next one here.
+	sn.saveTimerMu.Lock()
+	sn.saveTimer = nil
+	window := sn.saveWindow
+	sn.saveTimerMu.Unlock()
+	if err == nil && sn.uncheckpointed() {
+		sn.deferIndexSave(window)
+	}
+}
+
+// cancelDeferredSave stops a pending deferred save, for callers about to
+// save the index themselves
+func (sn *StorageNode) cancelDeferredSave() {
+	sn.saveTimerMu.Lock()
+	defer sn.saveTimerMu.Unlock()
+	if sn.saveTimer != nil && sn.saveTimer.Stop() {
+		sn.saveTimer = nil
+	}
+}
+
+// handleBatchDelete deletes up to MaxBatchItems chunks with a single index
+// write, reporting each item's status as a batch PUT does
+func (sn *StorageNode) handleBatchDelete(w http.ResponseWriter, r *http.Request) {
+	var req BatchDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.ChunkIDs) > MaxBatchItems {
+		http.Error(w, fmt.Sprintf("Batch exceeds %d items", MaxBatchItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// One wait budget for the whole batch, as for a single DELETE
+	ctx, cancel := context.WithTimeout(r.Context(), sn.deleteWaitTimeout)
+	defer cancel()
+
+	resp := BatchDeleteResponse{Results: make([]BatchItemResult, 0, len(req.ChunkIDs))}
+	deleted := 0
+	for _, chunkID := range req.ChunkIDs {
+		result := BatchItemResult{ChunkID: chunkID, Status: http.StatusNoContent}
+		if err := sn.validateChunkID(chunkID); err != nil {
+			result.Status, result.Error, result.Code = http.StatusBadRequest, err.Error(), chunkIDErrorCode(err)
+		} else if err := sn.awaitWrite(ctx, chunkID); err != nil {
+			result.Status, result.Error = http.StatusConflict, err.Error()
+		} else if !sn.deleteChunk(chunkID) {
+			result.Status, result.Error = http.StatusNotFound, ErrChunkNotFound
+		} else {
+			deleted++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	if deleted > 0 {
+		if err := sn.deferIndexSave(0); err != nil {
+			log.Printf("Warning: failed to persist index after batch delete: %v", err)
+		}
+		log.Printf("Deleted %d chunks from index", deleted)
+	}
+
+	status, failed := batchStatus(resp.Results, http.StatusOK)
+	resp.Succeeded, resp.Failed = len(resp.Results)-failed, failed
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode batch delete response: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// seedIndex adds n index entries directly, standing in for stored chunks
+func seedIndex(sn *StorageNode, n int) []string {
+	ids := make([]string, n)
+	sn.index.mu.Lock()
+	for i := range ids {
+		ids[i] = fmt.Sprintf("storm-%06d", i)
+		sn.index.set(ChunkEntry{ChunkID: ids[i], Offset: int64(i), Size: 1, Checksum: fmt.Sprintf("%064x", i), StoredAt: time.Now()})
+	}
+	sn.index.mu.Unlock()
+	if err := sn.saveIndex(); err != nil {
+		panic(err)
+	}
+	return ids
+}
+
+func TestDeleteStormCoalescesIndexWrites(t *testing.T) {
+	if testing.Short() {
+		t.Skip("deletes 100k chunks")
+	}
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	ids := seedIndex(sn, 100000)
+	router := sn.newRouter()
+
+	// One log line per delete would dominate the run
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	before := atomic.LoadInt64(&sn.indexSaves)
+	start := time.Now()
+	for _, id := range ids {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/chunk/"+id, nil))
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected 204 deleting %s, got %d", id, rr.Code)
+		}
+	}
+	sn.Shutdown()
+	elapsed := time.Since(start)
+
+	// At most one save per coalescing window, plus the shutdown save
+	saves := atomic.LoadInt64(&sn.indexSaves) - before
+	if limit := int64(elapsed/sn.deleteCoalesceWindow) + 2; saves > limit {
+		t.Errorf("Expected at most %d index writes for 100k deletes in %v, got %d", limit, elapsed, saves)
+	}
+	t.Logf("100k deletes took %v with %d index writes", elapsed, saves)
+
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	if n := len(sn2.index.chunks); n != 0 {
+		t.Errorf("Expected deletes to be persisted, %d chunks remain after restart", n)
+	}
+}
+
+func TestDeleteIsPersistedAfterCoalescingWindow(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.deleteCoalesceWindow = 10 * time.Millisecond
+	ids := seedIndex(sn, 3)
+
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("DELETE", "/chunk/"+ids[0], nil))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", rr.Code)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sn.uncheckpointed() {
+		if time.Now().After(deadline) {
+			t.Fatal("Deferred index save never happened")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	if _, ok := sn2.index.chunks[ids[0]]; ok || len(sn2.index.chunks) != 2 {
+		t.Errorf("Expected only the deleted chunk gone after restart, have %d chunks", len(sn2.index.chunks))
+	}
+}
+
+func TestBatchDeleteWritesIndexOnce(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	ids := seedIndex(sn, MaxBatchItems)
+
+	body, _ := json.Marshal(BatchDeleteRequest{ChunkIDs: append(ids, "never-stored", "bad/id")})
+	before := atomic.LoadInt64(&sn.indexSaves)
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("POST", "/chunks/batch/delete", bytes.NewReader(body)))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413 above %d items, got %d", MaxBatchItems, rr.Code)
+	}
+
+	body, _ = json.Marshal(BatchDeleteRequest{ChunkIDs: append(ids[:MaxBatchItems-2], "never-stored", "bad/id")})
+	rr = httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("POST", "/chunks/batch/delete", bytes.NewReader(body)))
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected 207 with two items failing, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if saves := atomic.LoadInt64(&sn.indexSaves) - before; saves != 1 {
+		t.Errorf("Expected one index write for the batch, got %d", saves)
+	}
+
+	var resp BatchDeleteResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	statuses := map[int]int{}
+	for _, result := range resp.Results {
+		statuses[result.Status]++
+	}
+	if statuses[http.StatusNoContent] != MaxBatchItems-2 || statuses[http.StatusNotFound] != 1 || statuses[http.StatusBadRequest] != 1 {
+		t.Errorf("Unexpected per-item statuses: %v", statuses)
+	}
+	if resp.Succeeded != MaxBatchItems-2 || resp.Failed != 2 {
+		t.Errorf("Expected %d succeeded and 2 failed, got %d and %d", MaxBatchItems-2, resp.Succeeded, resp.Failed)
+	}
+	if n := len(sn.index.chunks); n != 2 {
+		t.Errorf("Expected 2 chunks left, got %d", n)
+	}
+}
+
+func TestDeleteReclaimsActiveSuperblockTail(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	store := func(chunkID string, data []byte) ChunkEntry {
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+		entry, _ := sn.lookupChunk(chunkID)
+		return entry
+	}
+	size := func(id int) int64 {
+		size, err := sn.getSuperblockSize(id)
+		if err != nil {
+			t.Fatalf("Failed to get superblock size: %v", err)
+		}
+		return size
+	}
+
+	first := store("tail-first", []byte("first chunk"))
+	last := store("tail-last", []byte("most recent chunk"))
+
+	t.Run("tail_delete_truncates", func(t *testing.T) {
+		sn.deleteChunk("tail-last")
+		if want := last.Offset - frameSize(last.ChunkID); size(last.SuperblockID) != want {
+			t.Errorf("Expected superblock truncated to %d bytes, got %d", want, size(last.SuperblockID))
+		}
+		if dead := sn.getDeadBytes(last.SuperblockID); dead != 0 {
+			t.Errorf("Expected no dead bytes after truncation, got %d", dead)
+		}
+
+		// The delete reached the saved index before the bytes were cut
+		persisted := NewStorageNode(tempDir, "test-node")
+		if err := persisted.loadIndex(); err != nil {
+			t.Fatalf("Failed to load index: %v", err)
+		}
+		if _, ok := persisted.index.chunks["tail-last"]; ok {
+			t.Error("Expected the delete to be persisted before the superblock was truncated")
+		}
+
+		// New writes land where the deleted chunk was and read back intact
+		data := []byte("written after truncation")
+		entry := store("tail-next", data)
+		if entry.Offset != last.Offset {
+			t.Errorf("Expected new chunk at offset %d, got %d", last.Offset, entry.Offset)
+		}
+		if _, got, err := sn.readVerifiedChunk(entry); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Failed to read chunk written after truncation: %v", err)
+		}
+	})
+
+	t.Run("non_tail_delete_leaves_file", func(t *testing.T) {
+		before := size(first.SuperblockID)
+		sn.deleteChunk("tail-first")
+		if got := size(first.SuperblockID); got != before {
+			t.Errorf("Expected superblock to stay %d bytes, got %d", before, got)
+		}
+	})
+
+	t.Run("inactive_superblock_untouched", func(t *testing.T) {
+		entry, _ := sn.lookupChunk("tail-next")
+		sn.mu.Lock()
+		sn.currentSuperblock++
+		sn.mu.Unlock()
+
+		before := size(entry.SuperblockID)
+		sn.deleteChunk("tail-next")
+		if got := size(entry.SuperblockID); got != before {
+			t.Errorf("Expected inactive superblock to stay %d bytes, got %d", before, got)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Health watch timing (see CRITICAL_DEREGISTER_AFTER)
+const (
+	MaxHealthWatchInterval = 5 * time.Second
+	DeregistrationTimeout  = 10 * time.Second
+)
+
+// deregisterNode asks the metadata service to drop this node so no reads
+// are routed to it. The service's DELETE /nodes/{id} succeeds for a node it
+// doesn't know, so any other status, 404 included, is a failure.
+func (sn *StorageNode) deregisterNode(ctx context.Context, metadataURL string) error {
+	url := fmt.Sprintf("%s/nodes/%s", metadataURL, sn.nodeID)
+
+	_, err := sn.flights.Do("deregister "+url, func() error {
+		reqCtx, cancel := context.WithTimeout(ctx, DeregistrationTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(reqCtx, "DELETE", url, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create deregistration request: %w", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("deregistration request failed: %w", err)
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusNoContent:
+		default:
+			return fmt.Errorf("deregistration failed with status: %d", resp.StatusCode)
+		}
+		atomic.StoreInt32(&sn.registered, 0)
+		return nil
+	})
+	return err
+}
+
+// startHealthWatch checks health periodically once the node is registered,
+// deregistering it after CRITICAL_DEREGISTER_AFTER of continuous critical
+// status and re-registering it once it recovers
+func (sn *StorageNode) startHealthWatch() {
+	if sn.criticalDeregisterAfter <= 0 {
+		return
+	}
+	interval := sn.criticalDeregisterAfter / 4
+	if interval > MaxHealthWatchInterval {
+		interval = MaxHealthWatchInterval
+	}
+	log.Printf("Deregistering after %v of critical health", sn.criticalDeregisterAfter)
+	sn.tasks.every("health-watch", interval, DefaultTaskJitterFraction, sn.watchHealth)
+}
+
+func (sn *StorageNode) watchHealth(ctx context.Context) {
+	critical := sn.health().Status == "critical"
+	deregistered := atomic.LoadInt32(&sn.deregistered) == 1
+
+	if !critical {
+		atomic.StoreInt64(&sn.criticalSince, 0)
+		if !deregistered {
+			return
+		}
+		if err := sn.registerNode(ctx, sn.metadataURL, sn.nodeURL); err != nil {
+			log.Printf("Failed to re-register after recovering from critical health: %v", err)
+			return
+		}
+		atomic.StoreInt32(&sn.deregistered, 0)
+		log.Printf("Health recovered, re-registered node %s with metadata service", sn.nodeID)
+		return
+	}
+
+	now := time.Now()
+	since := atomic.LoadInt64(&sn.criticalSince)
+	if since == 0 {
+		atomic.StoreInt64(&sn.criticalSince, now.UnixNano())
+		return
+	}
+	if deregistered || now.Sub(time.Unix(0, since)) < sn.criticalDeregisterAfter {
+		return
+	}
+
+	if err := sn.deregisterNode(ctx, sn.metadataURL); err != nil {
+		log.Printf("Failed to deregister after sustained critical health: %v", err)
+		return
+	}
+	atomic.StoreInt32(&sn.deregistered, 1)
+	log.Printf("WARNING: health critical for %v, deregistered node %s from metadata service",
+		now.Sub(time.Unix(0, since)).Round(time.Second), sn.nodeID)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeregisterAfterSustainedCritical(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	var mu sync.Mutex
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sn.metadataURL, sn.nodeURL = server.URL, "http://node.example:8081"
+	sn.criticalDeregisterAfter = 100 * time.Millisecond
+	atomic.StoreInt32(&sn.registered, 1)
+	ctx := context.Background()
+
+	callLog := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), calls...)
+	}
+	setCritical := func(critical bool) {
+		if critical {
+			atomic.StoreInt64(&sn.failedIndexSaves, 6)
+		} else {
+			atomic.StoreInt64(&sn.failedIndexSaves, 0)
+		}
+	}
+
+	t.Run("brief_critical_blip_ignored", func(t *testing.T) {
+		setCritical(true)
+		sn.watchHealth(ctx)
+		setCritical(false)
+		sn.watchHealth(ctx)
+		time.Sleep(150 * time.Millisecond)
+		setCritical(true)
+		sn.watchHealth(ctx)
+		if got := callLog(); len(got) != 0 {
+			t.Errorf("Expected no metadata calls for a brief critical blip, got %v", got)
+		}
+	})
+
+	t.Run("sustained_critical_deregisters", func(t *testing.T) {
+		time.Sleep(150 * time.Millisecond)
+		sn.watchHealth(ctx)
+		sn.watchHealth(ctx) // Only deregisters once
+		if got := callLog(); len(got) != 1 || got[0] != "DELETE /nodes/test-node" {
+			t.Fatalf("Expected a single deregistration, got %v", got)
+		}
+		if atomic.LoadInt32(&sn.registered) != 0 || atomic.LoadInt32(&sn.deregistered) != 1 {
+			t.Error("Expected the node to be marked deregistered")
+		}
+	})
+
+	t.Run("recovery_reregisters", func(t *testing.T) {
+		setCritical(false)
+		sn.watchHealth(ctx)
+		if got := callLog(); len(got) != 2 || got[1] != "POST /nodes/register" {
+			t.Fatalf("Expected re-registration after recovery, got %v", got)
+		}
+		if atomic.LoadInt32(&sn.registered) != 1 || atomic.LoadInt32(&sn.deregistered) != 0 {
+			t.Error("Expected the node to be registered again")
+		}
+	})
+}
+
+func TestDeregisterFailsOnNotFound(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	// A metadata service without the endpoint answers 404
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	atomic.StoreInt32(&sn.registered, 1)
+
+	if err := sn.deregisterNode(context.Background(), server.URL); err == nil {
+		t.Error("Expected a 404 to fail deregistration")
+	}
+	if atomic.LoadInt32(&sn.registered) != 1 {
+		t.Error("Expected the node to stay registered after a failed deregistration")
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultDrainRateLimit bounds how fast a drain copies data (bytes/sec) so it
+// doesn't starve client I/O
+const DefaultDrainRateLimit = 20 * 1024 * 1024
+
+// MaxDrainPasses bounds how often a drain rescans for chunks that changed
+// while it was relocating them
+const MaxDrainPasses = 5
+
+// Drain states
+const (
+	DrainRunning   = "running"
+	DrainCompleted = "completed"
+	DrainFailed    = "failed"
+)
+
+// DrainStatus reports the progress of draining a superblock
+type DrainStatus struct {
+	SuperblockID int        `json:"superblock_id"`
+	State        string     `json:"state"`
+	ChunksTotal  int        `json:"chunks_total"`
+	ChunksMoved  int        `json:"chunks_moved"`
+	BytesMoved   int64      `json:"bytes_moved"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+func (sn *StorageNode) getSuperblockDrainPath(id int) string {
+	return filepath.Join(sn.dataDir, "data", fmt.Sprintf("superblock_%d.drain", id))
+}
+
+// chunksInSuperblock returns the IDs of all live chunks stored in a superblock
+func (sn *StorageNode) chunksInSuperblock(id int) []string {
+	sn.index.mu.RLock()
+	defer sn.index.mu.RUnlock()
+
+	var ids []string
+	for chunkID, entry := range sn.index.chunks {
+		if entry.SuperblockID == id {
+			ids = append(ids, chunkID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// startDrain begins draining a superblock in the background. The drain
+// marker is persisted first so an interrupted drain resumes on restart.
+func (sn *StorageNode) startDrain(id int) (DrainStatus, error) {
+	if _, err := os.Stat(sn.getSuperblockPath(id)); err != nil {
+		return DrainStatus{}, fmt.Errorf("%w: %d", errInvalidTarget, id)
+	}
+
+	sn.drainMu.Lock()
+	if status, ok := sn.drains[id]; ok && status.State == DrainRunning {
+		sn.drainMu.Unlock()
+		return *status, nil
+	}
+	status := &DrainStatus{
+		SuperblockID: id,
+		State:        DrainRunning,
+		StartedAt:    time.Now(),
+	}
+	sn.drains[id] = status
+	sn.drainMu.Unlock()
+
+	if err := os.WriteFile(sn.getSuperblockDrainPath(id), nil, 0644); err != nil {
+		log.Printf("Warning: failed to persist drain marker for superblock %d: %v", id, err)
+	}
+
+	// Stop writing new chunks into the superblock being drained
+	sn.mu.Lock()
+	if sn.currentSuperblock == id {
+		size, _ := sn.getSuperblockSize(id)
+		sn.rotateSuperblock(&sn.currentSuperblock, size, RotationDrain)
+	}
+	if sn.fastTierDir != "" && sn.currentFastSuperblock == id {
+		size, _ := sn.getSuperblockSize(id)
+		sn.rotateSuperblock(&sn.currentFastSuperblock, size, RotationDrain)
+	}
+	sn.mu.Unlock()
+
+	go sn.runDrain(status)
+	return sn.getDrainStatus(id)
+}
+
+// resumeDrains restarts drains that were interrupted by a shutdown or crash
+func (sn *StorageNode) resumeDrains() {
+	files, err := os.ReadDir(filepath.Join(sn.dataDir, "data"))
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "superblock_") || !strings.HasSuffix(file.Name(), ".drain") {
+			continue
+		}
+		idStr := strings.TrimSuffix(strings.TrimPrefix(file.Name(), "superblock_"), ".drain")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		log.Printf("Resuming drain of superblock %d", id)
+		if _, err := sn.startDrain(id); err != nil {
+			log.Printf("Warning: failed to resume drain of superblock %d: %v", id, err)
+			os.Remove(sn.getSuperblockDrainPath(id))
+		}
+	}
+}
+
+// runDrain relocates every live chunk out of a superblock, rate limited to
+// sn.drainRateLimit bytes/sec, and removes the superblock once it is empty.
+// It waits for the maintenance gate first; a drain still waiting at shutdown
+// keeps its marker and resumes on restart.
+func (sn *StorageNode) runDrain(status *DrainStatus) {
+	id := status.SuperblockID
+	release, err := sn.maintenance.acquire(sn.tasks.ctx, MaintenanceDrain)
+	if err != nil {
+		return
+	}
+	defer release()
+
+	start := time.Now()
+	var moved int64
+
+	for pass := 0; pass < MaxDrainPasses; pass++ {
+		chunkIDs := sn.chunksInSuperblock(id)
+		if len(chunkIDs) == 0 {
+			break
+		}
+
+		sn.drainMu.Lock()
+		if pass == 0 {
+			status.ChunksTotal = len(chunkIDs)
+		}
+		sn.drainMu.Unlock()
+
+		for _, chunkID := range chunkIDs {
+			entry, err := sn.drainChunk(chunkID, id)
+			if err != nil {
+				if errors.Is(err, errChunkNotFound) || errors.Is(err, errChunkChanged) {
+					continue // Deleted or rewritten meanwhile; rescanned next pass
+				}
+				sn.finishDrain(status, err)
+				return
+			}
+
+			moved += int64(entry.Size)
+			sn.drainMu.Lock()
+			status.ChunksMoved++
+			status.BytesMoved = moved
+			sn.drainMu.Unlock()
+
+			if sn.drainRateLimit > 0 {
+				expected := time.Duration(float64(moved) / float64(sn.drainRateLimit) * float64(time.Second))
+				if elapsed := time.Since(start); elapsed < expected {
+					time.Sleep(expected - elapsed)
+				}
+			}
+		}
+	}
+
+	if remaining := len(sn.chunksInSuperblock(id)); remaining > 0 {
+		sn.finishDrain(status, fmt.Errorf("%d chunk(s) still live after %d passes", remaining, MaxDrainPasses))
+		return
+	}
+
+	sn.finishDrain(status, sn.removeSuperblock(id))
+}
+
+// drainChunk relocates one chunk into the active superblock, rotating when
+// the active superblock has no room left
+func (sn *StorageNode) drainChunk(chunkID string, from int) (ChunkEntry, error) {
+	for {
+		sn.mu.Lock()
+		target := sn.currentSuperblock
+		sn.mu.Unlock()
+
+		old, _, err := sn.relocateChunk(chunkID, target)
+		if errors.Is(err, errSameSuperblock) && old.SuperblockID != from {
+			return old, errChunkChanged
+		}
+		if !errors.Is(err, errTargetFull) {
+			return old, err
+		}
+
+		sn.mu.Lock()
+		if sn.currentSuperblock == target {
+			size, _ := sn.getSuperblockSize(target)
+			sn.rotateSuperblock(&sn.currentSuperblock, size, RotationFull)
+			log.Printf("Rotated to new superblock %d while draining superblock %d", sn.currentSuperblock, from)
+		}
+		sn.mu.Unlock()
+	}
+}
+
+// removeSuperblock deletes an empty superblock and its metadata
+func (sn *StorageNode) removeSuperblock(id int) error {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	if len(sn.chunksInSuperblock(id)) > 0 {
+		return fmt.Errorf("superblock %d is not empty", id)
+	}
+	if sn.streaming[id] > 0 {
+		return fmt.Errorf("superblock %d has a chunk streaming into it", id)
+	}
+	if err := os.Remove(sn.getSuperblockPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove superblock: %w", err)
+	}
+	sn.handles.invalidate(id)
+	os.Remove(sn.getSuperblockHeaderPath(id))
+	sn.invalidateSuperblockChecksum(id)
+
+	sn.deadMu.Lock()
+	delete(sn.deadBytes, id)
+	sn.deadMu.Unlock()
+
+	return syncDir(filepath.Dir(sn.getSuperblockPath(id)))
+}
+
+func (sn *StorageNode) finishDrain(status *DrainStatus, err error) {
+	now := time.Now()
+
+	sn.drainMu.Lock()
+	status.FinishedAt = &now
+	if err != nil {
+		status.State = DrainFailed
+		status.Error = err.Error()
+	} else {
+		status.State = DrainCompleted
+	}
+	sn.drainMu.Unlock()
+
+	if err != nil {
+		// Keep the marker so the drain resumes on restart
+		log.Printf("Drain of superblock %d failed after moving %d chunk(s): %v", status.SuperblockID, status.ChunksMoved, err)
+		return
+	}
+	os.Remove(sn.getSuperblockDrainPath(status.SuperblockID))
+	log.Printf("Drained superblock %d: moved %d chunk(s), %d bytes", status.SuperblockID, status.ChunksMoved, status.BytesMoved)
+}
+
+// getDrainStatus returns a snapshot of a superblock's drain progress
+func (sn *StorageNode) getDrainStatus(id int) (DrainStatus, error) {
+	sn.drainMu.Lock()
+	defer sn.drainMu.Unlock()
+
+	status, ok := sn.drains[id]
+	if !ok {
+		return DrainStatus{}, fmt.Errorf("no drain for superblock %d", id)
+	}
+	return *status, nil
+}
+
+func (sn *StorageNode) handleDrainSuperblock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 0 {
+		http.Error(w, "Invalid superblock ID", http.StatusBadRequest)
+		return
+	}
+
+	status, err := sn.startDrain(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Failed to encode drain status: %v", err)
+	}
+}
+
+func (sn *StorageNode) handleDrainStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 0 {
+		http.Error(w, "Invalid superblock ID", http.StatusBadRequest)
+		return
+	}
+
+	status, err := sn.getDrainStatus(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Failed to encode drain status: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDrainSuperblock(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.maxSuperblockSize = 1024
+	sn.drainRateLimit = 0
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+	r.HandleFunc("/admin/superblocks/{id}/drain", sn.handleDrainSuperblock).Methods("POST")
+	r.HandleFunc("/admin/superblocks/{id}/drain", sn.handleDrainStatus).Methods("GET")
+
+	// Two chunks in superblock 0, one in superblock 1
+	data := bytes.Repeat([]byte("d"), 400)
+	chunkIDs := []string{"drain-a", "drain-b", "drain-c"}
+	for _, chunkID := range chunkIDs {
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/admin/superblocks/0/drain", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	// Poll the status endpoint until the drain finishes
+	var status DrainStatus
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		statusReq := httptest.NewRequest("GET", "/admin/superblocks/0/drain", nil)
+		statusW := httptest.NewRecorder()
+		r.ServeHTTP(statusW, statusReq)
+		if statusW.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, statusW.Code)
+		}
+		if err := json.NewDecoder(statusW.Body).Decode(&status); err != nil {
+			t.Fatalf("Failed to decode drain status: %v", err)
+		}
+		if status.State != DrainRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Drain did not finish: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status.State != DrainCompleted {
+		t.Fatalf("Expected drain to complete, got %+v", status)
+	}
+	if status.ChunksMoved != 2 || status.BytesMoved != int64(2*len(data)) {
+		t.Errorf("Unexpected drain progress %+v", status)
+	}
+
+	if _, err := os.Stat(sn.getSuperblockPath(0)); !os.IsNotExist(err) {
+		t.Errorf("Expected superblock 0 to be removed, stat error: %v", err)
+	}
+	if _, err := os.Stat(sn.getSuperblockDrainPath(0)); !os.IsNotExist(err) {
+		t.Errorf("Expected drain marker to be removed, stat error: %v", err)
+	}
+
+	for _, chunkID := range chunkIDs {
+		sn.index.mu.RLock()
+		entry := sn.index.chunks[chunkID]
+		sn.index.mu.RUnlock()
+		if entry.SuperblockID == 0 {
+			t.Errorf("Chunk %s still in drained superblock", chunkID)
+		}
+
+		getReq := httptest.NewRequest("GET", "/chunk/"+chunkID, nil)
+		getW := httptest.NewRecorder()
+		r.ServeHTTP(getW, getReq)
+		if getW.Code != http.StatusOK || !bytes.Equal(getW.Body.Bytes(), data) {
+			t.Errorf("Failed to read drained chunk %s: %d", chunkID, getW.Code)
+		}
+	}
+
+	t.Run("missing_superblock_rejected", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/admin/superblocks/0/drain", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestDrainResumesAfterRestart(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.maxSuperblockSize = 1024
+
+	data := bytes.Repeat([]byte("e"), 400)
+	for _, chunkID := range []string{"resume-a", "resume-b", "resume-c"} {
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+	}
+
+	// Simulate a drain interrupted before it moved anything
+	if err := os.WriteFile(sn.getSuperblockDrainPath(0), nil, 0644); err != nil {
+		t.Fatalf("Failed to write drain marker: %v", err)
+	}
+
+	t.Setenv("MAX_SUPERBLOCK_SIZE_MB", "1")
+	t.Setenv("MAX_CHUNK_SIZE_MB", "1")
+	t.Setenv("DRAIN_RATE_LIMIT_MB", "0")
+	restarted := NewStorageNode(tempDir, "test-node")
+	if err := restarted.Initialize(); err != nil {
+		t.Fatalf("Failed to restart storage node: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := restarted.getDrainStatus(0)
+		if err != nil {
+			t.Fatalf("Expected drain to resume: %v", err)
+		}
+		if status.State == DrainCompleted {
+			break
+		}
+		if status.State == DrainFailed || time.Now().After(deadline) {
+			t.Fatalf("Resumed drain did not complete: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if chunks := restarted.chunksInSuperblock(0); len(chunks) != 0 {
+		t.Errorf("Expected superblock 0 to be empty, still holds %v", chunks)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ChunkEncryptionKeySize is the length of ENCRYPTION_KEY once hex-decoded,
+// selecting AES-256
+const ChunkEncryptionKeySize = 32
+
+// errNoEncryptionKey indicates an encrypted chunk was read by a node started
+// without ENCRYPTION_KEY
+var errNoEncryptionKey = errors.New("chunk is encrypted but ENCRYPTION_KEY is not set")
+
+// parseEncryptionKey builds the AES-256-GCM cipher for an ENCRYPTION_KEY
+// value, returning nil when the value is empty
+func parseEncryptionKey(value string) (cipher.AEAD, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("ENCRYPTION_KEY must be hex-encoded: %v", err)
+	}
+	if len(key) != ChunkEncryptionKeySize {
+		return nil, fmt.Errorf("ENCRYPTION_KEY must be %d bytes (%d hex characters), got %d bytes",
+			ChunkEncryptionKeySize, 2*ChunkEncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptChunk seals chunk data for storage. The stored payload is a fresh
+// random nonce followed by the ciphertext and its authentication tag.
+func encryptChunk(aead cipher.AEAD, data []byte) ([]byte, error) {
+	sealed := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(sealed); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(sealed, sealed, data, nil), nil
+}
+
+// decryptChunk opens a payload written by encryptChunk into a new buffer.
+// Payloads that fail authentication are reported as corrupt.
+func decryptChunk(aead cipher.AEAD, stored []byte) ([]byte, error) {
+	if aead == nil {
+		return nil, errNoEncryptionKey
+	}
+	if len(stored) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("%w: encrypted payload of %d bytes is too short", errChunkCorrupt, len(stored))
+	}
+	nonce, sealed := stored[:aead.NonceSize()], stored[aead.NonceSize():]
+	data, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt: %v", errChunkCorrupt, err)
+	}
+	return data, nil
+}
+
+// decodeChunk restores a chunk's data from its stored payload, decrypting
+// and then decompressing as recorded for it
+func (sn *StorageNode) decodeChunk(compression string, encrypted bool, stored []byte) ([]byte, error) {
+	data := stored
+	if encrypted {
+		var err error
+		if data, err = decryptChunk(sn.chunkCipher, data); err != nil {
+			return nil, err
+		}
+	}
+	if compression != "" {
+		return decompressChunk(compression, data)
+	}
+	return data, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testEncryptionKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func TestEncryptionAtRest(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", testEncryptionKey)
+	t.Setenv("COMPRESSION", ChunkCompressionZstd)
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	data := bytes.Repeat([]byte("confidential patient record 0042\n"), 200)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/secret", bytes.NewReader(data)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", rr.Code)
+	}
+	entry, _ := sn.lookupChunk("secret")
+	if !entry.Encrypted || entry.Compression != ChunkCompressionZstd || int(entry.RawSize) != len(data) {
+		t.Fatalf("Expected a compressed, encrypted entry, got %+v", entry)
+	}
+	if entry.Checksum != fmt.Sprintf("%x", sha256.Sum256(data)) {
+		t.Errorf("Expected the checksum of the plaintext, got %s", entry.Checksum)
+	}
+
+	superblock, err := os.ReadFile(sn.getSuperblockPath(entry.SuperblockID))
+	if err != nil {
+		t.Fatalf("Failed to read superblock: %v", err)
+	}
+	if bytes.Contains(superblock, []byte("confidential")) {
+		t.Error("Expected no plaintext in the superblock")
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/secret", nil))
+	if !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Fatal("Expected GET to return the plaintext")
+	}
+	if etag := rr.Header().Get("ETag"); etag != entry.Checksum {
+		t.Errorf("Expected the ETag %s, got %s", entry.Checksum, etag)
+	}
+
+	// Two copies of the same data never share ciphertext
+	if err := sn.storeChunk("secret-copy", data, entry.Checksum); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	copied, _ := sn.lookupChunk("secret-copy")
+	first, _ := sn.readStoredChunk(entry)
+	second, _ := sn.readStoredChunk(copied)
+	if bytes.Equal(first[:sn.chunkCipher.NonceSize()], second[:sn.chunkCipher.NonceSize()]) || bytes.Equal(first, second) {
+		t.Error("Expected each chunk to be sealed with its own nonce")
+	}
+
+	// The frame records the encryption, so a rebuild can decrypt
+	if err := sn.RebuildIndex(); err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	rebuilt, _ := sn.lookupChunk("secret")
+	if !rebuilt.Encrypted || rebuilt.RawSize != entry.RawSize {
+		t.Errorf("Expected the rebuilt entry to be encrypted, got %+v", rebuilt)
+	}
+	if _, got, err := sn.readVerifiedChunk(rebuilt); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected the rebuilt chunk to read back: %v", err)
+	}
+
+	// Tampering fails authentication
+	file, err := os.OpenFile(sn.getSuperblockPath(entry.SuperblockID), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open superblock: %v", err)
+	}
+	file.WriteAt([]byte{first[len(first)-1] ^ 0xff}, entry.Offset+int64(entry.Size)-1)
+	file.Close()
+	sn.handles.invalidate(entry.SuperblockID)
+	if _, err := sn.readChunk(entry); !errors.Is(err, errChunkCorrupt) {
+		t.Errorf("Expected tampered ciphertext to read as corrupt, got %v", err)
+	}
+
+	// A node without the key can't read the chunk
+	sn.chunkCipher = nil
+	if _, err := sn.readChunk(copied); !errors.Is(err, errNoEncryptionKey) {
+		t.Errorf("Expected %v without a key, got %v", errNoEncryptionKey, err)
+	}
+}
+
+func TestEncryptionKeyValidation(t *testing.T) {
+	testCases := map[string]string{
+		"too_short": testEncryptionKey[:32],
+		"not_hex":   strings.Repeat("zz", 32),
+	}
+	for name, key := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("ENCRYPTION_KEY", key)
+			tempDir := t.TempDir()
+			sn := NewStorageNode(tempDir, "test-node")
+			if err := sn.Initialize(); err == nil || !strings.Contains(err.Error(), "ENCRYPTION_KEY") {
+				t.Errorf("Expected Initialize to reject the key, got %v", err)
+			}
+			if _, err := os.Stat(sn.indexFile); err == nil {
+				t.Error("Expected nothing to be written with an invalid key")
+			}
+		})
+	}
+}
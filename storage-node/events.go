@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Mutation event log configuration
+const (
+	DefaultEventLogMaxSize = 64 * 1024 * 1024 // Rotate events.log beyond this size
+	EventBufferSize        = 10000            // Recent events kept in memory for /events
+	MaxEventsPerPoll       = 1000
+	MaxEventPollTimeout    = 30 * time.Second
+)
+
+// Mutation event operations
+const (
+	EventStore  = "store"
+	EventDelete = "delete"
+)
+
+// MutationEvent records a chunk being stored or deleted
+type MutationEvent struct {
+	Seq       uint64    `json:"seq"`
+	Op        string    `json:"op"`
+	ChunkID   string    `json:"chunk_id"`
+	Checksum  string    `json:"checksum"`
+	Size      int32     `json:"size"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EventsResponse represents a page of the mutation feed
+type EventsResponse struct {
+	Events  []MutationEvent `json:"events"`
+	NextSeq uint64          `json:"next_seq"`
+}
+
+// eventLog is an append-only JSON lines log of mutations with sequence
+// numbers, plus an in-memory tail that long-polling consumers read from.
+// Events are sequenced and buffered by record, which callers may invoke
+// under other locks, and written to disk by flush.
+type eventLog struct {
+	mu     sync.Mutex
+	path   string
+	seq    uint64          // Last assigned sequence number
+	recent []MutationEvent // Ring of up to EventBufferSize most recent events
+	oldest int             // Index of the oldest event in recent once it is full
+	queued [][]byte        // Encoded events not yet written to the file
+	notify chan struct{}   // Closed and replaced whenever events are appended
+
+	writeMu sync.Mutex // Serializes flushes so lines land in sequence order
+	file    *os.File
+	size    int64
+	maxSize int64
+}
+
+// openEventLog opens (or creates) the event log at path, resuming the
+// sequence from its last entry
+func openEventLog(path string, maxSize int64) (*eventLog, error) {
+	l := &eventLog{path: path, maxSize: maxSize, notify: make(chan struct{})}
+
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var event MutationEvent
+			if json.Unmarshal(scanner.Bytes(), &event) == nil {
+				l.remember(event)
+			}
+		}
+		file.Close()
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat event log: %w", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return l, nil
+}
+
+func (l *eventLog) remember(event MutationEvent) {
+	l.seq = event.Seq
+	if len(l.recent) < EventBufferSize {
+		l.recent = append(l.recent, event)
+		return
+	}
+	l.recent[l.oldest] = event
+	l.oldest = (l.oldest + 1) % len(l.recent)
+}
+
+// at returns the i-th oldest buffered event
+func (l *eventLog) at(i int) MutationEvent {
+	return l.recent[(l.oldest+i)%len(l.recent)]
+}
+
+// record assigns sequence numbers to events, makes them visible to
+// consumers and queues them for flush. It does no I/O.
+func (l *eventLog) record(events ...MutationEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, event := range events {
+		event.Seq = l.seq + 1
+		line, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Warning: failed to encode mutation event: %v", err)
+			continue
+		}
+		l.queued = append(l.queued, append(line, '\n'))
+		l.remember(event)
+	}
+
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// flush writes queued events to the log, rotating it as it fills
+func (l *eventLog) flush() {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	l.mu.Lock()
+	lines := l.queued
+	l.queued = nil
+	l.mu.Unlock()
+
+	for _, line := range lines {
+		if l.size+int64(len(line)) > l.maxSize {
+			if err := l.rotate(); err != nil {
+				log.Printf("Warning: failed to rotate event log: %v", err)
+			}
+		}
+		n, err := l.file.Write(line)
+		l.size += int64(n)
+		if err != nil {
+			log.Printf("Warning: failed to write mutation event: %v", err)
+		}
+	}
+}
+
+// rotate moves the current log to events.log.1, replacing any older one.
+// If the rename fails the current log is kept and appended to.
+func (l *eventLog) rotate() error {
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file = file
+	l.size = 0
+	return nil
+}
+
+// since returns buffered events after seq (at most limit), a channel closed
+// on the next append, and whether events after seq were already dropped
+// from the buffer
+func (l *eventLog) since(seq uint64, limit int) ([]MutationEvent, <-chan struct{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.recent) > 0 && seq+1 < l.at(0).Seq {
+		return nil, l.notify, true
+	}
+
+	var events []MutationEvent
+	for i := range l.recent {
+		if event := l.at(i); event.Seq > seq {
+			events = append(events, event)
+			if len(events) == limit {
+				break
+			}
+		}
+	}
+	return events, l.notify, false
+}
+
+func (l *eventLog) close() error {
+	l.flush()
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	if err := l.file.Sync(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// recordEvents sequences mutation events if the event log is enabled.
+// Callers record under sn.index.mu, so events are ordered consistently with
+// the index, and call flushEvents once they've released it.
+func (sn *StorageNode) recordEvents(events ...MutationEvent) {
+	if sn.events == nil || len(events) == 0 {
+		return
+	}
+	sn.events.record(events...)
+}
+
+// flushEvents writes recorded events to the event log
+func (sn *StorageNode) flushEvents() {
+	if sn.events != nil {
+		sn.events.flush()
+	}
+}
+
+// handleEvents serves the mutation feed. With no events after ?since=<seq>
+// it long-polls until one arrives or ?timeout (seconds, max 30) expires.
+func (sn *StorageNode) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if sn.events == nil {
+		http.Error(w, "Event log disabled", http.StatusNotFound)
+		return
+	}
+
+	var since uint64
+	if param := r.URL.Query().Get("since"); param != "" {
+		var err error
+		if since, err = strconv.ParseUint(param, 10, 64); err != nil {
+			http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	timeout := MaxEventPollTimeout
+	if param := r.URL.Query().Get("timeout"); param != "" {
+		secs, err := strconv.Atoi(param)
+		if err != nil || secs < 0 {
+			http.Error(w, "Invalid timeout parameter", http.StatusBadRequest)
+			return
+		}
+		if d := time.Duration(secs) * time.Second; d < timeout {
+			timeout = d
+		}
+	}
+
+	events, notify, dropped := sn.events.since(since, MaxEventsPerPoll)
+	if dropped {
+		http.Error(w, "Events after the requested sequence are no longer buffered", http.StatusGone)
+		return
+	}
+	if len(events) == 0 && timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-notify:
+			events, _, _ = sn.events.since(since, MaxEventsPerPoll)
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	next := since
+	if len(events) > 0 {
+		next = events[len(events)-1].Seq
+	} else {
+		events = []MutationEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(EventsResponse{Events: events, NextSeq: next}); err != nil {
+		log.Printf("Failed to encode events response: %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func setupEventLogNode(t *testing.T) (*StorageNode, string) {
+	t.Setenv("EVENT_LOG", "true")
+	return setupTestStorageNode(t)
+}
+
+func TestMutationEventLog(t *testing.T) {
+	sn, tempDir := setupEventLogNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleDeleteChunk).Methods("DELETE")
+	r.HandleFunc("/events", sn.handleEvents).Methods("GET")
+
+	for _, chunkID := range []string{"event-a", "event-b"} {
+		data := []byte("event log chunk " + chunkID)
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	}
+	req := httptest.NewRequest("DELETE", "/chunk/event-a", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	expected := []struct {
+		op      string
+		chunkID string
+	}{
+		{EventStore, "event-a"},
+		{EventStore, "event-b"},
+		{EventDelete, "event-a"},
+	}
+
+	t.Run("log_file", func(t *testing.T) {
+		file, err := os.Open(filepath.Join(tempDir, "logs", "events.log"))
+		if err != nil {
+			t.Fatalf("Failed to open event log: %v", err)
+		}
+		defer file.Close()
+
+		var events []MutationEvent
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var event MutationEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				t.Fatalf("Invalid event line %q: %v", scanner.Text(), err)
+			}
+			events = append(events, event)
+		}
+
+		if len(events) != len(expected) {
+			t.Fatalf("Expected %d events, got %d", len(expected), len(events))
+		}
+		for i, want := range expected {
+			got := events[i]
+			if got.Seq != uint64(i+1) || got.Op != want.op || got.ChunkID != want.chunkID {
+				t.Errorf("Event %d: expected #%d %s %s, got #%d %s %s", i, i+1, want.op, want.chunkID, got.Seq, got.Op, got.ChunkID)
+			}
+			if got.Checksum == "" || got.Size == 0 || got.Timestamp.IsZero() {
+				t.Errorf("Event %d is missing details: %+v", i, got)
+			}
+		}
+	})
+
+	t.Run("feed_since", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/events?since=1", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var resp EventsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode events: %v", err)
+		}
+		if len(resp.Events) != 2 || resp.Events[0].Seq != 2 || resp.NextSeq != 3 {
+			t.Errorf("Unexpected feed page %+v", resp)
+		}
+	})
+
+	t.Run("long_poll_wakes_on_mutation", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			data := []byte("late event chunk")
+			sn.storeChunk("event-c", data, fmt.Sprintf("%x", sha256.Sum256(data)))
+		}()
+
+		start := time.Now()
+		req := httptest.NewRequest("GET", "/events?since=3&timeout=5", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var resp EventsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode events: %v", err)
+		}
+		if len(resp.Events) != 1 || resp.Events[0].ChunkID != "event-c" {
+			t.Errorf("Expected the new store event, got %+v", resp)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Long poll returned after %v, expected to wake on the mutation", elapsed)
+		}
+	})
+
+	t.Run("sequence_resumes_after_restart", func(t *testing.T) {
+		sn.Shutdown()
+		restarted := NewStorageNode(tempDir, "test-node")
+		if err := restarted.Initialize(); err != nil {
+			t.Fatalf("Failed to restart storage node: %v", err)
+		}
+		defer restarted.Shutdown()
+
+		data := []byte("after restart")
+		restarted.storeChunk("event-d", data, fmt.Sprintf("%x", sha256.Sum256(data)))
+		events, _, _ := restarted.events.since(4, 10)
+		if len(events) != 1 || events[0].Seq != 5 {
+			t.Errorf("Expected sequence to resume at 5, got %+v", events)
+		}
+	})
+}
+
+func TestEventLogRotation(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "events.log")
+
+	l, err := openEventLog(path, 512)
+	if err != nil {
+		t.Fatalf("Failed to open event log: %v", err)
+	}
+	defer l.close()
+
+	for i := 0; i < 20; i++ {
+		l.record(MutationEvent{Op: EventStore, ChunkID: fmt.Sprintf("rotate-%d", i), Checksum: "abcd1234", Size: 1, Timestamp: time.Now()})
+		l.flush()
+	}
+
+	for _, p := range []string{path, path + ".1"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", p, err)
+		}
+		if info.Size() > 512 {
+			t.Errorf("Expected %s bounded to 512 bytes, got %d", p, info.Size())
+		}
+	}
+	if l.seq != 20 {
+		t.Errorf("Expected sequence 20, got %d", l.seq)
+	}
+}
+
+func TestEventBufferWraps(t *testing.T) {
+	l, err := openEventLog(filepath.Join(t.TempDir(), "events.log"), DefaultEventLogMaxSize)
+	if err != nil {
+		t.Fatalf("Failed to open event log: %v", err)
+	}
+	defer l.close()
+
+	for i := 0; i < EventBufferSize+5; i++ {
+		l.record(MutationEvent{Op: EventStore, ChunkID: fmt.Sprintf("wrap-%d", i), Timestamp: time.Now()})
+	}
+	l.flush()
+
+	if _, _, dropped := l.since(0, MaxEventsPerPoll); !dropped {
+		t.Error("Expected the oldest events to have been dropped from the buffer")
+	}
+	events, _, dropped := l.since(5, 2)
+	if dropped || len(events) != 2 || events[0].Seq != 6 || events[1].Seq != 7 {
+		t.Errorf("Expected events 6 and 7 after wrapping, got %+v (dropped=%v)", events, dropped)
+	}
+	events, _, _ = l.since(uint64(EventBufferSize+4), MaxEventsPerPoll)
+	if len(events) != 1 || events[0].ChunkID != fmt.Sprintf("wrap-%d", EventBufferSize+4) {
+		t.Errorf("Expected only the newest event, got %+v", events)
+	}
+}
+
+func TestEventLogRotationKeepsLogWhenRenameFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.log")
+	l, err := openEventLog(path, 256)
+	if err != nil {
+		t.Fatalf("Failed to open event log: %v", err)
+	}
+	defer l.close()
+
+	// A directory in the way makes the rename fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0755); err != nil {
+		t.Fatalf("Failed to create blocking directory: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		l.record(MutationEvent{Op: EventStore, ChunkID: fmt.Sprintf("kept-%d", i), Timestamp: time.Now()})
+		l.flush()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read event log: %v", err)
+	}
+	if !strings.Contains(string(data), `"chunk_id":"kept-0"`) {
+		t.Error("Expected the log not to be truncated when rotation fails")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DefaultExpiryReapInterval is how often expired chunks are deleted from the
+// index (see EXPIRY_REAP_INTERVAL). Lookups already treat them as absent;
+// reaping frees their index entries and marks their bytes for compaction.
+const DefaultExpiryReapInterval = time.Minute
+
+// deleteExpired deletes a chunk if its TTL has passed, reporting whether it
+// did. A PUT to the ID of an expired chunk calls it first, so the new chunk
+// replaces the expired one rather than being reported as already stored.
+func (sn *StorageNode) deleteExpired(chunkID string) bool {
+	return sn.deleteChunkIf(chunkID, func(entry ChunkEntry) bool {
+		return entry.expired(time.Now())
+	})
+}
+
+// reapExpired is the EXPIRY_REAP_INTERVAL task: it deletes every chunk whose
+// TTL has passed and saves the index once for all of them
+func (sn *StorageNode) reapExpired(ctx context.Context) {
+	now := time.Now()
+	var expired []string
+	sn.index.mu.RLock()
+	for chunkID, entry := range sn.index.chunks {
+		if entry.expired(now) {
+			expired = append(expired, chunkID)
+		}
+	}
+	sn.index.mu.RUnlock()
+
+	reaped := 0
+	for _, chunkID := range expired {
+		if ctx.Err() != nil {
+			break
+		}
+		if sn.deleteExpired(chunkID) {
+			reaped++
+		}
+	}
+	if reaped == 0 {
+		return
+	}
+
+	if err := sn.deferIndexSave(sn.deleteCoalesceWindow); err != nil {
+		log.Printf("Warning: failed to persist index after reaping %d expired chunks: %v", reaped, err)
+	}
+	log.Printf("Reaped %d expired chunks", reaped)
+}
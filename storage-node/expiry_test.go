@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// expireChunk stores a chunk whose TTL has already passed
+func expireChunk(t *testing.T, sn *StorageNode, chunkID string) {
+	t.Helper()
+	data := []byte("expired " + chunkID)
+	if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+	}
+	past := time.Now().Add(-time.Second)
+	sn.index.mu.Lock()
+	entry := sn.index.chunks[chunkID]
+	entry.ExpiresAt = &past
+	sn.index.set(entry)
+	sn.index.mu.Unlock()
+}
+
+func TestPutReplacesExpiredChunk(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	expireChunk(t, sn, "expired-single")
+	data := []byte("fresh single")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/expired-single", bytes.NewReader(data)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected a PUT over an expired chunk to store it, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/expired-single", nil))
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Errorf("Expected GET to return the new chunk, got %d %q", rr.Code, rr.Body.Bytes())
+	}
+
+	expireChunk(t, sn, "expired-batch")
+	if result := sn.putBatchItem("expired-batch", []byte("fresh batch"), "", ""); result.Status != http.StatusCreated {
+		t.Errorf("Expected a batch PUT over an expired chunk to store it, got %+v", result)
+	}
+}
+
+func TestReapExpiredChunks(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	expireChunk(t, sn, "reaped")
+	live := []byte("still live")
+	if err := sn.storeChunk("live", live, fmt.Sprintf("%x", sha256.Sum256(live))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+
+	sn.reapExpired(context.Background())
+
+	sn.index.mu.RLock()
+	_, reaped := sn.index.chunks["reaped"]
+	_, kept := sn.index.chunks["live"]
+	sn.index.mu.RUnlock()
+	if reaped || !kept {
+		t.Errorf("Expected only the expired chunk to be reaped (expired present=%v, live present=%v)", reaped, kept)
+	}
+}
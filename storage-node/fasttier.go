@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fast tier configuration. When FAST_TIER_DIR is set new chunks are written
+// to superblocks there (e.g. on NVMe) and migrated to the primary data
+// directory once older than FAST_TIER_MAX_AGE.
+const (
+	// FastTierSuperblockBase starts the fast tier's superblock IDs, keeping
+	// them disjoint from primary superblocks so relocation, draining and
+	// integrity checks treat both tiers alike
+	FastTierSuperblockBase = 1 << 30
+
+	DefaultFastTierMaxAge = 10 * time.Minute
+
+	TierFast    = "fast"
+	TierPrimary = "primary"
+)
+
+func isFastTierSuperblock(id int) bool {
+	return id >= FastTierSuperblockBase
+}
+
+// tierOf names the tier holding a superblock
+func tierOf(id int) string {
+	if isFastTierSuperblock(id) {
+		return TierFast
+	}
+	return TierPrimary
+}
+
+// findCurrentFastSuperblock resumes appending to the newest fast tier
+// superblock
+func (sn *StorageNode) findCurrentFastSuperblock() {
+	sn.currentFastSuperblock = FastTierSuperblockBase
+	files, err := os.ReadDir(sn.fastTierDir)
+	if err != nil {
+		log.Printf("Warning: failed to read fast tier dir: %v", err)
+		return
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, "superblock_") || !strings.HasSuffix(name, ".dat") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "superblock_"), ".dat"))
+		if err == nil && isFastTierSuperblock(id) && id > sn.currentFastSuperblock {
+			sn.currentFastSuperblock = id
+		}
+	}
+}
+
+// fastTierSuperblocks returns the IDs of all fast tier superblock files
+func (sn *StorageNode) fastTierSuperblocks() []int {
+	files, err := os.ReadDir(sn.fastTierDir)
+	if err != nil {
+		return nil
+	}
+	var ids []int
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, "superblock_") || !strings.HasSuffix(name, ".dat") {
+			continue
+		}
+		if id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "superblock_"), ".dat")); err == nil && isFastTierSuperblock(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// coldFastTierChunks returns fast tier chunks stored before cutoff, oldest first
+func (sn *StorageNode) coldFastTierChunks(cutoff time.Time) []ChunkEntry {
+	sn.index.mu.RLock()
+	defer sn.index.mu.RUnlock()
+
+	var cold []ChunkEntry
+	for _, entry := range sn.index.chunks {
+		if isFastTierSuperblock(entry.SuperblockID) && entry.StoredAt.Before(cutoff) {
+			cold = append(cold, entry)
+		}
+	}
+	sort.Slice(cold, func(i, j int) bool { return cold[i].StoredAt.Before(cold[j].StoredAt) })
+	return cold
+}
+
+// migrateColdChunks moves fast tier chunks older than FAST_TIER_MAX_AGE to
+// the primary tier, then removes fast tier superblocks left empty
+func (sn *StorageNode) migrateColdChunks(ctx context.Context) {
+	cold := sn.coldFastTierChunks(time.Now().Add(-sn.fastTierMaxAge))
+	if len(cold) > 0 {
+		release, err := sn.maintenance.acquire(ctx, MaintenanceFastTier)
+		if err != nil {
+			return
+		}
+		defer release()
+	}
+
+	moved := 0
+	for _, entry := range cold {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := sn.drainChunk(entry.ChunkID, entry.SuperblockID); err != nil {
+			// Deleted or rewritten since it was listed: nothing to migrate
+			if errors.Is(err, errChunkNotFound) || errors.Is(err, errChunkChanged) {
+				continue
+			}
+			log.Printf("Warning: failed to migrate chunk %s to the primary tier: %v", entry.ChunkID, err)
+			continue
+		}
+		moved++
+	}
+	if moved > 0 {
+		log.Printf("Migrated %d cold chunk(s) from the fast tier", moved)
+	}
+
+	for _, id := range sn.fastTierSuperblocks() {
+		sn.mu.Lock()
+		active := id == sn.currentFastSuperblock
+		sn.mu.Unlock()
+		if active || len(sn.chunksInSuperblock(id)) > 0 {
+			continue
+		}
+		if err := sn.removeSuperblock(id); err != nil {
+			log.Printf("Warning: failed to remove empty fast tier superblock %d: %v", id, err)
+		}
+	}
+}
+
+// fastTierPath returns the path of a fast tier superblock
+func (sn *StorageNode) fastTierPath(id int) string {
+	return filepath.Join(sn.fastTierDir, fmt.Sprintf("superblock_%d.dat", id))
+}
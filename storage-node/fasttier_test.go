@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupFastTierNode(t *testing.T) (*StorageNode, string, string) {
+	fastDir := t.TempDir()
+	t.Setenv("FAST_TIER_DIR", fastDir)
+	t.Setenv("FAST_TIER_MAX_AGE", "1h")
+	sn, tempDir := setupTestStorageNode(t)
+	return sn, tempDir, fastDir
+}
+
+// ageChunk backdates a chunk's store time so it counts as cold
+func ageChunk(sn *StorageNode, chunkID string, age time.Duration) {
+	sn.index.mu.Lock()
+	defer sn.index.mu.Unlock()
+	entry := sn.index.chunks[chunkID]
+	entry.StoredAt = time.Now().Add(-age)
+	sn.index.set(entry)
+}
+
+func TestFastTierWriteMigratesAfterAging(t *testing.T) {
+	sn, tempDir, fastDir := setupFastTierNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := []byte("recently written chunk")
+	if err := sn.storeChunk("fast-chunk", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+
+	entry := sn.index.chunks["fast-chunk"]
+	if tierOf(entry.SuperblockID) != TierFast {
+		t.Fatalf("Expected a fresh write on the fast tier, got superblock %d", entry.SuperblockID)
+	}
+	if _, err := os.Stat(filepath.Join(fastDir, fmt.Sprintf("superblock_%d.dat", entry.SuperblockID))); err != nil {
+		t.Fatalf("Expected the chunk's superblock in the fast tier dir: %v", err)
+	}
+
+	// Not cold yet: stays put
+	sn.migrateColdChunks(context.Background())
+	if tierOf(sn.index.chunks["fast-chunk"].SuperblockID) != TierFast {
+		t.Fatal("Expected a recent chunk to stay on the fast tier")
+	}
+
+	// Retire the active fast superblock so it can be removed once empty
+	ageChunk(sn, "fast-chunk", 2*time.Hour)
+	sn.mu.Lock()
+	sn.currentFastSuperblock++
+	sn.mu.Unlock()
+	sn.migrateColdChunks(context.Background())
+
+	migrated := sn.index.chunks["fast-chunk"]
+	if tierOf(migrated.SuperblockID) != TierPrimary {
+		t.Fatalf("Expected the aged chunk on the primary tier, got superblock %d", migrated.SuperblockID)
+	}
+	if _, err := os.Stat(sn.getSuperblockPath(entry.SuperblockID)); !os.IsNotExist(err) {
+		t.Errorf("Expected the emptied fast tier superblock to be removed, stat error: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/fast-chunk", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != string(data) {
+		t.Errorf("Expected migrated chunk to read back, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// The new location survives a restart
+	sn.Shutdown()
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	defer sn2.Shutdown()
+	if got := sn2.index.chunks["fast-chunk"].SuperblockID; got != migrated.SuperblockID {
+		t.Errorf("Expected superblock %d after restart, got %d", migrated.SuperblockID, got)
+	}
+}
+
+func TestFastTierRotatesAndResumes(t *testing.T) {
+	t.Setenv("MAX_SUPERBLOCK_SIZE_MB", "1")
+	t.Setenv("MAX_CHUNK_SIZE_MB", "1")
+	sn, tempDir, _ := setupFastTierNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := make([]byte, 600*1024)
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+	for i := 0; i < 2; i++ {
+		if err := sn.storeChunk(fmt.Sprintf("big-%d", i), data, checksum); err != nil {
+			t.Fatalf("Failed to store chunk %d: %v", i, err)
+		}
+	}
+	if sn.currentFastSuperblock != FastTierSuperblockBase+1 {
+		t.Fatalf("Expected the fast tier to rotate to superblock %d, at %d", FastTierSuperblockBase+1, sn.currentFastSuperblock)
+	}
+	if sn.currentSuperblock != 0 {
+		t.Errorf("Expected the primary tier untouched, at superblock %d", sn.currentSuperblock)
+	}
+
+	sn.Shutdown()
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	defer sn2.Shutdown()
+	if sn2.currentFastSuperblock != sn.currentFastSuperblock {
+		t.Errorf("Expected to resume fast tier superblock %d, got %d", sn.currentFastSuperblock, sn2.currentFastSuperblock)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFlushMakesWritesRecoverable(t *testing.T) {
+	t.Setenv("CHUNK_FSYNC_POLICY", "never")
+	t.Setenv("INDEX_FSYNC_POLICY", "never")
+	t.Setenv("DELETE_COALESCE_WINDOW", "1h")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.adminToken = "secret"
+	router := sn.newRouter()
+
+	for i := 0; i < 3; i++ {
+		data := []byte(fmt.Sprintf("flushed chunk %d", i))
+		if err := sn.storeChunk(fmt.Sprintf("flush-%d", i), data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %d: %v", i, err)
+		}
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/chunk/flush-0", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 from delete, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, adminRequest("POST", "/admin/flush", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from flush, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp FlushResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode flush response: %v", err)
+	}
+	if resp.Chunks != 2 || len(resp.Superblocks) != 1 {
+		t.Errorf("Expected 2 chunks and 1 synced superblock, got %+v", resp)
+	}
+
+	// A fresh node on the same dir, without a clean shutdown of the first,
+	// sees everything acknowledged before the flush
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to start second node: %v", err)
+	}
+	if _, ok := sn2.index.chunks["flush-0"]; ok {
+		t.Error("Expected the deleted chunk to stay deleted")
+	}
+	for i := 1; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		sn2.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/chunk/flush-%d", i), nil))
+		if want := fmt.Sprintf("flushed chunk %d", i); rr.Code != http.StatusOK || rr.Body.String() != want {
+			t.Errorf("Expected %q from the second node, got %d %q", want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestFlushReportsFailure(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	atomic.StoreInt32(&sn.readOnly, 1)
+	sn.adminToken = "secret"
+
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, adminRequest("POST", "/admin/flush", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500 when the index can't be saved, got %d", rr.Code)
+	}
+	var resp FlushResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp.Error == "" {
+		t.Errorf("Expected an error in the response, got %+v (%v)", resp, err)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// Every chunk in a current-format superblock is preceded by a frame header
+// identifying it, so the superblock files alone are enough to rebuild the
+// index (see RebuildIndex):
+//
+//	offset  size  field
+//	0       4     magic "VSCF"
+//	4       1     frame version
+//	5       1     checksum algorithm (low 4 bits): 1 = sha256, 2 = crc32c
+//	              compression (bits 4-6): 0 = none, 1 = gzip, 2 = zstd
+//	              encrypted (bit 7)
+//	6       2     chunk ID length n (uint16, little-endian)
+//	8       4     payload length (uint32)
+//	12      8     written at, Unix nanoseconds (int64)
+//	20      32    checksum of the decoded data, zero padded
+//	52      n     chunk ID
+//	52+n    ...   payload
+//
+// The payload of an encrypted chunk starts with its AES-GCM nonce, followed
+// by the ciphertext of the (possibly compressed) data and its tag.
+//
+// Index offsets point at the payload, so reads never look at the frame. The
+// written-at time is when these bytes were appended, not when the chunk was
+// first stored: a relocated copy is newer than the original it replaced.
+const (
+	ChunkFrameMagic   = "VSCF"
+	ChunkFrameVersion = 1
+
+	chunkFrameFixedSize      = 52
+	chunkFrameChecksumOffset = 20
+	chunkFrameChecksumLen    = 32
+
+	frameEncryptedFlag = 0x80
+)
+
+var errNoChunkFrame = errors.New("no chunk frame")
+
+// Checksum algorithm codes in chunk frames
+var frameChecksumAlgos = []string{1: ChecksumSHA256, 2: ChecksumCRC32C}
+
+// chunkFrame is the decoded header of a framed chunk
+type chunkFrame struct {
+	ChunkID      string
+	Size         int32 // payload length, as encoded by Compression and Encrypted
+	Checksum     string
+	ChecksumAlgo string
+	Compression  string
+	Encrypted    bool
+	WrittenAt    time.Time
+}
+
+// frameSize returns the length of the frame header in front of a chunk
+func frameSize(chunkID string) int64 {
+	return chunkFrameFixedSize + int64(len(chunkID))
+}
+
+// encode returns the frame header to write before the chunk's payload
+func (f chunkFrame) encode() ([]byte, error) {
+	sum, err := hex.DecodeString(f.Checksum)
+	if err != nil || len(sum) > chunkFrameChecksumLen {
+		return nil, fmt.Errorf("invalid checksum %q for chunk frame", f.Checksum)
+	}
+	algo := 0
+	for code, name := range frameChecksumAlgos {
+		if name != "" && name == f.ChecksumAlgo {
+			algo = code
+		}
+	}
+	if algo == 0 {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q for chunk frame", f.ChecksumAlgo)
+	}
+	if f.Compression != "" {
+		codec := 0
+		for code, name := range frameCompressions {
+			if name != "" && name == f.Compression {
+				codec = code
+			}
+		}
+		if codec == 0 {
+			return nil, fmt.Errorf("unsupported compression %q for chunk frame", f.Compression)
+		}
+		algo |= codec << 4
+	}
+	if f.Encrypted {
+		algo |= frameEncryptedFlag
+	}
+
+	buf := make([]byte, frameSize(f.ChunkID))
+	copy(buf, ChunkFrameMagic)
+	buf[4] = ChunkFrameVersion
+	buf[5] = byte(algo)
+	binary.LittleEndian.PutUint16(buf[6:], uint16(len(f.ChunkID)))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(f.Size))
+	binary.LittleEndian.PutUint64(buf[12:], uint64(f.WrittenAt.UnixNano()))
+	copy(buf[chunkFrameChecksumOffset:], sum)
+	copy(buf[chunkFrameFixedSize:], f.ChunkID)
+	return buf, nil
+}
+
+// patchFrameChecksum fills in the checksum of the frame at off, written
+// before its payload was hashed, without rewriting the rest of the frame
+func patchFrameChecksum(w io.WriterAt, off int64, checksum string) error {
+	sum, err := hex.DecodeString(checksum)
+	if err != nil || len(sum) > chunkFrameChecksumLen {
+		return fmt.Errorf("invalid checksum %q for chunk frame", checksum)
+	}
+	field := make([]byte, chunkFrameChecksumLen)
+	copy(field, sum)
+	_, err = w.WriteAt(field, off+chunkFrameChecksumOffset)
+	return err
+}
+
+// readFrameAt decodes the chunk frame starting at off. errNoChunkFrame means
+// there is no intact frame header there.
+func readFrameAt(r io.ReaderAt, off int64) (chunkFrame, error) {
+	fixed := make([]byte, chunkFrameFixedSize)
+	if _, err := r.ReadAt(fixed, off); err != nil {
+		return chunkFrame{}, fmt.Errorf("%w at offset %d: %v", errNoChunkFrame, off, err)
+	}
+	if string(fixed[:4]) != ChunkFrameMagic {
+		return chunkFrame{}, fmt.Errorf("%w at offset %d: bad magic", errNoChunkFrame, off)
+	}
+	if fixed[4] != ChunkFrameVersion {
+		return chunkFrame{}, fmt.Errorf("%w at offset %d: unsupported version %d", errNoChunkFrame, off, fixed[4])
+	}
+	algoCode, codec := fixed[5]&0x0f, fixed[5]>>4&0x07
+	if int(algoCode) >= len(frameChecksumAlgos) || frameChecksumAlgos[algoCode] == "" {
+		return chunkFrame{}, fmt.Errorf("%w at offset %d: unknown checksum algorithm %d", errNoChunkFrame, off, algoCode)
+	}
+	if codec != 0 && (int(codec) >= len(frameCompressions) || frameCompressions[codec] == "") {
+		return chunkFrame{}, fmt.Errorf("%w at offset %d: unknown compression %d", errNoChunkFrame, off, codec)
+	}
+
+	id := make([]byte, binary.LittleEndian.Uint16(fixed[6:]))
+	if _, err := r.ReadAt(id, off+chunkFrameFixedSize); err != nil {
+		return chunkFrame{}, fmt.Errorf("%w at offset %d: %v", errNoChunkFrame, off, err)
+	}
+	if err := validateChunkID(string(id)); err != nil {
+		return chunkFrame{}, fmt.Errorf("%w at offset %d: invalid chunk ID", errNoChunkFrame, off)
+	}
+
+	algo := frameChecksumAlgos[algoCode]
+	sumLen := chunkFrameChecksumLen
+	if algo == ChecksumCRC32C {
+		sumLen = 4
+	}
+	return chunkFrame{
+		ChunkID:      string(id),
+		Size:         int32(binary.LittleEndian.Uint32(fixed[8:])),
+		Checksum:     hex.EncodeToString(fixed[chunkFrameChecksumOffset : chunkFrameChecksumOffset+sumLen]),
+		ChecksumAlgo: algo,
+		Compression:  frameCompressions[codec],
+		Encrypted:    fixed[5]&frameEncryptedFlag != 0,
+		WrittenAt:    time.Unix(0, int64(binary.LittleEndian.Uint64(fixed[12:]))),
+	}, nil
+}
+
+// trimTornAppend truncates a torn append off the end of a superblock: bytes
+// past the header's next offset that a crash interrupted before the write
+// was acknowledged. Frames there the index points at are kept, since the
+// header update after an acknowledged append can fail on its own. It returns
+// the number of bytes removed. Legacy superblocks have no frames and are
+// left alone. Caller must hold sn.mu or run before requests are served.
+func (sn *StorageNode) trimTornAppend(id int) (int64, error) {
+	path := sn.getSuperblockPath(id)
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	hdr, err := readHeaderFrom(file)
+	if err != nil {
+		return 0, nil // Legacy, or a damaged header fsck has to rebuild first
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	end := hdr.NextOffset
+	if end < SuperblockHeaderSize || end >= info.Size() {
+		return 0, nil // Nothing past the last append; a lost tail is checkIndexIntegrity's job
+	}
+
+	// Whole frames the index doesn't know, e.g. deleted since, are skipped
+	// rather than ending the walk so later acknowledged chunks survive
+	kept := 0
+	for off := end; off < info.Size(); {
+		frame, err := readFrameAt(file, off)
+		if err != nil {
+			break
+		}
+		payload := off + frameSize(frame.ChunkID)
+		if payload+int64(frame.Size) > info.Size() {
+			break
+		}
+		off = payload + int64(frame.Size)
+		sn.index.mu.RLock()
+		entry, ok := sn.index.chunks[frame.ChunkID]
+		sn.index.mu.RUnlock()
+		if ok && entry.SuperblockID == id && entry.Offset == payload {
+			end = off
+			kept++
+		}
+	}
+
+	trimmed := info.Size() - end
+	if trimmed > 0 {
+		if err := file.Truncate(end); err != nil {
+			return 0, fmt.Errorf("failed to truncate torn append: %w", err)
+		}
+		log.Printf("Truncated a torn append of %d bytes off superblock %d at offset %d", trimmed, id, end)
+	}
+
+	hdr.ChunkCount += uint32(kept)
+	hdr.NextOffset = end
+	sn.invalidateSuperblockChecksum(id)
+	if _, err := file.WriteAt(hdr.encode(), 0); err != nil {
+		return trimmed, fmt.Errorf("failed to update header after trimming torn append: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return trimmed, fmt.Errorf("failed to sync superblock after trimming torn append: %w", err)
+	}
+	return trimmed, nil
+}
+
+// reconcileSuperblockHeader checks a superblock's header against a scan of
+// its framed records before any new writes, logging any disagreement. A next
+// offset past the end of the file or inside a record, e.g. from a crash
+// during a header update, is replaced with the end of the last intact record
+// and the chunk count with the records scanned. A next offset on a record
+// boundary is kept, and any bytes past it are left to trimTornAppend, which
+// knows which of them were acknowledged. Legacy superblocks, damaged headers
+// and files the index references past the scanned records are left alone.
+// Caller must hold sn.mu or run before requests are served.
+func (sn *StorageNode) reconcileSuperblockHeader(id int) error {
+	path := sn.getSuperblockPath(id)
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	hdr, err := readHeaderFrom(file)
+	if err != nil {
+		return nil // Legacy, or a damaged header rebuilt on the next append
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	end, records, onBoundary := int64(SuperblockHeaderSize), uint32(0), hdr.NextOffset == SuperblockHeaderSize
+	for end < info.Size() {
+		frame, err := readFrameAt(file, end)
+		if err != nil {
+			break
+		}
+		payload := end + frameSize(frame.ChunkID)
+		if payload+int64(frame.Size) > info.Size() {
+			break
+		}
+		end = payload + int64(frame.Size)
+		records++
+		if end == hdr.NextOffset {
+			onBoundary = true
+		}
+	}
+	if hdr.NextOffset == info.Size() && end == info.Size() {
+		return nil
+	}
+	log.Printf("Warning: superblock %d header next offset %d disagrees with the file (size %d, last intact record ends at %d)",
+		id, hdr.NextOffset, info.Size(), end)
+	if onBoundary {
+		return nil
+	}
+
+	// A corrupt record followed by ones still in use is fsck's to repair
+	sn.index.mu.RLock()
+	for _, entry := range sn.index.chunks {
+		if entry.SuperblockID == id && entry.Offset+int64(entry.Size) > end {
+			sn.index.mu.RUnlock()
+			log.Printf("Warning: superblock %d has chunks in use past offset %d; leaving its header for fsck", id, end)
+			return nil
+		}
+	}
+	sn.index.mu.RUnlock()
+
+	hdr.ChunkCount, hdr.NextOffset = records, end
+	sn.invalidateSuperblockChecksum(id)
+	if _, err := file.WriteAt(hdr.encode(), 0); err != nil {
+		return fmt.Errorf("failed to rewrite superblock header: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync superblock header: %w", err)
+	}
+	log.Printf("Reconciled superblock %d header to %d chunks ending at offset %d", id, records, end)
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestChunkFrameRoundTrip(t *testing.T) {
+	data := []byte("framed payload")
+	for _, algo := range []string{ChecksumSHA256, ChecksumCRC32C} {
+		sum, _ := computeChecksum(algo, data)
+		want := chunkFrame{ChunkID: "frame-" + algo, Size: int32(len(data)), Checksum: sum, ChecksumAlgo: algo, WrittenAt: time.Unix(0, 12345)}
+		encoded, err := want.encode()
+		if err != nil {
+			t.Fatalf("%s: failed to encode frame: %v", algo, err)
+		}
+		if int64(len(encoded)) != frameSize(want.ChunkID) {
+			t.Errorf("%s: expected a %d byte frame, got %d", algo, frameSize(want.ChunkID), len(encoded))
+		}
+
+		got, err := readFrameAt(bytes.NewReader(append(encoded, data...)), 0)
+		if err != nil {
+			t.Fatalf("%s: failed to decode frame: %v", algo, err)
+		}
+		if got.ChunkID != want.ChunkID || got.Size != want.Size || got.Checksum != want.Checksum ||
+			got.ChecksumAlgo != want.ChecksumAlgo || !got.WrittenAt.Equal(want.WrittenAt) {
+			t.Errorf("%s: expected %+v, got %+v", algo, want, got)
+		}
+	}
+
+	if _, err := readFrameAt(bytes.NewReader(bytes.Repeat([]byte{0}, 100)), 0); !errors.Is(err, errNoChunkFrame) {
+		t.Errorf("Expected errNoChunkFrame for zeroed bytes, got %v", err)
+	}
+}
+
+func TestPatchFrameChecksum(t *testing.T) {
+	data := []byte("streamed payload")
+	sum, _ := computeChecksum(ChecksumSHA256, data)
+	blank := chunkFrame{ChunkID: "patched", Size: int32(len(data)), ChecksumAlgo: ChecksumSHA256, WrittenAt: time.Unix(0, 12345)}
+	encoded, err := blank.encode()
+	if err != nil {
+		t.Fatalf("Failed to encode frame: %v", err)
+	}
+
+	// Patched in place at an offset, as in a superblock
+	file, err := os.CreateTemp(t.TempDir(), "frame")
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer file.Close()
+	file.Write(make([]byte, SuperblockHeaderSize))
+	file.Write(append(encoded, data...))
+	if err := patchFrameChecksum(file, SuperblockHeaderSize, sum); err != nil {
+		t.Fatalf("Failed to patch frame checksum: %v", err)
+	}
+
+	got, err := readFrameAt(file, SuperblockHeaderSize)
+	if err != nil {
+		t.Fatalf("Failed to decode patched frame: %v", err)
+	}
+	want := blank
+	want.Checksum = sum
+	if got.ChunkID != want.ChunkID || got.Size != want.Size || got.Checksum != want.Checksum || !got.WrittenAt.Equal(want.WrittenAt) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	payload := make([]byte, len(data))
+	if _, err := file.ReadAt(payload, SuperblockHeaderSize+frameSize(want.ChunkID)); err != nil || !bytes.Equal(payload, data) {
+		t.Errorf("Expected the payload to be left alone, got %q", payload)
+	}
+
+	if err := patchFrameChecksum(file, SuperblockHeaderSize, "not hex"); err == nil {
+		t.Error("Expected an invalid checksum to be refused")
+	}
+}
+
+func TestTornAppendTrimmedOnRestart(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	stored := make(map[string][]byte)
+	for i := 0; i < 3; i++ {
+		chunkID := fmt.Sprintf("torn-%d", i)
+		data := []byte("acknowledged chunk " + chunkID)
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+		stored[chunkID] = data
+	}
+	sn.Shutdown()
+	id := sn.currentSuperblock
+	path := sn.getSuperblockPath(id)
+
+	// The last chunk's header update failed after it was acknowledged
+	last, _ := sn.lookupChunk("torn-2")
+	hdr, err := sn.readSuperblockHeader(id)
+	if err != nil {
+		t.Fatalf("Failed to read superblock header: %v", err)
+	}
+	hdr.ChunkCount--
+	hdr.NextOffset = last.Offset - frameSize(last.ChunkID)
+	if err := sn.writeSuperblockHeader(id, hdr); err != nil {
+		t.Fatalf("Failed to write superblock header: %v", err)
+	}
+	complete := last.Offset + int64(last.Size)
+
+	// Then a crash cut the next append short
+	data := bytes.Repeat([]byte("x"), 100)
+	frame, _ := chunkFrame{ChunkID: "torn-lost", Size: int32(len(data)), Checksum: fmt.Sprintf("%x", sha256.Sum256(data)), ChecksumAlgo: ChecksumSHA256}.encode()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open superblock: %v", err)
+	}
+	file.Write(append(frame, data[:10]...))
+	file.Close()
+
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage node: %v", err)
+	}
+
+	if size, _ := sn2.getSuperblockSize(id); size != complete {
+		t.Errorf("Expected superblock trimmed to %d bytes, got %d", complete, size)
+	}
+	hdr, err = sn2.readSuperblockHeader(id)
+	if err != nil || hdr.ChunkCount != 3 || hdr.NextOffset != complete {
+		t.Errorf("Expected header for 3 chunks ending at %d, got %+v (%v)", complete, hdr, err)
+	}
+	for chunkID, want := range stored {
+		entry, _ := sn2.lookupChunk(chunkID)
+		if _, got, err := sn2.readVerifiedChunk(entry); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Chunk %s unreadable after trimming: %v", chunkID, err)
+		}
+	}
+
+	// New writes continue from the last complete append
+	more := []byte("written after the torn append")
+	if err := sn2.storeChunk("torn-next", more, fmt.Sprintf("%x", sha256.Sum256(more))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	if entry, _ := sn2.lookupChunk("torn-next"); entry.Offset != complete+frameSize("torn-next") {
+		t.Errorf("Expected new chunk's payload at %d, got %d", complete+frameSize("torn-next"), entry.Offset)
+	}
+}
+
+func TestLegacySuperblockNotTrimmed(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := []byte("legacy data is never framed")
+	if err := os.WriteFile(sn.getSuperblockPath(0), data, 0644); err != nil {
+		t.Fatalf("Failed to write legacy superblock: %v", err)
+	}
+	if trimmed, err := sn.trimTornAppend(0); err != nil || trimmed != 0 {
+		t.Errorf("Expected a legacy superblock to be left alone, trimmed %d (%v)", trimmed, err)
+	}
+	if size, _ := sn.getSuperblockSize(0); size != int64(len(data)) {
+		t.Errorf("Expected legacy superblock to stay %d bytes, got %d", len(data), size)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FsckReport summarizes an offline integrity check of the data directory
+type FsckReport struct {
+	IndexEntries     int      `json:"index_entries"`
+	ChunksVerified   int      `json:"chunks_verified"`
+	Truncated        int      `json:"truncated"`         // entries past the end of their superblock (torn tail)
+	MissingData      int      `json:"missing_data"`      // entries whose superblock file is gone
+	Corrupt          int      `json:"corrupt"`           // entries failing checksum verification
+	StaleHeaders     int      `json:"stale_headers"`     // superblock headers disagreeing with their file
+	TornAppends      int      `json:"torn_appends"`      // superblocks truncated back to their last complete append
+	RemovedEntries   int      `json:"removed_entries"`   // missing, truncated or corrupt entries dropped from the index
+	RewrittenHeaders int      `json:"rewritten_headers"` // stale headers rewritten
+	Unrepaired       []string `json:"unrepaired,omitempty"`
+}
+
+// Clean reports whether no problems remain after repair
+func (r FsckReport) Clean() bool {
+	return len(r.Unrepaired) == 0
+}
+
+// fsck validates the index against the superblock files and repairs what it
+// can. Entries whose data is truncated, missing or corrupt are dropped from
+// the index: the bytes are gone from this node and the coordinator
+// re-replicates missing chunks. Entries that merely fail to read are kept
+// and reported as unrepaired. Torn appends at the end of a superblock are
+// truncated. An unreadable or missing index is left in place and reported as
+// unrepaired; the node rebuilds it from the chunk frames when it next starts.
+// Checksums are verified for a VERIFY_SAMPLE_RATE fraction of chunks.
+func (sn *StorageNode) fsck() (FsckReport, error) {
+	var report FsckReport
+
+	if err := sn.validateConfig(); err != nil {
+		return report, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if _, err := os.Stat(sn.dataDir); err != nil {
+		return report, fmt.Errorf("cannot access data directory: %w", err)
+	}
+
+	superblocks, err := sn.listSuperblocks()
+	if err != nil {
+		return report, err
+	}
+
+	if _, err := os.Stat(sn.indexFile); os.IsNotExist(err) && len(superblocks) > 0 {
+		report.Unrepaired = append(report.Unrepaired,
+			fmt.Sprintf("index file missing but %d superblock(s) hold data", len(superblocks)))
+		return report, nil
+	}
+	if err := sn.loadIndexFile(false); err != nil {
+		report.Unrepaired = append(report.Unrepaired, fmt.Sprintf("index unreadable: %v", err))
+		return report, nil
+	}
+	if _, _, err := sn.replayIndexWAL(); err != nil {
+		report.Unrepaired = append(report.Unrepaired, fmt.Sprintf("index WAL unreadable: %v", err))
+		return report, nil
+	}
+
+	sn.index.mu.RLock()
+	entries := make([]ChunkEntry, 0, len(sn.index.chunks))
+	for _, entry := range sn.index.chunks {
+		entries = append(entries, entry)
+	}
+	sn.index.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ChunkID < entries[j].ChunkID })
+	report.IndexEntries = len(entries)
+
+	var bad []string
+	for _, entry := range entries {
+		lost, err := sn.fsckChunk(entry, &report)
+		if err == nil {
+			continue
+		}
+		log.Printf("fsck: chunk %s: %v", entry.ChunkID, err)
+		if lost {
+			bad = append(bad, entry.ChunkID)
+		} else {
+			report.Unrepaired = append(report.Unrepaired, fmt.Sprintf("chunk %s unreadable: %v", entry.ChunkID, err))
+		}
+	}
+
+	if len(bad) > 0 {
+		sn.index.mu.Lock()
+		for _, chunkID := range bad {
+			sn.index.remove(chunkID)
+		}
+		sn.index.mu.Unlock()
+
+		if err := sn.saveIndex(); err != nil {
+			report.Unrepaired = append(report.Unrepaired, fmt.Sprintf("failed to save repaired index: %v", err))
+		} else {
+			report.RemovedEntries = len(bad)
+		}
+	}
+
+	// Headers are recomputed after the index repair so chunk counts are accurate
+	for _, id := range superblocks {
+		if trimmed, err := sn.trimTornAppend(id); err != nil {
+			report.Unrepaired = append(report.Unrepaired, fmt.Sprintf("superblock %d torn append: %v", id, err))
+		} else if trimmed > 0 {
+			report.TornAppends++
+		}
+		info, err := os.Stat(sn.getSuperblockPath(id))
+		if err != nil {
+			continue
+		}
+		hdr, err := sn.readSuperblockHeader(id)
+		if os.IsNotExist(err) {
+			continue // Only the active superblock gets a header on shutdown
+		}
+		if err == nil && hdr.NextOffset == info.Size() {
+			continue
+		}
+		report.StaleHeaders++
+		fresh, err := sn.currentSuperblockHeader(id)
+		if err == nil {
+			err = sn.writeSuperblockHeader(id, fresh)
+		}
+		if err != nil {
+			report.Unrepaired = append(report.Unrepaired, fmt.Sprintf("superblock %d header: %v", id, err))
+			continue
+		}
+		report.RewrittenHeaders++
+	}
+
+	return report, nil
+}
+
+// fsckChunk checks a single index entry, counting the problem it finds.
+// lost reports whether the chunk's data is confirmed missing or corrupt, as
+// opposed to a read error that may be transient.
+func (sn *StorageNode) fsckChunk(entry ChunkEntry, report *FsckReport) (lost bool, err error) {
+	info, err := os.Stat(sn.getSuperblockPath(entry.SuperblockID))
+	if os.IsNotExist(err) {
+		report.MissingData++
+		return true, fmt.Errorf("superblock %d missing: %w", entry.SuperblockID, err)
+	}
+	if err != nil {
+		return false, fmt.Errorf("superblock %d unavailable: %w", entry.SuperblockID, err)
+	}
+	if end := entry.Offset + int64(entry.Size); end > info.Size() {
+		report.Truncated++
+		return true, fmt.Errorf("%w: ends at %d, superblock %d is %d bytes",
+			errChunkTruncated, end, entry.SuperblockID, info.Size())
+	}
+	if !sn.sampleVerification() {
+		return false, nil
+	}
+
+	data, err := sn.readChunk(entry)
+	if err == nil {
+		var computed string
+		if computed, err = computeChecksum(entry.checksumAlgorithm(), data); err == nil && computed != entry.Checksum {
+			err = fmt.Errorf("%w: expected %s, got %s", errChunkCorrupt, entry.Checksum, computed)
+		}
+	}
+	if errors.Is(err, errChunkCorrupt) {
+		report.Corrupt++
+		return true, err
+	}
+	if err != nil {
+		return false, err
+	}
+	report.ChunksVerified++
+	return false, nil
+}
+
+// listSuperblocks returns the IDs of the superblock data files on disk
+func (sn *StorageNode) listSuperblocks() ([]int, error) {
+	files, err := os.ReadDir(filepath.Join(sn.dataDir, "data"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read data dir: %w", err)
+	}
+
+	var ids []int
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "superblock_") || !strings.HasSuffix(file.Name(), ".dat") {
+			continue
+		}
+		idStr := strings.TrimSuffix(strings.TrimPrefix(file.Name(), "superblock_"), ".dat")
+		if id, err := strconv.Atoi(idStr); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// runFsck runs fsck and logs a summary, returning the process exit code:
+// 0 if the data directory is clean or fully repaired, 1 otherwise
+func (sn *StorageNode) runFsck() int {
+	log.Printf("Running fsck on %s", sn.dataDir)
+
+	report, err := sn.fsck()
+	if err != nil {
+		log.Printf("fsck failed: %v", err)
+		return 1
+	}
+
+	log.Printf("fsck: %d index entries, %d verified, %d truncated, %d missing data, %d corrupt, %d stale headers, %d torn appends",
+		report.IndexEntries, report.ChunksVerified, report.Truncated, report.MissingData, report.Corrupt, report.StaleHeaders, report.TornAppends)
+	log.Printf("fsck: repaired %d index entries and %d superblock headers", report.RemovedEntries, report.RewrittenHeaders)
+	for _, problem := range report.Unrepaired {
+		log.Printf("fsck: UNREPAIRED: %s", problem)
+	}
+
+	if !report.Clean() {
+		return 1
+	}
+	log.Printf("fsck: data directory is clean")
+	return 0
+}
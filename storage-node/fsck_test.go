@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// damagedDataDir stores three chunks, then flips a byte in the first and cuts
+// the last one off the end of the superblock
+func damagedDataDir(t *testing.T) string {
+	sn, tempDir := setupTestStorageNode(t)
+	for i := 0; i < 3; i++ {
+		data := []byte(fmt.Sprintf("fsck chunk data %d", i))
+		if err := sn.storeChunk(fmt.Sprintf("fsck-%d", i), data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	}
+	sn.Shutdown()
+
+	first, _ := sn.lookupChunk("fsck-0")
+	last, _ := sn.lookupChunk("fsck-2")
+	file, err := os.OpenFile(sn.getSuperblockPath(first.SuperblockID), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open superblock: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteAt([]byte{'X'}, first.Offset); err != nil {
+		t.Fatalf("Failed to corrupt chunk: %v", err)
+	}
+	if err := file.Truncate(last.Offset + 2); err != nil {
+		t.Fatalf("Failed to truncate superblock: %v", err)
+	}
+	return tempDir
+}
+
+func TestFsckRepairsDamagedDataDir(t *testing.T) {
+	tempDir := damagedDataDir(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	sn := NewStorageNode(tempDir, "test-node")
+	report, err := sn.fsck()
+	if err != nil {
+		t.Fatalf("fsck failed: %v", err)
+	}
+	if report.IndexEntries != 3 || report.Corrupt != 1 || report.Truncated != 1 || report.ChunksVerified != 1 {
+		t.Errorf("Unexpected fsck report %+v", report)
+	}
+	if report.RemovedEntries != 2 || report.StaleHeaders != 1 || report.RewrittenHeaders != 1 || !report.Clean() {
+		t.Errorf("Expected damage to be repaired, got %+v", report)
+	}
+
+	// A second pass over the repaired directory finds nothing to do
+	if code := NewStorageNode(tempDir, "test-node").runFsck(); code != 0 {
+		t.Errorf("Expected exit code 0 after repair, got %d", code)
+	}
+
+	sn = NewStorageNode(tempDir, "test-node")
+	if err := sn.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage node: %v", err)
+	}
+	if _, ok := sn.lookupChunk("fsck-1"); !ok {
+		t.Error("Expected intact chunk to survive repair")
+	}
+	if _, ok := sn.lookupChunk("fsck-0"); ok {
+		t.Error("Expected corrupt chunk to be dropped from the index")
+	}
+	if n := sn.checkIndexIntegrity(); n != 0 {
+		t.Errorf("Expected no truncated entries after repair, got %d", n)
+	}
+}
+
+func TestFsckFailsOnUnreadableIndex(t *testing.T) {
+	tempDir := damagedDataDir(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	sn := NewStorageNode(tempDir, "test-node")
+	if err := os.WriteFile(sn.indexFile, []byte(`{"fsck-0": {"chunk_id"`), 0644); err != nil {
+		t.Fatalf("Failed to corrupt index: %v", err)
+	}
+
+	if code := sn.runFsck(); code == 0 {
+		t.Error("Expected non-zero exit code for an unreadable index")
+	}
+	// fsck leaves the index for the node to quarantine and rebuild
+	if matches, _ := filepath.Glob(sn.indexFile + ".corrupt-*"); len(matches) != 0 {
+		t.Errorf("Expected fsck not to move the index aside, found %v", matches)
+	}
+	if code := NewStorageNode(tempDir, "test-node").runFsck(); code == 0 {
+		t.Error("Expected non-zero exit code while the index is still unreadable")
+	}
+}
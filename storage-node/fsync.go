@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Fsync policies, configured separately for chunk data (CHUNK_FSYNC_POLICY)
+// and the index (INDEX_FSYNC_POLICY), or for both at once with FSYNC_POLICY.
+// Anything but always trades durability for throughput: a crash or power
+// loss can lose chunks that were acknowledged within the last FSYNC_INTERVAL
+// (interval) or since the OS last wrote back (never).
+const (
+	FsyncAlways   = "always"   // fsync every write before acknowledging it
+	FsyncInterval = "interval" // fsync at most once per FSYNC_INTERVAL, flushing in the background
+	FsyncNever    = "never"    // leave writeback to the OS
+
+	DefaultFsyncInterval = time.Second
+)
+
+func parseFsyncPolicy(name string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(name)); policy {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown fsync policy %q (want %s, %s or %s)", name, FsyncAlways, FsyncInterval, FsyncNever)
+	}
+}
+
+// fsyncPolicy decides which writes to a class of files are fsynced inline.
+// Under the interval policy skipped files are remembered and synced by the
+// background flusher, bounding how much acknowledged data a crash can lose.
+type fsyncPolicy struct {
+	mode     string
+	interval time.Duration
+	last     int64 // atomic unix nanos of the last inline sync
+	syncs    int64 // atomic count of inline syncs
+	skipped  int64 // atomic count of writes not synced inline
+
+	mu    sync.Mutex
+	dirty map[string]struct{} // files written since their last sync
+}
+
+func newFsyncPolicy(mode string, interval time.Duration) *fsyncPolicy {
+	return &fsyncPolicy{mode: mode, interval: interval, dirty: make(map[string]struct{})}
+}
+
+// due reports whether a write to path should be fsynced now. Writes that are
+// not synced under the interval policy leave path dirty for flush.
+func (p *fsyncPolicy) due(path string) bool {
+	switch p.mode {
+	case FsyncNever:
+		atomic.AddInt64(&p.skipped, 1)
+		return false
+	case FsyncInterval:
+		now := time.Now().UnixNano()
+		last := atomic.LoadInt64(&p.last)
+		if now-last < int64(p.interval) || !atomic.CompareAndSwapInt64(&p.last, last, now) {
+			atomic.AddInt64(&p.skipped, 1)
+			p.mu.Lock()
+			p.dirty[path] = struct{}{}
+			p.mu.Unlock()
+			return false
+		}
+	}
+	atomic.AddInt64(&p.syncs, 1)
+	return true
+}
+
+// flush fsyncs every file left dirty by skipped writes, and its directory so
+// renames that replaced it are durable too. It returns the first failure but
+// still attempts every file.
+func (p *fsyncPolicy) flush() error {
+	p.mu.Lock()
+	paths := p.dirty
+	p.dirty = make(map[string]struct{})
+	p.mu.Unlock()
+
+	var firstErr error
+	for path := range paths {
+		if err := syncFile(path); err != nil && !errors.Is(err, os.ErrNotExist) && firstErr == nil {
+			firstErr = err
+		}
+		if err := syncDir(filepath.Dir(path)); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// syncFile fsyncs an existing file
+func syncFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for fsync: %w", path, err)
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return nil
+}
+
+// flushFsync syncs files left dirty under the interval policy
+func (sn *StorageNode) flushFsync(ctx context.Context) {
+	for _, p := range []*fsyncPolicy{sn.chunkFsync, sn.indexFsync} {
+		if err := p.flush(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
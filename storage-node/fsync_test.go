@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func storeFsyncTestChunks(t *testing.T, sn *StorageNode, n int) {
+	for i := 0; i < n; i++ {
+		data := []byte(fmt.Sprintf("fsync policy chunk %d", i))
+		if err := sn.storeChunk(fmt.Sprintf("fsync-%d", i), data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	}
+}
+
+func TestFsyncPoliciesAreIndependent(t *testing.T) {
+	tests := []struct {
+		chunkPolicy string
+		indexPolicy string
+	}{
+		{FsyncNever, FsyncAlways},
+		{FsyncAlways, FsyncNever},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.chunkPolicy+"_"+tt.indexPolicy, func(t *testing.T) {
+			t.Setenv("CHUNK_FSYNC_POLICY", tt.chunkPolicy)
+			t.Setenv("INDEX_FSYNC_POLICY", tt.indexPolicy)
+			t.Setenv("SMALL_CHUNK_BATCHING", "false")
+			t.Setenv("INDEX_SAVE_DELAY", "0") // one index save per write
+			sn, tempDir := setupTestStorageNode(t)
+			defer cleanupTestStorageNode(tempDir)
+
+			storeFsyncTestChunks(t, sn, 3)
+
+			for name, p := range map[string]*fsyncPolicy{"chunk": sn.chunkFsync, "index": sn.indexFsync} {
+				syncs, skipped := atomic.LoadInt64(&p.syncs), atomic.LoadInt64(&p.skipped)
+				if p.mode == FsyncAlways && (syncs != 3 || skipped != 0) {
+					t.Errorf("Expected every %s write synced, got %d synced, %d skipped", name, syncs, skipped)
+				}
+				if p.mode == FsyncNever && (syncs != 0 || skipped != 3) {
+					t.Errorf("Expected no %s write synced, got %d synced, %d skipped", name, syncs, skipped)
+				}
+			}
+
+			req := httptest.NewRequest("GET", "/health", nil)
+			w := httptest.NewRecorder()
+			sn.newRouter().ServeHTTP(w, req)
+			var health HealthResponse
+			if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+				t.Fatalf("Failed to decode health response: %v", err)
+			}
+			if health.ChunkFsyncPolicy != tt.chunkPolicy || health.IndexFsyncPolicy != tt.indexPolicy {
+				t.Errorf("Expected policies %s/%s in health, got %s/%s",
+					tt.chunkPolicy, tt.indexPolicy, health.ChunkFsyncPolicy, health.IndexFsyncPolicy)
+			}
+			if health.Status != "healthy" {
+				t.Errorf("Expected healthy status, got %s", health.Status)
+			}
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+			}
+		})
+	}
+}
+
+func TestIntervalFsyncDefersToFlush(t *testing.T) {
+	t.Setenv("CHUNK_FSYNC_POLICY", FsyncInterval)
+	t.Setenv("FSYNC_INTERVAL", "1h")
+	t.Setenv("SMALL_CHUNK_BATCHING", "false")
+	t.Setenv("INDEX_SAVE_DELAY", "0") // one index save per write
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	defer sn.Shutdown()
+
+	storeFsyncTestChunks(t, sn, 3)
+
+	// Only the first write in the interval is synced inline
+	if syncs, skipped := atomic.LoadInt64(&sn.chunkFsync.syncs), atomic.LoadInt64(&sn.chunkFsync.skipped); syncs != 1 || skipped != 2 {
+		t.Errorf("Expected 1 synced and 2 deferred chunk writes, got %d and %d", syncs, skipped)
+	}
+	if syncs := atomic.LoadInt64(&sn.indexFsync.syncs); syncs != 3 {
+		t.Errorf("Expected index policy unaffected with 3 syncs, got %d", syncs)
+	}
+
+	sn.chunkFsync.mu.Lock()
+	dirty := len(sn.chunkFsync.dirty)
+	sn.chunkFsync.mu.Unlock()
+	if dirty != 1 {
+		t.Fatalf("Expected the superblock to be left dirty, got %d dirty files", dirty)
+	}
+
+	sn.chunkFsync.flush()
+	sn.chunkFsync.mu.Lock()
+	dirty = len(sn.chunkFsync.dirty)
+	sn.chunkFsync.mu.Unlock()
+	if dirty != 0 {
+		t.Errorf("Expected flush to clear dirty files, got %d", dirty)
+	}
+}
+
+func TestIntervalFlusherRuns(t *testing.T) {
+	t.Setenv("INDEX_FSYNC_POLICY", FsyncInterval)
+	t.Setenv("FSYNC_INTERVAL", "50ms")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	defer sn.Shutdown()
+
+	sn.indexFsync.due(sn.indexFile) // consumes the inline sync for this interval
+	sn.indexFsync.due(sn.indexFile)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sn.indexFsync.mu.Lock()
+		dirty := len(sn.indexFsync.dirty)
+		sn.indexFsync.mu.Unlock()
+		if dirty == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected background flusher to sync the deferred index write")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFsyncPolicyDefaultsBoth(t *testing.T) {
+	t.Setenv("FSYNC_POLICY", FsyncInterval)
+	sn := NewStorageNode(t.TempDir(), "test-node")
+	if sn.chunkFsync.mode != FsyncInterval || sn.indexFsync.mode != FsyncInterval {
+		t.Errorf("Expected FSYNC_POLICY to set both policies, got %s/%s", sn.chunkFsync.mode, sn.indexFsync.mode)
+	}
+
+	t.Setenv("INDEX_FSYNC_POLICY", FsyncAlways)
+	sn = NewStorageNode(t.TempDir(), "test-node")
+	if sn.chunkFsync.mode != FsyncInterval || sn.indexFsync.mode != FsyncAlways {
+		t.Errorf("Expected INDEX_FSYNC_POLICY to override FSYNC_POLICY, got %s/%s", sn.chunkFsync.mode, sn.indexFsync.mode)
+	}
+
+	t.Setenv("FSYNC_POLICY", "sometimes")
+	t.Setenv("INDEX_FSYNC_POLICY", "")
+	sn = NewStorageNode(t.TempDir(), "test-node")
+	if sn.chunkFsync.mode != FsyncAlways || sn.indexFsync.mode != FsyncAlways {
+		t.Errorf("Expected an invalid FSYNC_POLICY to fall back to always, got %s/%s", sn.chunkFsync.mode, sn.indexFsync.mode)
+	}
+}
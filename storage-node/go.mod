@@ -2,4 +2,7 @@ module storage-node
 
 go 1.21
 
-require github.com/gorilla/mux v1.8.1
+require (
+	github.com/gorilla/mux v1.8.1
+	github.com/klauspost/compress v1.17.11
+)
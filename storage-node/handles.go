@@ -0,0 +1,182 @@
+package main
+
+import (
+	"container/list"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSuperblockHandleCacheSize is how many superblock files stay open for
+// reads (see SUPERBLOCK_HANDLE_CACHE)
+const DefaultSuperblockHandleCacheSize = 64
+
+// Read modes (see READ_MODE)
+const (
+	ReadModePread = "pread" // read chunks with ReadAt into a fresh buffer
+	ReadModeMmap  = "mmap"  // serve chunks from read-only mappings of cached handles
+)
+
+// handleCache is an LRU cache of open superblock files, so reads skip an
+// open and close per GET. Handles are only read with ReadAt, which keeps no
+// file position, so one handle serves concurrent readers. A handle evicted
+// or invalidated while in use is closed when its last reader releases it.
+// A cache with maxHandles <= 0 is disabled and opens a file per read.
+//
+// With mmap set (READ_MODE=mmap) each cached handle also maps the file as it
+// was when opened. The mapping lives as long as the handle, so a slice of it
+// stays valid until the reader holding it releases the handle.
+type handleCache struct {
+	mu         sync.Mutex
+	maxHandles int
+	mmap       bool
+	ll         *list.List
+	items      map[int]*list.Element // superblock ID -> *superblockHandle
+	gens       map[int]uint64        // bumped by invalidate, so stale opens aren't cached
+
+	opens         int64 // atomic
+	hits          int64 // atomic
+	mappedReads   int64 // atomic, reads served from a mapping
+	mmapFallbacks int64 // atomic, reads past the end of a mapping
+}
+
+// superblockHandle is a shared open superblock file
+type superblockHandle struct {
+	id      int
+	file    *os.File
+	mapped  []byte // the file's first len(mapped) bytes, nil if not mapped
+	refs    int    // readers holding the handle, guarded by handleCache.mu
+	evicted bool   // no longer cached; closed once refs reach 0
+}
+
+// close unmaps and closes the file once no reader holds the handle
+func (h *superblockHandle) close() {
+	if h.mapped != nil {
+		if err := munmapFile(h.mapped); err != nil {
+			log.Printf("Warning: failed to unmap superblock %d: %v", h.id, err)
+		}
+		h.mapped = nil
+	}
+	h.file.Close()
+}
+
+func newHandleCache(maxHandles int) *handleCache {
+	return &handleCache{
+		maxHandles: maxHandles,
+		ll:         list.New(),
+		items:      make(map[int]*list.Element),
+		gens:       make(map[int]uint64),
+	}
+}
+
+// acquire returns an open handle on the superblock at path. The caller must
+// release it and must not close its file.
+func (c *handleCache) acquire(id int, path string) (*superblockHandle, error) {
+	c.mu.Lock()
+	if elem, ok := c.items[id]; ok {
+		c.ll.MoveToFront(elem)
+		h := elem.Value.(*superblockHandle)
+		h.refs++
+		c.mu.Unlock()
+		atomic.AddInt64(&c.hits, 1)
+		return h, nil
+	}
+	gen := c.gens[id]
+	c.mu.Unlock()
+
+	// Open without the lock so a slow open doesn't stall reads of other
+	// superblocks
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&c.opens, 1)
+	h := &superblockHandle{id: id, file: file, refs: 1, evicted: true}
+	// Mapping a file for a single read costs more than reading it
+	if c.mmap && c.maxHandles > 0 {
+		h.mapped = mapSuperblock(id, file)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxHandles <= 0 || c.gens[id] != gen {
+		return h, nil // Uncached; the file may have been replaced since it was opened
+	}
+	if elem, ok := c.items[id]; ok {
+		// Another reader cached it first
+		h.close()
+		existing := elem.Value.(*superblockHandle)
+		existing.refs++
+		return existing, nil
+	}
+	h.evicted = false
+	c.items[id] = c.ll.PushFront(h)
+	for c.ll.Len() > c.maxHandles {
+		c.evict(c.ll.Back())
+	}
+	return h, nil
+}
+
+// release returns a handle obtained from acquire
+func (c *handleCache) release(h *superblockHandle) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h.refs--
+	if h.evicted && h.refs == 0 {
+		h.close()
+	}
+}
+
+// invalidate drops the cached handle of a superblock whose file was replaced
+// or removed. Must be called after the file changed, so reads opening it
+// again get the new file.
+func (c *handleCache) invalidate(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gens[id]++
+	if elem, ok := c.items[id]; ok {
+		c.evict(elem)
+	}
+}
+
+// closeAll drops every cached handle
+func (c *handleCache) closeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.ll.Len() > 0 {
+		c.evict(c.ll.Back())
+	}
+}
+
+// evict removes a handle from the cache. Caller must hold c.mu.
+func (c *handleCache) evict(elem *list.Element) {
+	h := elem.Value.(*superblockHandle)
+	c.ll.Remove(elem)
+	delete(c.items, h.id)
+	h.evicted = true
+	if h.refs == 0 {
+		h.close()
+	}
+}
+
+func (c *handleCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// mapSuperblock maps an open superblock file read-only, returning nil if it
+// is empty or can't be mapped so reads fall back to ReadAt
+func mapSuperblock(id int, file *os.File) []byte {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 || int64(int(info.Size())) != info.Size() {
+		return nil
+	}
+	mapped, err := mmapFile(file, int(info.Size()))
+	if err != nil {
+		log.Printf("Warning: failed to map superblock %d, reading it with ReadAt: %v", id, err)
+		return nil
+	}
+	return mapped
+}
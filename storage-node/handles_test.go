@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHandleCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	paths := make([]string, 3)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("superblock_%d.dat", i))
+		if err := os.WriteFile(paths[i], []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	c := newHandleCache(2)
+	held, err := c.acquire(0, paths[0])
+	if err != nil {
+		t.Fatalf("Failed to acquire handle: %v", err)
+	}
+	for _, id := range []int{1, 2} {
+		h, err := c.acquire(id, paths[id])
+		if err != nil {
+			t.Fatalf("Failed to acquire handle: %v", err)
+		}
+		c.release(h)
+	}
+	if c.size() != 2 {
+		t.Errorf("Expected 2 cached handles, got %d", c.size())
+	}
+
+	// Evicted while held: still readable until released, closed after
+	buf := make([]byte, 4)
+	if _, err := held.file.ReadAt(buf, 0); err != nil {
+		t.Errorf("Expected an evicted handle to stay open while held, got %v", err)
+	}
+	c.release(held)
+	if _, err := held.file.ReadAt(buf, 0); err == nil {
+		t.Error("Expected the evicted handle to be closed once released")
+	}
+
+	h, _ := c.acquire(2, paths[2])
+	c.release(h)
+	if hits := atomic.LoadInt64(&c.hits); hits != 1 {
+		t.Errorf("Expected 1 cache hit, got %d", hits)
+	}
+	c.closeAll()
+	if c.size() != 0 {
+		t.Errorf("Expected no cached handles after closeAll, got %d", c.size())
+	}
+}
+
+func TestHandleCacheInvalidatedOnCompaction(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	deleted := bytes.Repeat([]byte("d"), 1000)
+	kept := bytes.Repeat([]byte("k"), 1000)
+	// "kept" moves to offset 0 when compacted, so a stale handle reads "deleted"
+	if err := sn.storeChunk("deleted", deleted, fmt.Sprintf("%x", sha256.Sum256(deleted))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	if err := sn.storeChunk("kept", kept, fmt.Sprintf("%x", sha256.Sum256(kept))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	entry, _ := sn.lookupChunk("kept")
+	if _, err := sn.readChunk(entry); err != nil { // Caches the handle
+		t.Fatalf("Failed to read chunk: %v", err)
+	}
+	if !sn.deleteChunk("deleted") {
+		t.Fatal("Failed to delete chunk")
+	}
+
+	sn.mu.Lock()
+	sn.currentSuperblock++
+	sn.mu.Unlock()
+	if _, err := sn.CompactSuperblock(entry.SuperblockID); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	entry, _ = sn.lookupChunk("kept")
+	got, err := sn.readChunk(entry)
+	if err != nil || !bytes.Equal(got, kept) {
+		t.Errorf("Expected the compacted chunk through a fresh handle, got error %v", err)
+	}
+}
+
+func benchmarkReadChunk(b *testing.B, handles int, readMode string) {
+	b.Setenv("SUPERBLOCK_HANDLE_CACHE", fmt.Sprint(handles))
+	b.Setenv("READ_MODE", readMode)
+	tempDir := b.TempDir()
+	sn := NewStorageNode(tempDir, "bench-node")
+	if err := sn.Initialize(); err != nil {
+		b.Fatalf("Failed to initialize: %v", err)
+	}
+	defer sn.Shutdown()
+
+	data := bytes.Repeat([]byte("r"), 4096)
+	if err := sn.storeChunk("bench", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		b.Fatalf("Failed to store chunk: %v", err)
+	}
+	entry, _ := sn.lookupChunk("bench")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, release, err := sn.readChunkView(entry)
+		if err != nil {
+			b.Fatal(err)
+		}
+		release()
+	}
+}
+
+// BenchmarkReadChunk compares reads opening the superblock each time against
+// reads sharing a cached handle, and ReadAt against slicing a mapping. All
+// are far inside MaxRetrievalLatency; mmap saves the syscall and the copy.
+func BenchmarkReadChunk(b *testing.B) {
+	b.Run("open_per_read", func(b *testing.B) { benchmarkReadChunk(b, 0, ReadModePread) })
+	b.Run("cached_handle", func(b *testing.B) { benchmarkReadChunk(b, DefaultSuperblockHandleCacheSize, ReadModePread) })
+	b.Run("mmap", func(b *testing.B) { benchmarkReadChunk(b, DefaultSuperblockHandleCacheSize, ReadModeMmap) })
+}
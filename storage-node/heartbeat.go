@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat configuration
+const (
+	DefaultHeartbeatInterval = 30 * time.Second
+	HeartbeatTimeout         = 10 * time.Second
+	HeartbeatJitterFraction  = 0.2
+
+	// Heartbeat intervals without contact before the metadata connection is
+	// considered lost
+	MetadataStaleHeartbeats = 3
+)
+
+// Metadata connection sub-statuses
+const (
+	MetadataStatusOK       = "ok"
+	MetadataStatusWarning  = "warning"
+	MetadataStatusDisabled = "disabled" // No metadata service configured
+)
+
+// MetadataHealth describes the node's connection to the metadata service
+type MetadataHealth struct {
+	Status           string     `json:"status"`
+	Registered       bool       `json:"registered"`
+	LastHeartbeat    *time.Time `json:"last_heartbeat,omitempty"`
+	FailedHeartbeats int64      `json:"failed_heartbeats"`
+}
+
+// HeartbeatRequest mirrors the metadata service heartbeat payload
+type HeartbeatRequest struct {
+	DiskUsagePercent float64 `json:"disk_usage_percent"`
+	ChunkCount       int     `json:"chunk_count"`
+	Version          string  `json:"version"`
+	ClusterEpoch     int64   `json:"cluster_epoch,omitempty"`
+	NodeTopology
+}
+
+// flightGroup coalesces concurrent calls sharing a key into a single
+// in-flight execution whose result is handed to every caller.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+// Do runs fn unless a call for key is already in flight, in which case it
+// waits for that call and returns its result. shared reports whether the
+// result came from another caller's execution.
+func (g *flightGroup) Do(key string, fn func() error) (shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return true, c.err
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return false, c.err
+}
+
+// jitter spreads d randomly by +/- fraction so that many nodes restarting
+// together don't hit the metadata service in lockstep
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if d <= 0 || fraction <= 0 {
+		return d
+	}
+	delta := (rand.Float64()*2 - 1) * fraction * float64(d)
+	return d + time.Duration(delta)
+}
+
+// sendHeartbeat reports disk usage and chunk count to the metadata service.
+// Overlapping heartbeats to the same endpoint share one outbound request.
+func (sn *StorageNode) sendHeartbeat(ctx context.Context, metadataURL string) error {
+	url := fmt.Sprintf("%s/nodes/%s/heartbeat", metadataURL, sn.nodeID)
+
+	_, err := sn.flights.Do("heartbeat "+url, func() error {
+		sn.index.mu.RLock()
+		chunkCount := len(sn.index.chunks)
+		sn.index.mu.RUnlock()
+
+		body, err := json.Marshal(HeartbeatRequest{
+			DiskUsagePercent: sn.getDiskUsage(),
+			ChunkCount:       chunkCount,
+			Version:          NodeVersion,
+			ClusterEpoch:     atomic.LoadInt64(&sn.clusterEpoch),
+			NodeTopology:     sn.topology,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal heartbeat: %w", err)
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, HeartbeatTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(reqCtx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create heartbeat request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("heartbeat request failed: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("heartbeat failed with status: %d", resp.StatusCode)
+		}
+		return nil
+	})
+
+	if err != nil {
+		atomic.AddInt64(&sn.failedHeartbeats, 1)
+	} else {
+		atomic.StoreInt64(&sn.failedHeartbeats, 0)
+		atomic.StoreInt64(&sn.lastHeartbeat, time.Now().UnixNano())
+	}
+	return err
+}
+
+// startHeartbeats schedules jittered periodic heartbeats until shutdown
+func (sn *StorageNode) startHeartbeats(metadataURL string) {
+	sn.tasks.every("heartbeat", sn.heartbeatEvery(), HeartbeatJitterFraction, func(ctx context.Context) {
+		if atomic.LoadInt32(&sn.deregistered) == 1 {
+			return // Deregistered until health recovers
+		}
+		if err := sn.sendHeartbeat(ctx, metadataURL); err != nil && ctx.Err() == nil {
+			log.Printf("Heartbeat failed: %v", err)
+		}
+	})
+}
+
+// metadataHealth reports whether the node believes it is registered with and
+// reachable by the metadata service. A node that hasn't heard back for
+// MetadataStaleHeartbeats intervals may have been dropped from the cluster.
+func (sn *StorageNode) metadataHealth() MetadataHealth {
+	health := MetadataHealth{
+		Status:           MetadataStatusOK,
+		Registered:       atomic.LoadInt32(&sn.registered) == 1,
+		FailedHeartbeats: atomic.LoadInt64(&sn.failedHeartbeats),
+	}
+	if sn.metadataURL == "" {
+		health.Status = MetadataStatusDisabled
+		return health
+	}
+
+	staleAfter := time.Duration(MetadataStaleHeartbeats) * sn.heartbeatEvery()
+	if last := atomic.LoadInt64(&sn.lastHeartbeat); last != 0 {
+		lastHeartbeat := time.Unix(0, last)
+		health.LastHeartbeat = &lastHeartbeat
+		if time.Since(lastHeartbeat) > staleAfter {
+			health.Status = MetadataStatusWarning
+		}
+	}
+	if !health.Registered || health.FailedHeartbeats >= MetadataStaleHeartbeats {
+		health.Status = MetadataStatusWarning
+	}
+	return health
+}
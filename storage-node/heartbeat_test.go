@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrentHeartbeatsCoalesce(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	var requests int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.URL.Path != "/nodes/test-node/heartbeat" {
+			t.Errorf("Unexpected heartbeat path %s", r.URL.Path)
+		}
+		var hb HeartbeatRequest
+		if err := json.NewDecoder(r.Body).Decode(&hb); err != nil {
+			t.Errorf("Failed to decode heartbeat body: %v", err)
+		}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	const numTriggers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, numTriggers)
+	for i := 0; i < numTriggers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- sn.sendHeartbeat(context.Background(), server.URL)
+		}()
+	}
+
+	// Give every goroutine a chance to join the in-flight request
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Heartbeat failed: %v", err)
+		}
+	}
+
+	if got := atomic.LoadInt64(&requests); got != 1 {
+		t.Errorf("Expected 1 outbound heartbeat request, got %d", got)
+	}
+}
+
+func TestConcurrentRegistrationsCoalesce(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	var requests int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sn.registerNode(context.Background(), server.URL, "http://node:8081"); err != nil {
+				t.Errorf("Registration failed: %v", err)
+			}
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt64(&requests); got != 1 {
+		t.Errorf("Expected 1 outbound registration request, got %d", got)
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	base := 10 * time.Second
+	for i := 0; i < 1000; i++ {
+		d := jitter(base, HeartbeatJitterFraction)
+		if d < 8*time.Second || d > 12*time.Second {
+			t.Fatalf("Jittered duration %v outside +/-20%% of %v", d, base)
+		}
+	}
+}
+
+func TestHealthMetadataSubStatus(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	health := func() HealthResponse {
+		req := httptest.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+		sn.handleHealth(w, req)
+
+		var resp HealthResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode health response: %v", err)
+		}
+		return resp
+	}
+
+	if got := health().Metadata.Status; got != MetadataStatusDisabled {
+		t.Errorf("Expected %s without a metadata service, got %s", MetadataStatusDisabled, got)
+	}
+
+	sn.metadataURL = server.URL
+	if resp := health(); resp.Metadata.Status != MetadataStatusWarning || resp.Status != "warning" {
+		t.Errorf("Expected warning before registration, got %s (overall %s)", resp.Metadata.Status, resp.Status)
+	}
+
+	if err := sn.registerNode(context.Background(), server.URL, "http://node"); err != nil {
+		t.Fatalf("Registration failed: %v", err)
+	}
+	if err := sn.sendHeartbeat(context.Background(), server.URL); err != nil {
+		t.Fatalf("Heartbeat failed: %v", err)
+	}
+	resp := health()
+	if resp.Metadata.Status != MetadataStatusOK || !resp.Metadata.Registered || resp.Metadata.LastHeartbeat == nil {
+		t.Errorf("Expected registered, healthy metadata connection, got %+v", resp.Metadata)
+	}
+	if resp.Status != "healthy" {
+		t.Errorf("Expected overall status healthy, got %s", resp.Status)
+	}
+
+	// A single missed heartbeat is tolerated
+	atomic.StoreInt32(&failing, 1)
+	sn.sendHeartbeat(context.Background(), server.URL)
+	if got := health().Metadata.Status; got != MetadataStatusOK {
+		t.Errorf("Expected %s after one failed heartbeat, got %s", MetadataStatusOK, got)
+	}
+
+	for i := 1; i < MetadataStaleHeartbeats; i++ {
+		sn.sendHeartbeat(context.Background(), server.URL)
+	}
+	resp = health()
+	if resp.Metadata.Status != MetadataStatusWarning || resp.Status != "warning" {
+		t.Errorf("Expected warning after %d failed heartbeats, got %s (overall %s)",
+			MetadataStaleHeartbeats, resp.Metadata.Status, resp.Status)
+	}
+	if resp.Metadata.FailedHeartbeats != MetadataStaleHeartbeats {
+		t.Errorf("Expected %d failed heartbeats, got %d", MetadataStaleHeartbeats, resp.Metadata.FailedHeartbeats)
+	}
+
+	t.Run("stale_last_heartbeat", func(t *testing.T) {
+		atomic.StoreInt32(&failing, 0)
+		sn.sendHeartbeat(context.Background(), server.URL)
+		sn.heartbeatInterval = time.Millisecond
+		time.Sleep(10 * time.Millisecond)
+
+		if got := health().Metadata.Status; got != MetadataStatusWarning {
+			t.Errorf("Expected warning when heartbeats stop arriving, got %s", got)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NodeIdentityFile records, inside the data directory, the ID of the node
+// that owns it
+const NodeIdentityFile = "node_id"
+
+var errNodeIDMismatch = errors.New("data directory belongs to another node")
+
+// checkNodeIdentity claims an unowned data directory for this node and
+// refuses one owned by a different node ID, e.g. after a volume is mounted
+// on the wrong host. ALLOW_NODE_ID_MISMATCH=true hands the directory over to
+// the configured ID instead.
+func (sn *StorageNode) checkNodeIdentity() error {
+	path := filepath.Join(sn.dataDir, NodeIdentityFile)
+	stored, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return sn.writeNodeIdentity(path)
+	case err != nil:
+		return fmt.Errorf("failed to read node identity: %w", err)
+	}
+
+	owner := strings.TrimSpace(string(stored))
+	if owner == sn.nodeID {
+		return nil
+	}
+	if !sn.allowNodeIDMismatch {
+		return fmt.Errorf("%w: %s is owned by node %q, not %q (set ALLOW_NODE_ID_MISMATCH=true to take it over)",
+			errNodeIDMismatch, sn.dataDir, owner, sn.nodeID)
+	}
+	log.Printf("WARNING: taking over data directory %s from node %q as node %q (ALLOW_NODE_ID_MISMATCH)",
+		sn.dataDir, owner, sn.nodeID)
+	return sn.writeNodeIdentity(path)
+}
+
+func (sn *StorageNode) writeNodeIdentity(path string) error {
+	tempFile := sn.tempPath(path)
+	if err := os.WriteFile(tempFile, []byte(sn.nodeID+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write node identity: %w", err)
+	}
+	if err := sn.replaceFile(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write node identity: %w", err)
+	}
+	return syncDir(filepath.Dir(path))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNodeRefusesAnotherNodesDataDir(t *testing.T) {
+	dataDir := t.TempDir()
+	owner := NewStorageNode(dataDir, "node-a")
+	if err := owner.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize owner: %v", err)
+	}
+	owner.Shutdown()
+
+	stored, err := os.ReadFile(filepath.Join(dataDir, NodeIdentityFile))
+	if err != nil || strings.TrimSpace(string(stored)) != "node-a" {
+		t.Fatalf("Expected node-a persisted in the data dir, got %q (%v)", stored, err)
+	}
+
+	// Restarting under the same ID is fine
+	same := NewStorageNode(dataDir, "node-a")
+	if err := same.Initialize(); err != nil {
+		t.Fatalf("Expected restart with the same ID to succeed: %v", err)
+	}
+	same.Shutdown()
+
+	intruder := NewStorageNode(dataDir, "node-b")
+	if err := intruder.Initialize(); !errors.Is(err, errNodeIDMismatch) {
+		t.Fatalf("Expected startup to be refused for a mismatched node ID, got %v", err)
+	}
+}
+
+func TestAllowNodeIDMismatchTakesOverDataDir(t *testing.T) {
+	dataDir := t.TempDir()
+	owner := NewStorageNode(dataDir, "node-a")
+	if err := owner.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize owner: %v", err)
+	}
+	owner.Shutdown()
+
+	t.Setenv("ALLOW_NODE_ID_MISMATCH", "true")
+	successor := NewStorageNode(dataDir, "node-b")
+	if err := successor.Initialize(); err != nil {
+		t.Fatalf("Expected the override to allow startup: %v", err)
+	}
+	successor.Shutdown()
+
+	stored, _ := os.ReadFile(filepath.Join(dataDir, NodeIdentityFile))
+	if strings.TrimSpace(string(stored)) != "node-b" {
+		t.Errorf("Expected the data dir handed over to node-b, got %q", stored)
+	}
+}
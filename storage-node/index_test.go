@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestGetByChecksum(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleDeleteChunk).Methods("DELETE")
+	r.HandleFunc("/by-checksum/{checksum}", sn.handleGetByChecksum).Methods("GET")
+
+	data := []byte("content addressed chunk data")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	// Two chunk IDs sharing the same content
+	for _, chunkID := range []string{"dedup-b", "dedup-a"} {
+		if err := sn.storeChunk(chunkID, data, checksum); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+	}
+
+	t.Run("fetch_by_checksum", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/by-checksum/"+checksum, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		if !bytes.Equal(w.Body.Bytes(), data) {
+			t.Error("Retrieved data doesn't match original")
+		}
+		if got := w.Header().Get("X-Chunk-ID"); got != "dedup-a" {
+			t.Errorf("Expected deterministic chunk dedup-a, got %s", got)
+		}
+	})
+
+	t.Run("fallback_after_delete", func(t *testing.T) {
+		delReq := httptest.NewRequest("DELETE", "/chunk/dedup-a", nil)
+		delW := httptest.NewRecorder()
+		r.ServeHTTP(delW, delReq)
+		if delW.Code != http.StatusNoContent {
+			t.Fatalf("Failed to delete chunk: %d", delW.Code)
+		}
+
+		req := httptest.NewRequest("GET", "/by-checksum/"+checksum, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		if got := w.Header().Get("X-Chunk-ID"); got != "dedup-b" {
+			t.Errorf("Expected remaining chunk dedup-b, got %s", got)
+		}
+	})
+
+	t.Run("unknown_checksum_returns_404", func(t *testing.T) {
+		other := fmt.Sprintf("%x", sha256.Sum256([]byte("never stored")))
+		req := httptest.NewRequest("GET", "/by-checksum/"+other, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+
+	t.Run("invalid_checksum_returns_400", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/by-checksum/not-a-checksum", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("secondary_index_rebuilt_on_load", func(t *testing.T) {
+		// Shut down cleanly so the deferred index save for the delete lands
+		sn.Shutdown()
+		sn2 := NewStorageNode(tempDir, "test-node")
+		if err := sn2.Initialize(); err != nil {
+			t.Fatalf("Failed to initialize storage node after restart: %v", err)
+		}
+
+		sn2.index.mu.RLock()
+		entry, ok := sn2.index.lookupChecksum(checksum)
+		sn2.index.mu.RUnlock()
+
+		if !ok || entry.ChunkID != "dedup-b" {
+			t.Errorf("Expected dedup-b by checksum after restart, got %+v (found=%v)", entry, ok)
+		}
+	})
+}
+
+func TestTruncatedIndexNotPartiallyLoaded(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "storage_node_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer cleanupTestStorageNode(tempDir)
+
+	// Valid for the first entries, then cut off mid-entry
+	if err := os.MkdirAll(filepath.Join(tempDir, "index"), 0755); err != nil {
+		t.Fatalf("Failed to create index dir: %v", err)
+	}
+	content := `{"chunk-a":{"chunk_id":"chunk-a","superblock_id":0,"offset":0,"size":4,"checksum":"aaaaaaaa"},` +
+		`"chunk-b":{"chunk_id":"chunk-b","superblock_id":0,"offset":4,"size":4,"checksum":"bbbbbbbb"},` +
+		`"chunk-c":{"chunk_id":"chunk-c","superb`
+	if err := os.WriteFile(filepath.Join(tempDir, "index", "chunk_index.json"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write index file: %v", err)
+	}
+
+	sn := NewStorageNode(tempDir, "test-node")
+	if err := sn.loadIndex(); err == nil {
+		t.Error("Expected loadIndex to fail on a truncated index")
+	}
+	if sn.index.chunks == nil || len(sn.index.chunks) != 0 {
+		t.Fatalf("Expected empty index after failed load, got %d entries", len(sn.index.chunks))
+	}
+	if matches, _ := filepath.Glob(sn.indexFile + ".corrupt-*"); len(matches) != 1 {
+		t.Errorf("Expected the corrupt index to be preserved, found %v", matches)
+	}
+
+	// The node still starts and accepts writes with the empty index
+	if err := sn.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage node: %v", err)
+	}
+	if len(sn.index.chunks) != 0 {
+		t.Errorf("Expected empty index after Initialize, got %d entries", len(sn.index.chunks))
+	}
+	data := []byte("written after failed load")
+	if err := sn.storeChunk("after-load", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Errorf("Failed to store chunk after failed index load: %v", err)
+	}
+}
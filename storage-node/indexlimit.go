@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Index size limits (see MAX_INDEX_ENTRIES)
+const (
+	IndexEntriesWarningFraction = 0.9 // health warns above this share of the limit
+	EstimatedIndexEntryBytes    = 384 // entry, IDs, checksum index and map overhead
+)
+
+// IndexStats describes the in-memory index in /stats
+type IndexStats struct {
+	Entries              int   `json:"entries"`
+	MaxEntries           int   `json:"max_entries,omitempty"`
+	EstimatedMemoryBytes int64 `json:"estimated_memory_bytes"`
+}
+
+func (sn *StorageNode) indexEntries() int {
+	sn.index.mu.RLock()
+	defer sn.index.mu.RUnlock()
+	return len(sn.index.chunks)
+}
+
+// indexStats reports the index's size. Memory is a per-entry estimate, not
+// a measurement.
+func (sn *StorageNode) indexStats() IndexStats {
+	entries := sn.indexEntries()
+	return IndexStats{
+		Entries:              entries,
+		MaxEntries:           sn.maxIndexEntries,
+		EstimatedMemoryBytes: int64(entries) * EstimatedIndexEntryBytes,
+	}
+}
+
+// indexUsage returns the index's share of MAX_INDEX_ENTRIES in percent; ok
+// is false when there is no limit
+func (sn *StorageNode) indexUsage(entries int) (percent float64, ok bool) {
+	if sn.maxIndexEntries <= 0 {
+		return 0, false
+	}
+	return float64(entries) / float64(sn.maxIndexEntries) * 100.0, true
+}
+
+// checkIndexCapacity rejects writes once the index holds MAX_INDEX_ENTRIES
+// chunks, so a node short of memory reports itself full (507) instead of
+// growing the index until it is OOM-killed. Crossing the warning threshold
+// is logged once per approach.
+func (sn *StorageNode) checkIndexCapacity() error {
+	if sn.maxIndexEntries <= 0 {
+		return nil
+	}
+	entries := sn.indexEntries()
+	if entries >= sn.maxIndexEntries {
+		return fmt.Errorf("insufficient storage space: index holds %d entries, maximum %d", entries, sn.maxIndexEntries)
+	}
+	if float64(entries) >= float64(sn.maxIndexEntries)*IndexEntriesWarningFraction {
+		if atomic.CompareAndSwapInt32(&sn.indexLimitWarned, 0, 1) {
+			log.Printf("WARNING: index holds %d entries, approaching MAX_INDEX_ENTRIES %d", entries, sn.maxIndexEntries)
+		}
+	} else {
+		atomic.StoreInt32(&sn.indexLimitWarned, 0)
+	}
+	return nil
+}
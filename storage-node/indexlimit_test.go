@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWritesRejectedAtIndexLimit(t *testing.T) {
+	t.Setenv("MAX_INDEX_ENTRIES", "10")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	put := func(chunkID string) int {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader([]byte("data for "+chunkID))))
+		return rr.Code
+	}
+	health := func() HealthResponse {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+		var h HealthResponse
+		if err := json.NewDecoder(rr.Body).Decode(&h); err != nil {
+			t.Fatalf("Failed to decode health: %v", err)
+		}
+		return h
+	}
+
+	for i := 0; i < 9; i++ {
+		if code := put(fmt.Sprintf("indexed-%d", i)); code != http.StatusCreated {
+			t.Fatalf("Expected 201 below the limit, got %d", code)
+		}
+	}
+	if h := health(); h.Status != "warning" || h.IndexUsage == nil || *h.IndexUsage != 90 {
+		t.Errorf("Expected warning health at 90%% of the limit, got %s (%v)", h.Status, h.IndexUsage)
+	}
+
+	if code := put("indexed-9"); code != http.StatusCreated {
+		t.Fatalf("Expected 201 up to the limit, got %d", code)
+	}
+	if code := put("indexed-10"); code != http.StatusInsufficientStorage {
+		t.Fatalf("Expected 507 beyond the limit, got %d", code)
+	}
+	if h := health(); h.Status != "critical" {
+		t.Errorf("Expected critical health at the limit, got %s", h.Status)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/stats", nil))
+	var stats StatsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	if stats.Index.Entries != 10 || stats.Index.MaxEntries != 10 || stats.Index.EstimatedMemoryBytes != 10*EstimatedIndexEntryBytes {
+		t.Errorf("Expected 10 of 10 entries in stats, got %+v", stats.Index)
+	}
+
+	// Deleting makes room again
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/chunk/indexed-0", nil))
+	if code := put("indexed-10"); code != http.StatusCreated {
+		t.Errorf("Expected 201 after a delete freed an entry, got %d", code)
+	}
+}
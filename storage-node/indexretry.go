@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Failed index save retry defaults (see INDEX_SAVE_RETRY_INTERVAL and
+// INDEX_SAVE_ALERT_AFTER)
+const (
+	DefaultIndexSaveRetryInterval = 5 * time.Second
+	MaxIndexSaveRetryBackoff      = 5 * time.Minute
+	DefaultIndexSaveAlertAfter    = 5
+	AlertWebhookTimeout           = 10 * time.Second
+)
+
+// indexSaveRetry tracks the backoff between retries of a failed index save
+type indexSaveRetry struct {
+	mu      sync.Mutex
+	backoff time.Duration // wait after the next failed retry, 0 before the first
+	next    time.Time     // no retry before this
+	alerted bool          // the alert webhook fired for the current failure streak
+}
+
+// IndexSaveAlert is the body POSTed to ALERT_WEBHOOK_URL
+type IndexSaveAlert struct {
+	NodeID      string    `json:"node_id"`
+	Alert       string    `json:"alert"`
+	FailedSaves int64     `json:"failed_saves"`
+	Error       string    `json:"error"`
+	Time        time.Time `json:"time"`
+}
+
+// retryFailedIndexSave re-attempts the index save while failedIndexSaves is
+// non-zero, doubling the wait after every failed retry up to
+// MaxIndexSaveRetryBackoff. Once INDEX_SAVE_ALERT_AFTER saves in a row have
+// failed the alert webhook fires, once per failure streak.
+func (sn *StorageNode) retryFailedIndexSave(ctx context.Context) {
+	r := &sn.indexRetry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if atomic.LoadInt64(&sn.failedIndexSaves) == 0 {
+		r.backoff, r.next, r.alerted = 0, time.Time{}, false
+		return
+	}
+	if time.Now().Before(r.next) {
+		return
+	}
+
+	err := sn.saveIndex()
+	if err == nil {
+		log.Printf("Index save succeeded on retry")
+		r.backoff, r.next, r.alerted = 0, time.Time{}, false
+		return
+	}
+
+	if r.backoff == 0 {
+		r.backoff = sn.indexSaveRetryInterval
+	} else {
+		r.backoff = min(2*r.backoff, MaxIndexSaveRetryBackoff)
+	}
+	r.next = time.Now().Add(r.backoff)
+	failed := atomic.LoadInt64(&sn.failedIndexSaves)
+	log.Printf("Warning: index save retry failed (%d failures in a row, next retry in %v): %v", failed, r.backoff, err)
+
+	if r.alerted || failed < int64(sn.indexSaveAlertAfter) {
+		return
+	}
+	r.alerted = true
+	if sn.alertWebhookURL == "" {
+		return
+	}
+	if err := sn.sendAlert(ctx, IndexSaveAlert{
+		NodeID:      sn.nodeID,
+		Alert:       "index_save_failed",
+		FailedSaves: failed,
+		Error:       err.Error(),
+		Time:        time.Now(),
+	}); err != nil {
+		log.Printf("Failed to send index save alert: %v", err)
+	}
+}
+
+// sendAlert POSTs alert as JSON to ALERT_WEBHOOK_URL
+func (sn *StorageNode) sendAlert(ctx context.Context, alert interface{}) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, AlertWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "POST", sn.alertWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("alert request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
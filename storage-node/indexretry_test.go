@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIndexSaveRetryClearsFailures(t *testing.T) {
+	t.Setenv("INDEX_SAVE_RETRY_INTERVAL", "0")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.indexSaveRetryInterval = time.Hour
+
+	renameFile = func(oldpath, newpath string) error {
+		return errors.New("simulated rename failure")
+	}
+	err := sn.saveIndex()
+	renameFile = os.Rename
+	if err == nil {
+		t.Fatal("Expected the index save to fail")
+	}
+	if failed := atomic.LoadInt64(&sn.failedIndexSaves); failed != 1 {
+		t.Fatalf("Expected 1 failed save, got %d", failed)
+	}
+
+	sn.retryFailedIndexSave(context.Background())
+	if failed := atomic.LoadInt64(&sn.failedIndexSaves); failed != 0 {
+		t.Errorf("Expected the retry to clear the failure counter, got %d", failed)
+	}
+	if !sn.indexRetry.next.IsZero() || sn.indexRetry.backoff != 0 {
+		t.Error("Expected a successful retry to reset the backoff")
+	}
+}
+
+func TestIndexSaveRetryBacksOffAndAlerts(t *testing.T) {
+	t.Setenv("INDEX_SAVE_RETRY_INTERVAL", "0")
+	t.Setenv("INDEX_SAVE_ALERT_AFTER", "3")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.indexSaveRetryInterval = time.Hour
+
+	alerts := make(chan IndexSaveAlert, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert IndexSaveAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("Failed to decode alert: %v", err)
+		}
+		alerts <- alert
+	}))
+	defer webhook.Close()
+	sn.alertWebhookURL = webhook.URL
+	sn.indexSaveRetryInterval = time.Minute
+
+	renameFile = func(oldpath, newpath string) error {
+		return errors.New("simulated rename failure")
+	}
+	defer func() { renameFile = os.Rename }()
+	sn.saveIndex()
+
+	// Each failed retry doubles the wait; skip ahead past it
+	retry := func() {
+		sn.indexRetry.next = time.Time{}
+		sn.retryFailedIndexSave(context.Background())
+	}
+	retry()
+	if sn.indexRetry.backoff != time.Minute {
+		t.Errorf("Expected the first backoff to be the retry interval, got %v", sn.indexRetry.backoff)
+	}
+	if len(alerts) != 0 {
+		t.Error("Expected no alert after 2 failed saves")
+	}
+
+	// A retry before the backoff is up isn't attempted
+	sn.retryFailedIndexSave(context.Background())
+	if failed := atomic.LoadInt64(&sn.failedIndexSaves); failed != 2 {
+		t.Errorf("Expected the retry to wait out its backoff, got %d failed saves", failed)
+	}
+
+	retry()
+	if sn.indexRetry.backoff != 2*time.Minute {
+		t.Errorf("Expected the backoff to double, got %v", sn.indexRetry.backoff)
+	}
+	select {
+	case alert := <-alerts:
+		if alert.NodeID != "test-node" || alert.Alert != "index_save_failed" || alert.FailedSaves != 3 || alert.Error == "" {
+			t.Errorf("Unexpected alert: %+v", alert)
+		}
+	default:
+		t.Fatal("Expected an alert after 3 failed saves")
+	}
+
+	retry()
+	retry()
+	if len(alerts) != 0 {
+		t.Error("Expected one alert per failure streak")
+	}
+	if sn.indexRetry.backoff != MaxIndexSaveRetryBackoff {
+		t.Errorf("Expected the backoff to be capped at %v, got %v", MaxIndexSaveRetryBackoff, sn.indexRetry.backoff)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriteBurstSharesIndexSaves(t *testing.T) {
+	t.Setenv("INDEX_SAVE_DELAY", "1h")
+	t.Setenv("SMALL_CHUNK_BATCHING", "false")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	before := atomic.LoadInt64(&sn.indexSaves)
+	for i := 0; i < 50; i++ {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("PUT", fmt.Sprintf("/chunk/burst-%02d", i), bytes.NewReader([]byte(fmt.Sprintf("burst chunk %d", i)))))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d", rr.Code)
+		}
+	}
+	if saves := atomic.LoadInt64(&sn.indexSaves) - before; saves != 0 {
+		t.Errorf("Expected no index save within the delay, got %d", saves)
+	}
+	if !sn.uncheckpointed() {
+		t.Error("Expected the writes to be pending an index save")
+	}
+
+	// Graceful shutdown flushes the pending save
+	sn.Shutdown()
+	if saves := atomic.LoadInt64(&sn.indexSaves) - before; saves != 1 {
+		t.Errorf("Expected one index save at shutdown, got %d", saves)
+	}
+
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	if n := len(sn2.index.chunks); n != 50 {
+		t.Errorf("Expected 50 chunks after restart, got %d", n)
+	}
+}
+
+func TestDeleteBringsPendingIndexSaveForward(t *testing.T) {
+	t.Setenv("INDEX_SAVE_DELAY", "1h")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.deleteCoalesceWindow = 10 * time.Millisecond
+	router := sn.newRouter()
+
+	for _, chunkID := range []string{"kept", "deleted"} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader([]byte("chunk "+chunkID))))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d", rr.Code)
+		}
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/chunk/deleted", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", rr.Code)
+	}
+
+	// The delete's window applies, not the write delay
+	deadline := time.Now().Add(2 * time.Second)
+	for sn.uncheckpointed() {
+		if time.Now().After(deadline) {
+			t.Fatal("Delete did not bring the pending index save forward")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	if _, ok := sn2.index.chunks["kept"]; !ok || len(sn2.index.chunks) != 1 {
+		t.Errorf("Expected only the kept chunk after restart, have %d chunks", len(sn2.index.chunks))
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// indexSnapshot is an immutable copy of the index, sorted by chunk ID, that
+// listing endpoints read without taking the index lock
+type indexSnapshot struct {
+	entries []ChunkEntry
+	gen     uint64    // index generation it was copied at
+	takenAt time.Time // when it was last known to match the index
+}
+
+// snapshotIndex copies the index. Only the copy happens under the read
+// lock; sorting is done after releasing it.
+func (sn *StorageNode) snapshotIndex() *indexSnapshot {
+	sn.index.mu.RLock()
+	entries := make([]ChunkEntry, 0, len(sn.index.chunks))
+	for _, entry := range sn.index.chunks {
+		entries = append(entries, entry)
+	}
+	gen := sn.index.gen
+	sn.index.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ChunkID < entries[j].ChunkID })
+	return &indexSnapshot{entries: entries, gen: gen, takenAt: time.Now()}
+}
+
+// listingEntries returns every index entry sorted by chunk ID for manifests
+// and searches. With INDEX_SNAPSHOT_MAX_STALENESS set it serves the shared
+// snapshot, so results may miss changes made within that bound; otherwise
+// each call copies the index.
+func (sn *StorageNode) listingEntries() []ChunkEntry {
+	if sn.snapshotStaleness <= 0 {
+		return sn.snapshotIndex().entries
+	}
+	snap := sn.listingSnapshot.Load()
+	if snap == nil || time.Since(snap.takenAt) > sn.snapshotStaleness {
+		snap = sn.refreshListingSnapshot(snap)
+	}
+	return snap.entries
+}
+
+// refreshListingSnapshot replaces stale as the shared snapshot, copying the
+// index only if it changed since. If another caller already replaced stale,
+// its snapshot is returned instead.
+func (sn *StorageNode) refreshListingSnapshot(stale *indexSnapshot) *indexSnapshot {
+	sn.snapshotMu.Lock()
+	defer sn.snapshotMu.Unlock()
+
+	if current := sn.listingSnapshot.Load(); current != stale {
+		return current
+	}
+
+	sn.index.mu.RLock()
+	gen := sn.index.gen
+	sn.index.mu.RUnlock()
+
+	var snap *indexSnapshot
+	if stale != nil && stale.gen == gen {
+		snap = &indexSnapshot{entries: stale.entries, gen: gen, takenAt: time.Now()}
+	} else {
+		snap = sn.snapshotIndex()
+	}
+	sn.listingSnapshot.Store(snap)
+	return snap
+}
+
+// prewarmListingSnapshot keeps the snapshot fresh in the background so
+// listing requests rarely pay for the copy themselves
+func (sn *StorageNode) prewarmListingSnapshot(ctx context.Context) {
+	sn.refreshListingSnapshot(sn.listingSnapshot.Load())
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestListingSnapshotStaleness(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.snapshotStaleness = time.Hour
+
+	sn.index.mu.Lock()
+	sn.index.set(ChunkEntry{ChunkID: "snap-b", Checksum: "bb", StoredAt: time.Now()})
+	sn.index.mu.Unlock()
+	if lines := sn.manifest(time.Time{}); len(lines) != 1 {
+		t.Fatalf("Expected 1 chunk in the first manifest, got %d", len(lines))
+	}
+
+	// Within the staleness bound the snapshot is served as is
+	sn.index.mu.Lock()
+	sn.index.set(ChunkEntry{ChunkID: "snap-a", Checksum: "aa", StoredAt: time.Now()})
+	sn.index.mu.Unlock()
+	if lines := sn.manifest(time.Time{}); len(lines) != 1 {
+		t.Errorf("Expected the snapshot to hide the new chunk, got %d chunks", len(lines))
+	}
+
+	// A refresh picks it up, sorted
+	sn.prewarmListingSnapshot(context.Background())
+	lines := sn.manifest(time.Time{})
+	if len(lines) != 2 || lines[0].chunkID != "snap-a" || lines[1].chunkID != "snap-b" {
+		t.Errorf("Expected both chunks sorted after a refresh, got %v", lines)
+	}
+
+	// An unchanged index is not copied again
+	before := sn.listingSnapshot.Load()
+	sn.prewarmListingSnapshot(context.Background())
+	after := sn.listingSnapshot.Load()
+	if after == before || &after.entries[0] != &before.entries[0] {
+		t.Error("Expected a refresh of an unchanged index to reuse its entries")
+	}
+
+	// Listings never serve a snapshot older than the bound
+	sn.snapshotStaleness = time.Nanosecond
+	sn.index.mu.Lock()
+	sn.index.set(ChunkEntry{ChunkID: "snap-c", Checksum: "cc", StoredAt: time.Now()})
+	sn.index.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	if lines := sn.manifest(time.Time{}); len(lines) != 3 {
+		t.Errorf("Expected an expired snapshot to be refreshed, got %d chunks", len(lines))
+	}
+}
+
+// BenchmarkListing lists a large index while a writer mutates it, comparing
+// a fresh copy per listing against the shared snapshot. writes/s shows how
+// much the listings held the writer up.
+func BenchmarkListing(b *testing.B) {
+	b.Run("copy", func(b *testing.B) { benchmarkListing(b, 0) })
+	b.Run("snapshot", func(b *testing.B) { benchmarkListing(b, time.Second) })
+}
+
+func benchmarkListing(b *testing.B, staleness time.Duration) {
+	sn := NewStorageNode(b.TempDir(), "bench-node")
+	sn.snapshotStaleness = staleness
+	sn.index.mu.Lock()
+	for i := 0; i < 100000; i++ {
+		sn.index.set(ChunkEntry{ChunkID: fmt.Sprintf("list-%06d", i), Checksum: "ab", StoredAt: time.Now()})
+	}
+	sn.index.mu.Unlock()
+
+	stop := make(chan struct{})
+	var writes int64
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			sn.index.mu.Lock()
+			sn.index.set(ChunkEntry{ChunkID: fmt.Sprintf("write-%d", i%1000), Checksum: "cd"})
+			sn.index.mu.Unlock()
+			atomic.AddInt64(&writes, 1)
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sn.manifest(time.Time{})
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	wg.Wait()
+	b.ReportMetric(float64(atomic.LoadInt64(&writes))/b.Elapsed().Seconds(), "writes/s")
+}
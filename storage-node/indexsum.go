@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// IndexChecksumSuffix names the sidecar holding the index file's SHA-256
+const IndexChecksumSuffix = ".sha256"
+
+var errIndexChecksumMismatch = errors.New("index checksum mismatch")
+
+func (sn *StorageNode) indexChecksumPath() string {
+	return sn.indexFile + IndexChecksumSuffix
+}
+
+// readIndexChecksums returns the checksums listed in the sidecar: the
+// current index first, then the one it replaced
+func readIndexChecksums(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sums []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if sum := strings.TrimSpace(scanner.Text()); sum != "" {
+			if !validChecksum.MatchString(sum) {
+				return nil, fmt.Errorf("malformed index checksum %q", sum)
+			}
+			sums = append(sums, sum)
+		}
+	}
+	return sums, scanner.Err()
+}
+
+// writeIndexChecksum durably records sum as the checksum of the index about
+// to be renamed into place. The previous checksum is kept alongside it, so
+// a crash between this and the index rename still verifies.
+func (sn *StorageNode) writeIndexChecksum(sum string) error {
+	path := sn.indexChecksumPath()
+	content := sum + "\n"
+	if old, err := readIndexChecksums(path); err == nil && len(old) > 0 && old[0] != sum {
+		content += old[0] + "\n"
+	}
+
+	tempFile := sn.tempPath(path)
+	file, err := os.Create(tempFile)
+	if err != nil {
+		return fmt.Errorf("failed to create temp index checksum file: %w", err)
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write index checksum: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to sync index checksum: %w", err)
+	}
+	file.Close()
+
+	if err := sn.replaceFile(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename index checksum: %w", err)
+	}
+	return nil
+}
+
+// verifyIndexChecksum checks the SHA-256 of a loaded index file against the
+// sidecar. Indexes saved before checksums existed have no sidecar and pass.
+func (sn *StorageNode) verifyIndexChecksum(sum string) error {
+	sums, err := readIndexChecksums(sn.indexChecksumPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, want := range sums {
+		if sum == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: file has %s, expected %s", errIndexChecksumMismatch, shortChecksum(sum), shortChecksum(sums[0]))
+}
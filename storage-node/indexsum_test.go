@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexChecksum(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	for i := 0; i < 3; i++ {
+		data := []byte(fmt.Sprintf("index checksum chunk %d", i))
+		if err := sn.storeChunk(fmt.Sprintf("sum-%d", i), data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	}
+	if err := sn.saveIndex(); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	reload := func(t *testing.T) (*StorageNode, error) {
+		sn2 := NewStorageNode(tempDir, "test-node")
+		return sn2, sn2.loadIndex()
+	}
+
+	t.Run("clean_index_verifies", func(t *testing.T) {
+		sn2, err := reload(t)
+		if err != nil {
+			t.Fatalf("Failed to load index: %v", err)
+		}
+		if len(sn2.index.chunks) != 3 {
+			t.Errorf("Expected 3 chunks, got %d", len(sn2.index.chunks))
+		}
+	})
+
+	t.Run("survives_crash_before_index_rename", func(t *testing.T) {
+		// The sidecar for a newer index lands but the index rename doesn't
+		sn.index.mu.Lock()
+		entry := sn.index.chunks["sum-0"]
+		entry.StoredBy = "never-persisted"
+		sn.index.chunks["sum-0"] = entry
+		sn.index.mu.Unlock()
+		renameFile = func(oldpath, newpath string) error {
+			if newpath == sn.indexFile {
+				return errors.New("simulated crash")
+			}
+			return os.Rename(oldpath, newpath)
+		}
+		err := sn.saveIndex()
+		renameFile = os.Rename
+		if err == nil {
+			t.Fatal("Expected the index save to fail")
+		}
+
+		sn2, err := reload(t)
+		if err != nil {
+			t.Fatalf("Expected the previous index to verify, got %v", err)
+		}
+		if entry := sn2.index.chunks["sum-0"]; entry.StoredBy != "" {
+			t.Errorf("Expected the previous index to be loaded, got stored_by %q", entry.StoredBy)
+		}
+	})
+
+	t.Run("flipped_byte_detected", func(t *testing.T) {
+		content, err := os.ReadFile(sn.indexFile)
+		if err != nil {
+			t.Fatalf("Failed to read index: %v", err)
+		}
+		// Change an offset digit so the file is still valid JSON
+		i := bytes.Index(content, []byte(`"offset":`)) + len(`"offset":`)
+		content[i] = '7'
+		if err := os.WriteFile(sn.indexFile, content, 0644); err != nil {
+			t.Fatalf("Failed to write index: %v", err)
+		}
+
+		sn2, err := reload(t)
+		if !errors.Is(err, errIndexChecksumMismatch) {
+			t.Fatalf("Expected a checksum mismatch, got %v", err)
+		}
+		if len(sn2.index.chunks) != 0 {
+			t.Errorf("Expected the tampered index not to be loaded, got %d entries", len(sn2.index.chunks))
+		}
+		if matches, _ := filepath.Glob(sn.indexFile + ".corrupt-*"); len(matches) != 1 {
+			t.Errorf("Expected the tampered index to be preserved, found %v", matches)
+		}
+	})
+
+	t.Run("legacy_index_without_sidecar_loads", func(t *testing.T) {
+		if err := sn.saveIndex(); err != nil {
+			t.Fatalf("Failed to save index: %v", err)
+		}
+		os.Remove(sn.indexChecksumPath())
+		sn2, err := reload(t)
+		if err != nil {
+			t.Fatalf("Failed to load index without a sidecar: %v", err)
+		}
+		if len(sn2.index.chunks) != 3 {
+			t.Errorf("Expected 3 chunks, got %d", len(sn2.index.chunks))
+		}
+	})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// IndexWALFile names the index write-ahead log, kept next to the index file
+const IndexWALFile = "chunk_index.wal"
+
+// DefaultIndexWALMaxSize is how large the WAL may grow before the index is
+// snapshotted and the WAL truncated (see INDEX_WAL_MAX_SIZE_MB)
+const DefaultIndexWALMaxSize = 64 * 1024 * 1024
+
+// Index WAL record ops
+const (
+	walOpSet    = "set"
+	walOpRemove = "remove"
+)
+
+// walRecord is one line of the index WAL
+type walRecord struct {
+	Op      string      `json:"op"`
+	ChunkID string      `json:"chunk_id"`
+	Entry   *ChunkEntry `json:"entry,omitempty"` // Only for set
+}
+
+// indexWAL logs index mutations as they are made, so persisting a write
+// costs one appended record instead of rewriting the whole index. Records
+// are appended under the index lock, so the log is in index order; a
+// snapshot (saveIndex) covers every record before it and truncates the log.
+// Replaying a record the snapshot already holds is harmless, as records set
+// or remove whole entries.
+type indexWAL struct {
+	mu         sync.Mutex
+	file       *os.File
+	buf        *bufio.Writer
+	size       int64 // bytes appended since the last snapshot
+	err        error // first failed append since the last snapshot
+	compacting int32 // atomic, 1 while a size-triggered snapshot runs
+}
+
+func (sn *StorageNode) indexWALPath() string {
+	return filepath.Join(filepath.Dir(sn.indexFile), IndexWALFile)
+}
+
+// openIndexWAL opens the WAL for appending, dropping anything past size,
+// the end of the last intact record
+func openIndexWAL(path string, size int64) (*indexWAL, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index WAL: %w", err)
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to trim index WAL: %w", err)
+	}
+	return &indexWAL{file: file, buf: bufio.NewWriter(file), size: size}, nil
+}
+
+// append logs a mutation. Failures are kept for the next sync, which falls
+// back to a snapshot, since index mutations themselves can't fail.
+// Caller must hold the index lock for writing.
+func (w *indexWAL) append(record walRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err == nil {
+		line = append(line, '\n')
+		_, err = w.buf.Write(line)
+	}
+	if err != nil {
+		w.err = fmt.Errorf("failed to append to index WAL: %w", err)
+		return
+	}
+	w.size += int64(len(line))
+}
+
+// sync writes buffered records out, fsyncing them if fsync is set
+func (w *indexWAL) sync(fsync bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.err = fmt.Errorf("failed to write index WAL: %w", err)
+		return w.err
+	}
+	if fsync {
+		if err := w.file.Sync(); err != nil {
+			w.err = fmt.Errorf("failed to sync index WAL: %w", err)
+			return w.err
+		}
+	}
+	return nil
+}
+
+// reset empties the WAL once a snapshot holds every record in it. Caller
+// must hold the index lock so no record is appended meanwhile.
+func (w *indexWAL) reset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Reset(w.file)
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate index WAL: %w", err)
+	}
+	w.size, w.err = 0, nil
+	return nil
+}
+
+func (w *indexWAL) bytes() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+func (w *indexWAL) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Flush()
+	return w.file.Close()
+}
+
+// replayIndexWAL applies the WAL's records to the in-memory index, returning
+// how many it applied and where the last intact one ends. A torn or corrupt
+// record ends the replay, as a crash mid-append leaves one at the end.
+func (sn *StorageNode) replayIndexWAL() (int, int64, error) {
+	file, err := os.Open(sn.indexWALPath())
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open index WAL: %w", err)
+	}
+	defer file.Close()
+
+	sn.index.mu.Lock()
+	defer sn.index.mu.Unlock()
+
+	reader := bufio.NewReader(file)
+	var records int
+	var valid int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return records, valid, fmt.Errorf("failed to read index WAL: %w", err)
+		}
+
+		var record walRecord
+		torn := err != nil // no newline: the append never finished
+		if !torn {
+			torn = json.Unmarshal(line, &record) != nil ||
+				(record.Op == walOpSet && (record.Entry == nil || record.Entry.ChunkID != record.ChunkID)) ||
+				(record.Op != walOpSet && record.Op != walOpRemove)
+		}
+		if torn {
+			log.Printf("Warning: ignoring torn index WAL record at offset %d", valid)
+			break
+		}
+
+		if record.Op == walOpSet {
+			sn.index.set(*record.Entry)
+		} else {
+			sn.index.remove(record.ChunkID)
+		}
+		records++
+		valid += int64(len(line))
+	}
+	if records > 0 {
+		log.Printf("Replayed %d index WAL record(s)", records)
+	}
+	sn.walReplayed = true
+	return records, valid, nil
+}
+
+// recoverIndexWAL replays the WAL on startup and, with INDEX_WAL enabled,
+// opens it for appending. Replayed records are folded into a fresh snapshot
+// so the WAL starts empty; if that fails they stay in the WAL.
+func (sn *StorageNode) recoverIndexWAL() error {
+	records, valid, err := sn.replayIndexWAL()
+	if err != nil {
+		return err
+	}
+	if records > 0 {
+		if err := sn.saveIndex(); err != nil {
+			log.Printf("Warning: failed to snapshot index after WAL replay: %v", err)
+		} else {
+			valid = 0
+		}
+	}
+	if !sn.indexWALEnabled {
+		return nil
+	}
+
+	wal, err := openIndexWAL(sn.indexWALPath(), valid)
+	if err != nil {
+		return err
+	}
+	sn.index.mu.Lock()
+	sn.index.wal = wal
+	sn.index.mu.Unlock()
+	log.Printf("Logging index mutations to %s (snapshot every %d MB)", sn.indexWALPath(), sn.indexWALMaxSize/(1024*1024))
+	return nil
+}
+
+// syncIndexWAL persists logged mutations per INDEX_FSYNC_POLICY. If the WAL
+// can't be written the index is snapshotted instead, which also resets it.
+// Once the WAL outgrows INDEX_WAL_MAX_SIZE_MB a snapshot is taken in the
+// background to truncate it.
+func (sn *StorageNode) syncIndexWAL() error {
+	wal := sn.index.wal
+	if err := wal.sync(sn.indexFsync.due(sn.indexWALPath())); err != nil {
+		log.Printf("Warning: %v, snapshotting index instead", err)
+		return sn.saveIndex()
+	}
+
+	if wal.bytes() > sn.indexWALMaxSize && atomic.CompareAndSwapInt32(&wal.compacting, 0, 1) {
+		started := sn.tasks.start("index-wal-compact", func(ctx context.Context) {
+			defer atomic.StoreInt32(&wal.compacting, 0)
+			if err := sn.saveIndex(); err != nil {
+				log.Printf("Warning: failed to snapshot index to truncate WAL: %v", err)
+			}
+		})
+		if !started {
+			atomic.StoreInt32(&wal.compacting, 0)
+		}
+	}
+	return nil
+}
+
+// resetIndexWAL empties the WAL after a snapshot. With the WAL disabled a
+// leftover one is removed once replayed; until then, as when the index is
+// rebuilt on startup, it is kept to be replayed over the snapshot. Caller
+// must hold the index lock.
+func (sn *StorageNode) resetIndexWAL() error {
+	wal := sn.index.wal
+	if wal == nil {
+		if !sn.walReplayed {
+			return nil
+		}
+		if err := os.Remove(sn.indexWALPath()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove index WAL: %w", err)
+		}
+		return nil
+	}
+
+	// The snapshot's rename must be durable before the records it replaces
+	// are dropped
+	if sn.indexFsync.mode == FsyncAlways && wal.bytes() > 0 {
+		if err := syncDir(filepath.Dir(sn.indexFile)); err != nil {
+			return err
+		}
+	}
+	return wal.reset()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// putTestChunks stores n chunks named prefix-i through the router
+func putTestChunks(t *testing.T, sn *StorageNode, prefix string, n int) {
+	router := sn.newRouter()
+	for i := 0; i < n; i++ {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("PUT", fmt.Sprintf("/chunk/%s-%02d", prefix, i), bytes.NewReader([]byte(fmt.Sprintf("%s chunk %d", prefix, i)))))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d", rr.Code)
+		}
+	}
+}
+
+func TestIndexWALRecoversWithoutSnapshots(t *testing.T) {
+	t.Setenv("INDEX_WAL", "true")
+	t.Setenv("SMALL_CHUNK_BATCHING", "false")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	before := atomic.LoadInt64(&sn.indexSaves)
+	putTestChunks(t, sn, "wal", 20)
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("DELETE", "/chunk/wal-00", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", rr.Code)
+	}
+	if saves := atomic.LoadInt64(&sn.indexSaves) - before; saves != 0 {
+		t.Errorf("Expected writes to be logged without rewriting the index, got %d index saves", saves)
+	}
+	if info, err := os.Stat(sn.indexWALPath()); err != nil || info.Size() == 0 {
+		t.Fatalf("Expected a non-empty index WAL (%v)", err)
+	}
+
+	// Restart without Shutdown, as after a crash
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	defer sn2.Shutdown()
+	if _, ok := sn2.lookupChunk("wal-00"); ok {
+		t.Error("Expected the logged delete to be replayed")
+	}
+	if n := len(sn2.index.chunks); n != 19 {
+		t.Errorf("Expected 19 chunks after replay, got %d", n)
+	}
+	if sn2.index.wal.bytes() != 0 {
+		t.Error("Expected the replayed WAL to be folded into a snapshot")
+	}
+}
+
+func TestIndexWALTornRecordIgnored(t *testing.T) {
+	t.Setenv("INDEX_WAL", "true")
+	t.Setenv("SMALL_CHUNK_BATCHING", "false")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	putTestChunks(t, sn, "torn", 3)
+
+	// A crash mid-append leaves half a record behind
+	file, err := os.OpenFile(sn.indexWALPath(), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	file.WriteString(`{"op":"set","chunk_id":"torn-99","entry":{"chunk_id":"tor`)
+	file.Close()
+
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	defer sn2.Shutdown()
+	if n := len(sn2.index.chunks); n != 3 {
+		t.Errorf("Expected the 3 intact records replayed, got %d chunks", n)
+	}
+	if _, ok := sn2.lookupChunk("torn-99"); ok {
+		t.Error("Expected the torn record to be ignored")
+	}
+}
+
+func TestIndexWALSnapshotsWhenFull(t *testing.T) {
+	t.Setenv("INDEX_WAL", "true")
+	t.Setenv("SMALL_CHUNK_BATCHING", "false")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.indexWALMaxSize = 1024
+
+	before := atomic.LoadInt64(&sn.indexSaves)
+	putTestChunks(t, sn, "full", 10)
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt64(&sn.indexSaves) == before || atomic.LoadInt32(&sn.index.wal.compacting) == 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a snapshot once the WAL outgrew its limit")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if size := sn.index.wal.bytes(); size > sn.indexWALMaxSize {
+		t.Errorf("Expected the snapshot to truncate the WAL, still %d bytes", size)
+	}
+
+	sn.Shutdown()
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	defer sn2.Shutdown()
+	if n := len(sn2.index.chunks); n != 10 {
+		t.Errorf("Expected 10 chunks after restart, got %d", n)
+	}
+}
+
+func TestLeftoverIndexWALReplayedWhenDisabled(t *testing.T) {
+	t.Setenv("INDEX_WAL", "true")
+	t.Setenv("SMALL_CHUNK_BATCHING", "false")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	putTestChunks(t, sn, "leftover", 5)
+
+	t.Setenv("INDEX_WAL", "false")
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	defer sn2.Shutdown()
+	if n := len(sn2.index.chunks); n != 5 {
+		t.Errorf("Expected 5 chunks replayed from the leftover WAL, got %d", n)
+	}
+	if _, err := os.Stat(sn2.indexWALPath()); !os.IsNotExist(err) {
+		t.Error("Expected the leftover WAL removed once snapshotted")
+	}
+}
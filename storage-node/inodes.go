@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"syscall"
+)
+
+// statfs is syscall.Statfs, swappable so tests can simulate full filesystems
+var statfs = syscall.Statfs
+
+// freeInodes reports the free inodes on the data volume and their share of
+// the total. ok is false on filesystems that don't report inode counts
+// (e.g. btrfs allocates them dynamically).
+func (sn *StorageNode) freeInodes() (free uint64, percent float64, ok bool) {
+	var stat syscall.Statfs_t
+	if err := statfs(sn.dataDir, &stat); err != nil {
+		log.Printf("Warning: failed to get inode usage: %v", err)
+		return 0, 0, false
+	}
+	if stat.Files == 0 {
+		return 0, 0, false
+	}
+	return stat.Ffree, float64(stat.Ffree) / float64(stat.Files) * 100.0, true
+}
+
+// checkFreeInodes rejects writes once free inodes drop below MIN_FREE_INODES,
+// so inode exhaustion surfaces as 507 rather than a confusing ENOSPC with
+// bytes still free
+func (sn *StorageNode) checkFreeInodes() error {
+	if sn.minFreeInodes == 0 {
+		return nil
+	}
+	if free, _, ok := sn.freeInodes(); ok && free < sn.minFreeInodes {
+		return fmt.Errorf("insufficient storage space: %d free inodes, minimum %d", free, sn.minFreeInodes)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+)
+
+// simulateInodes makes statfs report the given free and total inodes, with
+// plenty of free bytes
+func simulateInodes(t *testing.T, free, total uint64) {
+	statfs = func(path string, stat *syscall.Statfs_t) error {
+		*stat = syscall.Statfs_t{Bsize: 4096, Blocks: 1 << 20, Bfree: 1 << 19, Bavail: 1 << 19, Files: total, Ffree: free}
+		return nil
+	}
+	t.Cleanup(func() { statfs = syscall.Statfs })
+}
+
+func TestWritesRejectedOnInodeExhaustion(t *testing.T) {
+	t.Setenv("MIN_FREE_INODES", "100")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	simulateInodes(t, 10, 1000000)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/inode-starved", bytes.NewReader([]byte("data"))))
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Fatalf("Expected 507 with inodes exhausted, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+	var health HealthResponse
+	if err := json.NewDecoder(rr.Body).Decode(&health); err != nil {
+		t.Fatalf("Failed to decode health: %v", err)
+	}
+	if health.FreeInodes == nil || *health.FreeInodes != 0.001 {
+		t.Errorf("Expected 0.001%% free inodes in health, got %v", health.FreeInodes)
+	}
+	if health.Status != "critical" {
+		t.Errorf("Expected critical health with inodes exhausted, got %s", health.Status)
+	}
+
+	simulateInodes(t, 500000, 1000000)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/inode-starved", bytes.NewReader([]byte("data"))))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 once inodes are free again, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestInodeGuardSkipsFilesystemsWithoutInodeCounts(t *testing.T) {
+	t.Setenv("MIN_FREE_INODES", "100")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	simulateInodes(t, 0, 0)
+	if err := sn.checkFreeInodes(); err != nil {
+		t.Errorf("Expected no inode guard without inode counts, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// checkIndexIntegrity compares every index entry against the size of its
+// superblock file and counts entries whose data extends past the end of the
+// file, e.g. after a crash that lost the tail of a superblock but kept the index.
+func (sn *StorageNode) checkIndexIntegrity() int {
+	sizes := make(map[int]int64)
+	truncated := 0
+
+	sn.index.mu.RLock()
+	for chunkID, entry := range sn.index.chunks {
+		size, ok := sizes[entry.SuperblockID]
+		if !ok {
+			size = -1
+			if info, err := os.Stat(sn.getSuperblockPath(entry.SuperblockID)); err == nil {
+				size = info.Size()
+			}
+			sizes[entry.SuperblockID] = size
+		}
+
+		if entry.Offset+int64(entry.Size) > size {
+			truncated++
+			log.Printf("Integrity check: chunk %s ends at %d but superblock %d is %d bytes",
+				chunkID, entry.Offset+int64(entry.Size), entry.SuperblockID, size)
+		}
+	}
+	sn.index.mu.RUnlock()
+
+	atomic.StoreInt64(&sn.truncatedChunks, int64(truncated))
+	if truncated > 0 {
+		log.Printf("WARNING: %d index entries point beyond the end of their superblock", truncated)
+	}
+	return truncated
+}
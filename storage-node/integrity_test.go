@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTruncatedSuperblockDetection(t *testing.T) {
+	t.Setenv("INDEX_SAVE_DELAY", "0") // one index save per write
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	intact := []byte("chunk that survives the crash")
+	lost := []byte("chunk whose tail is lost in the crash")
+
+	for chunkID, data := range map[string][]byte{"intact-chunk": intact, "lost-chunk": lost} {
+		checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+		if err := sn.storeChunk(chunkID, data, checksum); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+	}
+
+	sn.index.mu.RLock()
+	lostEntry := sn.index.chunks["lost-chunk"]
+	intactEntry := sn.index.chunks["intact-chunk"]
+	sn.index.mu.RUnlock()
+
+	// Cut the superblock just below the end of the later-written chunk
+	last, first := lostEntry, intactEntry
+	if first.Offset > last.Offset {
+		last, first = first, last
+	}
+	if err := os.Truncate(sn.getSuperblockPath(last.SuperblockID), last.Offset+int64(last.Size)-5); err != nil {
+		t.Fatalf("Failed to truncate superblock: %v", err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+
+	t.Run("read_returns_410", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/chunk/"+last.ChunkID, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusGone {
+			t.Errorf("Expected status %d for truncated chunk, got %d", http.StatusGone, w.Code)
+		}
+	})
+
+	t.Run("intact_chunk_still_readable", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/chunk/"+first.ChunkID, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status %d for intact chunk, got %d", http.StatusOK, w.Code)
+		}
+	})
+
+	t.Run("startup_integrity_check_flags_entry", func(t *testing.T) {
+		sn2 := NewStorageNode(tempDir, "test-node")
+		if err := sn2.Initialize(); err != nil {
+			t.Fatalf("Failed to initialize storage node after restart: %v", err)
+		}
+
+		if got := atomic.LoadInt64(&sn2.truncatedChunks); got != 1 {
+			t.Errorf("Expected 1 truncated chunk flagged at startup, got %d", got)
+		}
+	})
+}
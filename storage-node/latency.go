@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// chunkLatencyBuckets are the upper bounds of the chunk read and write
+// latency histograms. MaxRetrievalLatency is one of them so reads can be
+// measured against the retrieval target directly.
+var chunkLatencyBuckets = [...]time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	MaxRetrievalLatency,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// latencyHistogram counts latencies into chunkLatencyBuckets plus a +Inf
+// bucket. It is updated with atomic adds only, so it can sit on the read
+// path without a lock; a snapshot taken mid-update may be off by a sample.
+type latencyHistogram struct {
+	counts [len(chunkLatencyBuckets) + 1]int64 // per bucket, not cumulative
+	sum    int64                               // nanoseconds
+}
+
+// LatencyPercentiles summarizes a latency histogram in /health
+type LatencyPercentiles struct {
+	Samples int64   `json:"samples"`
+	P50Ms   float64 `json:"p50_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := 0
+	for i < len(chunkLatencyBuckets) && d > chunkLatencyBuckets[i] {
+		i++
+	}
+	atomic.AddInt64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// reset zeroes the histogram. Samples observed meanwhile may be split
+// between the old and new counts.
+func (h *latencyHistogram) reset() {
+	for i := range h.counts {
+		atomic.StoreInt64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.sum, 0)
+}
+
+// snapshot returns the per-bucket counts and their total
+func (h *latencyHistogram) snapshot() ([len(chunkLatencyBuckets) + 1]int64, int64) {
+	var counts [len(chunkLatencyBuckets) + 1]int64
+	var total int64
+	for i := range counts {
+		counts[i] = atomic.LoadInt64(&h.counts[i])
+		total += counts[i]
+	}
+	return counts, total
+}
+
+// quantile estimates the q-th quantile by interpolating linearly within the
+// bucket it falls in, as Prometheus' histogram_quantile does. Quantiles in
+// the +Inf bucket are reported as the highest finite bound.
+func quantile(counts [len(chunkLatencyBuckets) + 1]int64, total int64, q float64) time.Duration {
+	rank := q * float64(total)
+	var cumulative int64
+	for i, count := range counts {
+		if count == 0 || float64(cumulative+count) < rank {
+			cumulative += count
+			continue
+		}
+		if i == len(chunkLatencyBuckets) {
+			break
+		}
+		var lower time.Duration
+		if i > 0 {
+			lower = chunkLatencyBuckets[i-1]
+		}
+		width := chunkLatencyBuckets[i] - lower
+		return lower + time.Duration(float64(width)*(rank-float64(cumulative))/float64(count))
+	}
+	return chunkLatencyBuckets[len(chunkLatencyBuckets)-1]
+}
+
+// percentiles returns the histogram's p50 and p99, or nil with no samples
+func (h *latencyHistogram) percentiles() *LatencyPercentiles {
+	counts, total := h.snapshot()
+	if total == 0 {
+		return nil
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return &LatencyPercentiles{
+		Samples: total,
+		P50Ms:   ms(quantile(counts, total, 0.5)),
+		P99Ms:   ms(quantile(counts, total, 0.99)),
+	}
+}
+
+// writeHistogram writes h as a Prometheus histogram in seconds
+func writeHistogram(w io.Writer, name, help string, h *latencyHistogram) {
+	counts, total := h.snapshot()
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	var cumulative int64
+	for i, bound := range chunkLatencyBuckets {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound.Seconds(), 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, total)
+	fmt.Fprintf(w, "%s_sum %g\n", name, time.Duration(atomic.LoadInt64(&h.sum)).Seconds())
+	fmt.Fprintf(w, "%s_count %d\n", name, total)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramPercentiles(t *testing.T) {
+	var h latencyHistogram
+	if h.percentiles() != nil {
+		t.Error("Expected no percentiles without samples")
+	}
+
+	// 98 fast samples, one at the retrieval target and one far past it
+	for i := 0; i < 98; i++ {
+		h.observe(500 * time.Microsecond)
+	}
+	h.observe(MaxRetrievalLatency)
+	h.observe(time.Second)
+
+	p := h.percentiles()
+	if p.Samples != 100 {
+		t.Errorf("Expected 100 samples, got %d", p.Samples)
+	}
+	if p.P50Ms <= 0 || p.P50Ms > 1 {
+		t.Errorf("Expected p50 within the 1ms bucket, got %vms", p.P50Ms)
+	}
+	if p.P99Ms <= 5 || p.P99Ms > 10 {
+		t.Errorf("Expected p99 within the bucket ending at the retrieval target, got %vms", p.P99Ms)
+	}
+
+	counts, _ := h.snapshot()
+	if counts[0] != 98 || counts[2] != 1 || counts[len(counts)-1] != 1 {
+		t.Errorf("Expected samples on a bound to count in that bucket, got %v", counts)
+	}
+	h.observe(time.Second)
+	if p := h.percentiles(); p.P99Ms != 100 {
+		t.Errorf("Expected p99 in the +Inf bucket to report the highest bound, got %vms", p.P99Ms)
+	}
+}
+
+func TestChunkLatencyExposed(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	if health := sn.health(); health.ReadLatency != nil || health.WriteLatency != nil {
+		t.Error("Expected no latency summary before any chunk traffic")
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/timed", bytes.NewReader([]byte("timed chunk"))))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", rr.Code)
+	}
+	for i := 0; i < 2; i++ {
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/timed", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rr.Code)
+		}
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/missing", nil))
+
+	health := sn.health()
+	if health.ReadLatency == nil || health.ReadLatency.Samples != 2 {
+		t.Errorf("Expected 2 read samples, got %+v", health.ReadLatency)
+	}
+	if health.WriteLatency == nil || health.WriteLatency.Samples != 1 {
+		t.Errorf("Expected 1 write sample, got %+v", health.WriteLatency)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	metrics := rr.Body.String()
+	for _, want := range []string{
+		"# TYPE vstack_chunk_read_duration_seconds histogram",
+		`vstack_chunk_read_duration_seconds_bucket{le="0.01"}`,
+		`vstack_chunk_read_duration_seconds_bucket{le="+Inf"} 2`,
+		"vstack_chunk_read_duration_seconds_count 2",
+		`vstack_chunk_write_duration_seconds_bucket{le="+Inf"} 1`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("Expected /metrics to contain %q", want)
+		}
+	}
+}
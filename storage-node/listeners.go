@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+)
+
+// listenerConfig is a socket the node is configured to serve on
+type listenerConfig struct {
+	name    string // the setting configuring it, named in errors
+	network string // "tcp" or "unix"
+	address string
+}
+
+// validateListeners checks at startup, before the index is loaded, that the
+// configured listeners don't overlap and can each be bound, so a
+// misconfiguration fails fast naming the listeners involved instead of as a
+// bind error once the node is otherwise up. Overlaps are checked first, for
+// the clearer error. TCP listeners are then bound and held until all are
+// checked, so an overlap the address comparison can't see, such as a
+// hostname and its IP, still fails to bind. Unix sockets are only checked
+// for an existing file that is not a stale socket, as listenUnix replaces
+// stale sockets.
+func validateListeners(listeners []listenerConfig) error {
+	for i, a := range listeners {
+		for _, b := range listeners[:i] {
+			if listenersOverlap(a, b) {
+				return fmt.Errorf("%s (%s) and %s (%s) would listen on the same %s address",
+					b.name, b.address, a.name, a.address, a.network)
+			}
+		}
+	}
+
+	var bound []net.Listener
+	defer func() {
+		for _, ln := range bound {
+			ln.Close()
+		}
+	}()
+	for _, l := range listeners {
+		if l.network == "unix" {
+			if _, err := staleSocket(l.address); err != nil {
+				return fmt.Errorf("%s: %w", l.name, err)
+			}
+			continue
+		}
+		ln, err := net.Listen(l.network, l.address)
+		if err != nil {
+			return fmt.Errorf("%s cannot listen on %s: %w", l.name, l.address, err)
+		}
+		bound = append(bound, ln)
+	}
+	return nil
+}
+
+// listenersOverlap reports whether two listeners would bind the same
+// address. A TCP listener on all interfaces overlaps any other on its port.
+func listenersOverlap(a, b listenerConfig) bool {
+	if a.network != b.network {
+		return false
+	}
+	if a.network == "unix" {
+		return filepath.Clean(a.address) == filepath.Clean(b.address)
+	}
+
+	hostA, portA, errA := net.SplitHostPort(a.address)
+	hostB, portB, errB := net.SplitHostPort(b.address)
+	if errA != nil || errB != nil {
+		return a.address == b.address
+	}
+	if portA != portB || portA == "0" {
+		return false
+	}
+	return isWildcardHost(hostA) || isWildcardHost(hostB) || net.ParseIP(hostA).Equal(net.ParseIP(hostB))
+}
+
+func isWildcardHost(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
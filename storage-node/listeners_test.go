@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateListeners(t *testing.T) {
+	t.Run("same_port_rejected", func(t *testing.T) {
+		err := validateListeners([]listenerConfig{
+			{name: "PORT", network: "tcp", address: "127.0.0.1:18081"},
+			{name: "ADMIN_PORT", network: "tcp", address: "127.0.0.1:18081"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "PORT") || !strings.Contains(err.Error(), "ADMIN_PORT") {
+			t.Errorf("Expected an error naming both listeners, got %v", err)
+		}
+	})
+
+	t.Run("wildcard_overlaps_specific_host", func(t *testing.T) {
+		err := validateListeners([]listenerConfig{
+			{name: "PORT", network: "tcp", address: ":18081"},
+			{name: "ADMIN_PORT", network: "tcp", address: "127.0.0.1:18081"},
+		})
+		if err == nil {
+			t.Error("Expected all interfaces and loopback on one port to conflict")
+		}
+	})
+
+	t.Run("distinct_listeners_accepted", func(t *testing.T) {
+		err := validateListeners([]listenerConfig{
+			{name: "PORT", network: "tcp", address: "127.0.0.1:0"},
+			{name: "UNIX_SOCKET", network: "unix", address: filepath.Join(t.TempDir(), "node.sock")},
+		})
+		if err != nil {
+			t.Errorf("Expected distinct listeners to validate, got %v", err)
+		}
+	})
+
+	t.Run("port_in_use_rejected", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer ln.Close()
+
+		err = validateListeners([]listenerConfig{{name: "PORT", network: "tcp", address: ln.Addr().String()}})
+		if err == nil || !strings.Contains(err.Error(), "PORT cannot listen") {
+			t.Errorf("Expected a bind error naming PORT, got %v", err)
+		}
+	})
+
+	t.Run("overlap_reported_before_bind", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer ln.Close()
+
+		// The port is taken, but the conflict between the two is the
+		// actionable error
+		err = validateListeners([]listenerConfig{
+			{name: "PORT", network: "tcp", address: ln.Addr().String()},
+			{name: "ADMIN_PORT", network: "tcp", address: ln.Addr().String()},
+		})
+		if err == nil || !strings.Contains(err.Error(), "same tcp address") {
+			t.Errorf("Expected the overlap to be reported, got %v", err)
+		}
+	})
+
+	t.Run("hostname_overlap_fails_to_bind", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		ln.Close()
+
+		// Not comparable as addresses, but both bind loopback
+		err = validateListeners([]listenerConfig{
+			{name: "PORT", network: "tcp", address: "127.0.0.1:" + port},
+			{name: "ADMIN_PORT", network: "tcp", address: "localhost:" + port},
+		})
+		if err == nil || !strings.Contains(err.Error(), "ADMIN_PORT cannot listen") {
+			t.Errorf("Expected a bind error naming ADMIN_PORT, got %v", err)
+		}
+	})
+
+	t.Run("socket_path_is_regular_file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "node.sock")
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := validateListeners([]listenerConfig{{name: "UNIX_SOCKET", network: "unix", address: path}}); err == nil {
+			t.Error("Expected a regular file at the socket path to be rejected")
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Page sizes for GET /chunks
+const (
+	DefaultListLimit = 1000
+	MaxListLimit     = 10000
+)
+
+// ChunkListing is one chunk in a GET /chunks page
+type ChunkListing struct {
+	ChunkID      string    `json:"chunk_id"`
+	SuperblockID int       `json:"superblock_id"`
+	Size         int32     `json:"size"`
+	Checksum     string    `json:"checksum"`
+	StoredAt     time.Time `json:"stored_at"`
+}
+
+// listChunks returns up to limit live chunks sorted by ID that sort after
+// the given ID, how many live chunks there are in all, and whether more
+// remain after this page. Like searches it reads the listing entries, which
+// may lag the index (see listingEntries).
+func (sn *StorageNode) listChunks(after string, limit int) ([]ChunkListing, int, bool) {
+	now := time.Now()
+	entries := sn.listingEntries()
+	start := sort.Search(len(entries), func(i int) bool { return entries[i].ChunkID > after })
+
+	total := 0
+	for _, entry := range entries {
+		if !entry.expired(now) {
+			total++
+		}
+	}
+
+	page := make([]ChunkListing, 0, min(limit, len(entries)-start))
+	for _, entry := range entries[start:] {
+		if entry.expired(now) {
+			continue
+		}
+		if len(page) == limit {
+			return page, total, true
+		}
+		page = append(page, ChunkListing{
+			ChunkID:      entry.ChunkID,
+			SuperblockID: entry.SuperblockID,
+			Size:         entry.logicalSize(),
+			Checksum:     entry.Checksum,
+			StoredAt:     entry.StoredAt,
+		})
+	}
+	return page, total, false
+}
+
+// handleListChunks serves GET /chunks?limit=N&after=<chunk_id>, a page of
+// chunk metadata sorted by chunk ID. X-Total-Count is the number of chunks
+// on the node; X-Next-After is set when more remain, to pass as after= for
+// the next page.
+func (sn *StorageNode) handleListChunks(w http.ResponseWriter, r *http.Request) {
+	after := ""
+	limit := DefaultListLimit
+	for name, values := range r.URL.Query() {
+		value := values[0]
+		switch name {
+		case "after":
+			after = value
+		case "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, MaxListLimit)
+		default:
+			http.Error(w, fmt.Sprintf("Unknown parameter %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, total, more := sn.listChunks(after, limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if more {
+		w.Header().Set("X-Next-After", page[len(page)-1].ChunkID)
+	}
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		log.Printf("Failed to encode chunk listing: %v", err)
+	}
+}
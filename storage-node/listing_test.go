@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListChunksPagination(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	for _, chunkID := range []string{"list-c", "list-a", "list-e", "list-b", "list-d"} {
+		data := []byte("listed " + chunkID)
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+	}
+	expired := time.Now().Add(-time.Minute)
+	sn.index.mu.Lock()
+	sn.index.set(ChunkEntry{ChunkID: "list-expired", Checksum: "ab", ExpiresAt: &expired})
+	sn.index.mu.Unlock()
+
+	router := sn.newRouter()
+	list := func(t *testing.T, query string) (*httptest.ResponseRecorder, []ChunkListing) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunks?"+query, nil))
+		var page []ChunkListing
+		if rr.Code == http.StatusOK {
+			if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+				t.Fatalf("Failed to decode listing: %v", err)
+			}
+		}
+		return rr, page
+	}
+
+	var got []string
+	after := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Expected the listing to end after 3 pages")
+		}
+		rr, page := list(t, "limit=2&after="+after)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if total := rr.Header().Get("X-Total-Count"); total != "5" {
+			t.Errorf("Expected X-Total-Count 5, got %q", total)
+		}
+		for _, chunk := range page {
+			got = append(got, chunk.ChunkID)
+			entry, _ := sn.lookupChunk(chunk.ChunkID)
+			if chunk.SuperblockID != entry.SuperblockID || chunk.Size != entry.Size ||
+				chunk.Checksum != entry.Checksum || !chunk.StoredAt.Equal(entry.StoredAt) {
+				t.Errorf("Listing of %s doesn't match its index entry: %+v", chunk.ChunkID, chunk)
+			}
+		}
+		after = rr.Header().Get("X-Next-After")
+		if after == "" {
+			break
+		}
+		if after != page[len(page)-1].ChunkID {
+			t.Errorf("Expected X-Next-After to be the page's last chunk, got %q", after)
+		}
+	}
+	if fmt.Sprint(got) != "[list-a list-b list-c list-d list-e]" {
+		t.Errorf("Expected every live chunk once in order, got %v", got)
+	}
+
+	if rr, page := list(t, "after=list-e"); rr.Code != http.StatusOK || page == nil || len(page) != 0 {
+		t.Errorf("Expected an empty array past the last chunk, got %d %v", rr.Code, page)
+	}
+	for _, query := range []string{"limit=0", "limit=abc", "prefix=list"} {
+		if rr, _ := list(t, query); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ChunkLocation is where a chunk's bytes live on disk, so an external
+// process with filesystem access can read and verify them without going
+// through the node's read path
+type ChunkLocation struct {
+	ChunkID        string `json:"chunk_id"`
+	SuperblockID   int    `json:"superblock_id"`
+	SuperblockPath string `json:"superblock_path"`
+	Tier           string `json:"tier"`
+	Offset         int64  `json:"offset"`
+	Size           int32  `json:"size"`
+	Checksum       string `json:"checksum"`
+	ChecksumAlgo   string `json:"checksum_algo"`
+	Compression    string `json:"compression,omitempty"` // Codec of chunks compressed at rest; the checksum is of the decompressed data
+	Encrypted      bool   `json:"encrypted,omitempty"`   // Stored encrypted; the checksum is of the plaintext
+}
+
+// handleChunkLocation reports the superblock byte range holding a chunk
+func (sn *StorageNode) handleChunkLocation(w http.ResponseWriter, r *http.Request) {
+	chunkID := mux.Vars(r)["chunk_id"]
+	if err := sn.validateChunkID(chunkID); err != nil {
+		writeChunkIDError(w, err)
+		return
+	}
+
+	sn.index.mu.RLock()
+	entry, exists := sn.index.chunks[chunkID]
+	sn.index.mu.RUnlock()
+	if !exists || entry.expired(time.Now()) {
+		http.Error(w, ErrChunkNotFound, http.StatusNotFound)
+		return
+	}
+
+	location := ChunkLocation{
+		ChunkID:        entry.ChunkID,
+		SuperblockID:   entry.SuperblockID,
+		SuperblockPath: sn.getSuperblockPath(entry.SuperblockID),
+		Tier:           tierOf(entry.SuperblockID),
+		Offset:         entry.Offset,
+		Size:           entry.Size,
+		Checksum:       entry.Checksum,
+		ChecksumAlgo:   entry.checksumAlgorithm(),
+		Compression:    entry.Compression,
+		Encrypted:      entry.Encrypted,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(location); err != nil {
+		log.Printf("Failed to encode chunk location: %v", err)
+	}
+}
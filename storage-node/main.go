@@ -3,18 +3,22 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/cipher"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"regexp"
-	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
@@ -29,8 +33,8 @@ import (
 const (
 	// Storage configuration
 	DefaultMaxSuperblockSize = 1 * 1024 * 1024 * 1024 // 1GB
-	MaxChunkSize             = 2 * 1024 * 1024        // 2MB
-	MaxChunkSizeBuffer       = MaxChunkSize + 1024    // Allow overhead for headers
+	MaxChunkSize             = 2 * 1024 * 1024        // 2MB (default, see MAX_CHUNK_SIZE_MB)
+	ChunkSizeOverhead        = 1024                   // Allow overhead for headers
 
 	// Performance requirements
 	MaxRetrievalLatency = 10 * time.Millisecond
@@ -42,7 +46,6 @@ const (
 	// Error messages
 	ErrInsufficientStorage = "Insufficient storage space"
 	ErrChunkNotFound       = "Chunk not found"
-	ErrInvalidChunkID      = "Invalid chunk ID format"
 	ErrChecksumMismatch    = "Checksum mismatch"
 
 	// Retry configuration
@@ -50,39 +53,227 @@ const (
 	RegistrationTimeout    = 2 * time.Minute
 	RetryInterval          = 5 * time.Second
 
+	// Cache-Control max-age for chunks without a TTL (see CHUNK_CACHE_MAX_AGE)
+	DefaultChunkCacheMaxAge = 365 * 24 * 60 * 60 // 1 year, in seconds
+
+	// Maximum length of the X-Stored-By attribution header
+	MaxStoredByLength = 128
+
+	// Fraction of reads verified against their checksum (see VERIFY_SAMPLE_RATE)
+	DefaultVerifySampleRate = 1.0
+
+	// Read retries when a chunk moves while being read
+	MaxChunkReadAttempts = 3
+
 	// Server timeouts
 	ServerReadTimeout  = 15 * time.Second
 	ServerWriteTimeout = 15 * time.Second
 	ServerIdleTimeout  = 60 * time.Second
+
+	// Server header limits (see SERVER_MAX_HEADER_BYTES)
+	DefaultServerMaxHeaderBytes = http.DefaultMaxHeaderBytes // 1MB
+	MinServerMaxHeaderBytes     = 1024
 )
 
 var (
-	// validChunkID validates chunk ID format (alphanumeric, underscore, hyphen, 1-64 chars)
-	validChunkID = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	// errChunkTruncated indicates an index entry points past the end of its superblock
+	errChunkTruncated = errors.New("chunk data extends beyond end of superblock")
+
+	// errChunkGone indicates a chunk was deleted while it was being read
+	errChunkGone = errors.New("chunk deleted during read")
+
+	// errChunkCorrupt indicates chunk data failed checksum verification
+	errChunkCorrupt = errors.New("chunk checksum verification failed")
+
+	// errChunkTooLarge indicates a chunk can never fit in a superblock
+	errChunkTooLarge = errors.New("chunk exceeds superblock capacity")
+
+	// validChecksum validates hex-encoded checksums (CRC32C through SHA-256)
+	validChecksum = regexp.MustCompile(`^[0-9a-f]{8,64}$`)
 )
 
-// validateChunkID validates the format of a chunk ID
-func validateChunkID(id string) error {
-	if !validChunkID.MatchString(id) {
-		return fmt.Errorf(ErrInvalidChunkID)
+// ChunkEntry represents metadata for a stored chunk
+type ChunkEntry struct {
+	ChunkID      string            `json:"chunk_id"`
+	SuperblockID int               `json:"superblock_id"`
+	Offset       int64             `json:"offset"`
+	Size         int32             `json:"size"`
+	Checksum     string            `json:"checksum"`
+	ChecksumAlgo string            `json:"checksum_algo,omitempty"`
+	StoredAt     time.Time         `json:"stored_at"`
+	StoredBy     string            `json:"stored_by,omitempty"`  // X-Stored-By of the writer, if given
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty"` // Set for chunks stored with a TTL
+	ContentType  string            `json:"content_type,omitempty"`
+	Pinned       bool              `json:"pinned,omitempty"` // Pinned chunks never expire
+	Meta         map[string]string `json:"meta,omitempty"`   // X-Chunk-Meta-* headers of the PUT
+	// Deduplicated entries share bytes framed under another chunk ID
+	Deduplicated bool `json:"deduplicated,omitempty"`
+	// Chunks compressed (see COMPRESSION) or encrypted (see ENCRYPTION_KEY)
+	// at rest store Size bytes of encoded data that decode to RawSize bytes
+	Compression string `json:"compression,omitempty"`
+	Encrypted   bool   `json:"encrypted,omitempty"`
+	RawSize     int32  `json:"raw_size,omitempty"`
+}
+
+// encoded reports whether a chunk is stored other than as its plain data
+func (e ChunkEntry) encoded() bool {
+	return e.Compression != "" || e.Encrypted
+}
+
+// logicalSize returns the size of a chunk's data as clients see it
+func (e ChunkEntry) logicalSize() int32 {
+	if e.encoded() {
+		return e.RawSize
 	}
-	return nil
+	return e.Size
 }
 
-// ChunkEntry represents metadata for a stored chunk
-type ChunkEntry struct {
-	ChunkID      string    `json:"chunk_id"`
-	SuperblockID int       `json:"superblock_id"`
-	Offset       int64     `json:"offset"`
-	Size         int32     `json:"size"`
-	Checksum     string    `json:"checksum"`
-	StoredAt     time.Time `json:"stored_at"`
+// expired reports whether a chunk's TTL has passed
+func (e ChunkEntry) expired(now time.Time) bool {
+	return !e.Pinned && e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
+
+// contentType returns the Content-Type chunks are served with
+func (e ChunkEntry) contentType() string {
+	if e.ContentType != "" {
+		return e.ContentType
+	}
+	return "application/octet-stream"
+}
+
+// lookupChunk returns a chunk's index entry, treating expired chunks as absent
+func (sn *StorageNode) lookupChunk(chunkID string) (ChunkEntry, bool) {
+	if sn.index.missing.contains(chunkID) {
+		return ChunkEntry{}, false
+	}
+
+	sn.index.mu.RLock()
+	entry, exists := sn.index.chunks[chunkID]
+	if !exists {
+		sn.index.missing.add(chunkID)
+	}
+	sn.index.mu.RUnlock()
+
+	if !exists || entry.expired(time.Now()) {
+		return ChunkEntry{}, false
+	}
+	return entry, true
 }
 
 // ChunkIndex provides O(1) chunk lookups
 type ChunkIndex struct {
-	mu     sync.RWMutex
-	chunks map[string]ChunkEntry
+	mu         sync.RWMutex
+	chunks     map[string]ChunkEntry
+	byChecksum map[string]map[string]struct{} // checksum -> chunk IDs sharing it
+	refs       map[blobRef]int                // stored bytes -> chunk IDs referencing them
+	gen        uint64                         // incremented on every mutation
+	bytes      int64                          // total Size of all entries
+	missing    *negativeCache                 // recent lookup misses, nil if disabled
+	wal        *indexWAL                      // mutation log, nil unless INDEX_WAL is enabled
+}
+
+func newChunkIndex(missing *negativeCache) *ChunkIndex {
+	return &ChunkIndex{
+		chunks:     make(map[string]ChunkEntry),
+		byChecksum: make(map[string]map[string]struct{}),
+		refs:       make(map[blobRef]int),
+		missing:    missing,
+	}
+}
+
+// set adds or replaces an entry. Caller must hold mu for writing.
+func (ci *ChunkIndex) set(entry ChunkEntry) {
+	if old, ok := ci.chunks[entry.ChunkID]; ok {
+		ci.unlinkChecksum(old)
+		ci.unref(old)
+		ci.bytes -= int64(old.Size)
+	}
+	ci.chunks[entry.ChunkID] = entry
+	ci.refs[entry.blob()]++
+	ci.bytes += int64(entry.Size)
+	ci.gen++
+	ci.missing.remove(entry.ChunkID)
+	if ci.wal != nil {
+		ci.wal.append(walRecord{Op: walOpSet, ChunkID: entry.ChunkID, Entry: &entry})
+	}
+
+	ids, ok := ci.byChecksum[entry.Checksum]
+	if !ok {
+		ids = make(map[string]struct{})
+		ci.byChecksum[entry.Checksum] = ids
+	}
+	ids[entry.ChunkID] = struct{}{}
+}
+
+// remove deletes an entry. Caller must hold mu for writing.
+func (ci *ChunkIndex) remove(chunkID string) (ChunkEntry, bool) {
+	entry, ok := ci.chunks[chunkID]
+	if !ok {
+		return ChunkEntry{}, false
+	}
+	delete(ci.chunks, chunkID)
+	ci.unlinkChecksum(entry)
+	ci.unref(entry)
+	ci.bytes -= int64(entry.Size)
+	ci.gen++
+	if ci.wal != nil {
+		ci.wal.append(walRecord{Op: walOpRemove, ChunkID: chunkID})
+	}
+	return entry, true
+}
+
+func (ci *ChunkIndex) unlinkChecksum(entry ChunkEntry) {
+	if ids, ok := ci.byChecksum[entry.Checksum]; ok {
+		delete(ids, entry.ChunkID)
+		if len(ids) == 0 {
+			delete(ci.byChecksum, entry.Checksum)
+		}
+	}
+}
+
+// replace swaps in a freshly loaded or rebuilt set of entries. Misses
+// recorded against the old entries no longer hold, so the negative cache is
+// cleared. Caller must hold mu for writing.
+func (ci *ChunkIndex) replace(chunks map[string]ChunkEntry) {
+	ci.chunks = chunks
+	ci.rebuildChecksumIndex()
+	ci.missing.clear()
+}
+
+// rebuildChecksumIndex recomputes the secondary indexes and byte total from
+// chunks. Caller must hold mu for writing.
+func (ci *ChunkIndex) rebuildChecksumIndex() {
+	ci.byChecksum = make(map[string]map[string]struct{})
+	ci.refs = make(map[blobRef]int)
+	ci.bytes = 0
+	for _, entry := range ci.chunks {
+		ci.bytes += int64(entry.Size)
+		ci.refs[entry.blob()]++
+		ids, ok := ci.byChecksum[entry.Checksum]
+		if !ok {
+			ids = make(map[string]struct{})
+			ci.byChecksum[entry.Checksum] = ids
+		}
+		ids[entry.ChunkID] = struct{}{}
+	}
+}
+
+// lookupChecksum returns a chunk with the given content checksum. When several
+// chunk IDs share the checksum the lexicographically smallest one is returned
+// so the choice is deterministic. Caller must hold mu for reading.
+func (ci *ChunkIndex) lookupChecksum(checksum string) (ChunkEntry, bool) {
+	var best ChunkEntry
+	found := false
+	for chunkID := range ci.byChecksum[checksum] {
+		entry, ok := ci.chunks[chunkID]
+		if !ok || entry.Checksum != checksum {
+			continue
+		}
+		if !found || chunkID < best.ChunkID {
+			best, found = entry, true
+		}
+	}
+	return best, found
 }
 
 // SuperblockHeader contains metadata for superblock files
@@ -96,23 +287,238 @@ type SuperblockHeader struct {
 // StorageNode represents the main storage node server
 type StorageNode struct {
 	dataDir           string
+	tempDir           string // scratch space for temp files, "" = next to their targets
 	indexFile         string
 	index             *ChunkIndex
 	currentSuperblock int
+	streaming         map[int]int // superblock ID -> streamed chunks still being written into it, guarded by sn.mu
 	maxSuperblockSize int64
+	maxChunkSize      int64
+	streamThreshold   int64 // larger chunks are always streamed to disk, never buffered whole
 	nodeID            string
 	mu                sync.Mutex
 	startTime         time.Time
 	failedIndexSaves  int64 // atomic counter for failed index save operations
+	chunkPuts         int64 // atomic count of chunks stored through the API
+	chunkGets         int64 // atomic count of chunks served through the API
+	chunkDeletes      int64 // atomic count of chunks deleted through the API
+	truncatedChunks   int64 // atomic count of index entries beyond their superblock's end
+	readCache         *readCache
+	handles           *handleCache // open superblock files shared by reads
+
+	readLatency  latencyHistogram // chunk GETs, from request to response written
+	writeLatency latencyHistogram // chunk PUTs that stored a chunk
+
+	responseCompression        string
+	responseCompressionMinSize int
+
+	chunkCompression string      // COMPRESSION codec for chunks at rest, ChunkCompressionNone = off
+	chunkCipher      cipher.AEAD // ENCRYPTION_KEY cipher for chunks at rest, nil = stored in the clear
+	chunkCipherErr   error       // ENCRYPTION_KEY parse failure, reported by validateConfig
+
+	tasks       *scheduler       // periodic background jobs, stopped on Shutdown
+	maintenance *maintenanceGate // MAX_MAINTENANCE_TASKS gate for disk-heavy background work
+
+	maxCheckpointAge time.Duration // force an index save when mutations are older than this, 0 = off
+	checkpointGen    uint64        // atomic index generation of the last successful save
+	lastCheckpoint   int64         // atomic unix nanos of the last successful save
+
+	indexSaveRetryInterval time.Duration // first wait before retrying a failed index save, 0 = off
+	indexSaveAlertAfter    int           // failed saves in a row before alerting
+	indexRetry             indexSaveRetry
+	alertWebhookURL        string // "" = alerts are only logged
+
+	flights           flightGroup   // coalesces concurrent metadata service calls
+	metadataURL       string        // "" when running without a metadata service
+	nodeURL           string        // URL registered with the metadata service
+	registrationDelay time.Duration // wait after the server is listening before registering
+	adminToken        string        // bearer token for admin-only endpoints, "" disables them
+	chunkTokenSecret  []byte        // CHUNK_TOKEN_SECRET for X-Chunk-Token, nil = chunk routes are open
+
+	criticalDeregisterAfter time.Duration // deregister after this long critical, 0 = never
+	criticalSince           int64         // atomic unix nanos critical health was first seen, 0 if healthy
+	deregistered            int32         // atomic, 1 while deregistered for critical health
+
+	fastTierDir           string        // "" = no fast tier, new chunks go straight to the primary tier
+	fastTierMaxAge        time.Duration // chunks older than this migrate to the primary tier
+	currentFastSuperblock int           // active fast tier superblock, guarded by sn.mu
+
+	maxSuperblockAge time.Duration // seal the active superblock once this old, 0 = only by size
+
+	snapshotStaleness    time.Duration                 // max age of listingSnapshot, 0 = listings copy the index
+	snapshotMu           sync.Mutex                    // serializes listingSnapshot refreshes
+	listingSnapshot      atomic.Pointer[indexSnapshot] // shared index copy for listing endpoints
+	superblocksSealedAge int64                         // atomic count of superblocks sealed by age
+	rotations            rotationStats
+
+	indexSaveDelay       time.Duration // debounce index saves after writes, 0 = save per write
+	deleteCoalesceWindow time.Duration // defer index saves after DELETE so a storm shares one write
+	saveTimerMu          sync.Mutex
+	saveTimer            *time.Timer   // pending deferred index save, nil if none
+	saveDue              time.Time     // when saveTimer fires, guarded by saveTimerMu
+	saveWindow           time.Duration // window saveTimer was scheduled with, guarded by saveTimerMu
+	indexSaves           int64         // atomic count of successful index saves
+	tailReclaimedBytes   int64         // atomic bytes truncated off the active superblock by deletes
+	replicaCopies        int64         // atomic count of chunks copied to a replica while being served
+	replicaCopyFailures  int64         // atomic count of failed replica copies
+	runtimeMu            sync.RWMutex  // guards heartbeatInterval, which the coordinator may change
+	heartbeatInterval    time.Duration // see heartbeatEvery
+	clusterEpoch         int64         // atomic, assigned at registration and echoed in heartbeats
+	failedHeartbeats     int64         // atomic count of consecutive heartbeat failures
+	lastHeartbeat        int64         // atomic unix nanos of the last successful heartbeat or registration
+	registered           int32         // atomic, 1 once registered with the metadata service
+
+	replicaPeers             []string            // REPLICA_PEERS new chunks are forwarded to
+	replicaPeersErr          error               // REPLICA_PEERS parse failure, reported by validateConfig
+	replicationFactor        int                 // peers each new chunk is forwarded to
+	replicationRetryInterval time.Duration       // first wait before retrying a failed forward
+	replicationSuccesses     int64               // atomic count of chunks replicated to a peer
+	replicationFailures      int64               // atomic count of replications abandoned after retries
+	replicationPending       int64               // atomic count of replications queued or in progress
+	replicationQueue         chan replicationJob // forwards awaiting a replication worker
+	readRepair               bool                // READ_REPAIR: fetch corrupt chunks back from replica peers
+	readRepairTimeout        time.Duration       // bound on fetching one chunk from the peers
+	readRepairs              int64               // atomic count of corrupt chunks repaired from a peer
+	readRepairFailures       int64               // atomic count of corrupt chunks no peer could repair
+
+	checksumAlgo     string // algorithm used for stored chunk checksums
+	checksumMismatch string // CHECKSUM_MISMATCH_POLICY for client checksums that don't match
+	contentAddressed bool   // CONTENT_ADDRESSED=true: chunk IDs are the SHA-256 of their data
+
+	checksumMismatches int64 // atomic count of chunks stored despite a mismatched client checksum
+
+	dedup           bool  // DEDUP=true: index repeated content against the stored copy
+	dedupHits       int64 // atomic count of chunks stored without writing their data
+	dedupBytesSaved int64 // atomic bytes those chunks would have appended
+
+	smallChunkBatching bool
+	smallWrites        writeBatcher
+
+	deadMu    sync.Mutex
+	deadBytes map[int]int64 // superblock ID -> bytes no longer referenced by the index
+
+	drainRateLimit int64 // bytes/sec, 0 = unlimited
+	drainMu        sync.Mutex
+	drains         map[int]*DrainStatus
+
+	chunkCacheMaxAge   int           // Cache-Control max-age (seconds) for chunks without a TTL
+	expiryReapInterval time.Duration // time between deletions of expired chunks, 0 = never
+
+	verifySampleRate float64 // fraction of disk reads whose checksum is verified
+	verifiedReads    int64   // atomic count of reads whose checksum was verified
+	verifyFailures   int64   // atomic count of reads that failed verification
+
+	postWriteVerify     *postWriteVerifier // nil unless VERIFY_AFTER_WRITE is enabled
+	postWriteVerifyRate int64              // bytes/sec, 0 = unlimited
+
+	scrub         scrubber
+	scrubInterval time.Duration // time between background scrub passes, 0 = only on POST /scrub
+	scrubRate     int64         // bytes/sec, 0 = unlimited
+
+	panics        int64 // atomic count of recovered handler panics
+	countersSince int64 // atomic unix nanos of the last counter reset, 0 if never reset
+	lastPanic     int64 // atomic unix nanos of the most recent panic
+	panicMu       sync.Mutex
+	panicsByRoute map[string]int64
+
+	routeStatsMu sync.Mutex
+	routeStats   map[string]*routeStats // "METHOD route template" -> stats
+
+	eventLogEnabled bool
+	eventLogMaxSize int64
+	events          *eventLog // nil unless EVENT_LOG is enabled
+
+	indexWALEnabled bool  // log index mutations instead of rewriting the index per write
+	indexWALMaxSize int64 // snapshot the index once the WAL outgrows this
+	walReplayed     bool  // the WAL on disk has been applied to the index, guarded by index.mu
+
+	renameStrategyOnce sync.Once
+	copyStrategyOnce   sync.Once
+
+	readOnly     int32 // atomic, 1 after a write failed with EROFS
+	readOnlyMode bool  // READ_ONLY=true: serve existing data, never write or register
+
+	warnLargeReadBytes int64 // log GETs with bodies above this size, 0 = off
+	maxReadBytes       int64 // reject GETs of chunks above this size with 413, 0 = off
+	largeReads         int64 // atomic count of GETs above warnLargeReadBytes
+	rejectedReads      int64 // atomic count of GETs rejected by maxReadBytes
+
+	writeSlots     chan struct{} // MAX_CONCURRENT_WRITES semaphore, nil when unlimited
+	inflightWrites int64         // atomic count of write requests being handled
+	writesShed     int64         // atomic count of writes rejected at the concurrency limit
+
+	clientLimits *clientRateLimiter // CLIENT_RATE_LIMIT buckets, nil when unlimited
+	rateLimited  int64              // atomic count of requests rejected by clientLimits
+
+	connSlots       chan struct{} // MAX_CONNECTIONS semaphore, nil when unlimited
+	openConnections int64         // atomic count of accepted connections still open
+
+	chunkFsync    *fsyncPolicy // CHUNK_FSYNC_POLICY for superblock data
+	indexFsync    *fsyncPolicy // INDEX_FSYNC_POLICY for the chunk index
+	fsyncInterval time.Duration
+	indexChecksum bool // keep a SHA-256 sidecar of the index (INDEX_CHECKSUM)
+
+	initialized int32 // atomic, 1 once Initialize has completed
+	rebuilding  int32 // atomic, 1 while the index is being rebuilt
+	rebuildMu   sync.Mutex
+	rebuild     *RebuildStatus // latest index rebuild, nil if none ran
+
+	topology    NodeTopology // zone/rack/labels reported to the metadata service
+	topologyErr error        // NODE_LABELS parse failure, reported by validateConfig
+
+	trustedProxies    []*net.IPNet // TRUSTED_PROXIES whose X-Forwarded-For/X-Real-IP are believed
+	trustedProxiesErr error        // TRUSTED_PROXIES parse failure, reported by validateConfig
+
+	minFreeInodes uint64 // reject writes below this many free inodes, 0 = off
+
+	maxIndexEntries  int   // reject writes once the index holds this many chunks, 0 = off
+	indexLimitWarned int32 // atomic, 1 once approaching maxIndexEntries has been logged
+
+	allowNodeIDMismatch bool // take over a data dir owned by another node ID
+
+	activeWritesMu    sync.Mutex
+	activeWrites      map[string]*activeWrite // chunk IDs with a PUT in progress
+	deleteWaitTimeout time.Duration           // how long a DELETE waits for such a PUT
+
+	notFoundHints bool // mark definitive chunk misses with X-Chunk-Not-Here
+
+	sbChecksumMu sync.Mutex
+	sbChecksums  map[int]SuperblockChecksum // cached whole-file checksums by superblock ID
+}
+
+// RegistrationRequest mirrors the metadata service registration payload
+type RegistrationRequest struct {
+	NodeURL string `json:"node_url"`
+	NodeID  string `json:"node_id"`
+	Version string `json:"version"`
+	NodeTopology
 }
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status     string  `json:"status"`
-	DiskUsage  float64 `json:"disk_usage"`
-	ChunkCount int     `json:"chunk_count"`
-	Uptime     int64   `json:"uptime"`
-	NodeID     string  `json:"node_id"`
+	Status     string   `json:"status"`
+	DiskUsage  float64  `json:"disk_usage"`
+	FreeInodes *float64 `json:"free_inodes_percent,omitempty"`
+	IndexUsage *float64 `json:"index_usage_percent,omitempty"` // Share of MAX_INDEX_ENTRIES
+	ChunkCount int      `json:"chunk_count"`
+	Uptime     int64    `json:"uptime"`
+	NodeID     string   `json:"node_id"`
+
+	TruncatedChunks  int64          `json:"truncated_chunks,omitempty"`
+	ScrubCorruptions int64          `json:"scrub_corruptions,omitempty"` // Corrupt chunks found by the scrubber
+	Panics           int64          `json:"panics,omitempty"`
+	Metadata         MetadataHealth `json:"metadata"`
+	Rebuild          *RebuildStatus `json:"rebuild,omitempty"`
+	Filesystem       string         `json:"filesystem"`
+	ReadOnlyMode     bool           `json:"read_only_mode,omitempty"` // Started with READ_ONLY=true
+
+	ChunkFsyncPolicy string `json:"chunk_fsync_policy"`
+	IndexFsyncPolicy string `json:"index_fsync_policy"`
+
+	ReadLatency  *LatencyPercentiles `json:"read_latency,omitempty"`  // Estimated from the histogram, omitted before any reads
+	WriteLatency *LatencyPercentiles `json:"write_latency,omitempty"` // Estimated from the histogram, omitted before any writes
+
+	Replication *ReplicationHealth `json:"replication,omitempty"` // Only with REPLICA_PEERS
 }
 
 func NewStorageNode(dataDir, nodeID string) *StorageNode {
@@ -125,19 +531,524 @@ func NewStorageNode(dataDir, nodeID string) *StorageNode {
 		}
 	}
 
+	// Parse max chunk size from environment with default
+	maxChunk := int64(MaxChunkSize)
+	if envChunk := os.Getenv("MAX_CHUNK_SIZE_MB"); envChunk != "" {
+		if sizeMB, err := strconv.ParseInt(envChunk, 10, 64); err == nil && sizeMB > 0 {
+			maxChunk = sizeMB * 1024 * 1024
+			log.Printf("Using custom max chunk size: %d MB", sizeMB)
+		}
+	}
+
+	// Parse the size above which chunks are never held in memory whole
+	streamThreshold := int64(DefaultStreamThreshold)
+	if envStream := os.Getenv("STREAM_THRESHOLD_MB"); envStream != "" {
+		if sizeMB, err := strconv.ParseInt(envStream, 10, 64); err == nil && sizeMB > 0 {
+			streamThreshold = sizeMB * 1024 * 1024
+		} else {
+			log.Printf("Warning: invalid STREAM_THRESHOLD_MB '%s', using %d MB", envStream, streamThreshold/(1024*1024))
+		}
+	}
+
+	// Parse read cache size from environment (disabled by default)
+	var cacheSize int64
+	if envCache := os.Getenv("READ_CACHE_SIZE_MB"); envCache != "" {
+		if sizeMB, err := strconv.ParseInt(envCache, 10, 64); err == nil && sizeMB >= 0 {
+			cacheSize = sizeMB * 1024 * 1024
+			log.Printf("Using read cache size: %d MB", sizeMB)
+		}
+	}
+
+	// Parse how many superblock files reads keep open
+	handleCacheSize := DefaultSuperblockHandleCacheSize
+	if envHandles := os.Getenv("SUPERBLOCK_HANDLE_CACHE"); envHandles != "" {
+		if n, err := strconv.Atoi(envHandles); err == nil && n >= 0 {
+			handleCacheSize = n
+			log.Printf("Caching up to %d open superblock files", n)
+		} else {
+			log.Printf("Warning: invalid SUPERBLOCK_HANDLE_CACHE '%s', using %d", envHandles, handleCacheSize)
+		}
+	}
+
+	// Parse how chunks are read from superblocks
+	handles := newHandleCache(handleCacheSize)
+	switch mode := os.Getenv("READ_MODE"); mode {
+	case "", ReadModePread:
+	case ReadModeMmap:
+		if !mmapSupported {
+			log.Printf("Warning: READ_MODE=mmap is not supported on this platform, using %s", ReadModePread)
+		} else if handleCacheSize == 0 {
+			log.Printf("Warning: READ_MODE=mmap needs SUPERBLOCK_HANDLE_CACHE, using %s", ReadModePread)
+		} else {
+			handles.mmap = true
+			log.Printf("Reading chunks from memory-mapped superblocks")
+		}
+	default:
+		log.Printf("Warning: invalid READ_MODE '%s', using %s", mode, ReadModePread)
+	}
+
+	// Parse negative lookup cache size
+	negativeCacheSize := DefaultNegativeCacheSize
+	if envSize := os.Getenv("NEGATIVE_CACHE_SIZE"); envSize != "" {
+		if n, err := strconv.Atoi(envSize); err == nil && n >= 0 {
+			negativeCacheSize = n
+		} else {
+			log.Printf("Warning: invalid NEGATIVE_CACHE_SIZE '%s', using %d", envSize, negativeCacheSize)
+		}
+	}
+
+	// Parse free inode floor for writes (disabled by default)
+	var minFreeInodes uint64
+	if envInodes := os.Getenv("MIN_FREE_INODES"); envInodes != "" {
+		if n, err := strconv.ParseUint(envInodes, 10, 64); err == nil {
+			minFreeInodes = n
+			log.Printf("Rejecting writes below %d free inodes", n)
+		} else {
+			log.Printf("Warning: invalid MIN_FREE_INODES '%s', inode guard disabled", envInodes)
+		}
+	}
+
+	// Parse failed index saves in a row before alerting
+	indexSaveAlertAfter := DefaultIndexSaveAlertAfter
+	if envAlert := os.Getenv("INDEX_SAVE_ALERT_AFTER"); envAlert != "" {
+		if n, err := strconv.Atoi(envAlert); err == nil && n > 0 {
+			indexSaveAlertAfter = n
+		} else {
+			log.Printf("Warning: invalid INDEX_SAVE_ALERT_AFTER '%s', using %d", envAlert, DefaultIndexSaveAlertAfter)
+		}
+	}
+
+	// Parse index entry limit for memory-constrained nodes (disabled by default)
+	var maxIndexEntries int
+	if envMax := os.Getenv("MAX_INDEX_ENTRIES"); envMax != "" {
+		if n, err := strconv.Atoi(envMax); err == nil && n >= 0 {
+			maxIndexEntries = n
+			log.Printf("Rejecting writes beyond %d index entries", n)
+		} else {
+			log.Printf("Warning: invalid MAX_INDEX_ENTRIES '%s', index limit disabled", envMax)
+		}
+	}
+
+	// Parse GET response compression settings
+	compression, err := parseResponseCompression(os.Getenv("RESPONSE_COMPRESSION"))
+	if err != nil {
+		log.Printf("Warning: %v, response compression disabled", err)
+		compression = ResponseCompressionOff
+	}
+	chunkCompression, err := parseChunkCompression(os.Getenv("COMPRESSION"))
+	if err != nil {
+		log.Printf("Warning: %v, chunks stored uncompressed", err)
+		chunkCompression = ChunkCompressionNone
+	}
+	chunkCipher, cipherErr := parseEncryptionKey(os.Getenv("ENCRYPTION_KEY"))
+	if chunkCipher != nil {
+		log.Printf("Encrypting chunks at rest with AES-256-GCM")
+	}
+	compressionMinSize := DefaultResponseCompressionMinSize
+	if envMin := os.Getenv("RESPONSE_COMPRESSION_MIN_SIZE"); envMin != "" {
+		if minSize, err := strconv.Atoi(envMin); err == nil && minSize >= 0 {
+			compressionMinSize = minSize
+		} else {
+			log.Printf("Warning: invalid RESPONSE_COMPRESSION_MIN_SIZE '%s', using %d", envMin, compressionMinSize)
+		}
+	}
+
+	// Parse checksum algorithm for newly stored chunks
+	checksumAlgo := DefaultChecksumAlgorithm
+	if envAlgo := os.Getenv("CHECKSUM_ALGORITHM"); envAlgo != "" {
+		if algo, err := parseChecksumAlgorithm(envAlgo); err == nil {
+			checksumAlgo = algo
+		} else {
+			log.Printf("Warning: %v, using %s", err, checksumAlgo)
+		}
+	}
+
+	// Parse what to do when a client checksum doesn't match its data
+	checksumMismatch := DefaultChecksumMismatchPolicy
+	if envPolicy := os.Getenv("CHECKSUM_MISMATCH_POLICY"); envPolicy != "" {
+		if policy, err := parseChecksumMismatchPolicy(envPolicy); err == nil {
+			checksumMismatch = policy
+		} else {
+			log.Printf("Warning: invalid CHECKSUM_MISMATCH_POLICY: %v, using %s", err, checksumMismatch)
+		}
+	}
+
+	// Parse drain rate limit (MB/s, 0 disables limiting)
+	drainRate := int64(DefaultDrainRateLimit)
+	if envRate := os.Getenv("DRAIN_RATE_LIMIT_MB"); envRate != "" {
+		if rateMB, err := strconv.ParseInt(envRate, 10, 64); err == nil && rateMB >= 0 {
+			drainRate = rateMB * 1024 * 1024
+		} else {
+			log.Printf("Warning: invalid DRAIN_RATE_LIMIT_MB '%s', using %d MB/s", envRate, drainRate/(1024*1024))
+		}
+	}
+
+	// Parse read verification sampling rate (1.0 verifies every read)
+	verifyRate := DefaultVerifySampleRate
+	if envRate := os.Getenv("VERIFY_SAMPLE_RATE"); envRate != "" {
+		if rate, err := strconv.ParseFloat(envRate, 64); err == nil && rate >= 0 && rate <= 1 {
+			verifyRate = rate
+			log.Printf("Verifying checksums on %.0f%% of reads", rate*100)
+		} else {
+			log.Printf("Warning: invalid VERIFY_SAMPLE_RATE '%s' (must be 0.0-1.0), using %.1f", envRate, verifyRate)
+		}
+	}
+
+	// Parse read-after-write verification (off by default)
+	var postWriteVerify *postWriteVerifier
+	postWriteVerifyRate := int64(DefaultPostWriteVerifyRate)
+	if os.Getenv("VERIFY_AFTER_WRITE") == "true" {
+		postWriteVerify = &postWriteVerifier{}
+		if envRate := os.Getenv("VERIFY_AFTER_WRITE_RATE_MB"); envRate != "" {
+			if rateMB, err := strconv.ParseInt(envRate, 10, 64); err == nil && rateMB >= 0 {
+				postWriteVerifyRate = rateMB * 1024 * 1024
+			} else {
+				log.Printf("Warning: invalid VERIFY_AFTER_WRITE_RATE_MB '%s', using %d MB/s", envRate, postWriteVerifyRate/(1024*1024))
+			}
+		}
+	}
+
+	// Parse scrub rate limit
+	scrubRate := int64(DefaultScrubRate)
+	if envRate := os.Getenv("SCRUB_RATE_MB"); envRate != "" {
+		if rateMB, err := strconv.ParseInt(envRate, 10, 64); err == nil && rateMB >= 0 {
+			scrubRate = rateMB * 1024 * 1024
+		} else {
+			log.Printf("Warning: invalid SCRUB_RATE_MB '%s', using %d MB/s", envRate, scrubRate/(1024*1024))
+		}
+	}
+
+	// Parse Cache-Control max-age for immutable chunks
+	cacheMaxAge := DefaultChunkCacheMaxAge
+	if envAge := os.Getenv("CHUNK_CACHE_MAX_AGE"); envAge != "" {
+		if age, err := strconv.Atoi(envAge); err == nil && age >= 0 {
+			cacheMaxAge = age
+		} else {
+			log.Printf("Warning: invalid CHUNK_CACHE_MAX_AGE '%s', using %d", envAge, cacheMaxAge)
+		}
+	}
+
+	// Parse mutation event log settings (disabled by default)
+	eventLogMaxSize := int64(DefaultEventLogMaxSize)
+	if envSize := os.Getenv("EVENT_LOG_MAX_SIZE_MB"); envSize != "" {
+		if sizeMB, err := strconv.ParseInt(envSize, 10, 64); err == nil && sizeMB > 0 {
+			eventLogMaxSize = sizeMB * 1024 * 1024
+		} else {
+			log.Printf("Warning: invalid EVENT_LOG_MAX_SIZE_MB '%s', using %d MB", envSize, eventLogMaxSize/(1024*1024))
+		}
+	}
+
+	// Parse index WAL settings (disabled by default)
+	indexWALMaxSize := int64(DefaultIndexWALMaxSize)
+	if envSize := os.Getenv("INDEX_WAL_MAX_SIZE_MB"); envSize != "" {
+		if sizeMB, err := strconv.ParseInt(envSize, 10, 64); err == nil && sizeMB > 0 {
+			indexWALMaxSize = sizeMB * 1024 * 1024
+		} else {
+			log.Printf("Warning: invalid INDEX_WAL_MAX_SIZE_MB '%s', using %d MB", envSize, indexWALMaxSize/(1024*1024))
+		}
+	}
+
+	// Parse fsync policies; the index and chunk data are tuned independently,
+	// each defaulting to FSYNC_POLICY
+	defaultFsync := FsyncAlways
+	if envPolicy := os.Getenv("FSYNC_POLICY"); envPolicy != "" {
+		if policy, err := parseFsyncPolicy(envPolicy); err == nil {
+			defaultFsync = policy
+		} else {
+			log.Printf("Warning: invalid FSYNC_POLICY: %v, using %s", err, FsyncAlways)
+		}
+	}
+	fsyncPolicies := make(map[string]string)
+	for _, name := range []string{"CHUNK_FSYNC_POLICY", "INDEX_FSYNC_POLICY"} {
+		fsyncPolicies[name] = defaultFsync
+		if envPolicy := os.Getenv(name); envPolicy != "" {
+			if policy, err := parseFsyncPolicy(envPolicy); err == nil {
+				fsyncPolicies[name] = policy
+			} else {
+				log.Printf("Warning: invalid %s: %v, using %s", name, err, defaultFsync)
+			}
+		}
+	}
+	fsyncInterval := envDuration("FSYNC_INTERVAL", DefaultFsyncInterval)
+	if fsyncInterval <= 0 {
+		fsyncInterval = DefaultFsyncInterval
+	}
+
+	// Parse oversized read thresholds (both off by default)
+	readLimits := map[string]int64{"WARN_LARGE_READ_BYTES": 0, "MAX_READ_BYTES": 0}
+	for name := range readLimits {
+		if envLimit := os.Getenv(name); envLimit != "" {
+			if limit, err := strconv.ParseInt(envLimit, 10, 64); err == nil && limit >= 0 {
+				readLimits[name] = limit
+			} else {
+				log.Printf("Warning: invalid %s '%s', disabled", name, envLimit)
+			}
+		}
+	}
+
+	// Parse global in-flight write limit (0 = unlimited)
+	var writeSlots chan struct{}
+	if envWrites := os.Getenv("MAX_CONCURRENT_WRITES"); envWrites != "" {
+		if limit, err := strconv.Atoi(envWrites); err == nil && limit >= 0 {
+			if limit > 0 {
+				writeSlots = make(chan struct{}, limit)
+				log.Printf("Limiting concurrent writes to %d", limit)
+			}
+		} else {
+			log.Printf("Warning: invalid MAX_CONCURRENT_WRITES '%s', writes unlimited", envWrites)
+		}
+	}
+
+	// Parse the per-client request rate limit (0 = unlimited)
+	var clientLimits *clientRateLimiter
+	if envRate := os.Getenv("CLIENT_RATE_LIMIT"); envRate != "" {
+		if rate, err := strconv.ParseFloat(envRate, 64); err == nil && rate >= 0 {
+			if rate > 0 {
+				burst := int(math.Ceil(rate))
+				if envBurst := os.Getenv("CLIENT_RATE_BURST"); envBurst != "" {
+					if b, err := strconv.Atoi(envBurst); err == nil && b > 0 {
+						burst = b
+					} else {
+						log.Printf("Warning: invalid CLIENT_RATE_BURST '%s', using %d", envBurst, burst)
+					}
+				}
+				clientLimits = newClientRateLimiter(rate, burst)
+				log.Printf("Limiting each client to %g requests/sec (burst %d)", rate, burst)
+			}
+		} else {
+			log.Printf("Warning: invalid CLIENT_RATE_LIMIT '%s', requests unlimited", envRate)
+		}
+	}
+
+	// Parse how many heavy maintenance operations may run at once (0 = unlimited)
+	maxMaintenance := DefaultMaxMaintenanceTasks
+	if envTasks := os.Getenv("MAX_MAINTENANCE_TASKS"); envTasks != "" {
+		if limit, err := strconv.Atoi(envTasks); err == nil && limit >= 0 {
+			maxMaintenance = limit
+		} else {
+			log.Printf("Warning: invalid MAX_MAINTENANCE_TASKS '%s', using %d", envTasks, maxMaintenance)
+		}
+	}
+
+	// Parse the listener-level connection cap (0 = unlimited)
+	var connSlots chan struct{}
+	if envConns := os.Getenv("MAX_CONNECTIONS"); envConns != "" {
+		if limit, err := strconv.Atoi(envConns); err == nil && limit >= 0 {
+			if limit > 0 {
+				connSlots = make(chan struct{}, limit)
+				log.Printf("Limiting open connections to %d", limit)
+			}
+		} else {
+			log.Printf("Warning: invalid MAX_CONNECTIONS '%s', connections unlimited", envConns)
+		}
+	}
+
+	// Parse the proxies trusted to report the client address
+	trustedProxies, proxiesErr := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if proxiesErr != nil {
+		proxiesErr = fmt.Errorf("invalid TRUSTED_PROXIES: %w", proxiesErr)
+	}
+
+	// Parse peers to replicate writes to and how many get each chunk
+	replicaPeers, peersErr := parseReplicaPeers(os.Getenv("REPLICA_PEERS"))
+	if peersErr != nil {
+		peersErr = fmt.Errorf("invalid REPLICA_PEERS: %w", peersErr)
+	}
+	replicationFactor := len(replicaPeers)
+	if envFactor := os.Getenv("REPLICATION_FACTOR"); envFactor != "" {
+		if n, err := strconv.Atoi(envFactor); err == nil && n > 0 {
+			if n < replicationFactor {
+				replicationFactor = n
+			}
+		} else {
+			log.Printf("Warning: invalid REPLICATION_FACTOR '%s', replicating to all %d peers", envFactor, replicationFactor)
+		}
+	}
+	if len(replicaPeers) > 0 {
+		log.Printf("Replicating writes to %d of %d peer(s)", replicationFactor, len(replicaPeers))
+	}
+
+	// Parse failure domain labels for topology-aware placement
+	labels, labelsErr := parseNodeLabels(os.Getenv("NODE_LABELS"))
+	if labelsErr != nil {
+		labelsErr = fmt.Errorf("invalid NODE_LABELS: %w", labelsErr)
+	}
+
 	return &StorageNode{
 		dataDir:           dataDir,
+		tempDir:           os.Getenv("TEMP_DIR"),
 		indexFile:         filepath.Join(dataDir, "index", "chunk_index.json"),
-		index:             &ChunkIndex{chunks: make(map[string]ChunkEntry)},
+		index:             newChunkIndex(newNegativeCache(envDuration("NEGATIVE_CACHE_TTL", DefaultNegativeCacheTTL), negativeCacheSize)),
 		currentSuperblock: 0,
 		maxSuperblockSize: maxSize,
+		maxChunkSize:      maxChunk,
+		streamThreshold:   streamThreshold,
 		nodeID:            nodeID,
 		startTime:         time.Now(),
 		failedIndexSaves:  0,
+		readCache:         newReadCache(cacheSize),
+		handles:           handles,
+		minFreeInodes:     minFreeInodes,
+		maxIndexEntries:   maxIndexEntries,
+
+		responseCompression:        compression,
+		responseCompressionMinSize: compressionMinSize,
+
+		chunkCompression: chunkCompression,
+		chunkCipher:      chunkCipher,
+		chunkCipherErr:   cipherErr,
+
+		tasks:             newScheduler(),
+		maintenance:       newMaintenanceGate(maxMaintenance),
+		maxCheckpointAge:  envDuration("MAX_CHECKPOINT_AGE", DefaultMaxCheckpointAge),
+		heartbeatInterval: envDuration("HEARTBEAT_INTERVAL", DefaultHeartbeatInterval),
+		registrationDelay: envDuration("REGISTRATION_INITIAL_DELAY", DefaultRegistrationInitialDelay),
+		adminToken:        os.Getenv("ADMIN_TOKEN"),
+		chunkTokenSecret:  []byte(os.Getenv("CHUNK_TOKEN_SECRET")),
+
+		indexSaveDelay:       envDuration("INDEX_SAVE_DELAY", DefaultIndexSaveDelay),
+		deleteCoalesceWindow: envDuration("DELETE_COALESCE_WINDOW", DefaultDeleteCoalesceWindow),
+
+		checksumAlgo:     checksumAlgo,
+		checksumMismatch: checksumMismatch,
+		contentAddressed: os.Getenv("CONTENT_ADDRESSED") == "true",
+
+		dedup: os.Getenv("DEDUP") == "true",
+
+		smallChunkBatching: os.Getenv("SMALL_CHUNK_BATCHING") != "false",
+		streaming:          make(map[int]int),
+		deadBytes:          make(map[int]int64),
+
+		chunkCacheMaxAge:   cacheMaxAge,
+		expiryReapInterval: envDuration("EXPIRY_REAP_INTERVAL", DefaultExpiryReapInterval),
+		verifySampleRate:   verifyRate,
+
+		eventLogEnabled: os.Getenv("EVENT_LOG") == "true",
+		eventLogMaxSize: eventLogMaxSize,
+
+		indexWALEnabled: os.Getenv("INDEX_WAL") == "true",
+		indexWALMaxSize: indexWALMaxSize,
+
+		allowNodeIDMismatch: os.Getenv("ALLOW_NODE_ID_MISMATCH") == "true",
+		readOnlyMode:        os.Getenv("READ_ONLY") == "true",
+
+		activeWrites:      make(map[string]*activeWrite),
+		deleteWaitTimeout: envDuration("DELETE_WAIT_TIMEOUT", DefaultDeleteWaitTimeout),
+
+		notFoundHints: os.Getenv("NOT_FOUND_HINTS") != "false",
+
+		criticalDeregisterAfter: envDuration("CRITICAL_DEREGISTER_AFTER", 0),
+
+		indexSaveRetryInterval: envDuration("INDEX_SAVE_RETRY_INTERVAL", DefaultIndexSaveRetryInterval),
+		indexSaveAlertAfter:    indexSaveAlertAfter,
+		alertWebhookURL:        os.Getenv("ALERT_WEBHOOK_URL"),
+
+		panicsByRoute: make(map[string]int64),
+		routeStats:    make(map[string]*routeStats),
+
+		postWriteVerify:     postWriteVerify,
+		postWriteVerifyRate: postWriteVerifyRate,
+
+		scrubInterval: envDuration("SCRUB_INTERVAL", 0),
+		scrubRate:     scrubRate,
+
+		drainRateLimit: drainRate,
+		drains:         make(map[int]*DrainStatus),
+
+		warnLargeReadBytes: readLimits["WARN_LARGE_READ_BYTES"],
+		maxReadBytes:       readLimits["MAX_READ_BYTES"],
+
+		writeSlots:   writeSlots,
+		connSlots:    connSlots,
+		clientLimits: clientLimits,
+
+		fastTierDir:    os.Getenv("FAST_TIER_DIR"),
+		fastTierMaxAge: envDuration("FAST_TIER_MAX_AGE", DefaultFastTierMaxAge),
+
+		maxSuperblockAge:  envDuration("MAX_SUPERBLOCK_AGE", 0),
+		snapshotStaleness: envDuration("INDEX_SNAPSHOT_MAX_STALENESS", 0),
+
+		chunkFsync:    newFsyncPolicy(fsyncPolicies["CHUNK_FSYNC_POLICY"], fsyncInterval),
+		indexFsync:    newFsyncPolicy(fsyncPolicies["INDEX_FSYNC_POLICY"], fsyncInterval),
+		fsyncInterval: fsyncInterval,
+		indexChecksum: os.Getenv("INDEX_CHECKSUM") != "false",
+
+		topology: NodeTopology{
+			Zone:   strings.TrimSpace(os.Getenv("NODE_ZONE")),
+			Rack:   strings.TrimSpace(os.Getenv("NODE_RACK")),
+			Labels: labels,
+		},
+		topologyErr: labelsErr,
+
+		replicaPeers:      replicaPeers,
+		replicaPeersErr:   peersErr,
+		replicationFactor: replicationFactor,
+		replicationQueue:  make(chan replicationJob, ReplicationQueueSize),
+
+		replicationRetryInterval: envDuration("REPLICATION_RETRY_INTERVAL", DefaultReplicationRetryInterval),
+		readRepair:               os.Getenv("READ_REPAIR") != "false",
+		readRepairTimeout:        envDuration("READ_REPAIR_TIMEOUT", DefaultReadRepairTimeout),
+
+		trustedProxies:    trustedProxies,
+		sbChecksums:       make(map[int]SuperblockChecksum),
+		trustedProxiesErr: proxiesErr,
+	}
+}
+
+// envDuration parses a duration from the environment, accepting either a Go
+// duration string ("30s", "5m") or a bare number of seconds
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return d
 	}
+	log.Printf("Warning: invalid %s '%s', using %v", name, value, def)
+	return def
+}
+
+// validateConfig checks that configured limits are mutually consistent
+func (sn *StorageNode) validateConfig() error {
+	if sn.maxChunkSize > sn.maxSuperblockSize {
+		return fmt.Errorf("max chunk size (%d bytes) exceeds max superblock size (%d bytes): no chunk of maximum size could ever be stored",
+			sn.maxChunkSize, sn.maxSuperblockSize)
+	}
+	if sn.maxChunkSize+ChunkSizeOverhead > math.MaxInt32 {
+		return fmt.Errorf("max chunk size (%d bytes) exceeds the %d bytes a chunk's size can record",
+			sn.maxChunkSize, math.MaxInt32-ChunkSizeOverhead)
+	}
+	if sn.chunkCipherErr != nil {
+		return sn.chunkCipherErr
+	}
+	if sn.chunkCipher != nil && sn.maxChunkSize > sn.streamThreshold {
+		return fmt.Errorf("max chunk size (%d bytes) exceeds the stream threshold (%d bytes): encrypted chunks are always buffered whole",
+			sn.maxChunkSize, sn.streamThreshold)
+	}
+	if sn.topologyErr != nil {
+		return sn.topologyErr
+	}
+	if sn.trustedProxiesErr != nil {
+		return sn.trustedProxiesErr
+	}
+	if sn.replicaPeersErr != nil {
+		return sn.replicaPeersErr
+	}
+	return nil
 }
 
 func (sn *StorageNode) Initialize() error {
+	if err := sn.validateConfig(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if sn.readOnlyMode {
+		return sn.initializeReadOnly()
+	}
+
 	// Create directory structure
 	dirs := []string{
 		sn.dataDir,
@@ -146,24 +1057,181 @@ func (sn *StorageNode) Initialize() error {
 		filepath.Join(sn.dataDir, "logs"),
 	}
 
+	if sn.tempDir != "" {
+		dirs = append(dirs, sn.tempDir)
+	}
+	if sn.fastTierDir != "" {
+		dirs = append(dirs, sn.fastTierDir)
+	}
+
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", dir, err)
 		}
 	}
 
-	// Load existing index
-	if err := sn.loadIndex(); err != nil {
-		log.Printf("Warning: failed to load index: %v", err)
+	if sn.tempDir != "" {
+		log.Printf("Using temp directory %s", sn.tempDir)
+	}
+
+	// Never serve or mutate another node's data under this node's ID
+	if err := sn.checkNodeIdentity(); err != nil {
+		return err
 	}
 
-	// Find current superblock
+	sn.loadOrRebuildIndex()
+	if err := sn.recoverIndexWAL(); err != nil {
+		return err
+	}
+	if err := sn.compactDedupLinks(); err != nil {
+		log.Printf("Warning: failed to compact the dedup link log: %v", err)
+	}
+
+	// Find current superblock, reconciling its header with its records and
+	// dropping any append a crash tore
 	sn.findCurrentSuperblock()
+	sn.rotations.setActive(sn.currentSuperblock)
+	if err := sn.reconcileSuperblockHeader(sn.currentSuperblock); err != nil {
+		log.Printf("Warning: failed to reconcile superblock %d header: %v", sn.currentSuperblock, err)
+	}
+	if _, err := sn.trimTornAppend(sn.currentSuperblock); err != nil {
+		log.Printf("Warning: failed to check superblock %d for a torn append: %v", sn.currentSuperblock, err)
+	}
+	if sn.validateActiveSuperblockHeader() {
+		log.Printf("Superblock %d header is consistent with its data", sn.currentSuperblock)
+	}
+
+	if sn.fastTierDir != "" {
+		sn.findCurrentFastSuperblock()
+		sn.rotations.setActive(sn.currentFastSuperblock)
+		if err := sn.reconcileSuperblockHeader(sn.currentFastSuperblock); err != nil {
+			log.Printf("Warning: failed to reconcile superblock %d header: %v", sn.currentFastSuperblock, err)
+		}
+		if _, err := sn.trimTornAppend(sn.currentFastSuperblock); err != nil {
+			log.Printf("Warning: failed to check superblock %d for a torn append: %v", sn.currentFastSuperblock, err)
+		}
+		log.Printf("Writing new chunks to fast tier %s (superblock %d), migrating after %v",
+			sn.fastTierDir, sn.currentFastSuperblock, sn.fastTierMaxAge)
+	}
+
+	// Finish compactions a crash interrupted before the index caught up
+	sn.recoverCompactions()
+
+	// Flag index entries whose data was lost from the superblock tail
+	sn.checkIndexIntegrity()
+
+	if sn.eventLogEnabled {
+		events, err := openEventLog(filepath.Join(sn.dataDir, "logs", "events.log"), sn.eventLogMaxSize)
+		if err != nil {
+			return err
+		}
+		sn.events = events
+		log.Printf("Mutation event log enabled (last sequence: %d)", events.seq)
+	}
+
+	if sn.chunkFsync.mode != FsyncAlways || sn.indexFsync.mode != FsyncAlways {
+		log.Printf("Fsync policy: chunks %s, index %s", sn.chunkFsync.mode, sn.indexFsync.mode)
+	}
+	// Index saves are best effort; make sure failed ones are retried while idle
+	atomic.StoreInt64(&sn.lastCheckpoint, time.Now().UnixNano())
+	if sn.maxCheckpointAge > 0 {
+		sn.tasks.every("checkpoint", sn.maxCheckpointAge/4, DefaultTaskJitterFraction, sn.checkpointIfStale)
+	}
+	if sn.indexSaveRetryInterval > 0 {
+		sn.tasks.every("index-save-retry", sn.indexSaveRetryInterval, DefaultTaskJitterFraction, sn.retryFailedIndexSave)
+	}
+
+	if sn.chunkFsync.mode == FsyncInterval || sn.indexFsync.mode == FsyncInterval {
+		sn.tasks.every("fsync", sn.fsyncInterval, DefaultTaskJitterFraction, sn.flushFsync)
+	}
+
+	if len(sn.replicaPeers) > 0 {
+		for i := 0; i < ReplicationWorkers; i++ {
+			sn.tasks.start("replicate", sn.runReplicationWorker)
+		}
+	}
+
+	if sn.postWriteVerify != nil {
+		log.Printf("Verifying chunks after write (up to %d MB/s)", sn.postWriteVerifyRate/(1024*1024))
+		sn.tasks.every("verify-after-write", PostWriteVerifyInterval, DefaultTaskJitterFraction, sn.verifyWrittenChunks)
+	}
+
+	if sn.clientLimits != nil {
+		sn.tasks.every("rate-limit-prune", ClientRateLimitIdle, DefaultTaskJitterFraction, func(context.Context) {
+			sn.clientLimits.prune(time.Now())
+		})
+	}
+
+	if sn.expiryReapInterval > 0 {
+		sn.tasks.every("reap-expired", sn.expiryReapInterval, DefaultTaskJitterFraction, sn.reapExpired)
+	}
+
+	if sn.scrubInterval > 0 {
+		log.Printf("Scrubbing all chunks every %v (up to %d MB/s)", sn.scrubInterval, sn.scrubRate/(1024*1024))
+		sn.tasks.every("scrub", sn.scrubInterval, DefaultTaskJitterFraction, sn.scrubPeriodically)
+	}
 
+	if sn.fastTierDir != "" {
+		interval := sn.fastTierMaxAge / 4
+		if interval < time.Second {
+			interval = time.Second
+		}
+		sn.tasks.every("fast-tier-migrate", interval, DefaultTaskJitterFraction, sn.migrateColdChunks)
+	}
+
+	if sn.maxSuperblockAge > 0 {
+		log.Printf("Sealing superblocks older than %v", sn.maxSuperblockAge)
+		// Rotation isn't persisted, so reseal before a restart appends to an
+		// aged superblock again
+		sn.sealAgedSuperblocks(context.Background())
+		// Check often enough that superblocks don't overstay by much
+		interval := sn.maxSuperblockAge / 4
+		if interval > time.Minute {
+			interval = time.Minute
+		}
+		if interval < time.Second {
+			interval = time.Second
+		}
+		sn.tasks.every("seal-aged-superblocks", interval, DefaultTaskJitterFraction, sn.sealAgedSuperblocks)
+	}
+
+	if sn.snapshotStaleness > 0 {
+		log.Printf("Serving listings from an index snapshot up to %v stale", sn.snapshotStaleness)
+		sn.tasks.every("index-snapshot", sn.snapshotStaleness/2, DefaultTaskJitterFraction, sn.prewarmListingSnapshot)
+	}
+
+	// Pick up drains interrupted by a restart
+	sn.resumeDrains()
+
+	atomic.StoreInt32(&sn.initialized, 1)
 	return nil
 }
 
+// loadOrRebuildIndex loads the existing index. If it was damaged or lost
+// while the superblocks still hold data, it is rebuilt from them rather than
+// starting empty.
+func (sn *StorageNode) loadOrRebuildIndex() {
+	_, statErr := os.Stat(sn.indexFile)
+	err := sn.loadIndex()
+	if err != nil {
+		log.Printf("Warning: failed to load index: %v", err)
+	}
+	if errors.Is(err, errCorruptIndex) || errors.Is(err, errIndexChecksumMismatch) ||
+		(os.IsNotExist(statErr) && sn.hasSuperblockData()) {
+		log.Printf("Rebuilding index from superblocks")
+		if err := sn.RebuildIndex(); err != nil {
+			log.Printf("Warning: failed to rebuild index: %v", err)
+		}
+	}
+}
+
 func (sn *StorageNode) loadIndex() error {
+	return sn.loadIndexFile(true)
+}
+
+// loadIndexFile loads the index, moving a damaged index file aside when
+// quarantine is set. fsck leaves it in place for the node to deal with.
+func (sn *StorageNode) loadIndexFile(quarantine bool) error {
 	sn.index.mu.Lock()
 	defer sn.index.mu.Unlock()
 
@@ -176,45 +1244,118 @@ func (sn *StorageNode) loadIndex() error {
 	}
 	defer file.Close()
 
-	return json.NewDecoder(file).Decode(&sn.index.chunks)
+	// Decode into a fresh map so a corrupt or truncated file can never leave
+	// a partially populated index behind
+	chunks := make(map[string]ChunkEntry)
+	hasher := sha256.New()
+	reader := io.TeeReader(file, hasher)
+	if err := json.NewDecoder(reader).Decode(&chunks); err != nil {
+		if quarantine {
+			sn.quarantineIndex()
+		}
+		return fmt.Errorf("%w: %v", errCorruptIndex, err)
+	}
+
+	// Valid JSON can still carry flipped bits in offsets or sizes
+	if sn.indexChecksum {
+		if _, err := io.Copy(io.Discard, reader); err != nil {
+			return fmt.Errorf("failed to read index file: %w", err)
+		}
+		if err := sn.verifyIndexChecksum(hex.EncodeToString(hasher.Sum(nil))); err != nil {
+			if quarantine {
+				sn.quarantineIndex()
+			}
+			return err
+		}
+	}
+	sn.index.replace(chunks)
+	return nil
 }
 
-func (sn *StorageNode) saveIndex() error {
+// quarantineIndex keeps a damaged index file for recovery instead of
+// overwriting it on the next save
+func (sn *StorageNode) quarantineIndex() {
+	if sn.readOnlyMode {
+		return
+	}
+	corruptFile := fmt.Sprintf("%s.corrupt-%d", sn.indexFile, time.Now().Unix())
+	if err := os.Rename(sn.indexFile, corruptFile); err != nil {
+		log.Printf("Warning: failed to move aside corrupt index: %v", err)
+	} else {
+		log.Printf("Moved corrupt index to %s", corruptFile)
+	}
+}
+
+func (sn *StorageNode) saveIndex() (err error) {
+	if sn.readOnlyMode {
+		return errReadOnlyMode
+	}
+	if sn.isReadOnly() {
+		return errReadOnly
+	}
+	defer func() { sn.noteWriteError(err) }()
+
 	sn.index.mu.RLock()
 	defer sn.index.mu.RUnlock()
 
 	// Write to temporary file first (atomic write pattern)
-	tempFile := sn.indexFile + ".tmp"
+	tempFile := sn.tempPath(sn.indexFile)
 	file, err := os.Create(tempFile)
 	if err != nil {
 		atomic.AddInt64(&sn.failedIndexSaves, 1)
 		return fmt.Errorf("failed to create temp index file: %w", err)
 	}
 
-	if err := json.NewEncoder(file).Encode(sn.index.chunks); err != nil {
+	hasher := sha256.New()
+	if err := json.NewEncoder(io.MultiWriter(file, hasher)).Encode(sn.index.chunks); err != nil {
 		file.Close()
 		os.Remove(tempFile)
 		atomic.AddInt64(&sn.failedIndexSaves, 1)
 		return fmt.Errorf("failed to encode index: %w", err)
 	}
 
-	if err := file.Sync(); err != nil {
-		file.Close()
+	// An index lost to a crash is far costlier than a few chunk bytes, so it
+	// is synced before the rename unless INDEX_FSYNC_POLICY says otherwise
+	if sn.indexFsync.due(sn.indexFile) {
+		if err := file.Sync(); err != nil {
+			file.Close()
+			os.Remove(tempFile)
+			atomic.AddInt64(&sn.failedIndexSaves, 1)
+			return fmt.Errorf("failed to sync index: %w", err)
+		}
+	}
+	file.Close()
+
+	// The checksum must be in place before the index it describes
+	if sn.indexChecksum {
+		err = sn.writeIndexChecksum(hex.EncodeToString(hasher.Sum(nil)))
+	} else if err = os.Remove(sn.indexChecksumPath()); os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
 		os.Remove(tempFile)
 		atomic.AddInt64(&sn.failedIndexSaves, 1)
-		return fmt.Errorf("failed to sync index: %w", err)
+		return err
 	}
-	file.Close()
 
 	// Atomic rename
-	if err := os.Rename(tempFile, sn.indexFile); err != nil {
+	if err := sn.replaceFile(tempFile, sn.indexFile); err != nil {
 		os.Remove(tempFile)
 		atomic.AddInt64(&sn.failedIndexSaves, 1)
 		return fmt.Errorf("failed to rename index file: %w", err)
 	}
 
+	// The snapshot holds every logged mutation; a failed reset only means
+	// they are replayed again, harmlessly
+	if err := sn.resetIndexWAL(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
 	// Reset failure counter on success
 	atomic.StoreInt64(&sn.failedIndexSaves, 0)
+	atomic.AddInt64(&sn.indexSaves, 1)
+	atomic.StoreUint64(&sn.checkpointGen, sn.index.gen)
+	atomic.StoreInt64(&sn.lastCheckpoint, time.Now().UnixNano())
 	return nil
 }
 
@@ -248,11 +1389,18 @@ func (sn *StorageNode) findCurrentSuperblock() {
 }
 
 func (sn *StorageNode) getSuperblockPath(id int) string {
+	if isFastTierSuperblock(id) {
+		return sn.fastTierPath(id)
+	}
 	return filepath.Join(sn.dataDir, "data", fmt.Sprintf("superblock_%d.dat", id))
 }
 
 func (sn *StorageNode) getCurrentSuperblockSize() (int64, error) {
-	path := sn.getSuperblockPath(sn.currentSuperblock)
+	return sn.getSuperblockSize(sn.currentSuperblock)
+}
+
+func (sn *StorageNode) getSuperblockSize(id int) (int64, error) {
+	path := sn.getSuperblockPath(id)
 	info, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -265,7 +1413,7 @@ func (sn *StorageNode) getCurrentSuperblockSize() (int64, error) {
 
 func (sn *StorageNode) getDiskUsage() float64 {
 	var stat syscall.Statfs_t
-	if err := syscall.Statfs(sn.dataDir, &stat); err != nil {
+	if err := statfs(sn.dataDir, &stat); err != nil {
 		log.Printf("Warning: failed to get disk usage: %v", err)
 		return 0.0
 	}
@@ -280,19 +1428,51 @@ func (sn *StorageNode) getDiskUsage() float64 {
 func (sn *StorageNode) Shutdown() {
 	log.Println("Shutting down storage node...")
 
+	// Stop background tasks before the final flushes below
+	sn.tasks.stop()
+
+	if sn.readOnlyMode {
+		sn.handles.closeAll()
+		log.Println("Storage Node shutdown complete")
+		return
+	}
+
 	//  Save index without holding lock
+	sn.cancelDeferredSave()
 	if err := sn.saveIndex(); err != nil {
 		log.Printf("Failed to save index during shutdown: %v", err)
 	} else {
 		log.Println("Index saved successfully")
 	}
 
+	if sn.index.wal != nil {
+		if err := sn.index.wal.close(); err != nil {
+			log.Printf("Failed to close index WAL: %v", err)
+		}
+	}
+
+	if err := sn.finalizeActiveSuperblock(); err != nil {
+		log.Printf("Failed to finalize active superblock header: %v", err)
+	}
+
+	// Don't leave writes deferred by the interval policy unsynced
+	sn.flushFsync(context.Background())
+
+	sn.handles.closeAll()
+
+	if sn.events != nil {
+		if err := sn.events.close(); err != nil {
+			log.Printf("Failed to close event log: %v", err)
+		}
+	}
+
 	log.Println("Storage Node shutdown complete")
 }
 
 // HTTP Handlers
 
 func (sn *StorageNode) handlePutChunk(w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
 	vars := mux.Vars(r)
 	chunkID := vars["chunk_id"]
 
@@ -302,20 +1482,45 @@ func (sn *StorageNode) handlePutChunk(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate chunk ID format
-	if err := validateChunkID(chunkID); err != nil {
+	if err := sn.validateChunkID(chunkID); err != nil {
+		writeChunkIDError(w, err)
+		return
+	}
+
+	storedBy := r.Header.Get("X-Stored-By")
+	if len(storedBy) > MaxStoredByLength {
+		http.Error(w, fmt.Sprintf("X-Stored-By exceeds %d characters", MaxStoredByLength), http.StatusBadRequest)
+		return
+	}
+
+	meta, err := parseUserMeta(r.Header)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Check if chunk already exists (idempotent operation)
-	sn.index.mu.RLock()
-	if _, exists := sn.index.chunks[chunkID]; exists {
-		sn.index.mu.RUnlock()
+	var expiresAt *time.Time
+	if ttlHeader := r.Header.Get("X-Chunk-TTL"); ttlHeader != "" {
+		ttl, err := strconv.ParseInt(ttlHeader, 10, 64)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "X-Chunk-TTL must be a positive number of seconds", http.StatusBadRequest)
+			return
+		}
+		expiry := time.Now().Add(time.Duration(ttl) * time.Second)
+		expiresAt = &expiry
+	}
+
+	// Concurrent DELETEs of this chunk wait for the PUT to finish
+	defer sn.beginWrite(chunkID)()
+
+	// Check if chunk already exists (idempotent operation). An expired
+	// chunk is gone as far as GET is concerned, so it's replaced.
+	if _, exists := sn.lookupChunk(chunkID); exists {
 		w.Header().Set("Location", fmt.Sprintf("/chunk/%s", chunkID))
 		w.WriteHeader(http.StatusOK) // Chunk already exists
 		return
 	}
-	sn.index.mu.RUnlock()
+	sn.deleteExpired(chunkID)
 
 	// Validate content length (early rejection)
 	contentLength := r.ContentLength
@@ -323,13 +1528,79 @@ func (sn *StorageNode) handlePutChunk(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Content-Length header required", http.StatusBadRequest)
 		return
 	}
-	if contentLength > MaxChunkSizeBuffer {
-		http.Error(w, fmt.Sprintf("Chunk size exceeds maximum allowed (%d bytes)", MaxChunkSize), http.StatusRequestEntityTooLarge)
+	if contentLength > sn.maxChunkSize+ChunkSizeOverhead {
+		http.Error(w, fmt.Sprintf("Chunk size exceeds maximum allowed (%d bytes)", sn.maxChunkSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Validate against client-provided checksum if present, computing the
+	// algorithm the client used (SHA-256 unless X-Chunk-Checksum-Algo says otherwise)
+	clientChecksum := strings.ToLower(r.Header.Get("X-Chunk-Checksum"))
+	clientAlgo := r.Header.Get("X-Chunk-Checksum-Algo")
+	if clientAlgo != "" && clientChecksum == "" {
+		http.Error(w, "X-Chunk-Checksum-Algo requires X-Chunk-Checksum", http.StatusBadRequest)
+		return
+	}
+	algo := ChecksumSHA256
+	if clientAlgo != "" {
+		if algo, err = parseChecksumAlgorithm(clientAlgo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// In content-addressed mode the chunk ID is the checksum to verify, and
+	// a mismatch is never stored
+	advisory := sn.checksumMismatch == ChecksumMismatchStoreComputed
+	if address, err := sn.contentAddressChecksum(chunkID, clientChecksum, algo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if address != "" {
+		clientChecksum, algo, advisory = address, ChecksumSHA256, false
+	}
+
+	pw := &pendingWrite{chunkID: chunkID, storedBy: storedBy, expiresAt: expiresAt, meta: meta}
+
+	// Chunks too large for the batched path are streamed straight to disk,
+	// unless they are to be compressed or encrypted, which takes them whole
+	whole := sn.chunkCipher != nil || (sn.chunkCompression != ChunkCompressionNone && contentLength <= sn.streamThreshold)
+	if !whole && (!sn.smallChunkBatching || contentLength > SmallChunkThreshold) {
+		var expect *expectedChecksum
+		if clientChecksum != "" {
+			expect = &expectedChecksum{algo: algo, value: clientChecksum, advisory: advisory}
+		}
+		entry, err := sn.storeStream(pw, r.Body, contentLength, expect)
+		switch {
+		case err == nil:
+		case errors.Is(err, errChecksumMismatch):
+			http.Error(w, sn.mismatchMessage(), http.StatusBadRequest)
+			return
+		case errors.Is(err, errShortBody):
+			http.Error(w, "Failed to read chunk data", http.StatusBadRequest)
+			return
+		default:
+			writeStoreError(w, chunkID, err)
+			return
+		}
+
+		if expect != nil && expect.mismatched {
+			sn.noteChecksumMismatch(chunkID, clientChecksum, entry.Checksum)
+			w.Header().Set("X-Checksum-Mismatch", "true")
+		}
+		w.Header().Set("Location", fmt.Sprintf("/chunk/%s", chunkID))
+		w.Header().Set("ETag", entry.Checksum)
+		w.Header().Set("X-Chunk-Size", strconv.Itoa(int(entry.Size)))
+		w.WriteHeader(http.StatusCreated)
+		atomic.AddInt64(&sn.chunkPuts, 1)
+		sn.writeLatency.observe(time.Since(requestStart))
+
+		log.Printf("Stored chunk %s (size: %d bytes, checksum: %s, streamed)", chunkID, entry.Size, shortChecksum(entry.Checksum))
+		sn.replicateWrite(r, chunkID)
 		return
 	}
 
 	// Read chunk data with size limit
-	data, err := io.ReadAll(io.LimitReader(r.Body, MaxChunkSizeBuffer))
+	data, err := io.ReadAll(io.LimitReader(r.Body, sn.maxChunkSize+ChunkSizeOverhead))
 	if err != nil {
 		http.Error(w, "Failed to read chunk data", http.StatusBadRequest)
 		return
@@ -340,35 +1611,58 @@ func (sn *StorageNode) handlePutChunk(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Compute checksum for integrity
-	hash := sha256.Sum256(data)
-	computedChecksum := hex.EncodeToString(hash[:])
-
-	// Validate against client-provided checksum if present
-	clientChecksum := r.Header.Get("X-Chunk-Checksum")
-	if clientChecksum != "" && clientChecksum != computedChecksum {
-		http.Error(w, ErrChecksumMismatch, http.StatusBadRequest)
+	// Compute checksum for integrity using the node's configured algorithm
+	computedChecksum, err := computeChecksum(sn.checksumAlgo, data)
+	if err != nil {
+		log.Printf("Checksum error for chunk %s: %v", chunkID, err)
+		http.Error(w, "Internal storage error", http.StatusInternalServerError)
 		return
 	}
 
-	// Store chunk with proper error handling
-	if err := sn.storeChunk(chunkID, data, computedChecksum); err != nil {
-		if strings.Contains(err.Error(), "insufficient storage") {
-			http.Error(w, ErrInsufficientStorage, http.StatusInsufficientStorage)
-		} else {
-			log.Printf("Storage error for chunk %s: %v", chunkID, err)
-			http.Error(w, "Internal storage error", http.StatusInternalServerError)
+	mismatched := false
+	if clientChecksum != "" {
+		expected := computedChecksum
+		if algo != sn.checksumAlgo {
+			expected, _ = computeChecksum(algo, data)
+		}
+		if clientChecksum != expected {
+			if !advisory {
+				http.Error(w, sn.mismatchMessage(), http.StatusBadRequest)
+				return
+			}
+			mismatched = true
 		}
+	}
+
+	// Store chunk with proper error handling
+	pw.data, pw.checksum = data, computedChecksum
+	if err := sn.storePending(pw); err != nil {
+		writeStoreError(w, chunkID, err)
 		return
 	}
 
 	// Success response with proper headers
+	if mismatched {
+		sn.noteChecksumMismatch(chunkID, clientChecksum, computedChecksum)
+		w.Header().Set("X-Checksum-Mismatch", "true")
+	}
 	w.Header().Set("Location", fmt.Sprintf("/chunk/%s", chunkID))
 	w.Header().Set("ETag", computedChecksum)
 	w.Header().Set("X-Chunk-Size", strconv.Itoa(len(data)))
 	w.WriteHeader(http.StatusCreated)
+	atomic.AddInt64(&sn.chunkPuts, 1)
+	sn.writeLatency.observe(time.Since(requestStart))
+
+	log.Printf("Stored chunk %s (size: %d bytes, checksum: %s)", chunkID, len(data), shortChecksum(computedChecksum))
+	sn.replicateWrite(r, chunkID)
+}
 
-	log.Printf("Stored chunk %s (size: %d bytes, checksum: %s)", chunkID, len(data), computedChecksum[:16]+"...")
+// noteChecksumMismatch records a chunk stored despite its client checksum
+// not matching, as CHECKSUM_MISMATCH_POLICY=store-computed allows
+func (sn *StorageNode) noteChecksumMismatch(chunkID, clientChecksum, computed string) {
+	atomic.AddInt64(&sn.checksumMismatches, 1)
+	log.Printf("Warning: client checksum %s for chunk %s doesn't match its data, stored with computed checksum %s",
+		shortChecksum(clientChecksum), chunkID, shortChecksum(computed))
 }
 
 func (sn *StorageNode) handleGetChunk(w http.ResponseWriter, r *http.Request) {
@@ -376,116 +1670,322 @@ func (sn *StorageNode) handleGetChunk(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	chunkID := vars["chunk_id"]
 
-	if chunkID == "" {
-		http.Error(w, "chunk_id is required", http.StatusBadRequest)
+	if err := sn.validateChunkID(chunkID); err != nil {
+		writeChunkIDError(w, err)
 		return
 	}
 
 	// Lookup chunk in index (optimized for <10ms latency requirement)
-	sn.index.mu.RLock()
-	entry, exists := sn.index.chunks[chunkID]
-	sn.index.mu.RUnlock()
+	entry, exists := sn.lookupChunk(chunkID)
 
 	if !exists {
-		http.Error(w, ErrChunkNotFound, http.StatusNotFound)
+		sn.writeChunkNotFound(w, chunkID)
+		return
+	}
+
+	sn.serveChunk(w, r, entry, requestStart)
+}
+
+// serveChunk reads, verifies and writes a chunk's data as a GET response
+func (sn *StorageNode) serveChunk(w http.ResponseWriter, r *http.Request, entry ChunkEntry, requestStart time.Time) {
+	chunkID := entry.ChunkID
+
+	// A replicating GET always serves the whole chunk as stored
+	replicaURL, ok := sn.replicationTarget(w, r)
+	if !ok {
+		return
+	}
+	if replicaURL != "" {
+		sn.serveAndReplicate(w, entry, replicaURL)
+		return
+	}
+
+	// Chunks are immutable, so a matching ETag lets caches revalidate without a read
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, entry.Checksum) {
+		sn.setCacheHeaders(w, entry)
+		w.Header().Set("ETag", entry.Checksum)
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	// Read chunk data with direct I/O for performance
-	data, err := sn.readChunk(entry)
+	// Protect memory-constrained clients from oversized bodies
+	size := int64(entry.logicalSize())
+	if sn.maxReadBytes > 0 && size > sn.maxReadBytes {
+		atomic.AddInt64(&sn.rejectedReads, 1)
+		http.Error(w, fmt.Sprintf("Chunk size %d exceeds read limit of %d bytes", size, sn.maxReadBytes),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+	if sn.warnLargeReadBytes > 0 && size > sn.warnLargeReadBytes {
+		atomic.AddInt64(&sn.largeReads, 1)
+		log.Printf("WARNING: serving chunk %s of %d bytes (above WARN_LARGE_READ_BYTES %d)", chunkID, size, sn.warnLargeReadBytes)
+	}
+
+	// Ranges apply to the chunk's data and skip response compression. If-Range
+	// falls back to the whole chunk when the client's copy is stale.
+	if header := r.Header.Get("Range"); header != "" && r.Method == http.MethodGet {
+		if ifRange := r.Header.Get("If-Range"); ifRange == "" || etagMatches(ifRange, entry.Checksum) {
+			ranges, err := parseRange(header, size)
+			if err != nil {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+				http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			if ranges != nil {
+				entry, parts, err := sn.fetchRanges(entry, ranges)
+				if err != nil {
+					writeReadError(w, chunkID, err)
+					return
+				}
+				w.Header().Set("ETag", entry.Checksum)
+				w.Header().Set("Accept-Ranges", "bytes")
+				sn.setCacheHeaders(w, entry)
+				setUserMetaHeaders(w, entry)
+				atomic.AddInt64(&sn.chunkGets, 1)
+				if err := writeRanges(w, ranges, parts, size, entry.contentType()); err != nil {
+					log.Printf("Failed to write ranges of chunk %s: %v", chunkID, err)
+				}
+				sn.readLatency.observe(time.Since(requestStart))
+				return
+			}
+		}
+	}
+
+	// Serve from the read cache when possible. Under READ_MODE=mmap data
+	// can point into the superblock's mapping, held until the response is
+	// written.
+	entry, data, release, err := sn.fetchChunkView(entry)
+	defer release()
+	if errors.Is(err, errChunkCorrupt) {
+		// A replica peer's copy can stand in for, and then replace, a corrupt one
+		if repaired, ok := sn.repairFromPeers(r, entry); ok {
+			data, err = repaired, nil
+		}
+	}
 	if err != nil {
-		log.Printf("Failed to read chunk %s: %v", chunkID, err)
-		http.Error(w, "Failed to read chunk", http.StatusInternalServerError)
+		writeReadError(w, chunkID, err)
 		return
 	}
 
-	// Verify checksum for data integrity
-	hash := sha256.Sum256(data)
-	computedChecksum := hex.EncodeToString(hash[:])
-	if computedChecksum != entry.Checksum {
-		log.Printf("Checksum mismatch for chunk %s: expected %s, got %s", chunkID, entry.Checksum, computedChecksum)
-		http.Error(w, "Chunk corruption detected", http.StatusInternalServerError)
+	// Compress the response body if negotiated with the client
+	body := data
+	if coding := sn.negotiateResponseEncoding(r, len(data)); coding != "" {
+		if compressed, err := compressResponse(coding, data); err != nil {
+			log.Printf("Warning: failed to %s-compress chunk %s, sending uncompressed: %v", coding, chunkID, err)
+		} else {
+			body = compressed
+			w.Header().Set("Content-Encoding", coding)
+		}
+	}
+	if sn.responseCompression != ResponseCompressionOff {
+		w.Header().Set("Vary", "Accept-Encoding")
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", entry.contentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("ETag", entry.Checksum)
+	setSizeHeaders(w, entry)
+	w.Header().Set("X-Superblock-ID", strconv.Itoa(entry.SuperblockID))
+	w.Header().Set("Accept-Ranges", "bytes")
+	sn.setCacheHeaders(w, entry)
+	setUserMetaHeaders(w, entry)
+
+	// Write response
+	w.WriteHeader(http.StatusOK)
+	atomic.AddInt64(&sn.chunkGets, 1)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Failed to write response for chunk %s: %v", chunkID, err)
+	}
+
+	duration := time.Since(requestStart)
+	sn.readLatency.observe(duration)
+	if duration > MaxRetrievalLatency {
+		log.Printf("WARNING: Chunk retrieval for %s took %v (exceeds 10ms requirement)", chunkID, duration)
+	}
+}
+
+// setCacheHeaders marks chunks as cacheable forever, since their bytes never
+// change, unless they expire. Pinned chunks never expire, whatever their TTL.
+func (sn *StorageNode) setCacheHeaders(w http.ResponseWriter, entry ChunkEntry) {
+	setAgeHeaders(w, entry, time.Now())
+	if entry.ExpiresAt != nil && !entry.Pinned {
+		w.Header().Set("Cache-Control", "no-store")
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", sn.chunkCacheMaxAge))
+}
+
+// setSizeHeaders reports a chunk's size as served in X-Chunk-Size and the
+// bytes it takes on disk, less when it's compressed at rest, in X-Stored-Size
+func setSizeHeaders(w http.ResponseWriter, entry ChunkEntry) {
+	w.Header().Set("X-Chunk-Size", strconv.Itoa(int(entry.logicalSize())))
+	w.Header().Set("X-Stored-Size", strconv.Itoa(int(entry.Size)))
+}
+
+// setAgeHeaders reports whole seconds since a chunk was stored in
+// X-Chunk-Age-Seconds and, for chunks that will expire, the whole seconds
+// left until they do in X-Chunk-TTL-Remaining
+func setAgeHeaders(w http.ResponseWriter, entry ChunkEntry, now time.Time) {
+	age := now.Sub(entry.StoredAt)
+	if age < 0 {
+		age = 0
+	}
+	w.Header().Set("X-Chunk-Age-Seconds", strconv.FormatInt(int64(age/time.Second), 10))
+
+	if entry.ExpiresAt == nil || entry.Pinned {
+		return
+	}
+	remaining := entry.ExpiresAt.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	w.Header().Set("X-Chunk-TTL-Remaining", strconv.FormatInt(int64(remaining/time.Second), 10))
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.Trim(candidate, `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func (sn *StorageNode) handleGetByChecksum(w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+	checksum := strings.ToLower(mux.Vars(r)["checksum"])
+
+	if !validChecksum.MatchString(checksum) {
+		http.Error(w, "Invalid checksum format", http.StatusBadRequest)
+		return
+	}
+
+	sn.index.mu.RLock()
+	entry, exists := sn.index.lookupChecksum(checksum)
+	sn.index.mu.RUnlock()
+
+	if !exists || entry.expired(time.Now()) {
+		sn.writeChunkNotFound(w, checksum)
+		return
+	}
+
+	w.Header().Set("X-Chunk-ID", entry.ChunkID)
+	sn.serveChunk(w, r, entry, requestStart)
+}
+
+func (sn *StorageNode) handleHeadChunk(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chunkID := vars["chunk_id"]
+
+	if err := sn.validateChunkID(chunkID); err != nil {
+		writeChunkIDError(w, err)
+		return
+	}
+
+	// Lookup chunk in index
+	entry, exists := sn.lookupChunk(chunkID)
+
+	if !exists {
+		sn.writeChunkNotFound(w, chunkID)
+		return
+	}
+
+	// Set response headers (same as GET but without body)
+	w.Header().Set("Content-Type", entry.contentType())
+	w.Header().Set("Content-Length", strconv.Itoa(int(entry.logicalSize())))
+	w.Header().Set("ETag", entry.Checksum)
+	setSizeHeaders(w, entry)
+	w.Header().Set("X-Superblock-ID", strconv.Itoa(entry.SuperblockID))
+	sn.setCacheHeaders(w, entry)
+	setUserMetaHeaders(w, entry)
+
+	// HEAD request - only headers, no body
+	w.WriteHeader(http.StatusOK)
+}
+
+// ExistsResponse represents the chunk existence check response
+type ExistsResponse struct {
+	ChunkID string `json:"chunk_id"`
+	Exists  bool   `json:"exists"`
+}
+
+func (sn *StorageNode) handleChunkExists(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chunkID := vars["chunk_id"]
+
+	if err := sn.validateChunkID(chunkID); err != nil {
+		writeChunkIDError(w, err)
 		return
 	}
 
-	// Set response headers
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
-	w.Header().Set("ETag", entry.Checksum)
-	w.Header().Set("X-Chunk-Size", strconv.Itoa(int(entry.Size)))
-	w.Header().Set("X-Superblock-ID", strconv.Itoa(entry.SuperblockID))
+	// Index lookup only, no disk access
+	_, exists := sn.lookupChunk(chunkID)
 
-	// Write response
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
 	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(data); err != nil {
-		log.Printf("Failed to write response for chunk %s: %v", chunkID, err)
-	}
-
-	//  Log performance metrics
-	duration := time.Since(requestStart)
-	if duration > MaxRetrievalLatency {
-		log.Printf("WARNING: Chunk retrieval for %s took %v (exceeds 10ms requirement)", chunkID, duration)
+	if err := json.NewEncoder(w).Encode(ExistsResponse{ChunkID: chunkID, Exists: exists}); err != nil {
+		log.Printf("Failed to encode exists response: %v", err)
 	}
 }
 
-func (sn *StorageNode) handleHeadChunk(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	chunkID := vars["chunk_id"]
-
-	if chunkID == "" {
-		http.Error(w, "chunk_id is required", http.StatusBadRequest)
+// handleChunkMetadata returns a chunk's index entry as JSON without reading its data
+func (sn *StorageNode) handleChunkMetadata(w http.ResponseWriter, r *http.Request) {
+	chunkID := mux.Vars(r)["chunk_id"]
+	if err := sn.validateChunkID(chunkID); err != nil {
+		writeChunkIDError(w, err)
 		return
 	}
 
-	// Lookup chunk in index
-	sn.index.mu.RLock()
-	entry, exists := sn.index.chunks[chunkID]
-	sn.index.mu.RUnlock()
+	entry, exists := sn.lookupChunk(chunkID)
 
 	if !exists {
-		http.Error(w, ErrChunkNotFound, http.StatusNotFound)
+		sn.writeChunkNotFound(w, chunkID)
 		return
 	}
 
-	// Set response headers (same as GET but without body)
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", strconv.Itoa(int(entry.Size)))
-	w.Header().Set("ETag", entry.Checksum)
-	w.Header().Set("X-Chunk-Size", strconv.Itoa(int(entry.Size)))
-	w.Header().Set("X-Superblock-ID", strconv.Itoa(entry.SuperblockID))
-
-	// HEAD request - only headers, no body
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(entry); err != nil {
+		log.Printf("Failed to encode chunk metadata: %v", err)
+	}
 }
 
+// handleDeleteChunk removes a chunk from the index. A DELETE that arrives
+// while a PUT of the same chunk is in progress waits for the PUT to finish
+// and then deletes what it stored, so the DELETE is never silently undone.
+// If the PUT doesn't finish within DELETE_WAIT_TIMEOUT the DELETE fails with
+// 409 and should be retried.
 func (sn *StorageNode) handleDeleteChunk(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	chunkID := vars["chunk_id"]
 
-	if chunkID == "" {
-		http.Error(w, "chunk_id is required", http.StatusBadRequest)
+	if err := sn.validateChunkID(chunkID); err != nil {
+		writeChunkIDError(w, err)
 		return
 	}
 
-	// Remove from index
-	sn.index.mu.Lock()
-	_, exists := sn.index.chunks[chunkID]
-	if exists {
-		delete(sn.index.chunks, chunkID)
+	ctx, cancel := context.WithTimeout(r.Context(), sn.deleteWaitTimeout)
+	defer cancel()
+	if err := sn.awaitWrite(ctx, chunkID); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
 	}
-	sn.index.mu.Unlock()
 
-	if !exists {
+	if !sn.deleteChunk(chunkID) {
 		http.Error(w, ErrChunkNotFound, http.StatusNotFound)
 		return
 	}
 
-	// Persist index (best effort)
-	if err := sn.saveIndex(); err != nil {
-		log.Printf("Warning: failed to persist index after deleting chunk %s: %v", chunkID, err)
+	// Persist index (best effort), coalesced with other deletes in the window
+	if err := sn.deferIndexSave(sn.deleteCoalesceWindow); err != nil {
+		log.Printf("Warning: failed to persist index after delete: %v", err)
 	}
 
-	// Note: Actual data remains in superblock file - would need garbage collection
+	// The data remains in the superblock until it is compacted
 	w.WriteHeader(http.StatusNoContent)
 	log.Printf("Deleted chunk %s from index", chunkID)
 }
@@ -509,7 +2009,8 @@ func (sn *StorageNode) handlePing(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (sn *StorageNode) handleHealth(w http.ResponseWriter, r *http.Request) {
+// health reports the node's current health as served by /health
+func (sn *StorageNode) health() HealthResponse {
 	sn.index.mu.RLock()
 	chunkCount := len(sn.index.chunks)
 	sn.index.mu.RUnlock()
@@ -517,28 +2018,69 @@ func (sn *StorageNode) handleHealth(w http.ResponseWriter, r *http.Request) {
 	uptime := time.Since(sn.startTime).Seconds()
 	diskUsage := sn.getDiskUsage()
 	failedSaves := atomic.LoadInt64(&sn.failedIndexSaves)
+	truncated := atomic.LoadInt64(&sn.truncatedChunks)
+	corruptions := atomic.LoadInt64(&sn.scrub.corruptions)
+	metadata := sn.metadataHealth()
+
+	var freeInodesPercent *float64
+	inodesLow := false
+	if free, percent, ok := sn.freeInodes(); ok {
+		freeInodesPercent = &percent
+		inodesLow = free < sn.minFreeInodes
+	}
+
+	var indexUsagePercent *float64
+	indexFull, indexNearlyFull := false, false
+	if percent, ok := sn.indexUsage(chunkCount); ok {
+		indexUsagePercent = &percent
+		indexFull = chunkCount >= sn.maxIndexEntries
+		indexNearlyFull = percent >= IndexEntriesWarningFraction*100
+	}
 
 	// Determine health status
 	status := "healthy"
-	if diskUsage > DiskUsageCriticalThreshold || failedSaves > 5 {
+	if diskUsage > DiskUsageCriticalThreshold || failedSaves > 5 || inodesLow || indexFull {
 		status = "critical"
-	} else if diskUsage > DiskUsageWarningThreshold || failedSaves > 0 {
+	} else if diskUsage > DiskUsageWarningThreshold || failedSaves > 0 || truncated > 0 || corruptions > 0 || indexNearlyFull ||
+		metadata.Status == MetadataStatusWarning || sn.recentPanic() || sn.isReadOnly() {
 		status = "warning"
 	}
 
-	health := HealthResponse{
+	return HealthResponse{
 		Status:     status,
 		DiskUsage:  diskUsage,
+		FreeInodes: freeInodesPercent,
+		IndexUsage: indexUsagePercent,
 		ChunkCount: chunkCount,
 		Uptime:     int64(uptime),
 		NodeID:     sn.nodeID,
+
+		TruncatedChunks:  truncated,
+		ScrubCorruptions: corruptions,
+		Panics:           atomic.LoadInt64(&sn.panics),
+		Metadata:         metadata,
+		Rebuild:          sn.rebuildStatus(),
+		Filesystem:       sn.filesystemStatus(),
+		ReadOnlyMode:     sn.readOnlyMode,
+
+		ChunkFsyncPolicy: sn.chunkFsync.mode,
+		IndexFsyncPolicy: sn.indexFsync.mode,
+
+		ReadLatency:  sn.readLatency.percentiles(),
+		WriteLatency: sn.writeLatency.percentiles(),
+
+		Replication: sn.replicationHealth(),
 	}
+}
+
+func (sn *StorageNode) handleHealth(w http.ResponseWriter, r *http.Request) {
+	health := sn.health()
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-cache")
 
 	// Set appropriate HTTP status based on health
-	if status == "critical" {
+	if health.Status == "critical" {
 		w.WriteHeader(http.StatusServiceUnavailable)
 	} else {
 		w.WriteHeader(http.StatusOK)
@@ -549,141 +2091,616 @@ func (sn *StorageNode) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// writeStoreError maps a failed chunk write to its HTTP response
+func writeStoreError(w http.ResponseWriter, chunkID string, err error) {
+	if strings.Contains(err.Error(), "insufficient storage") {
+		http.Error(w, ErrInsufficientStorage, http.StatusInsufficientStorage)
+	} else if isReadOnlyError(err) {
+		http.Error(w, "Filesystem is read-only", http.StatusServiceUnavailable)
+	} else if errors.Is(err, errChunkTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	} else {
+		log.Printf("Storage error for chunk %s: %v", chunkID, err)
+		http.Error(w, "Internal storage error", http.StatusInternalServerError)
+	}
+}
+
 func (sn *StorageNode) storeChunk(chunkID string, data []byte, checksum string) error {
+	return sn.storePending(&pendingWrite{chunkID: chunkID, data: data, checksum: checksum})
+}
+
+// storePending appends a chunk to the active superblock and indexes it
+func (sn *StorageNode) storePending(pw *pendingWrite) error {
+	data := pw.data
+
+	if sn.isReadOnly() {
+		return errReadOnly
+	}
+
+	// Compress before queueing, outside any lock
+	if sn.chunkCompression != ChunkCompressionNone && pw.compression == "" {
+		stored, err := compressChunk(sn.chunkCompression, data)
+		if err != nil {
+			log.Printf("Warning: failed to %s-compress chunk %s, storing it uncompressed: %v", sn.chunkCompression, pw.chunkID, err)
+		} else if stored != nil {
+			pw.compression, pw.stored = sn.chunkCompression, stored
+		}
+	}
+	if sn.chunkCipher != nil && !pw.encrypted {
+		stored, err := encryptChunk(sn.chunkCipher, pw.payload())
+		if err != nil {
+			return fmt.Errorf("failed to encrypt chunk: %w", err)
+		}
+		pw.encrypted, pw.stored = true, stored
+	}
+
+	// Tiny chunks share a single write + fsync with concurrent small writes
+	if sn.smallChunkBatching && len(data) <= SmallChunkThreshold {
+		return sn.storeSmallChunk(pw)
+	}
+
+	return sn.appendChunks([]*pendingWrite{pw})
+}
+
+// appendChunks appends one or more chunks to the active superblock, rotating
+// as needed. Chunks destined for the same superblock are written with a single
+// write and fsync, and the index is persisted once for the whole batch.
+func (sn *StorageNode) appendChunks(batch []*pendingWrite) error {
 	sn.mu.Lock()
 	defer sn.mu.Unlock()
 
-	// Check available disk space
+	// A chunk larger than a whole superblock would never fit
+	for _, pw := range batch {
+		if SuperblockHeaderSize+frameSize(pw.chunkID)+int64(len(pw.payload())) > sn.maxSuperblockSize {
+			return fmt.Errorf("%w: %d bytes, superblock size is %d bytes", errChunkTooLarge, len(pw.payload()), sn.maxSuperblockSize)
+		}
+	}
+
+	if err := sn.checkCapacity(); err != nil {
+		return err
+	}
+
+	// Content already stored under another ID isn't written again
+	if batch = sn.storeDuplicates(batch); len(batch) == 0 {
+		return nil
+	}
+
+	// New chunks land on the fast tier when there is one
+	current, fastTier := &sn.currentSuperblock, sn.fastTierDir != ""
+	if fastTier {
+		current = &sn.currentFastSuperblock
+	}
+
+	entries := make([]ChunkEntry, 0, len(batch))
+	for i := 0; i < len(batch); {
+		// Check if current superblock has space
+		currentSize, err := sn.getSuperblockSize(*current)
+		if err != nil {
+			return fmt.Errorf("failed to get superblock size: %w", err)
+		}
+		if currentSize == 0 {
+			currentSize = SuperblockHeaderSize // Written with the first chunk
+		}
+
+		// Take as many pending chunks as fit in the current superblock
+		j, size := i, currentSize
+		for j < len(batch) && size+frameSize(batch[j].chunkID)+int64(len(batch[j].payload())) <= sn.maxSuperblockSize {
+			size += frameSize(batch[j].chunkID) + int64(len(batch[j].payload()))
+			j++
+		}
+
+		// Rotate to new superblock if current one would exceed limit
+		if j == i {
+			sn.rotateSuperblock(current, currentSize, RotationFull)
+			continue
+		}
+
+		written, err := sn.writeToSuperblock(*current, batch[i:j])
+		if err != nil && fastTier {
+			// A full or failed fast tier shouldn't fail writes the primary tier can take
+			log.Printf("Warning: fast tier write failed, falling back to the primary tier: %v", err)
+			current, fastTier = &sn.currentSuperblock, false
+			continue
+		}
+		if err != nil {
+			sn.noteWriteError(err)
+			// Chunks already appended to an earlier superblock are never
+			// indexed, so their bytes are dead
+			for _, entry := range entries {
+				sn.markDead(entry.SuperblockID, int64(entry.Size))
+			}
+			return err
+		}
+		entries = append(entries, written...)
+		i = j
+	}
+
+	sn.commitEntries(entries, batch)
+	return nil
+}
+
+// checkCapacity rejects writes when the disk or its inodes are nearly full
+func (sn *StorageNode) checkCapacity() error {
 	diskUsage := sn.getDiskUsage()
 	if diskUsage > DiskUsageCriticalThreshold {
 		return fmt.Errorf("insufficient storage space: disk usage %.2f%%", diskUsage)
 	}
+	if err := sn.checkFreeInodes(); err != nil {
+		return err
+	}
+	return sn.checkIndexCapacity()
+}
+
+// commitEntries indexes newly written chunks and persists the index.
+// Caller must hold sn.mu.
+func (sn *StorageNode) commitEntries(entries []ChunkEntry, batch []*pendingWrite) {
+	// Update in-memory index; events are recorded under the index lock so
+	// they are ordered consistently with concurrent deletes
+	sn.index.mu.Lock()
+	events := make([]MutationEvent, 0, len(entries))
+	for _, entry := range entries {
+		sn.index.set(entry)
+		events = append(events, MutationEvent{Op: EventStore, ChunkID: entry.ChunkID, Checksum: entry.Checksum, Size: entry.logicalSize(), Timestamp: entry.StoredAt})
+	}
+	sn.recordEvents(events...)
+	sn.index.mu.Unlock()
+	sn.flushEvents()
 
-	// Check if current superblock has space
-	currentSize, err := sn.getCurrentSuperblockSize()
-	if err != nil {
-		return fmt.Errorf("failed to get superblock size: %w", err)
+	// Persist index for crash recovery (best effort), debounced so a burst
+	// of writes shares one index write
+	if err := sn.deferIndexSave(sn.indexSaveDelay); err != nil {
+		log.Printf("Warning: failed to persist index after storing %d chunk(s) (first: %s): %v", len(batch), batch[0].chunkID, err)
 	}
 
-	// Rotate to new superblock if current one would exceed limit
-	if currentSize+int64(len(data)) > sn.maxSuperblockSize {
-		sn.currentSuperblock++
-		log.Printf("Rotating to new superblock %d (current size: %d bytes)", sn.currentSuperblock, currentSize)
+	if sn.postWriteVerify != nil {
+		sn.postWriteVerify.enqueue(entries, batch)
 	}
+}
 
-	// Open/create superblock file
-	superblockPath := sn.getSuperblockPath(sn.currentSuperblock)
-	file, err := os.OpenFile(superblockPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+// writeToSuperblock appends chunks to a superblock in one write.
+// Caller must hold sn.mu and ensure they fit.
+func (sn *StorageNode) writeToSuperblock(id int, chunks []*pendingWrite) ([]ChunkEntry, error) {
+	superblockPath := sn.getSuperblockPath(id)
+	file, offset, hdr, err := sn.openSuperblockForAppend(id)
 	if err != nil {
-		return fmt.Errorf("failed to open superblock file %s: %w", superblockPath, err)
+		return nil, err
 	}
 	defer file.Close()
-
-	// Get current offset for direct I/O positioning
-	offset, err := file.Seek(0, io.SeekEnd)
-	if err != nil {
-		return fmt.Errorf("failed to seek to end of superblock: %w", err)
+	defer sn.invalidateSuperblockChecksum(id)
+
+	// Chunks in current-format superblocks are framed; legacy ones stay
+	// unframed so they can still be parsed as before
+	now := time.Now()
+	entries := make([]ChunkEntry, 0, len(chunks))
+	total := 0
+	for _, c := range chunks {
+		total += len(c.payload())
+		if hdr != nil {
+			total += int(frameSize(c.chunkID))
+		}
+	}
+	buf := make([]byte, 0, total)
+	pos := offset
+	for _, c := range chunks {
+		algo := c.checksumAlgo
+		if algo == "" {
+			algo = sn.checksumAlgo
+		}
+		payload := c.payload()
+		if hdr != nil {
+			frame, err := chunkFrame{ChunkID: c.chunkID, Size: int32(len(payload)), Checksum: c.checksum, ChecksumAlgo: algo, Compression: c.compression, Encrypted: c.encrypted, WrittenAt: now}.encode()
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, frame...)
+			pos += int64(len(frame))
+		}
+		buf = append(buf, payload...)
+		entry := ChunkEntry{
+			ChunkID:      c.chunkID,
+			SuperblockID: id,
+			Offset:       pos,
+			Size:         int32(len(payload)),
+			Checksum:     c.checksum,
+			ChecksumAlgo: algo,
+			StoredAt:     now,
+			StoredBy:     c.storedBy,
+			ExpiresAt:    c.expiresAt,
+			Meta:         c.meta,
+		}
+		if c.compression != "" || c.encrypted {
+			entry.Compression, entry.Encrypted, entry.RawSize = c.compression, c.encrypted, int32(len(c.data))
+		}
+		entries = append(entries, entry)
+		pos += int64(len(payload))
 	}
 
-	// Write chunk data atomically
-	n, err := file.Write(data)
+	// Write chunk data atomically, undoing a partial append
+	n, err := writeChunkData(file, buf)
+	if err == nil && n != len(buf) {
+		err = fmt.Errorf("incomplete write: expected %d bytes, wrote %d", len(buf), n)
+	} else if err != nil {
+		err = fmt.Errorf("failed to write chunk data: %w", err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to write chunk data: %w", err)
+		if n > 0 {
+			sn.undoAppend(id, file, offset, int64(n))
+		}
+		return nil, err
 	}
-
-	if n != len(data) {
-		return fmt.Errorf("incomplete write: expected %d bytes, wrote %d", len(data), n)
+	if err := recordAppend(file, hdr, len(chunks), offset+int64(n)); err != nil {
+		log.Printf("Warning: failed to update superblock %d header: %v", id, err)
 	}
 
-	// Ensure data is written to disk (fsync for durability)
-	if err := file.Sync(); err != nil {
-		log.Printf("Warning: failed to sync chunk %s to disk: %v", chunkID, err)
+	// Ensure data is written to disk (fsync for durability, per CHUNK_FSYNC_POLICY)
+	if sn.chunkFsync.due(superblockPath) {
+		if err := file.Sync(); err != nil {
+			log.Printf("Warning: failed to sync chunk %s to disk: %v", chunks[0].chunkID, err)
+		}
 	}
 
-	// Update in-memory index
-	entry := ChunkEntry{
-		ChunkID:      chunkID,
-		SuperblockID: sn.currentSuperblock,
-		Offset:       offset,
-		Size:         int32(n),
-		Checksum:     checksum,
-		StoredAt:     time.Now(),
+	return entries, nil
+}
+
+func (sn *StorageNode) readChunk(entry ChunkEntry) ([]byte, error) {
+	data, release, err := sn.readChunkView(entry)
+	return sn.ownChunkData(data, release), err
+}
+
+// noRelease is the release func of chunk data that doesn't borrow a mapping
+func noRelease() {}
+
+// ownChunkData returns data that stays valid after release, copying it out
+// of the superblock's mapping under READ_MODE=mmap, and calls release
+func (sn *StorageNode) ownChunkData(data []byte, release func()) []byte {
+	if sn.handles.mmap && data != nil {
+		data = bytes.Clone(data)
 	}
+	release()
+	return data
+}
 
-	sn.index.mu.Lock()
-	sn.index.chunks[chunkID] = entry
-	sn.index.mu.Unlock()
+// readChunkView reads a chunk's data. Under READ_MODE=mmap the data may be a
+// slice of the superblock's mapping rather than a copy: it must not be
+// modified and is only valid until release is called. release is never nil
+// and must be called exactly once, also on error. Chunks compressed or
+// encrypted at rest are decoded into a buffer of their own.
+func (sn *StorageNode) readChunkView(entry ChunkEntry) ([]byte, func(), error) {
+	stored, release, err := sn.readStoredView(entry)
+	if err != nil || !entry.encoded() {
+		return stored, release, err
+	}
+	defer release()
 
-	// Persist index for crash recovery (best effort)
-	if err := sn.saveIndex(); err != nil {
-		log.Printf("Warning: failed to persist index after storing chunk %s: %v", chunkID, err)
+	data, err := sn.decodeChunk(entry.Compression, entry.Encrypted, stored)
+	if err == nil && len(data) != int(entry.RawSize) {
+		err = fmt.Errorf("%w: decoded to %d bytes, expected %d", errChunkCorrupt, len(data), entry.RawSize)
+	}
+	if err != nil {
+		return nil, noRelease, err
 	}
+	return data, noRelease, nil
+}
 
-	return nil
+// readStoredChunk reads a chunk's bytes as stored, encoded or not
+func (sn *StorageNode) readStoredChunk(entry ChunkEntry) ([]byte, error) {
+	stored, release, err := sn.readStoredView(entry)
+	return sn.ownChunkData(stored, release), err
 }
 
-func (sn *StorageNode) readChunk(entry ChunkEntry) ([]byte, error) {
+// readStoredView reads a chunk's bytes as stored, encoded or not, with
+// the same release contract as readChunkView
+func (sn *StorageNode) readStoredView(entry ChunkEntry) ([]byte, func(), error) {
 	superblockPath := sn.getSuperblockPath(entry.SuperblockID)
 
-	file, err := os.Open(superblockPath)
+	handle, err := sn.handles.acquire(entry.SuperblockID, superblockPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open superblock: %w", err)
+		return nil, noRelease, fmt.Errorf("failed to open superblock: %w", err)
 	}
-	defer file.Close()
+	file := handle.file
 
-	// Seek to chunk offset
-	_, err = file.Seek(entry.Offset, io.SeekStart)
+	// Detect entries pointing past the end of the file (lost superblock tail)
+	info, err := file.Stat()
 	if err != nil {
-		return nil, fmt.Errorf("failed to seek to chunk offset: %w", err)
+		sn.handles.release(handle)
+		return nil, noRelease, fmt.Errorf("failed to stat superblock: %w", err)
+	}
+	end := entry.Offset + int64(entry.Size)
+	if end > info.Size() {
+		sn.handles.release(handle)
+		return nil, noRelease, fmt.Errorf("%w: chunk ends at %d, superblock %d is %d bytes",
+			errChunkTruncated, end, entry.SuperblockID, info.Size())
+	}
+
+	// The handle, and so the mapping, is held until the caller releases it
+	if end <= int64(len(handle.mapped)) {
+		atomic.AddInt64(&sn.handles.mappedReads, 1)
+		return handle.mapped[entry.Offset:end:end], func() { sn.handles.release(handle) }, nil
+	}
+	defer sn.handles.release(handle)
+	if handle.mapped != nil {
+		// Appended to since it was mapped; the next read maps it again
+		atomic.AddInt64(&sn.handles.mmapFallbacks, 1)
+		sn.handles.invalidate(entry.SuperblockID)
 	}
 
-	// Read chunk data
+	// ReadAt fills the buffer or fails, and keeps no file position, so one
+	// handle could safely be shared by concurrent readers
 	data := make([]byte, entry.Size)
-	n, err := file.Read(data)
+	if _, err := file.ReadAt(data, entry.Offset); err != nil {
+		return nil, noRelease, fmt.Errorf("failed to read chunk data: %w", err)
+	}
+
+	return data, noRelease, nil
+}
+
+// fetchChunk returns a chunk's data, preferring the read cache. Disk reads
+// are verified for a VERIFY_SAMPLE_RATE fraction of requests and only
+// verified data is cached.
+func (sn *StorageNode) fetchChunk(entry ChunkEntry) (ChunkEntry, []byte, error) {
+	entry, data, release, err := sn.fetchChunkView(entry)
+	return entry, sn.ownChunkData(data, release), err
+}
+
+// fetchChunkView is fetchChunk for callers that can release the data once
+// done with it (see readChunkView)
+func (sn *StorageNode) fetchChunkView(entry ChunkEntry) (ChunkEntry, []byte, func(), error) {
+	if data, ok := sn.readCache.Get(entry.ChunkID, entry.Checksum); ok {
+		return entry, data, noRelease, nil
+	}
+	verify := sn.sampleVerification() || sn.scrub.isCorrupt(entry.blob())
+	entry, data, release, err := sn.readChunkCheckedView(entry, verify)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read chunk data: %w", err)
+		return entry, nil, release, err
+	}
+	if verify && sn.readCache.enabled() {
+		cached := data
+		if sn.handles.mmap {
+			cached = bytes.Clone(data)
+		}
+		sn.readCache.Add(entry.ChunkID, entry.Checksum, cached)
 	}
+	return entry, data, release, nil
+}
 
-	if n != int(entry.Size) {
-		return nil, fmt.Errorf("incomplete read: expected %d bytes, got %d", entry.Size, n)
+// writeReadError maps a failed chunk read to its HTTP response
+func writeReadError(w http.ResponseWriter, chunkID string, err error) {
+	switch {
+	case errors.Is(err, errChunkGone):
+		http.Error(w, ErrChunkNotFound, http.StatusNotFound)
+	case errors.Is(err, errChunkTruncated):
+		log.Printf("Chunk %s is truncated on disk: %v", chunkID, err)
+		http.Error(w, "Chunk data truncated on disk", http.StatusGone)
+	case errors.Is(err, errChunkCorrupt):
+		http.Error(w, "Chunk corruption detected", http.StatusInternalServerError)
+	default:
+		log.Printf("Failed to read chunk %s: %v", chunkID, err)
+		http.Error(w, "Failed to read chunk", http.StatusInternalServerError)
 	}
+}
 
-	return data, nil
+// readVerifiedChunk reads and verifies a chunk's data
+func (sn *StorageNode) readVerifiedChunk(entry ChunkEntry) (ChunkEntry, []byte, error) {
+	return sn.readChunkChecked(entry, true)
 }
 
-func (sn *StorageNode) registerNode(ctx context.Context, metadataURL, nodeURL string) error {
-	// Prepare registration data
-	regData := map[string]string{
-		"node_url": nodeURL,
-		"node_id":  sn.nodeID,
-		"version":  "1.0.0",
+// readChunkChecked reads a chunk's data, verifying its checksum if verify is
+// set. Index lookups and disk reads are not atomic: between copying an entry
+// and reading it, a concurrent DELETE followed by relocation, drain or
+// compaction can move the bytes or remove the superblock entirely. Reads are
+// therefore re-validated against the index: if the chunk was deleted
+// errChunkGone is returned, if it moved the read is retried at its new
+// location. A verified read is trusted by its checksum; an unverified read is
+// only returned if the entry still points where the bytes were read from.
+func (sn *StorageNode) readChunkChecked(entry ChunkEntry, verify bool) (ChunkEntry, []byte, error) {
+	entry, data, release, err := sn.readChunkCheckedView(entry, verify)
+	return entry, sn.ownChunkData(data, release), err
+}
+
+// readChunkCheckedView is readChunkChecked for callers that can release the
+// data once done with it (see readChunkView)
+func (sn *StorageNode) readChunkCheckedView(entry ChunkEntry, verify bool) (ChunkEntry, []byte, func(), error) {
+	var lastErr error
+	for attempt := 0; attempt < MaxChunkReadAttempts; attempt++ {
+		data, release, err := sn.readChunkView(entry)
+		if err == nil && verify {
+			var computedChecksum string
+			computedChecksum, err = computeChecksum(entry.checksumAlgorithm(), data)
+			if err != nil {
+				release()
+				return entry, nil, noRelease, fmt.Errorf("cannot verify chunk: %w", err)
+			}
+			if computedChecksum == entry.Checksum {
+				atomic.AddInt64(&sn.verifiedReads, 1)
+				return entry, data, release, nil
+			}
+			err = fmt.Errorf("%w: expected %s, got %s", errChunkCorrupt, entry.Checksum, computedChecksum)
+		}
+		lastErr = err
+
+		sn.index.mu.RLock()
+		current, exists := sn.index.chunks[entry.ChunkID]
+		sn.index.mu.RUnlock()
+		if !exists {
+			release()
+			return entry, nil, noRelease, errChunkGone
+		}
+		if current.SuperblockID == entry.SuperblockID && current.Offset == entry.Offset && current.Checksum == entry.Checksum {
+			if err == nil {
+				return entry, data, release, nil // Unverified, but read from where the chunk still lives
+			}
+			release()
+			break // Nothing moved; the failure is real
+		}
+		release()
+		entry = current
 	}
-	body, err := json.Marshal(regData)
-	if err != nil {
-		return fmt.Errorf("failed to marshal registration data: %w", err)
+
+	if lastErr == nil {
+		return entry, nil, noRelease, fmt.Errorf("chunk %s moved %d times while being read", entry.ChunkID, MaxChunkReadAttempts)
 	}
+	if errors.Is(lastErr, errChunkCorrupt) {
+		atomic.AddInt64(&sn.verifyFailures, 1)
+		log.Printf("Checksum mismatch for chunk %s: %v", entry.ChunkID, lastErr)
+	}
+	return entry, nil, noRelease, lastErr
+}
 
+func (sn *StorageNode) registerNode(ctx context.Context, metadataURL, nodeURL string) error {
 	url := fmt.Sprintf("%s/nodes/register", metadataURL)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+
+	// Overlapping registration attempts to the same endpoint share one request
+	_, err := sn.flights.Do("register "+url, func() error {
+		// Prepare registration data
+		regData := RegistrationRequest{
+			NodeURL:      nodeURL,
+			NodeID:       sn.nodeID,
+			Version:      NodeVersion,
+			NodeTopology: sn.topology,
+		}
+		body, err := json.Marshal(regData)
+		if err != nil {
+			return fmt.Errorf("failed to marshal registration data: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("registration request failed: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("registration failed with status: %d", resp.StatusCode)
+		}
+
+		// Coordinators may hand out configuration; anything else in the body is ignored
+		var cfg RegistrationResponse
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&cfg); err != nil && err != io.EOF {
+			log.Printf("Warning: ignoring unparseable registration response: %v", err)
+		} else {
+			sn.applyRegistrationConfig(cfg)
+		}
+
+		// Registration counts as the first heartbeat
+		atomic.StoreInt32(&sn.registered, 1)
+		atomic.StoreInt64(&sn.lastHeartbeat, time.Now().UnixNano())
+		return nil
+	})
+	return err
+}
+
+// newRouter builds the HTTP router with middleware and all endpoints
+func (sn *StorageNode) newRouter() *mux.Router {
+	r := mux.NewRouter()
+
+	r.Use(sn.recoveryMiddleware)
+	r.Use(sn.clientIPMiddleware)
+	r.Use(requestLoggingMiddleware)
+	r.Use(sn.routeMetricsMiddleware)
+	r.Use(sn.rateLimitMiddleware)
+	r.Use(corsMiddleware)
+	r.Use(sn.rebuildGateMiddleware)
+	r.Use(sn.chunkTokenMiddleware)
+
+	// API Endpoints
+	r.HandleFunc("/chunk/{chunk_id}", sn.mutating(sn.limitWrites(sn.handlePutChunk))).Methods("PUT")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleHeadChunk).Methods("HEAD")
+	r.HandleFunc("/chunk/{chunk_id}", sn.mutating(sn.handleDeleteChunk)).Methods("DELETE")
+	r.HandleFunc("/chunk/{chunk_id}/exists", sn.handleChunkExists).Methods("GET")
+	r.HandleFunc("/chunk/{chunk_id}/metadata", sn.handleChunkMetadata).Methods("GET")
+	r.HandleFunc("/chunk/{chunk_id}/meta", sn.mutating(sn.handlePatchChunkMeta)).Methods("PATCH")
+	r.HandleFunc("/chunk/{chunk_id}/location", sn.adminOnly(sn.handleChunkLocation)).Methods("GET")
+	r.HandleFunc("/by-checksum/{checksum}", sn.multiChunk(sn.handleGetByChecksum)).Methods("GET")
+	r.HandleFunc("/chunks/batch", sn.multiChunk(sn.mutating(sn.limitWrites(sn.handleBatchPut)))).Methods("POST")
+	r.HandleFunc("/chunks/batch/get", sn.multiChunk(sn.handleBatchGet)).Methods("POST")
+	r.HandleFunc("/chunks/batch/delete", sn.multiChunk(sn.mutating(sn.handleBatchDelete))).Methods("POST")
+	r.HandleFunc("/chunks", sn.multiChunk(sn.handleListChunks)).Methods("GET")
+	r.HandleFunc("/chunks/search", sn.multiChunk(sn.handleSearchChunks)).Methods("GET")
+	r.HandleFunc("/ping", sn.handlePing).Methods("HEAD", "GET")
+	r.HandleFunc("/health", sn.handleHealth).Methods("GET")
+	r.HandleFunc("/readyz", sn.handleReadiness).Methods("GET")
+	r.HandleFunc("/stats", sn.handleStats).Methods("GET")
+	r.HandleFunc("/version", sn.handleVersion).Methods("GET")
+	r.HandleFunc("/metrics", sn.handleMetrics).Methods("GET")
+	r.HandleFunc("/events", sn.multiChunk(sn.handleEvents)).Methods("GET")
+	r.HandleFunc("/scrub", sn.adminOnly(sn.writable(sn.handleScrub))).Methods("POST")
+	r.HandleFunc("/scrub", sn.handleScrubStatus).Methods("GET")
+
+	// Admin Endpoints, all behind ADMIN_TOKEN
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(sn.adminMiddleware)
+	admin.HandleFunc("/cache/flush", sn.handleCacheFlush).Methods("POST")
+	admin.HandleFunc("/cache/stats", sn.handleCacheStats).Methods("GET")
+	admin.HandleFunc("/counters", sn.handleCounters).Methods("GET")
+	admin.HandleFunc("/counters/reset", sn.handleResetCounters).Methods("POST")
+	admin.HandleFunc("/chunk/{chunk_id}/relocate", sn.mutating(sn.handleRelocateChunk)).Methods("POST")
+	admin.HandleFunc("/superblocks/{id}/drain", sn.mutating(sn.handleDrainSuperblock)).Methods("POST")
+	admin.HandleFunc("/superblocks/{id}/drain", sn.handleDrainStatus).Methods("GET")
+	admin.HandleFunc("/superblocks/{id}/compact", sn.mutating(sn.handleCompactSuperblock)).Methods("POST")
+	admin.HandleFunc("/superblocks/checksums", sn.handleSuperblockChecksums).Methods("GET")
+	admin.HandleFunc("/manifest", sn.handleManifest).Methods("GET")
+	admin.HandleFunc("/recheck", sn.writable(sn.handleRecheck)).Methods("POST")
+	admin.HandleFunc("/flush", sn.writable(sn.handleFlush)).Methods("POST")
+
+	return r
+}
+
+// listenAddress combines LISTEN_ADDR (default: all interfaces) with the port
+func listenAddress(port int) (string, error) {
+	host := strings.TrimSuffix(strings.TrimPrefix(os.Getenv("LISTEN_ADDR"), "["), "]")
+	if host != "" && net.ParseIP(host) == nil {
+		return "", fmt.Errorf("'%s' is not an IP address", host)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("registration request failed: %w", err)
+// newHTTPServer builds the HTTP server, applying SERVER_MAX_HEADER_BYTES and
+// SERVER_DISABLE_KEEPALIVE from the environment
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	maxHeaderBytes := DefaultServerMaxHeaderBytes
+	if envMax := os.Getenv("SERVER_MAX_HEADER_BYTES"); envMax != "" {
+		if n, err := strconv.Atoi(envMax); err == nil && n >= MinServerMaxHeaderBytes {
+			maxHeaderBytes = n
+			log.Printf("Using max header size: %d bytes", n)
+		} else {
+			log.Printf("Warning: invalid SERVER_MAX_HEADER_BYTES '%s' (minimum %d), using %d",
+				envMax, MinServerMaxHeaderBytes, maxHeaderBytes)
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("registration failed with status: %d", resp.StatusCode)
+	srv := &http.Server{
+		Addr:           addr,
+		Handler:        handler,
+		ReadTimeout:    ServerReadTimeout,
+		WriteTimeout:   ServerWriteTimeout,
+		IdleTimeout:    ServerIdleTimeout,
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+
+	if envKeepAlive := os.Getenv("SERVER_DISABLE_KEEPALIVE"); envKeepAlive != "" {
+		disable, err := strconv.ParseBool(envKeepAlive)
+		if err != nil {
+			log.Printf("Warning: invalid SERVER_DISABLE_KEEPALIVE '%s', keep-alives enabled", envKeepAlive)
+		} else if disable {
+			srv.SetKeepAlivesEnabled(false)
+			log.Printf("HTTP keep-alives disabled")
+		}
 	}
 
-	return nil
+	return srv
 }
 
 func main() {
+	fsckMode := flag.Bool("fsck", false, "check and repair the data directory, then exit without serving")
+	flag.Parse()
+
 	// Parse command line arguments or environment variables
 	portStr := os.Getenv("PORT")
 	if portStr == "" {
@@ -707,120 +2724,101 @@ func main() {
 	// Create storage node
 	sn := NewStorageNode(dataDir, nodeID)
 
+	// Offline maintenance: report and repair, never serve
+	if *fsckMode || os.Getenv("MODE") == "fsck" {
+		os.Exit(sn.runFsck())
+	}
+
+	addr, err := listenAddress(port)
+	if err != nil {
+		log.Fatalf("Invalid LISTEN_ADDR: %v", err)
+	}
+	socketPath, socketMode, socketOnly, err := unixSocketConfig()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// Catch listener conflicts before a potentially long index load
+	var listeners []listenerConfig
+	if !socketOnly {
+		listeners = append(listeners, listenerConfig{name: "PORT", network: "tcp", address: addr})
+	}
+	if socketPath != "" {
+		listeners = append(listeners, listenerConfig{name: "UNIX_SOCKET", network: "unix", address: socketPath})
+	}
+	if err := validateListeners(listeners); err != nil {
+		log.Fatalf("Invalid listener configuration: %v", err)
+	}
+
 	if err := sn.Initialize(); err != nil {
 		log.Fatalf("Failed to initialize storage node: %v", err)
 	}
 
-	// Setup router
-	r := mux.NewRouter()
+	r := sn.newRouter()
+	srv := newHTTPServer(addr, r)
 
-	// Panic recovery middleware
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			defer func() {
-				if err := recover(); err != nil {
-					log.Printf("PANIC: %v\n%s", err, debug.Stack())
-					http.Error(w, "Internal server error", http.StatusInternalServerError)
-				}
-			}()
-			next.ServeHTTP(w, r)
-		})
-	})
+	// Create context for graceful shutdown
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-	// Request logging middleware
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-			requestID := fmt.Sprintf("%d", time.Now().UnixNano())
-			w.Header().Set("X-Request-ID", requestID)
-			next.ServeHTTP(w, r)
-			duration := time.Since(start)
-			log.Printf("Request: %s %s - Duration: %v - Request-ID: %s",
-				r.Method, r.URL.Path, duration, requestID)
-		})
-	})
+	metadataURL := os.Getenv("METADATA_SERVICE_URL")
+	nodeURL := os.Getenv("NODE_URL")
+	if metadataURL != "" && nodeURL != "" {
+		sn.metadataURL = metadataURL
+		sn.nodeURL = nodeURL
+	}
 
-	// CORS middleware
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			allowedOrigin := os.Getenv("ALLOWED_ORIGIN")
-			if allowedOrigin == "" {
-				allowedOrigin = "*" // Default for development
+	// Run server in goroutine, signaling once the listener is open so
+	// registration doesn't have to guess when the node is reachable
+	listening := make(chan struct{})
+	if socketPath != "" {
+		ln, err := listenUnix(socketPath, socketMode)
+		if err != nil {
+			log.Fatalf("Failed to listen on Unix socket %s: %v", socketPath, err)
+		}
+		defer os.Remove(socketPath)
+		ln = sn.limitListener(ln)
+		log.Printf("Storage Node %s listening on unix:%s (mode %04o)", nodeID, socketPath, socketMode)
+		go func() {
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Server failed: %v", err)
 			}
-			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, DELETE, HEAD, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Chunk-Checksum")
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
+		}()
+		if socketOnly {
+			close(listening)
+		}
+	}
+	if !socketOnly {
+		go func() {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				log.Fatalf("Server failed: %v", err)
 			}
-			next.ServeHTTP(w, r)
-		})
-	})
-
-	// API Endpoints
-	r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
-	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
-	r.HandleFunc("/chunk/{chunk_id}", sn.handleHeadChunk).Methods("HEAD")
-	r.HandleFunc("/chunk/{chunk_id}", sn.handleDeleteChunk).Methods("DELETE")
-	r.HandleFunc("/ping", sn.handlePing).Methods("HEAD", "GET")
-	r.HandleFunc("/health", sn.handleHealth).Methods("GET")
-
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
-		Handler:      r,
-		ReadTimeout:  ServerReadTimeout,
-		WriteTimeout: ServerWriteTimeout,
-		IdleTimeout:  ServerIdleTimeout,
+			log.Printf("Storage Node %s listening on %s", nodeID, addr)
+			close(listening)
+			if err := srv.Serve(sn.limitListener(ln)); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Server failed: %v", err)
+			}
+		}()
 	}
 
-	// Create context for graceful shutdown
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
-
 	// Register with metadata service in background
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
-		// Wait for service to start
-		time.Sleep(2 * time.Second)
-
-		metadataURL := os.Getenv("METADATA_SERVICE_URL")
-		nodeURL := os.Getenv("NODE_URL")
-
-		if metadataURL == "" || nodeURL == "" {
-			log.Printf("Warning: METADATA_SERVICE_URL or NODE_URL not set, skipping registration")
+		if sn.readOnlyMode {
+			log.Printf("Read-only mode, skipping registration")
 			return
 		}
-
-		// Create context with timeout for registration
-		regCtx, regCancel := context.WithTimeout(ctx, RegistrationTimeout)
-		defer regCancel()
-
-		for i := 0; i < MaxRegistrationRetries; i++ {
-			if err := sn.registerNode(regCtx, metadataURL, nodeURL); err != nil {
-				log.Printf("Failed to register (attempt %d/%d): %v", i+1, MaxRegistrationRetries, err)
-				select {
-				case <-regCtx.Done():
-					log.Println("Registration timeout, continuing without registration")
-					return
-				case <-time.After(RetryInterval):
-					continue
-				}
-			} else {
-				log.Printf("Successfully registered node %s with metadata service at %s", nodeID, metadataURL)
-				break
-			}
+		if sn.metadataURL == "" {
+			log.Printf("Warning: METADATA_SERVICE_URL or NODE_URL not set, skipping registration")
+			return
 		}
-	}()
-
-	// Run server in goroutine
-	go func() {
-		log.Printf("Storage Node %s listening on port %d", nodeID, port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed: %v", err)
+		if sn.registerWhenReady(ctx, listening, metadataURL, nodeURL) {
+			sn.startHeartbeats(metadataURL)
+			sn.startHealthWatch()
 		}
 	}()
 
@@ -958,4 +958,47 @@ func TestPerformanceRequirements(t *testing.T) {
 			t.Errorf("Failed %d out of %d concurrent requests", errorCount, numConcurrentRequests)
 		}
 	})
-}
\ No newline at end of file
+}
+
+// TestChunkExistsEndpoint tests the lightweight existence check
+func TestChunkExistsEndpoint(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}/exists", sn.handleChunkExists).Methods("GET")
+
+	data := []byte("exists test data")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+	if err := sn.storeChunk("exists-test", data, checksum); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+
+	testCases := []struct {
+		chunkID string
+		exists  bool
+	}{
+		{"exists-test", true},
+		{"missing-chunk", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.chunkID, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/chunk/"+tc.chunkID+"/exists", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			var resp ExistsResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode exists response: %v", err)
+			}
+			if resp.Exists != tc.exists {
+				t.Errorf("Expected exists=%v for %s, got %v", tc.exists, tc.chunkID, resp.Exists)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMaxMaintenanceTasks bounds heavy background operations running at
+// once (see MAX_MAINTENANCE_TASKS)
+const DefaultMaxMaintenanceTasks = 1
+
+// Maintenance task names, as reported in /stats
+const (
+	MaintenanceCompact  = "compact"
+	MaintenanceScrub    = "scrub"
+	MaintenanceFastTier = "fast-tier-migrate"
+	MaintenanceDrain    = "drain"
+)
+
+// maintenanceGate bounds how many disk-heavy maintenance operations
+// (compaction, scrubbing, tier migration, draining) run at once. Each is
+// rate limited on its own, but together they can still saturate the disk,
+// so operations beyond the limit queue until a running one finishes.
+type maintenanceGate struct {
+	slots chan struct{} // nil = unlimited
+
+	mu      sync.Mutex
+	running map[string]int // task name -> operations holding a slot
+	waiting map[string]int // task name -> operations queued for a slot
+}
+
+// MaintenanceStats describes the maintenance operations holding or waiting
+// for the gate
+type MaintenanceStats struct {
+	MaxTasks int      `json:"max_tasks"` // 0 = unlimited
+	Running  []string `json:"running"`
+	Waiting  []string `json:"waiting"`
+}
+
+func newMaintenanceGate(limit int) *maintenanceGate {
+	g := &maintenanceGate{
+		running: make(map[string]int),
+		waiting: make(map[string]int),
+	}
+	if limit > 0 {
+		g.slots = make(chan struct{}, limit)
+	}
+	return g
+}
+
+// acquire waits for a slot for the named task, returning the function that
+// gives it back. It fails only if ctx is done first.
+func (g *maintenanceGate) acquire(ctx context.Context, name string) (func(), error) {
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		default:
+			g.mu.Lock()
+			g.waiting[name]++
+			g.mu.Unlock()
+			log.Printf("Maintenance task %s waiting for one of %d slot(s)", name, cap(g.slots))
+
+			start := time.Now()
+			var err error
+			select {
+			case g.slots <- struct{}{}:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+
+			g.mu.Lock()
+			decrementCount(g.waiting, name)
+			g.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Maintenance task %s started after waiting %v", name, time.Since(start).Round(time.Millisecond))
+		}
+	}
+
+	return g.admitted(name), nil
+}
+
+// admitted records the named task as holding a slot, returning the function
+// that gives it back
+func (g *maintenanceGate) admitted(name string) func() {
+	g.mu.Lock()
+	g.running[name]++
+	g.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			g.mu.Lock()
+			decrementCount(g.running, name)
+			g.mu.Unlock()
+			if g.slots != nil {
+				<-g.slots
+			}
+		})
+	}
+}
+
+// tryAcquire takes a slot for the named task only if one is free, returning
+// the function that gives it back, or nil if the gate is full
+func (g *maintenanceGate) tryAcquire(name string) func() {
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		default:
+			return nil
+		}
+	}
+	return g.admitted(name)
+}
+
+func decrementCount(counts map[string]int, name string) {
+	if counts[name]--; counts[name] <= 0 {
+		delete(counts, name)
+	}
+}
+
+// stats lists running and queued tasks by name, once per operation
+func (g *maintenanceGate) stats() MaintenanceStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return MaintenanceStats{
+		MaxTasks: cap(g.slots),
+		Running:  expandCounts(g.running),
+		Waiting:  expandCounts(g.waiting),
+	}
+}
+
+func expandCounts(counts map[string]int) []string {
+	names := []string{}
+	for name, n := range counts {
+		for i := 0; i < n; i++ {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceGateQueuesTasks(t *testing.T) {
+	t.Setenv("SCRUB_RATE_MB", "0")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	defer sn.Shutdown()
+
+	for i := 0; i < 3; i++ {
+		if err := sn.storeChunk(fmt.Sprintf("gated-%d", i), []byte(fmt.Sprintf("gated chunk %d", i)), ""); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	}
+
+	stats := func() MaintenanceStats {
+		rr := httptest.NewRecorder()
+		sn.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/stats", nil))
+		var resp StatsResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode stats: %v", err)
+		}
+		return resp.Maintenance
+	}
+
+	release, err := sn.maintenance.acquire(context.Background(), MaintenanceCompact)
+	if err != nil {
+		t.Fatalf("Failed to acquire the maintenance gate: %v", err)
+	}
+	sn.startScrub()
+
+	// The scrub queues behind the compaction holding the only slot
+	deadline := time.Now().Add(5 * time.Second)
+	for len(stats().Waiting) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Scrub never queued for the maintenance gate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := stats()
+	want := MaintenanceStats{MaxTasks: DefaultMaxMaintenanceTasks, Running: []string{MaintenanceCompact}, Waiting: []string{MaintenanceScrub}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected /stats maintenance %+v, got %+v", want, got)
+	}
+	if scanned := sn.scrub.current().ChunksScanned; scanned != 0 {
+		t.Errorf("Expected the queued scrub not to scan yet, scanned %d chunks", scanned)
+	}
+
+	release()
+	for sn.scrub.current().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("Scrub did not run after the gate was released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if scanned := sn.scrub.current().ChunksScanned; scanned != 3 {
+		t.Errorf("Expected the scrub to scan 3 chunks once admitted, scanned %d", scanned)
+	}
+	if got := stats(); len(got.Running) != 0 || len(got.Waiting) != 0 {
+		t.Errorf("Expected no maintenance running or queued, got %+v", got)
+	}
+
+	// A waiter whose context ends gives up without taking a slot
+	release, _ = sn.maintenance.acquire(context.Background(), MaintenanceCompact)
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := sn.maintenance.acquire(ctx, MaintenanceDrain); err == nil {
+		t.Error("Expected a canceled wait for the maintenance gate to fail")
+	}
+}
+
+func TestScrubYieldsGateBetweenBatches(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	defer sn.Shutdown()
+
+	for i := 0; i < 5; i++ {
+		if err := sn.storeChunk(fmt.Sprintf("batched-%d", i), bytes.Repeat([]byte{byte(i)}, 100), ""); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	}
+	defer func(n int64) { scrubBatchBytes = n }(scrubBatchBytes)
+	scrubBatchBytes = 1 // one chunk per turn at the gate
+	sn.scrubRate = 1000 // 100 byte chunks, a tenth of a second each
+	sn.startScrub()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sn.scrub.current().ChunksScanned == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Scrub never started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	release, err := sn.maintenance.acquire(ctx, MaintenanceCompact)
+	if err != nil {
+		t.Fatalf("Expected compaction to get the gate between scrub batches: %v", err)
+	}
+	if !sn.scrub.current().Running {
+		t.Error("Expected the scrub pass to still be running")
+	}
+
+	// Compacting by request doesn't queue behind the gate
+	sn.adminToken = "secret"
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, adminRequest("POST", "/admin/superblocks/0/compact", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 compacting while the gate is full, got %d", rr.Code)
+	}
+	release()
+
+	for sn.scrub.current().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("Scrub did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if scanned := sn.scrub.current().ChunksScanned; scanned != 5 {
+		t.Errorf("Expected the scrub to scan all 5 chunks, scanned %d", scanned)
+	}
+}
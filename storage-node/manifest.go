@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// manifestLine is one chunk's entry in a manifest
+type manifestLine struct {
+	chunkID, checksum string
+}
+
+// parseStoredAfter accepts an RFC 3339 timestamp or Unix seconds
+func parseStoredAfter(param string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(param, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339Nano, param)
+}
+
+// manifest returns the ID and checksum of every live chunk stored after
+// cutoff (all chunks for a zero cutoff), sorted by chunk ID
+func (sn *StorageNode) manifest(cutoff time.Time) []manifestLine {
+	now := time.Now()
+	entries := sn.listingEntries()
+	lines := make([]manifestLine, 0, len(entries))
+	for _, entry := range entries {
+		if entry.expired(now) || (!cutoff.IsZero() && !entry.StoredAt.After(cutoff)) {
+			continue
+		}
+		lines = append(lines, manifestLine{chunkID: entry.ChunkID, checksum: entry.Checksum})
+	}
+	return lines
+}
+
+// handleManifest streams "<chunk_id> <checksum>" lines sorted by chunk ID, so
+// manifests from replicas can be compared with diff or comm. stored_after
+// limits it to chunks stored since a previous manifest. Under
+// INDEX_SNAPSHOT_MAX_STALENESS the manifest may lag the index by that long.
+func (sn *StorageNode) handleManifest(w http.ResponseWriter, r *http.Request) {
+	var cutoff time.Time
+	if param := r.URL.Query().Get("stored_after"); param != "" {
+		var err error
+		if cutoff, err = parseStoredAfter(param); err != nil {
+			http.Error(w, "Invalid stored_after parameter: want RFC 3339 or Unix seconds", http.StatusBadRequest)
+			return
+		}
+	}
+
+	lines := sn.manifest(cutoff)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Chunk-Count", strconv.Itoa(len(lines)))
+	bw := bufio.NewWriter(w)
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(bw, "%s %s\n", line.chunkID, line.checksum); err != nil {
+			log.Printf("Failed to write manifest: %v", err)
+			return
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		log.Printf("Failed to write manifest: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getManifest(t *testing.T, sn *StorageNode, query string) []string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, adminRequest("GET", "/admin/manifest"+query, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	return strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+}
+
+func TestManifestListsChunksSorted(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.adminToken = "secret"
+
+	checksums := map[string]string{}
+	for _, chunkID := range []string{"manifest-c", "manifest-a", "manifest-b"} {
+		data := []byte("data for " + chunkID)
+		checksums[chunkID] = fmt.Sprintf("%x", sha256.Sum256(data))
+		if err := sn.storeChunk(chunkID, data, checksums[chunkID]); err != nil {
+			t.Fatalf("Failed to store %s: %v", chunkID, err)
+		}
+	}
+
+	lines := getManifest(t, sn, "")
+	want := []string{
+		"manifest-a " + checksums["manifest-a"],
+		"manifest-b " + checksums["manifest-b"],
+		"manifest-c " + checksums["manifest-c"],
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected manifest:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(lines, "\n"))
+	}
+}
+
+func TestManifestStoredAfter(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.adminToken = "secret"
+
+	sn.index.mu.Lock()
+	sn.index.set(ChunkEntry{ChunkID: "old", Checksum: "aa", StoredAt: time.Now().Add(-2 * time.Hour)})
+	sn.index.set(ChunkEntry{ChunkID: "new", Checksum: "bb", StoredAt: time.Now()})
+	sn.index.mu.Unlock()
+
+	cutoff := time.Now().Add(-time.Hour)
+	for _, param := range []string{cutoff.Format(time.RFC3339), strconv.FormatInt(cutoff.Unix(), 10)} {
+		if lines := getManifest(t, sn, "?stored_after="+param); len(lines) != 1 || lines[0] != "new bb" {
+			t.Errorf("stored_after=%s: expected only the new chunk, got %q", param, lines)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, adminRequest("GET", "/admin/manifest?stored_after=yesterday", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid stored_after, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestStoredByAttribution(t *testing.T) {
+	t.Setenv("INDEX_SAVE_DELAY", "0") // one index save per write
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
+	r.HandleFunc("/chunk/{chunk_id}/metadata", sn.handleChunkMetadata).Methods("GET")
+
+	put := func(chunkID, storedBy string) int {
+		req := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader([]byte("attributed chunk "+chunkID)))
+		if storedBy != "" {
+			req.Header.Set("X-Stored-By", storedBy)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	metadata := func(chunkID string) ChunkEntry {
+		req := httptest.NewRequest("GET", "/chunk/"+chunkID+"/metadata", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var entry ChunkEntry
+		if err := json.NewDecoder(w.Body).Decode(&entry); err != nil {
+			t.Fatalf("Failed to decode metadata: %v", err)
+		}
+		return entry
+	}
+
+	if code := put("by-ingest", "ingest-service/2.1"); code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, code)
+	}
+	if got := metadata("by-ingest").StoredBy; got != "ingest-service/2.1" {
+		t.Errorf("Expected stored_by ingest-service/2.1, got %q", got)
+	}
+
+	if code := put("by-nobody", ""); code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, code)
+	}
+	if got := metadata("by-nobody").StoredBy; got != "" {
+		t.Errorf("Expected empty stored_by, got %q", got)
+	}
+
+	if code := put("by-verbose", strings.Repeat("x", MaxStoredByLength+1)); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for oversized X-Stored-By, got %d", http.StatusBadRequest, code)
+	}
+
+	// Attribution is persisted with the index
+	restarted := NewStorageNode(tempDir, "test-node")
+	if err := restarted.loadIndex(); err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	if got := restarted.index.chunks["by-ingest"].StoredBy; got != "ingest-service/2.1" {
+		t.Errorf("Expected stored_by to survive restart, got %q", got)
+	}
+}
+
+func TestChunkMetadataNotFound(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}/metadata", sn.handleChunkMetadata).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/chunk/absent/metadata", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestChunkMetadataMatchesIndex(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	data := []byte("chunk described by its metadata")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/described", bytes.NewReader(data)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/described/metadata", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected a JSON 200, got %d (%s)", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var got ChunkEntry
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode metadata: %v", err)
+	}
+	want, _ := sn.lookupChunk("described")
+	if got.ChunkID != want.ChunkID || got.SuperblockID != want.SuperblockID || got.Offset != want.Offset ||
+		got.Size != int32(len(data)) || got.Checksum != want.Checksum || !got.StoredAt.Equal(want.StoredAt) {
+		t.Errorf("Expected metadata %+v, got %+v", want, got)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/bad.id/metadata", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid chunk ID, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
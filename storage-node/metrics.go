@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// writeMetric writes one metric in the Prometheus text exposition format
+func writeMetric(w io.Writer, name, metricType, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+	fmt.Fprintf(w, "%s %v\n", name, value)
+}
+
+// writeLabeledMetric writes a metric family with one sample per label value
+func writeLabeledMetric(w io.Writer, name, metricType, help, label string, values map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, k, values[k])
+	}
+}
+
+func (sn *StorageNode) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	sn.index.mu.RLock()
+	storedBytes := sn.index.bytes
+	sn.index.mu.RUnlock()
+	writeMetric(w, "vstack_stored_bytes", "gauge",
+		"Total size of indexed chunks",
+		storedBytes)
+	writeMetric(w, "vstack_disk_usage_percent", "gauge",
+		"Used space on the data volume",
+		sn.getDiskUsage())
+	writeMetric(w, "vstack_uptime_seconds", "gauge",
+		"Seconds since the node started",
+		time.Since(sn.startTime).Seconds())
+	writeMetric(w, "vstack_index_save_failures_total", "counter",
+		"Failed index saves",
+		atomic.LoadInt64(&sn.failedIndexSaves))
+	writeLabeledMetric(w, "vstack_chunk_operations_total", "counter",
+		"Chunks stored, served and deleted through the API", "op", map[string]int64{
+			"put":    atomic.LoadInt64(&sn.chunkPuts),
+			"get":    atomic.LoadInt64(&sn.chunkGets),
+			"delete": atomic.LoadInt64(&sn.chunkDeletes),
+		})
+	writeHistogram(w, "vstack_chunk_read_duration_seconds",
+		"Chunk GET latency, from request to response written", &sn.readLatency)
+	writeHistogram(w, "vstack_chunk_write_duration_seconds",
+		"Chunk PUT latency for PUTs that stored a chunk", &sn.writeLatency)
+
+	writeMetric(w, "vstack_checksum_mismatches_stored_total", "counter",
+		"Chunks stored with their computed checksum despite a mismatched client checksum",
+		atomic.LoadInt64(&sn.checksumMismatches))
+
+	writeMetric(w, "vstack_verify_sample_rate", "gauge",
+		"Fraction of disk reads whose checksum is verified",
+		sn.verifySampleRate)
+	writeMetric(w, "vstack_verified_reads_total", "counter",
+		"Disk reads whose checksum was verified",
+		atomic.LoadInt64(&sn.verifiedReads))
+	writeMetric(w, "vstack_verify_failures_total", "counter",
+		"Sampled reads that failed checksum verification",
+		atomic.LoadInt64(&sn.verifyFailures))
+
+	if v := sn.postWriteVerify; v != nil {
+		writeMetric(w, "vstack_post_write_verified_total", "counter",
+			"Chunks verified by reading them back after write",
+			atomic.LoadInt64(&v.verified))
+		writeMetric(w, "vstack_post_write_verify_failures_total", "counter",
+			"Chunks that failed read-after-write verification",
+			atomic.LoadInt64(&v.failed))
+		writeMetric(w, "vstack_post_write_rewrites_total", "counter",
+			"Chunks rewritten after failing read-after-write verification",
+			atomic.LoadInt64(&v.rewritten))
+		writeMetric(w, "vstack_post_write_verify_skipped_total", "counter",
+			"Chunks not verified after write because the queue was full",
+			atomic.LoadInt64(&v.skipped))
+		writeMetric(w, "vstack_post_write_verify_pending", "gauge",
+			"Chunks waiting for read-after-write verification",
+			v.pending())
+		writeMetric(w, "vstack_quarantined_chunks_total", "counter",
+			"Chunks taken out of service after failing verification",
+			atomic.LoadInt64(&v.quarantined))
+	}
+
+	writeMetric(w, "vstack_scrubbed_chunks_total", "counter",
+		"Chunks verified by the background scrubber",
+		atomic.LoadInt64(&sn.scrub.scanned))
+	writeMetric(w, "vstack_scrub_corruptions_total", "counter",
+		"Chunks the scrubber found corrupt and quarantined",
+		atomic.LoadInt64(&sn.scrub.corruptions))
+
+	writeMetric(w, "vstack_superblock_handles_open", "gauge",
+		"Superblock files held open for reads",
+		sn.handles.size())
+	writeMetric(w, "vstack_superblock_handle_opens_total", "counter",
+		"Superblock files opened for reads",
+		atomic.LoadInt64(&sn.handles.opens))
+	writeMetric(w, "vstack_superblock_handle_hits_total", "counter",
+		"Reads served by an already open superblock file",
+		atomic.LoadInt64(&sn.handles.hits))
+	if sn.handles.mmap {
+		writeMetric(w, "vstack_mmap_reads_total", "counter",
+			"Chunk reads served from a memory-mapped superblock",
+			atomic.LoadInt64(&sn.handles.mappedReads))
+		writeMetric(w, "vstack_mmap_fallback_reads_total", "counter",
+			"Chunk reads past the end of a superblock's mapping, read with ReadAt",
+			atomic.LoadInt64(&sn.handles.mmapFallbacks))
+	}
+
+	writeMetric(w, "vstack_negative_cache_hits_total", "counter",
+		"Chunk lookups answered as missing from the negative cache",
+		sn.index.missing.hitCount())
+	writeMetric(w, "vstack_negative_cache_entries", "gauge",
+		"Recently missed chunk IDs held in the negative cache",
+		sn.index.missing.size())
+
+	indexStats := sn.indexStats()
+	writeMetric(w, "vstack_index_entries", "gauge",
+		"Chunks held in the in-memory index",
+		indexStats.Entries)
+	writeMetric(w, "vstack_index_max_entries", "gauge",
+		"MAX_INDEX_ENTRIES write limit (0 = unlimited)",
+		indexStats.MaxEntries)
+	writeMetric(w, "vstack_index_estimated_memory_bytes", "gauge",
+		"Estimated memory held by the in-memory index",
+		indexStats.EstimatedMemoryBytes)
+	writeMetric(w, "vstack_index_saves_total", "counter",
+		"Successful index writes",
+		atomic.LoadInt64(&sn.indexSaves))
+	if sn.index.wal != nil {
+		writeMetric(w, "vstack_index_wal_bytes", "gauge",
+			"Index WAL bytes logged since the last index snapshot",
+			sn.index.wal.bytes())
+	}
+	superblocks := sn.superblockStats()
+	writeLabeledMetric(w, "vstack_superblock_rotations_total", "counter",
+		"Active superblocks rotated away from, by reason", "reason", superblocks.RotationsByReason)
+	active := map[string]int64{TierPrimary: int64(superblocks.Active)}
+	if superblocks.ActiveFast != nil {
+		active[TierFast] = int64(*superblocks.ActiveFast)
+	}
+	writeLabeledMetric(w, "vstack_active_superblock_id", "gauge",
+		"Superblock new chunks are appended to, by tier", "tier", active)
+	writeMetric(w, "vstack_superblocks_sealed_by_age_total", "counter",
+		"Active superblocks rotated for reaching MAX_SUPERBLOCK_AGE",
+		atomic.LoadInt64(&sn.superblocksSealedAge))
+	writeMetric(w, "vstack_tail_reclaimed_bytes_total", "counter",
+		"Bytes freed by truncating the active superblock after deleting its last chunk",
+		atomic.LoadInt64(&sn.tailReclaimedBytes))
+
+	writeMetric(w, "vstack_replica_copies_total", "counter",
+		"Chunks copied to a replica while being served",
+		atomic.LoadInt64(&sn.replicaCopies))
+	writeMetric(w, "vstack_replica_copy_failures_total", "counter",
+		"Replica copies that failed while the chunk was being served",
+		atomic.LoadInt64(&sn.replicaCopyFailures))
+	writeMetric(w, "vstack_replications_total", "counter",
+		"New chunks forwarded to a REPLICA_PEERS peer",
+		atomic.LoadInt64(&sn.replicationSuccesses))
+	writeMetric(w, "vstack_replication_failures_total", "counter",
+		"Forwards to a REPLICA_PEERS peer abandoned after retries",
+		atomic.LoadInt64(&sn.replicationFailures))
+	writeMetric(w, "vstack_read_repairs_total", "counter",
+		"Corrupt chunks replaced with a copy fetched from a REPLICA_PEERS peer",
+		atomic.LoadInt64(&sn.readRepairs))
+	writeMetric(w, "vstack_read_repair_failures_total", "counter",
+		"Corrupt chunks no REPLICA_PEERS peer could supply a valid copy of",
+		atomic.LoadInt64(&sn.readRepairFailures))
+
+	writeMetric(w, "vstack_large_reads_total", "counter",
+		"GETs returning chunks above WARN_LARGE_READ_BYTES",
+		atomic.LoadInt64(&sn.largeReads))
+	writeMetric(w, "vstack_reads_rejected_too_large_total", "counter",
+		"GETs rejected for chunks above MAX_READ_BYTES",
+		atomic.LoadInt64(&sn.rejectedReads))
+	writeMetric(w, "vstack_inflight_writes", "gauge",
+		"Write requests currently being handled",
+		atomic.LoadInt64(&sn.inflightWrites))
+	writeMetric(w, "vstack_write_concurrency_limit", "gauge",
+		"Maximum concurrent write requests (0 = unlimited)",
+		cap(sn.writeSlots))
+	writeMetric(w, "vstack_writes_shed_total", "counter",
+		"Write requests rejected at the concurrency limit",
+		atomic.LoadInt64(&sn.writesShed))
+	writeMetric(w, "vstack_rate_limited_total", "counter",
+		"Requests rejected by the per-client CLIENT_RATE_LIMIT",
+		atomic.LoadInt64(&sn.rateLimited))
+	writeMetric(w, "vstack_dedup_hits_total", "counter",
+		"Chunks stored against an identical stored copy under DEDUP",
+		atomic.LoadInt64(&sn.dedupHits))
+	writeMetric(w, "vstack_dedup_bytes_saved_total", "counter",
+		"Superblock bytes not written thanks to DEDUP",
+		atomic.LoadInt64(&sn.dedupBytesSaved))
+	writeMetric(w, "vstack_open_connections", "gauge",
+		"Accepted client connections currently open",
+		atomic.LoadInt64(&sn.openConnections))
+	writeMetric(w, "vstack_connection_limit", "gauge",
+		"Maximum open client connections (0 = unlimited)",
+		cap(sn.connSlots))
+
+	uncheckpointed := 0
+	if sn.uncheckpointed() {
+		uncheckpointed = 1
+	}
+	writeMetric(w, "vstack_index_checkpoint_age_seconds", "gauge",
+		"Seconds since the index was last persisted",
+		sn.checkpointAge().Seconds())
+	writeMetric(w, "vstack_index_uncheckpointed", "gauge",
+		"1 if the index has mutations not yet persisted",
+		uncheckpointed)
+
+	taskRuns, taskPanics := sn.tasks.stats()
+	writeLabeledMetric(w, "vstack_background_task_runs_total", "counter",
+		"Completed runs of periodic background tasks", "task", taskRuns)
+	writeLabeledMetric(w, "vstack_background_task_panics_total", "counter",
+		"Recovered panics in periodic background tasks", "task", taskPanics)
+
+	writeRouteMetrics(w, sn.routeStatsSnapshot())
+
+	sn.panicMu.Lock()
+	panicsByRoute := make(map[string]int64, len(sn.panicsByRoute))
+	for route, count := range sn.panicsByRoute {
+		panicsByRoute[route] = count
+	}
+	sn.panicMu.Unlock()
+	writeMetric(w, "vstack_handler_panics_total", "counter",
+		"Recovered handler panics",
+		atomic.LoadInt64(&sn.panics))
+	writeLabeledMetric(w, "vstack_handler_panics_by_route_total", "counter",
+		"Recovered handler panics by route template", "route", panicsByRoute)
+}
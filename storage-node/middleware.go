@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxClientRequestIDLength bounds client-supplied X-Request-ID values
+const MaxClientRequestIDLength = 128
+
+// newRequestID returns a random (version 4) UUID
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand should never fail; fall back to a timestamp-based ID
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// PanicHealthWindow is how long a handler panic keeps /health in warning
+const PanicHealthWindow = 5 * time.Minute
+
+// routeTemplate returns the mux route template for a request, falling back
+// to the raw path when no route matched
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return r.URL.Path
+}
+
+// recoveryMiddleware turns handler panics into 500 responses and counts them
+// per route
+func (sn *StorageNode) recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				route := routeTemplate(r)
+				sn.recordPanic(route)
+				log.Printf("PANIC: %v (route: %s %s, Request-ID: %s)\n%s",
+					err, r.Method, route, w.Header().Get("X-Request-ID"), debug.Stack())
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recordPanic counts a recovered handler panic
+func (sn *StorageNode) recordPanic(route string) {
+	atomic.AddInt64(&sn.panics, 1)
+	atomic.StoreInt64(&sn.lastPanic, time.Now().UnixNano())
+
+	sn.panicMu.Lock()
+	sn.panicsByRoute[route]++
+	sn.panicMu.Unlock()
+}
+
+// recentPanic reports whether a handler panicked within PanicHealthWindow
+func (sn *StorageNode) recentPanic() bool {
+	last := atomic.LoadInt64(&sn.lastPanic)
+	return last != 0 && time.Since(time.Unix(0, last)) < PanicHealthWindow
+}
+
+// requestLoggingMiddleware tags every request with an ID and logs its duration.
+// A client-supplied X-Request-ID is honored so traces can span services.
+func requestLoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > MaxClientRequestIDLength {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r)
+		duration := time.Since(start)
+		log.Printf("Request: %s %s - Client: %s - Duration: %v - Request-ID: %s",
+			r.Method, r.URL.Path, clientIP(r), duration, requestID)
+	})
+}
+
+// corsMiddleware sets CORS headers and answers preflight requests
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowedOrigin := os.Getenv("ALLOWED_ORIGIN")
+		if allowedOrigin == "" {
+			allowedOrigin = "*" // Default for development
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Chunk-Checksum, X-Chunk-Checksum-Algo, X-Request-ID, X-Stored-By, X-Chunk-TTL, X-Chunk-Token")
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRequestIDsAreUnique(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := sn.newRouter()
+
+	const numRequests = 500
+	ids := make(chan string, numRequests)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("HEAD", "/ping", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			ids <- w.Header().Get("X-Request-ID")
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[string]bool)
+	for id := range ids {
+		if !uuidPattern.MatchString(id) {
+			t.Errorf("Request ID %q is not a UUID", id)
+		}
+		if seen[id] {
+			t.Errorf("Duplicate request ID %s", id)
+		}
+		seen[id] = true
+	}
+
+	if len(seen) != numRequests {
+		t.Errorf("Expected %d distinct request IDs, got %d", numRequests, len(seen))
+	}
+}
+
+func TestClientRequestIDHonored(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := sn.newRouter()
+
+	req := httptest.NewRequest("HEAD", "/ping", nil)
+	req.Header.Set("X-Request-ID", "client-trace-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("X-Request-ID"); got != "client-trace-123" {
+		t.Errorf("Expected client request ID to be echoed, got %s", got)
+	}
+}
+
+func TestHandlerPanicsAreCounted(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := sn.newRouter()
+	r.HandleFunc("/explode/{id}", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}).Methods("GET")
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/explode/%d", i), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+		}
+	}
+
+	if got := atomic.LoadInt64(&sn.panics); got != 2 {
+		t.Errorf("Expected 2 panics counted, got %d", got)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if line := `vstack_handler_panics_by_route_total{route="/explode/{id}"} 2`; !strings.Contains(w.Body.String(), line) {
+		t.Errorf("Expected metrics to contain %q, got:\n%s", line, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/health", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var health HealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+		t.Fatalf("Failed to decode health response: %v", err)
+	}
+	if health.Panics != 2 || health.Status != "warning" {
+		t.Errorf("Expected warning health with 2 panics, got %s with %d", health.Status, health.Panics)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapSupported reports whether READ_MODE=mmap can map superblocks here
+const mmapSupported = false
+
+func mmapFile(file *os.File, size int) ([]byte, error) {
+	return nil, errors.New("mmap is not supported on this platform")
+}
+
+func munmapFile(mapped []byte) error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMmapReadsAcrossRotation(t *testing.T) {
+	if !mmapSupported {
+		t.Skip("mmap is not supported on this platform")
+	}
+	t.Setenv("READ_MODE", ReadModeMmap)
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	defer sn.Shutdown()
+	if !sn.handles.mmap {
+		t.Fatal("Expected READ_MODE=mmap to enable mapped reads")
+	}
+	sn.maxSuperblockSize = 4096
+
+	stored := make(map[string][]byte)
+	store := func(chunkID string) {
+		data := bytes.Repeat([]byte(chunkID), 100)
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+		stored[chunkID] = data
+	}
+	readAll := func() {
+		t.Helper()
+		for chunkID, want := range stored {
+			entry, _ := sn.lookupChunk(chunkID)
+			got, err := sn.readChunk(entry)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("Chunk %s read back wrong (%v)", chunkID, err)
+			}
+		}
+	}
+
+	// Five chunks fit a superblock; leave room in the last one
+	for i := 0; i < 18; i++ {
+		store(fmt.Sprintf("mmap-%02d", i))
+	}
+	first, _ := sn.lookupChunk("mmap-00")
+	if sn.currentSuperblock == first.SuperblockID {
+		t.Fatal("Expected the chunks to span several superblocks")
+	}
+	readAll()
+	readAll()
+	if n := atomic.LoadInt64(&sn.handles.mappedReads); n == 0 {
+		t.Error("Expected reads to be served from mappings")
+	}
+
+	// The active superblock grows past its mapping and is mapped again
+	fallbacks := atomic.LoadInt64(&sn.handles.mmapFallbacks)
+	current := sn.currentSuperblock
+	store("mmap-late")
+	if entry, _ := sn.lookupChunk("mmap-late"); entry.SuperblockID != current {
+		t.Fatalf("Expected the chunk to be appended to superblock %d, got %d", current, entry.SuperblockID)
+	}
+	readAll()
+	if atomic.LoadInt64(&sn.handles.mmapFallbacks) == fallbacks {
+		t.Error("Expected a read past the end of a mapping to fall back to ReadAt")
+	}
+	entry, _ := sn.lookupChunk("mmap-late")
+	mapped := atomic.LoadInt64(&sn.handles.mappedReads)
+	if _, err := sn.readChunk(entry); err != nil || atomic.LoadInt64(&sn.handles.mappedReads) != mapped+1 {
+		t.Errorf("Expected the grown superblock to be mapped again (%v)", err)
+	}
+
+	// A view outlives its handle's eviction until released
+	view, release, err := sn.readChunkView(first)
+	if err != nil {
+		t.Fatalf("Failed to read chunk view: %v", err)
+	}
+	sn.handles.invalidate(first.SuperblockID)
+	if !bytes.Equal(view, stored["mmap-00"]) {
+		t.Error("Expected an evicted mapping to stay readable while held")
+	}
+	release()
+
+	// Deleting the newest chunk leaves the mapped file's length alone
+	size, _ := sn.getSuperblockSize(entry.SuperblockID)
+	if !sn.deleteChunk("mmap-late") {
+		t.Fatal("Failed to delete chunk")
+	}
+	delete(stored, "mmap-late")
+	if after, _ := sn.getSuperblockSize(entry.SuperblockID); after != size {
+		t.Errorf("Expected no tail truncation under mmap, superblock went from %d to %d bytes", size, after)
+	}
+
+	// GET serves mapped data through to the end of the response
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/mmap-03", nil))
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), stored["mmap-03"]) {
+		t.Errorf("Expected GET to return the chunk, got %d", rr.Code)
+	}
+}
+
+func TestReadModeFallsBackWithoutHandleCache(t *testing.T) {
+	t.Setenv("READ_MODE", ReadModeMmap)
+	t.Setenv("SUPERBLOCK_HANDLE_CACHE", "0")
+	sn := NewStorageNode(t.TempDir(), "test-node")
+	if sn.handles.mmap {
+		t.Error("Expected mmap reads to stay off without a handle cache")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Negative cache defaults (see NEGATIVE_CACHE_TTL and NEGATIVE_CACHE_SIZE)
+const (
+	DefaultNegativeCacheTTL  = time.Second
+	DefaultNegativeCacheSize = 10000
+)
+
+// negativeCache remembers chunk IDs recently looked up and not found, so a
+// storm of GETs for chunks this node doesn't have (e.g. stale coordinator
+// routing) is answered without taking the index lock. Entries are added
+// under the index read lock and removed by ChunkIndex.set under its write
+// lock, so a stored chunk is never reported missing.
+type negativeCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu    sync.Mutex
+	items map[string]time.Time // chunk ID -> expiry
+
+	hits int64 // atomic
+}
+
+// newNegativeCache returns a cache of up to maxSize misses, or nil (a
+// disabled cache) if ttl or maxSize is not positive
+func newNegativeCache(ttl time.Duration, maxSize int) *negativeCache {
+	if ttl <= 0 || maxSize <= 0 {
+		return nil
+	}
+	return &negativeCache{ttl: ttl, maxSize: maxSize, items: make(map[string]time.Time)}
+}
+
+// contains reports whether chunkID missed within the TTL
+func (c *negativeCache) contains(chunkID string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	expiry, ok := c.items[chunkID]
+	if ok && time.Now().After(expiry) {
+		delete(c.items, chunkID)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		atomic.AddInt64(&c.hits, 1)
+	}
+	return ok
+}
+
+// add records a miss. When full, expired entries are swept first and an
+// arbitrary live one is evicted if that frees nothing.
+func (c *negativeCache) add(chunkID string) {
+	if c == nil {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[chunkID]; !ok && len(c.items) >= c.maxSize {
+		for id, expiry := range c.items {
+			if now.After(expiry) {
+				delete(c.items, id)
+			}
+		}
+		for id := range c.items {
+			if len(c.items) < c.maxSize {
+				break
+			}
+			delete(c.items, id)
+		}
+	}
+	c.items[chunkID] = now.Add(c.ttl)
+}
+
+func (c *negativeCache) remove(chunkID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.items, chunkID)
+	c.mu.Unlock()
+}
+
+// clear forgets every recorded miss
+func (c *negativeCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.items = make(map[string]time.Time)
+	c.mu.Unlock()
+}
+
+func (c *negativeCache) size() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+func (c *negativeCache) hitCount() int64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&c.hits)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNegativeCacheAbsorbsMissStorm(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	get := func() int {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/not-here-yet", nil))
+		return rr.Code
+	}
+
+	for i := 0; i < 100; i++ {
+		if code := get(); code != http.StatusNotFound {
+			t.Fatalf("Expected 404 for a missing chunk, got %d", code)
+		}
+	}
+	if hits := sn.index.missing.hitCount(); hits != 99 {
+		t.Errorf("Expected every miss after the first served from the negative cache, got %d hits", hits)
+	}
+
+	// Storing the chunk invalidates its negative entry immediately
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/not-here-yet", bytes.NewReader([]byte("arrived"))))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", rr.Code)
+	}
+	if code := get(); code != http.StatusOK {
+		t.Errorf("Expected 200 right after the chunk was stored, got %d", code)
+	}
+}
+
+func TestNegativeCacheExpiryAndBound(t *testing.T) {
+	c := newNegativeCache(20*time.Millisecond, 3)
+	for i := 0; i < 10; i++ {
+		c.add(fmt.Sprintf("miss-%d", i))
+	}
+	if n := c.size(); n != 3 {
+		t.Errorf("Expected the cache bounded at 3 entries, got %d", n)
+	}
+	if !c.contains("miss-9") {
+		t.Error("Expected the latest miss to be cached")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if c.contains("miss-9") {
+		t.Error("Expected the miss to expire after the TTL")
+	}
+
+	if newNegativeCache(0, 3) != nil {
+		t.Error("Expected a zero TTL to disable the cache")
+	}
+}
+
+func TestNegativeCacheClearedOnRebuild(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := []byte("dropped from the index, still on disk")
+	if err := sn.storeChunk("rediscovered", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	sn.index.mu.Lock()
+	sn.index.remove("rediscovered")
+	sn.index.mu.Unlock()
+	if _, ok := sn.lookupChunk("rediscovered"); ok {
+		t.Fatal("Expected the chunk to be missing from the index")
+	}
+
+	if err := sn.RebuildIndex(); err != nil {
+		t.Fatalf("Failed to rebuild index: %v", err)
+	}
+	if _, ok := sn.lookupChunk("rediscovered"); !ok {
+		t.Error("Expected the rebuilt index to serve the chunk despite the earlier miss")
+	}
+}
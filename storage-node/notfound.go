@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Chunk miss hints (see NOT_FOUND_HINTS)
+const (
+	ChunkNotHereHeader = "X-Chunk-Not-Here"
+	PendingWriteRetry  = time.Second // Retry-After for misses racing a PUT
+)
+
+// writeChunkNotFound answers a GET or HEAD for a chunk missing from the
+// index. A coordinator following stale routing needs to know whether to
+// move on: unless a PUT of the chunk is in progress, the miss is definitive
+// and is marked with X-Chunk-Not-Here so another replica can be tried at
+// once. A miss racing a PUT gets Retry-After instead. Requests during an
+// index rebuild never get here; they are answered 503 with Retry-After.
+func (sn *StorageNode) writeChunkNotFound(w http.ResponseWriter, chunkID string) {
+	if sn.notFoundHints {
+		if sn.writeInProgress(chunkID) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(PendingWriteRetry/time.Second)))
+		} else {
+			w.Header().Set(ChunkNotHereHeader, "true")
+		}
+	}
+	http.Error(w, ErrChunkNotFound, http.StatusNotFound)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChunkNotHereHint(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	request := func(method, chunkID string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, "/chunk/"+chunkID, nil))
+		return rr
+	}
+
+	t.Run("genuine_miss", func(t *testing.T) {
+		for _, method := range []string{"HEAD", "GET"} {
+			rr := request(method, "never-stored")
+			if rr.Code != http.StatusNotFound {
+				t.Fatalf("Expected 404 for %s, got %d", method, rr.Code)
+			}
+			if got := rr.Header().Get(ChunkNotHereHeader); got != "true" {
+				t.Errorf("Expected %s: true on a %s miss, got %q", ChunkNotHereHeader, method, got)
+			}
+		}
+	})
+
+	t.Run("by_checksum_miss", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/by-checksum/"+strings.Repeat("0", 64), nil))
+		if rr.Code != http.StatusNotFound || rr.Header().Get(ChunkNotHereHeader) != "true" {
+			t.Errorf("Expected a 404 with %s: true, got %d %q", ChunkNotHereHeader, rr.Code, rr.Header().Get(ChunkNotHereHeader))
+		}
+	})
+
+	t.Run("metadata_miss", func(t *testing.T) {
+		rr := request("GET", "never-stored/metadata")
+		if rr.Code != http.StatusNotFound || rr.Header().Get(ChunkNotHereHeader) != "true" {
+			t.Errorf("Expected a 404 with %s: true, got %d %q", ChunkNotHereHeader, rr.Code, rr.Header().Get(ChunkNotHereHeader))
+		}
+	})
+
+	t.Run("miss_racing_put", func(t *testing.T) {
+		end := sn.beginWrite("being-written")
+		defer end()
+
+		rr := request("HEAD", "being-written")
+		if rr.Code != http.StatusNotFound {
+			t.Fatalf("Expected 404, got %d", rr.Code)
+		}
+		if got := rr.Header().Get(ChunkNotHereHeader); got != "" {
+			t.Errorf("Expected no %s while a PUT is in progress, got %q", ChunkNotHereHeader, got)
+		}
+		if rr.Header().Get("Retry-After") != "1" {
+			t.Errorf("Expected Retry-After: 1, got %q", rr.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		sn.notFoundHints = false
+		defer func() { sn.notFoundHints = true }()
+
+		if got := request("HEAD", "never-stored").Header().Get(ChunkNotHereHeader); got != "" {
+			t.Errorf("Expected no hint with NOT_FOUND_HINTS=false, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Read-after-write verification (see VERIFY_AFTER_WRITE)
+const (
+	DefaultPostWriteVerifyRate = 50 * 1024 * 1024 // bytes/sec read back by the verifier
+	PostWriteVerifyInterval    = 100 * time.Millisecond
+	PostWriteVerifyQueueSize   = 4096
+	PostWriteRewriteBuffer     = 64 * 1024 * 1024 // Bytes of chunk data kept for rewrites
+	PostWriteVerifyAttempts    = 3                // Reads tried before giving up on a chunk that won't read
+)
+
+// writeChunkData writes a superblock append; tests swap it to inject faults
+var writeChunkData = func(file *os.File, buf []byte) (int, error) {
+	return file.Write(buf)
+}
+
+// postWriteJob is a stored chunk awaiting read-after-write verification.
+// pw is kept, with its data, only while the rewrite buffer has room and the
+// chunk isn't itself a rewrite. Streamed chunks were never buffered.
+type postWriteJob struct {
+	entry    ChunkEntry
+	pw       *pendingWrite
+	attempts int // reads that failed with an error other than corruption
+}
+
+// postWriteVerifier queues newly stored chunks for background verification
+type postWriteVerifier struct {
+	mu       sync.Mutex
+	jobs     []postWriteJob
+	buffered int64 // bytes of chunk data held by queued jobs
+
+	verified    int64 // atomic
+	failed      int64 // atomic
+	rewritten   int64 // atomic
+	skipped     int64 // atomic, dropped because the queue was full
+	quarantined int64 // atomic
+}
+
+// QuarantineRecord is a line of logs/quarantine.log
+type QuarantineRecord struct {
+	Entry  ChunkEntry `json:"entry"`
+	Reason string     `json:"reason"`
+	Time   time.Time  `json:"time"`
+}
+
+// enqueue adds stored chunks to the queue. It never blocks the write path.
+func (v *postWriteVerifier) enqueue(entries []ChunkEntry, batch []*pendingWrite) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i, entry := range entries {
+		if len(v.jobs) >= PostWriteVerifyQueueSize {
+			atomic.AddInt64(&v.skipped, 1)
+			continue
+		}
+		job := postWriteJob{entry: entry}
+		if !batch[i].rewrite && len(batch[i].data) > 0 && v.buffered+int64(len(batch[i].data)) <= PostWriteRewriteBuffer {
+			job.pw = batch[i]
+			v.buffered += int64(len(batch[i].data))
+		}
+		v.jobs = append(v.jobs, job)
+	}
+}
+
+// requeue puts a job whose read failed back at the end of the queue, unless
+// the queue is full
+func (v *postWriteVerifier) requeue(job postWriteJob) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.jobs) >= PostWriteVerifyQueueSize {
+		atomic.AddInt64(&v.skipped, 1)
+		return false
+	}
+	if job.pw != nil {
+		v.buffered += int64(len(job.pw.data))
+	}
+	v.jobs = append(v.jobs, job)
+	return true
+}
+
+func (v *postWriteVerifier) next() (postWriteJob, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.jobs) == 0 {
+		return postWriteJob{}, false
+	}
+	job := v.jobs[0]
+	v.jobs[0] = postWriteJob{}
+	v.jobs = v.jobs[1:]
+	if job.pw != nil {
+		v.buffered -= int64(len(job.pw.data))
+	}
+	return job, true
+}
+
+func (v *postWriteVerifier) pending() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.jobs)
+}
+
+// verifyWrittenChunks works through the queue, reading back at most
+// sn.postWriteVerifyRate bytes/sec
+func (sn *StorageNode) verifyWrittenChunks(ctx context.Context) {
+	start := time.Now()
+	var read int64
+	for ctx.Err() == nil {
+		job, ok := sn.postWriteVerify.next()
+		if !ok {
+			return
+		}
+		sn.verifyWrittenChunk(job)
+
+		read += int64(job.entry.Size)
+		if sn.postWriteVerifyRate > 0 {
+			expected := time.Duration(float64(read) / float64(sn.postWriteVerifyRate) * float64(time.Second))
+			if wait := expected - time.Since(start); wait > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(wait):
+				}
+			}
+		}
+	}
+}
+
+// verifyWrittenChunk reads a chunk back from disk and checks its checksum.
+// A chunk that proves corrupt is quarantined and, if its data is still
+// buffered, written again. Other read errors may be transient, so the chunk
+// is retried later, up to PostWriteVerifyAttempts reads.
+func (sn *StorageNode) verifyWrittenChunk(job postWriteJob) {
+	v := sn.postWriteVerify
+	entry := job.entry
+
+	data, err := sn.readChunk(entry)
+	if err == nil {
+		var computed string
+		if computed, err = computeChecksum(entry.checksumAlgorithm(), data); err == nil && computed != entry.Checksum {
+			err = fmt.Errorf("%w: expected %s, got %s", errChunkCorrupt, entry.Checksum, computed)
+		}
+	}
+	if err == nil {
+		atomic.AddInt64(&v.verified, 1)
+		return
+	}
+	if !errors.Is(err, errChunkCorrupt) {
+		if job.attempts++; job.attempts < PostWriteVerifyAttempts && v.requeue(job) {
+			return
+		}
+		log.Printf("Warning: giving up verifying chunk %s after %d failed reads: %v", entry.ChunkID, job.attempts, err)
+		return
+	}
+
+	// The chunk may have been deleted or moved since it was queued
+	if !sn.quarantineChunk(entry, err) {
+		return
+	}
+	atomic.AddInt64(&v.failed, 1)
+
+	if job.pw == nil {
+		log.Printf("Chunk %s failed read-after-write verification and is no longer buffered; quarantined: %v", entry.ChunkID, err)
+		return
+	}
+	// Rewrite once; a chunk that fails again stays quarantined
+	rewrite := *job.pw
+	rewrite.done, rewrite.rewrite = nil, true
+	if err := sn.storePending(&rewrite); err != nil {
+		log.Printf("Failed to rewrite chunk %s after failed verification: %v", entry.ChunkID, err)
+		return
+	}
+	atomic.AddInt64(&v.rewritten, 1)
+	log.Printf("Rewrote chunk %s after failed read-after-write verification", entry.ChunkID)
+}
+
+// quarantineChunk takes an index entry whose data failed verification out
+// of service and records it in logs/quarantine.log. It reports false if the
+// index no longer holds that exact entry.
+func (sn *StorageNode) quarantineChunk(entry ChunkEntry, reason error) bool {
+	sn.index.mu.Lock()
+	current, exists := sn.index.chunks[entry.ChunkID]
+	if !exists || current.SuperblockID != entry.SuperblockID || current.Offset != entry.Offset || current.Checksum != entry.Checksum {
+		sn.index.mu.Unlock()
+		return false
+	}
+	sn.index.remove(entry.ChunkID)
+	shared := sn.index.referenced(entry)
+	sn.recordEvents(MutationEvent{Op: EventDelete, ChunkID: entry.ChunkID, Checksum: entry.Checksum, Size: entry.logicalSize(), Timestamp: time.Now()})
+	sn.index.mu.Unlock()
+	sn.flushEvents()
+
+	sn.readCache.Remove(entry.ChunkID)
+	if !shared {
+		sn.markDead(entry.SuperblockID, int64(entry.Size))
+	}
+	if v := sn.postWriteVerify; v != nil {
+		atomic.AddInt64(&v.quarantined, 1)
+	}
+	log.Printf("Quarantined chunk %s (superblock %d, offset %d): %v", entry.ChunkID, entry.SuperblockID, entry.Offset, reason)
+
+	if err := sn.appendQuarantineRecord(QuarantineRecord{Entry: entry, Reason: reason.Error(), Time: time.Now()}); err != nil {
+		log.Printf("Warning: failed to record quarantined chunk %s: %v", entry.ChunkID, err)
+	}
+	if err := sn.deferIndexSave(sn.deleteCoalesceWindow); err != nil {
+		log.Printf("Warning: failed to persist index after quarantining chunk %s: %v", entry.ChunkID, err)
+	}
+	return true
+}
+
+func (sn *StorageNode) appendQuarantineRecord(record QuarantineRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(sn.dataDir, "logs", "quarantine.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return file.Sync()
+}
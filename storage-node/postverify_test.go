@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// corruptNextWrite makes the next superblock write containing marker land on
+// disk with a flipped byte while still reporting success
+func corruptNextWrite(t *testing.T, marker []byte) {
+	var done int32
+	writeChunkData = func(file *os.File, buf []byte) (int, error) {
+		if i := bytes.Index(buf, marker); i >= 0 && atomic.CompareAndSwapInt32(&done, 0, 1) {
+			bad := append([]byte(nil), buf...)
+			bad[i] ^= 0xff
+			return file.Write(bad)
+		}
+		return file.Write(buf)
+	}
+	t.Cleanup(func() {
+		writeChunkData = func(file *os.File, buf []byte) (int, error) { return file.Write(buf) }
+	})
+}
+
+func TestVerifyAfterWrite(t *testing.T) {
+	t.Setenv("VERIFY_AFTER_WRITE", "true")
+	t.Setenv("VERIFY_AFTER_WRITE_RATE_MB", "0")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	defer sn.Shutdown()
+
+	store := func(chunkID string, data []byte) {
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+	}
+
+	t.Run("corrupt_write_quarantined_and_rewritten", func(t *testing.T) {
+		data := []byte("chunk that lands corrupted on disk")
+		corruptNextWrite(t, data)
+		store("bad-write", data)
+		store("good-write", []byte("chunk that lands intact"))
+		first, _ := sn.lookupChunk("bad-write")
+
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt64(&sn.postWriteVerify.rewritten) == 0 || sn.postWriteVerify.pending() > 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("Expected the corrupted chunk to be rewritten after verification")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		if n := atomic.LoadInt64(&sn.postWriteVerify.quarantined); n != 1 {
+			t.Errorf("Expected 1 quarantined chunk, got %d", n)
+		}
+		entry, ok := sn.lookupChunk("bad-write")
+		if !ok || entry.Offset == first.Offset {
+			t.Fatalf("Expected the chunk to be rewritten to a new location, got %+v (found=%v)", entry, ok)
+		}
+		if _, got, err := sn.readVerifiedChunk(entry); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Expected the rewritten chunk to read back intact: %v", err)
+		}
+
+		log, err := os.ReadFile(filepath.Join(tempDir, "logs", "quarantine.log"))
+		if err != nil {
+			t.Fatalf("Failed to read quarantine log: %v", err)
+		}
+		if !strings.Contains(string(log), `"chunk_id":"bad-write"`) || strings.Contains(string(log), "good-write") {
+			t.Errorf("Expected only bad-write in the quarantine log, got %s", log)
+		}
+	})
+
+	t.Run("unbuffered_corrupt_write_stays_quarantined", func(t *testing.T) {
+		// Drive verification by hand, as if the rewrite buffer had been full
+		sn.tasks.stop()
+		data := []byte("corrupted chunk whose data is gone")
+		corruptNextWrite(t, data)
+		store("lost-write", data)
+
+		job, ok := sn.postWriteVerify.next()
+		if !ok || job.entry.ChunkID != "lost-write" {
+			t.Fatalf("Expected lost-write to be queued, got %+v", job.entry)
+		}
+		job.pw = nil
+		sn.verifyWrittenChunk(job)
+
+		if _, ok := sn.lookupChunk("lost-write"); ok {
+			t.Error("Expected the corrupted chunk to be taken out of service")
+		}
+	})
+	t.Run("read_error_requeued_not_quarantined", func(t *testing.T) {
+		store("unreadable", []byte("chunk whose read back fails"))
+		job, ok := sn.postWriteVerify.next()
+		if !ok || job.entry.ChunkID != "unreadable" {
+			t.Fatalf("Expected unreadable to be queued, got %+v", job.entry)
+		}
+
+		// Point the entry past the end of its superblock so reads fail
+		// without proving the data corrupt
+		sn.index.mu.Lock()
+		entry := sn.index.chunks["unreadable"]
+		entry.Offset += 1 << 20
+		sn.index.set(entry)
+		sn.index.mu.Unlock()
+		job.entry = entry
+
+		for i := 1; i <= PostWriteVerifyAttempts; i++ {
+			sn.verifyWrittenChunk(job)
+			requeued, ok := sn.postWriteVerify.next()
+			if wantQueued := i < PostWriteVerifyAttempts; ok != wantQueued {
+				t.Fatalf("Read %d: expected requeued=%v, got %v", i, wantQueued, ok)
+			}
+			job = requeued
+		}
+		if _, ok := sn.lookupChunk("unreadable"); !ok {
+			t.Error("Expected a chunk that failed to read not to be quarantined")
+		}
+	})
+}
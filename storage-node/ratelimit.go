@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientRateLimitIdle is how long a client's bucket is kept after its last
+// request; a bucket idle that long has refilled and can be dropped
+const ClientRateLimitIdle = time.Minute
+
+// clientRateLimiter is a token bucket per client IP (see CLIENT_RATE_LIMIT).
+// Each client may burst up to burst requests, refilled at rate per second.
+type clientRateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newClientRateLimiter(rate float64, burst int) *clientRateLimiter {
+	return &clientRateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from ip's bucket, returning false and how long until
+// one is available if the bucket is empty
+func (l *clientRateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune drops the buckets of clients idle for ClientRateLimitIdle
+func (l *clientRateLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ip, b := range l.buckets {
+		if now.Sub(b.last) >= ClientRateLimitIdle {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// rateLimitMiddleware rejects requests beyond CLIENT_RATE_LIMIT from a
+// single client, keyed on the address clientIPMiddleware resolved
+func (sn *StorageNode) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sn.clientLimits != nil {
+			if ok, wait := sn.clientLimits.allow(clientIP(r), time.Now()); !ok {
+				atomic.AddInt64(&sn.rateLimited, 1)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
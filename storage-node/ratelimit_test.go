@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientRateLimit(t *testing.T) {
+	t.Setenv("CLIENT_RATE_LIMIT", "1")
+	t.Setenv("CLIENT_RATE_BURST", "2")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	ping := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/ping", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := ping("10.0.0.1:1234"); rr.Code != http.StatusOK {
+			t.Fatalf("Expected request %d within the burst to succeed, got %d", i+1, rr.Code)
+		}
+	}
+	rr := ping("10.0.0.1:5678")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 429 with Retry-After past the burst, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := ping("10.0.0.2:1234"); rr.Code != http.StatusOK {
+		t.Errorf("Expected another client to be unaffected, got %d", rr.Code)
+	}
+	if sn.rateLimited != 1 {
+		t.Errorf("Expected 1 rate limited request, got %d", sn.rateLimited)
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	l := newClientRateLimiter(2, 1)
+	now := time.Now()
+	if ok, _ := l.allow("client", now); !ok {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	if ok, wait := l.allow("client", now); ok || wait != 500*time.Millisecond {
+		t.Errorf("Expected a 500ms wait on an empty bucket, got ok=%v wait=%v", ok, wait)
+	}
+	if ok, _ := l.allow("client", now.Add(500*time.Millisecond)); !ok {
+		t.Error("Expected the bucket to refill at the configured rate")
+	}
+
+	l.prune(now.Add(ClientRateLimitIdle + time.Second))
+	if len(l.buckets) != 0 {
+		t.Errorf("Expected idle buckets to be pruned, got %d", len(l.buckets))
+	}
+}
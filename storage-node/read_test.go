@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestConcurrentReadAndDelete interleaves GETs of a chunk with DELETE and
+// reclamation of the superblock that held it. Run with -race.
+func TestConcurrentReadAndDelete(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	// Every write rotates into a fresh superblock
+	sn.maxSuperblockSize = 640
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleDeleteChunk).Methods("DELETE")
+
+	const iterations = 50
+	versions := make(map[string]bool)
+	payloads := make([][]byte, iterations)
+	for i := range payloads {
+		payloads[i] = bytes.Repeat([]byte{byte('a' + i%26), byte(i)}, 200)
+		versions[fmt.Sprintf("%x", sha256.Sum256(payloads[i]))] = true
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				req := httptest.NewRequest("GET", "/chunk/race-chunk", nil)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				switch w.Code {
+				case http.StatusNotFound:
+				case http.StatusOK:
+					sum := fmt.Sprintf("%x", sha256.Sum256(w.Body.Bytes()))
+					if !versions[sum] || w.Header().Get("ETag") != sum {
+						t.Errorf("Read returned data of no stored version (ETag %s)", w.Header().Get("ETag"))
+					}
+				default:
+					t.Errorf("Unexpected status %d: %s", w.Code, w.Body.String())
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < iterations; i++ {
+		data := payloads[i]
+		if err := sn.storeChunk("race-chunk", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+
+		sn.index.mu.RLock()
+		superblockID := sn.index.chunks["race-chunk"].SuperblockID
+		sn.index.mu.RUnlock()
+
+		req := httptest.NewRequest("DELETE", "/chunk/race-chunk", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+		}
+
+		// Reclaim the now-empty superblock out from under in-flight reads
+		if err := sn.removeSuperblock(superblockID); err != nil {
+			t.Fatalf("Failed to remove superblock %d: %v", superblockID, err)
+		}
+	}
+
+	close(done)
+	wg.Wait()
+}
+
+func TestReadWithStaleEntry(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.maxSuperblockSize = 640
+
+	data := bytes.Repeat([]byte("s"), 400)
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+	if err := sn.storeChunk("stale-chunk", data, checksum); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+
+	sn.index.mu.RLock()
+	stale := sn.index.chunks["stale-chunk"]
+	sn.index.mu.RUnlock()
+
+	t.Run("moved_chunk_is_reread", func(t *testing.T) {
+		sn.mu.Lock()
+		sn.currentSuperblock++
+		target := sn.currentSuperblock
+		sn.mu.Unlock()
+
+		if _, _, err := sn.relocateChunk("stale-chunk", target); err != nil {
+			t.Fatalf("Failed to relocate chunk: %v", err)
+		}
+		if err := sn.removeSuperblock(stale.SuperblockID); err != nil {
+			t.Fatalf("Failed to remove superblock: %v", err)
+		}
+
+		entry, got, err := sn.readVerifiedChunk(stale)
+		if err != nil {
+			t.Fatalf("Expected read to follow the relocated chunk, got %v", err)
+		}
+		if entry.SuperblockID != target || !bytes.Equal(got, data) {
+			t.Errorf("Expected data from superblock %d, got superblock %d", target, entry.SuperblockID)
+		}
+	})
+
+	t.Run("deleted_chunk_is_gone", func(t *testing.T) {
+		sn.index.mu.Lock()
+		current, _ := sn.index.remove("stale-chunk")
+		sn.index.mu.Unlock()
+		if err := sn.removeSuperblock(current.SuperblockID); err != nil {
+			t.Fatalf("Failed to remove superblock: %v", err)
+		}
+
+		if _, _, err := sn.readVerifiedChunk(current); !errors.Is(err, errChunkGone) {
+			t.Errorf("Expected errChunkGone, got %v", err)
+		}
+	})
+}
+
+// TestConcurrentReadsOfOneSuperblock reads chunks at different offsets of the
+// same superblock in parallel. Run with -race.
+func TestConcurrentReadsOfOneSuperblock(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	chunks := make(map[string][]byte)
+	for i := 0; i < 8; i++ {
+		data := bytes.Repeat([]byte{byte('a' + i)}, 1000+i*257)
+		chunkID := fmt.Sprintf("shared-%d", i)
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+		chunks[chunkID] = data
+	}
+
+	var wg sync.WaitGroup
+	for chunkID, data := range chunks {
+		entry, _ := sn.lookupChunk(chunkID)
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func(entry ChunkEntry, data []byte) {
+				defer wg.Done()
+				got, err := sn.readChunk(entry)
+				if err != nil || !bytes.Equal(got, data) {
+					t.Errorf("Expected chunk %s at offset %d intact, got error %v", entry.ChunkID, entry.Offset, err)
+				}
+			}(entry, data)
+		}
+	}
+	wg.Wait()
+}
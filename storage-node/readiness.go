@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RebuildRetryAfter is the Retry-After hint for chunk requests rejected
+// while the index is being rebuilt
+const RebuildRetryAfter = 5 * time.Second
+
+// Index rebuild states
+const (
+	RebuildStateRunning   = "running"
+	RebuildStateCompleted = "completed"
+)
+
+// RebuildStatus reports the progress of an index rebuild
+type RebuildStatus struct {
+	State              string     `json:"state"`
+	SuperblocksTotal   int        `json:"superblocks_total"`
+	SuperblocksScanned int        `json:"superblocks_scanned"`
+	ChunksFound        int64      `json:"chunks_found"`
+	StartedAt          time.Time  `json:"started_at"`
+	FinishedAt         *time.Time `json:"finished_at,omitempty"`
+}
+
+// ReadinessResponse represents the /readyz response
+type ReadinessResponse struct {
+	Ready   bool           `json:"ready"`
+	Rebuild *RebuildStatus `json:"rebuild,omitempty"`
+}
+
+// beginRebuild marks the index as being rebuilt from a scan of total
+// superblocks. Until finishRebuild, chunk requests get 503 rather than
+// spurious 404s for chunks that haven't been scanned yet.
+func (sn *StorageNode) beginRebuild(total int) {
+	sn.rebuildMu.Lock()
+	defer sn.rebuildMu.Unlock()
+	sn.rebuild = &RebuildStatus{
+		State:            RebuildStateRunning,
+		SuperblocksTotal: total,
+		StartedAt:        time.Now(),
+	}
+	atomic.StoreInt32(&sn.rebuilding, 1)
+}
+
+// advanceRebuild records one more scanned superblock and the chunks found in it
+func (sn *StorageNode) advanceRebuild(chunks int) {
+	sn.rebuildMu.Lock()
+	defer sn.rebuildMu.Unlock()
+	if sn.rebuild != nil {
+		sn.rebuild.SuperblocksScanned++
+		sn.rebuild.ChunksFound += int64(chunks)
+	}
+}
+
+func (sn *StorageNode) finishRebuild() {
+	sn.rebuildMu.Lock()
+	defer sn.rebuildMu.Unlock()
+	if sn.rebuild != nil {
+		now := time.Now()
+		sn.rebuild.State = RebuildStateCompleted
+		sn.rebuild.FinishedAt = &now
+		log.Printf("Index rebuild completed: %d chunks in %d superblocks (%v)",
+			sn.rebuild.ChunksFound, sn.rebuild.SuperblocksScanned, now.Sub(sn.rebuild.StartedAt))
+	}
+	atomic.StoreInt32(&sn.rebuilding, 0)
+}
+
+// rebuildStatus returns a copy of the latest rebuild's progress, or nil if
+// the index has never been rebuilt
+func (sn *StorageNode) rebuildStatus() *RebuildStatus {
+	sn.rebuildMu.Lock()
+	defer sn.rebuildMu.Unlock()
+	if sn.rebuild == nil {
+		return nil
+	}
+	status := *sn.rebuild
+	return &status
+}
+
+func (sn *StorageNode) isReady() bool {
+	return atomic.LoadInt32(&sn.initialized) == 1 && atomic.LoadInt32(&sn.rebuilding) == 0
+}
+
+// handleReadiness reports whether the node can serve chunk requests
+func (sn *StorageNode) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	resp := ReadinessResponse{Ready: sn.isReady(), Rebuild: sn.rebuildStatus()}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if !resp.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode readiness response: %v", err)
+	}
+}
+
+// rebuildGateMiddleware rejects chunk requests with 503 and Retry-After while
+// the index is incomplete. Status and admin endpoints stay available.
+func (sn *StorageNode) rebuildGateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&sn.rebuilding) == 1 && isChunkPath(r.URL.Path) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(RebuildRetryAfter/time.Second)))
+			http.Error(w, "Index rebuild in progress", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isChunkPath(path string) bool {
+	return strings.HasPrefix(path, "/chunk/") || strings.HasPrefix(path, "/chunks/") ||
+		strings.HasPrefix(path, "/by-checksum/")
+}
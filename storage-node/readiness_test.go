@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChunkRequestsGatedDuringRebuild(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	r := sn.newRouter()
+
+	data := []byte("scanned late")
+	if err := sn.storeChunk("scanned", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/readyz"); w.Code != http.StatusOK {
+		t.Fatalf("Expected ready node, got status %d", w.Code)
+	}
+
+	// Simulate a slow rebuild that hasn't reached any chunk yet
+	sn.beginRebuild(4)
+	sn.advanceRebuild(0)
+
+	for _, path := range []string{"/chunk/scanned", "/chunk/not-scanned-yet", "/chunk/scanned/exists"} {
+		w := get(path)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("GET %s: expected status %d during rebuild, got %d", path, http.StatusServiceUnavailable, w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Errorf("GET %s: expected Retry-After header", path)
+		}
+	}
+
+	w := get("/readyz")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz status %d during rebuild, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	var readiness ReadinessResponse
+	if err := json.NewDecoder(w.Body).Decode(&readiness); err != nil {
+		t.Fatalf("Failed to decode readiness response: %v", err)
+	}
+	if readiness.Ready || readiness.Rebuild == nil || readiness.Rebuild.State != RebuildStateRunning ||
+		readiness.Rebuild.SuperblocksScanned != 1 || readiness.Rebuild.SuperblocksTotal != 4 {
+		t.Errorf("Expected rebuild progress 1/4, got %+v", readiness.Rebuild)
+	}
+
+	if w := get("/health"); w.Code != http.StatusOK {
+		t.Errorf("Expected /health to stay available during rebuild, got %d", w.Code)
+	}
+
+	sn.advanceRebuild(1)
+	sn.finishRebuild()
+
+	if w := get("/chunk/scanned"); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d after rebuild, got %d", http.StatusOK, w.Code)
+	}
+	if w := get("/chunk/not-scanned-yet"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after rebuild, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := get("/readyz"); w.Code != http.StatusOK {
+		t.Errorf("Expected ready node after rebuild, got status %d", w.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadSizeLimits(t *testing.T) {
+	t.Setenv("WARN_LARGE_READ_BYTES", "100")
+	t.Setenv("MAX_READ_BYTES", "1000")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	r := sn.newRouter()
+
+	sizes := map[string]int{"read-small": 50, "read-large": 500, "read-huge": 2000}
+	for chunkID, size := range sizes {
+		data := bytes.Repeat([]byte("r"), size)
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	}
+
+	tests := []struct {
+		chunkID string
+		status  int
+	}{
+		{"read-small", http.StatusOK},
+		{"read-large", http.StatusOK},
+		{"read-huge", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/chunk/"+tt.chunkID, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("GET %s: expected status %d, got %d", tt.chunkID, tt.status, w.Code)
+		}
+		if tt.status == http.StatusOK && w.Body.Len() != sizes[tt.chunkID] {
+			t.Errorf("GET %s: expected %d bytes, got %d", tt.chunkID, sizes[tt.chunkID], w.Body.Len())
+		}
+	}
+
+	if got := atomic.LoadInt64(&sn.largeReads); got != 1 {
+		t.Errorf("Expected 1 large read counted, got %d", got)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	for _, line := range []string{"vstack_large_reads_total 1", "vstack_reads_rejected_too_large_total 1"} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
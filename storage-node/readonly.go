@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Filesystem sub-statuses reported in /health
+const (
+	FilesystemStatusOK       = "ok"
+	FilesystemStatusReadOnly = "filesystem read-only"
+)
+
+// errReadOnly is returned for writes attempted after the data volume was
+// found remounted read-only
+var errReadOnly = errors.New("filesystem is read-only")
+
+// errReadOnlyMode is returned for writes attempted by a node started with
+// READ_ONLY=true
+var errReadOnlyMode = errors.New("node is in read-only mode")
+
+// RecheckResponse represents the /admin/recheck response
+type RecheckResponse struct {
+	ReadOnly bool   `json:"read_only"`
+	Error    string `json:"error,omitempty"`
+}
+
+// isReadOnlyError reports whether err means writes can't currently succeed
+// because the filesystem is read-only
+func isReadOnlyError(err error) bool {
+	return errors.Is(err, errReadOnly) || errors.Is(err, syscall.EROFS)
+}
+
+// noteWriteError flips the node into read-only mode when a write fails with
+// EROFS, as happens when a controller error makes the kernel remount the
+// volume. Writes are then rejected up front instead of failing one by one
+// until an operator triggers /admin/recheck.
+func (sn *StorageNode) noteWriteError(err error) {
+	if !errors.Is(err, syscall.EROFS) {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&sn.readOnly, 0, 1) {
+		log.Printf("ERROR: data volume is read-only (%v); rejecting writes until /admin/recheck", err)
+	}
+}
+
+func (sn *StorageNode) isReadOnly() bool {
+	return atomic.LoadInt32(&sn.readOnly) == 1
+}
+
+// filesystemStatus returns the /health filesystem sub-status
+func (sn *StorageNode) filesystemStatus() string {
+	if sn.isReadOnly() {
+		return FilesystemStatusReadOnly
+	}
+	return FilesystemStatusOK
+}
+
+// mutating wraps handlers that write to disk so they fail fast with 503
+// while the filesystem is read-only, and with 405 in READ_ONLY mode
+func (sn *StorageNode) mutating(next http.HandlerFunc) http.HandlerFunc {
+	return sn.writable(func(w http.ResponseWriter, r *http.Request) {
+		if sn.isReadOnly() {
+			http.Error(w, "Filesystem is read-only", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// writable wraps handlers that may write to disk so they are rejected with
+// 405 in READ_ONLY mode. Unlike mutating it lets them through while the
+// filesystem is read-only, for endpoints such as /admin/recheck.
+func (sn *StorageNode) writable(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sn.readOnlyMode {
+			http.Error(w, "Node is in read-only mode", http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// initializeReadOnly loads an existing data directory for READ_ONLY mode,
+// e.g. for forensics or to serve a recovered snapshot. Nothing on disk is
+// created, repaired or claimed: a damaged index is rebuilt and the index WAL
+// replayed in memory only, torn appends and interrupted compactions are left
+// alone, the node ID file isn't checked, and no background task is started.
+func (sn *StorageNode) initializeReadOnly() error {
+	if info, err := os.Stat(filepath.Join(sn.dataDir, "data")); err != nil || !info.IsDir() {
+		return fmt.Errorf("READ_ONLY needs an existing data directory: %s has no data directory", sn.dataDir)
+	}
+	log.Printf("Read-only mode: serving %s without writes, background tasks or registration", sn.dataDir)
+
+	sn.loadOrRebuildIndex()
+	if _, _, err := sn.replayIndexWAL(); err != nil {
+		return err
+	}
+
+	sn.findCurrentSuperblock()
+	sn.rotations.setActive(sn.currentSuperblock)
+	if sn.fastTierDir != "" {
+		sn.findCurrentFastSuperblock()
+		sn.rotations.setActive(sn.currentFastSuperblock)
+	}
+	sn.checkIndexIntegrity()
+
+	atomic.StoreInt32(&sn.initialized, 1)
+	return nil
+}
+
+// probeWritable creates, syncs, renames and removes a scratch file in each
+// directory the node writes to
+func (sn *StorageNode) probeWritable() error {
+	for _, dir := range []string{filepath.Join(sn.dataDir, "data"), filepath.Join(sn.dataDir, "index")} {
+		if err := probeDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probeDir runs the write probe in one directory, leaving no scratch file
+// behind whichever step fails
+func probeDir(dir string) error {
+	probe := filepath.Join(dir, fmt.Sprintf(".write-probe-%d", time.Now().UnixNano()))
+	file, err := os.Create(probe)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(probe)
+	defer os.Remove(probe + ".done")
+
+	err = file.Sync()
+	file.Close()
+	if err != nil {
+		return err
+	}
+	return renameFile(probe, probe+".done")
+}
+
+// handleRecheck probes whether the data volume is writable again and leaves
+// read-only mode if so
+func (sn *StorageNode) handleRecheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var resp RecheckResponse
+	if err := sn.probeWritable(); err != nil {
+		sn.noteWriteError(err)
+		resp.Error = err.Error()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else if atomic.CompareAndSwapInt32(&sn.readOnly, 1, 0) {
+		log.Printf("Data volume is writable again, accepting writes")
+	}
+	resp.ReadOnly = sn.isReadOnly()
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode recheck response: %v", err)
+	}
+}
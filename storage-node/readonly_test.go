@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// simulateReadOnlyRemount makes every rename fail with EROFS, as it would
+// after the kernel remounted the data volume read-only
+func simulateReadOnlyRemount(t *testing.T) {
+	renameFile = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EROFS}
+	}
+	t.Cleanup(func() { renameFile = os.Rename })
+}
+
+func TestReadOnlyRemountDetected(t *testing.T) {
+	t.Setenv("INDEX_SAVE_DELAY", "0") // one index save per write
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.adminToken = "secret"
+	r := sn.newRouter()
+
+	put := func(chunkID string) *httptest.ResponseRecorder {
+		data := []byte("payload for " + chunkID)
+		req := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader(data))
+		req.Header.Set("X-Chunk-Checksum", fmt.Sprintf("%x", sha256.Sum256(data)))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	health := func() HealthResponse {
+		req := httptest.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp HealthResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode health response: %v", err)
+		}
+		return resp
+	}
+
+	if w := put("before-remount"); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if h := health(); h.Filesystem != FilesystemStatusOK {
+		t.Fatalf("Expected filesystem %q, got %q", FilesystemStatusOK, h.Filesystem)
+	}
+
+	simulateReadOnlyRemount(t)
+
+	// The first failing index save flips the node into read-only mode
+	put("during-remount")
+	if !sn.isReadOnly() {
+		t.Fatal("Expected EROFS to put the node in read-only mode")
+	}
+	h := health()
+	if h.Filesystem != FilesystemStatusReadOnly || h.Status != "warning" {
+		t.Errorf("Expected warning status with read-only filesystem, got %s / %s", h.Status, h.Filesystem)
+	}
+
+	// Further writes are rejected cleanly, reads keep working
+	if w := put("after-remount"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d for PUT while read-only, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	req := httptest.NewRequest("DELETE", "/chunk/before-remount", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d for DELETE while read-only, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	req = httptest.NewRequest("GET", "/chunk/before-remount", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected reads to keep working while read-only, got %d", w.Code)
+	}
+
+	// A recheck while the volume is still read-only keeps rejecting writes
+	req = adminRequest("POST", "/admin/recheck", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || !sn.isReadOnly() {
+		t.Errorf("Expected recheck to fail while read-only, got %d", w.Code)
+	}
+	for _, dir := range []string{"data", "index"} {
+		if probes, _ := filepath.Glob(filepath.Join(tempDir, dir, ".write-probe-*")); len(probes) != 0 {
+			t.Errorf("Expected the failed probe to clean up after itself, found %v", probes)
+		}
+	}
+
+	renameFile = os.Rename
+	req = adminRequest("POST", "/admin/recheck", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var recheck RecheckResponse
+	if err := json.NewDecoder(w.Body).Decode(&recheck); err != nil {
+		t.Fatalf("Failed to decode recheck response: %v", err)
+	}
+	if w.Code != http.StatusOK || recheck.ReadOnly {
+		t.Fatalf("Expected recheck to clear read-only mode, got %d %+v", w.Code, recheck)
+	}
+	if w := put("after-recheck"); w.Code != http.StatusCreated {
+		t.Errorf("Expected writes to resume after recheck, got %d", w.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snapshotDataDir records the size and modification time of every file
+// under dir
+func snapshotDataDir(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[path] = fmt.Sprintf("%v/%d", info.ModTime(), info.Size())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk %s: %v", dir, err)
+	}
+	return files
+}
+
+func TestReadOnlyModeServesReadsAndRejectsMutations(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	data := []byte("chunk served from a recovered snapshot")
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/snapshot", bytes.NewReader(data)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", rr.Code)
+	}
+	sn.Shutdown()
+	before := snapshotDataDir(t, tempDir)
+
+	t.Setenv("READ_ONLY", "true")
+	t.Setenv("MAX_SUPERBLOCK_AGE", "1s")
+	t.Setenv("SCRUB_INTERVAL", "1s")
+	ro := NewStorageNode(tempDir, "some-other-node")
+	if err := ro.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize in read-only mode: %v", err)
+	}
+	ro.adminToken = "secret"
+	router := ro.newRouter()
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/snapshot", nil))
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Errorf("Expected the chunk to be served, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("HEAD", "/chunk/snapshot", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 for HEAD, got %d", rr.Code)
+	}
+	if health := ro.health(); health.Status != "healthy" || !health.ReadOnlyMode {
+		t.Errorf("Expected a healthy node reporting read-only mode, got %s (read_only_mode: %v)", health.Status, health.ReadOnlyMode)
+	}
+
+	for _, req := range []struct{ method, path, body string }{
+		{"PUT", "/chunk/new", "new chunk"},
+		{"DELETE", "/chunk/snapshot", ""},
+		{"PATCH", "/chunk/snapshot/meta", `{"user_meta":{"k":"v"}}`},
+		{"POST", "/chunks/batch", ""},
+		{"POST", "/chunks/batch/delete", `{"chunk_ids":["snapshot"]}`},
+		{"POST", "/scrub", ""},
+		{"POST", "/admin/superblocks/0/compact", ""},
+		{"POST", "/admin/flush", ""},
+		{"POST", "/admin/recheck", ""},
+	} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, adminRequest(req.method, req.path, strings.NewReader(req.body)))
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected 405 for %s %s, got %d", req.method, req.path, rr.Code)
+		}
+	}
+	if _, ok := ro.lookupChunk("snapshot"); !ok {
+		t.Error("Expected the chunk to survive the rejected DELETE")
+	}
+
+	// Background tasks would have sealed or scrubbed by now
+	time.Sleep(1500 * time.Millisecond)
+	ro.Shutdown()
+	after := snapshotDataDir(t, tempDir)
+	for path, stat := range before {
+		if after[path] != stat {
+			t.Errorf("Expected %s untouched in read-only mode", path)
+		}
+	}
+	for path := range after {
+		if _, ok := before[path]; !ok {
+			t.Errorf("Expected no new files in read-only mode, found %s", path)
+		}
+	}
+}
+
+func TestReadOnlyModeNeedsExistingDataDir(t *testing.T) {
+	t.Setenv("READ_ONLY", "true")
+	dir := filepath.Join(t.TempDir(), "missing")
+	if err := NewStorageNode(dir, "test-node").Initialize(); err == nil {
+		t.Error("Expected read-only mode to refuse a missing data directory")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("Expected read-only mode not to create the data directory")
+	}
+}
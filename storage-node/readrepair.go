@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReadRepairTimeout bounds fetching a corrupt chunk from the replica
+// peers (see READ_REPAIR_TIMEOUT)
+const DefaultReadRepairTimeout = 500 * time.Millisecond
+
+// repairFromPeers fetches a valid copy of a chunk that failed checksum
+// verification from the replica peers, returning its data to serve. The
+// corrupt local copy is then replaced in the background. GETs from peers
+// never trigger repairs of their own, so two nodes holding the same damaged
+// chunk don't ask each other back and forth.
+func (sn *StorageNode) repairFromPeers(r *http.Request, entry ChunkEntry) ([]byte, bool) {
+	if !sn.canRepair() || r.Header.Get(ReplicaHeader) == "true" {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), sn.readRepairTimeout)
+	defer cancel()
+	data, ok := sn.fetchRepairCopy(ctx, entry)
+	if !ok {
+		atomic.AddInt64(&sn.readRepairFailures, 1)
+		return nil, false
+	}
+	log.Printf("Read repair of chunk %s: serving the copy from a peer", entry.ChunkID)
+	if !sn.tasks.start("read-repair", func(context.Context) { sn.replaceCorruptChunk(entry, data) }) {
+		atomic.AddInt64(&sn.readRepairFailures, 1)
+	}
+	return data, true
+}
+
+// canRepair reports whether corrupt chunks can be repaired from replica
+// peers (see READ_REPAIR and REPLICA_PEERS)
+func (sn *StorageNode) canRepair() bool {
+	return sn.readRepair && len(sn.replicaPeers) > 0
+}
+
+// fetchRepairCopy asks the replica peers in turn, those the chunk was
+// forwarded to first, for a valid copy of a chunk until ctx is done
+func (sn *StorageNode) fetchRepairCopy(ctx context.Context, entry ChunkEntry) ([]byte, bool) {
+	for _, peer := range sn.rankReplicaPeers(entry.ChunkID) {
+		data, err := sn.fetchFromPeer(ctx, entry, peer)
+		if err == nil {
+			log.Printf("Read repair of chunk %s: %s has a valid copy", entry.ChunkID, peer)
+			return data, true
+		}
+		log.Printf("Read repair of chunk %s: %s has no valid copy: %v", entry.ChunkID, peer, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, false
+}
+
+// fetchFromPeer GETs a chunk from a peer, accepting it only if it matches
+// the local entry's size and checksum
+func (sn *StorageNode) fetchFromPeer(ctx context.Context, entry ChunkEntry, peer string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", peer+"/chunk/"+entry.ChunkID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	sn.authorizePeerRequest(req, entry.ChunkID)
+	req.Header.Set(ReplicaHeader, "true")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned status %d", resp.StatusCode)
+	}
+
+	size := int64(entry.logicalSize())
+	data, err := io.ReadAll(io.LimitReader(resp.Body, size+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk: %w", err)
+	}
+	if int64(len(data)) != size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", size, len(data))
+	}
+	if sum, err := computeChecksum(entry.checksumAlgorithm(), data); err != nil || sum != entry.Checksum {
+		return nil, fmt.Errorf("%w: copy does not match checksum %s", errChunkCorrupt, entry.Checksum)
+	}
+	return data, nil
+}
+
+// replaceCorruptChunk stores a repaired chunk's data afresh and marks the
+// corrupt bytes dead. The new entry keeps the old one's metadata. Nothing is
+// written if the chunk was deleted or replaced meanwhile, and a repair is
+// only counted once the index points at the fresh copy.
+func (sn *StorageNode) replaceCorruptChunk(old ChunkEntry, data []byte) {
+	if !sn.indexedAt(old) {
+		return
+	}
+	pw := &pendingWrite{
+		chunkID:      old.ChunkID,
+		data:         data,
+		checksum:     old.Checksum,
+		checksumAlgo: old.checksumAlgorithm(),
+		storedBy:     old.StoredBy,
+		expiresAt:    old.ExpiresAt,
+		meta:         old.Meta,
+		rewrite:      true,
+	}
+	if err := sn.storePending(pw); err != nil {
+		atomic.AddInt64(&sn.readRepairFailures, 1)
+		log.Printf("Read repair of chunk %s: failed to store the repaired copy: %v", old.ChunkID, err)
+		return
+	}
+
+	// Metadata set after the PUT lives only in the index entry
+	sn.index.mu.Lock()
+	repaired, ok := sn.index.chunks[old.ChunkID]
+	ok = ok && repaired.Checksum == old.Checksum && repaired.blob() != old.blob()
+	if ok {
+		repaired.StoredAt, repaired.ContentType, repaired.Pinned = old.StoredAt, old.ContentType, old.Pinned
+		sn.index.set(repaired)
+	}
+	shared := sn.index.referenced(old)
+	sn.index.mu.Unlock()
+	if !shared {
+		sn.markDead(old.SuperblockID, int64(old.Size))
+		sn.scrub.clearCorrupt(old.blob())
+	}
+
+	if ok {
+		atomic.AddInt64(&sn.readRepairs, 1)
+		if err := sn.deferIndexSave(sn.indexSaveDelay); err != nil {
+			log.Printf("Warning: failed to persist index after repairing chunk %s: %v", old.ChunkID, err)
+		}
+		log.Printf("Read repair of chunk %s: replaced the corrupt copy in superblock %d at offset %d with superblock %d at offset %d",
+			old.ChunkID, old.SuperblockID, old.Offset, repaired.SuperblockID, repaired.Offset)
+	}
+}
+
+// indexedAt reports whether the index still maps entry's chunk ID to the
+// same stored bytes
+func (sn *StorageNode) indexedAt(entry ChunkEntry) bool {
+	sn.index.mu.RLock()
+	defer sn.index.mu.RUnlock()
+	current, ok := sn.index.chunks[entry.ChunkID]
+	return ok && current.blob() == entry.blob()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// corruptStoredChunk flips the first byte of a chunk's data on disk
+func corruptStoredChunk(t *testing.T, sn *StorageNode, chunkID string) ChunkEntry {
+	t.Helper()
+	entry, _ := sn.lookupChunk(chunkID)
+	file, err := os.OpenFile(sn.getSuperblockPath(entry.SuperblockID), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open superblock: %v", err)
+	}
+	defer file.Close()
+	b := make([]byte, 1)
+	file.ReadAt(b, entry.Offset)
+	if _, err := file.WriteAt([]byte{b[0] ^ 0xff}, entry.Offset); err != nil {
+		t.Fatalf("Failed to corrupt chunk: %v", err)
+	}
+	sn.invalidateSuperblockChecksum(entry.SuperblockID)
+	return entry
+}
+
+func TestReadRepairFromPeer(t *testing.T) {
+	data := []byte("chunk a replica peer still has intact")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	peer, peerDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(peerDir)
+	if err := peer.storeChunk("repairable", data, checksum); err != nil {
+		t.Fatalf("Failed to store chunk on peer: %v", err)
+	}
+	server := httptest.NewServer(peer.newRouter())
+	defer server.Close()
+
+	t.Setenv("REPLICA_PEERS", server.URL)
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+	if err := sn.storeChunk("repairable", data, checksum); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	sn.index.mu.Lock()
+	entry := sn.index.chunks["repairable"]
+	entry.ContentType = "video/mp4"
+	sn.index.set(entry)
+	sn.index.mu.Unlock()
+	corrupted := corruptStoredChunk(t, sn, "repairable")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/repairable", nil))
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Fatalf("Expected the peer's copy to be served, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&sn.readRepairs) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the local copy to be repaired")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	repaired, _ := sn.lookupChunk("repairable")
+	if repaired.blob() == corrupted.blob() {
+		t.Fatal("Expected the repaired chunk to be stored afresh")
+	}
+	if repaired.ContentType != "video/mp4" || !repaired.StoredAt.Equal(corrupted.StoredAt) {
+		t.Errorf("Expected the repaired entry to keep its metadata, got %+v", repaired)
+	}
+	if _, got, err := sn.readVerifiedChunk(repaired); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected the local copy to verify after repair: %v", err)
+	}
+	if dead := sn.getDeadBytes(corrupted.SuperblockID); dead < int64(corrupted.Size) {
+		t.Errorf("Expected the corrupt bytes to be marked dead, got %d dead bytes", dead)
+	}
+}
+
+func TestReadRepairAuthenticatesToPeer(t *testing.T) {
+	data := []byte("chunk behind chunk access tokens")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	// Both nodes require chunk tokens signed with the shared secret
+	t.Setenv("CHUNK_TOKEN_SECRET", "shared")
+	peer, peerDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(peerDir)
+	if err := peer.storeChunk("guarded", data, checksum); err != nil {
+		t.Fatalf("Failed to store chunk on peer: %v", err)
+	}
+	server := httptest.NewServer(peer.newRouter())
+	defer server.Close()
+
+	t.Setenv("REPLICA_PEERS", server.URL)
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	if err := sn.storeChunk("guarded", data, checksum); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	corruptStoredChunk(t, sn, "guarded")
+
+	req := httptest.NewRequest("GET", "/chunk/guarded", nil)
+	req.Header.Set(ChunkTokenHeader, SignChunkToken([]byte("shared"), "GET", "guarded", time.Now().Add(time.Minute)))
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Fatalf("Expected the peer to serve its copy to an authenticated repair, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestReadRepairFailures(t *testing.T) {
+	data := []byte("chunk no peer has a valid copy of")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	var requests int64
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.Header.Get(ReplicaHeader) != "true" {
+			t.Errorf("Expected read repair GETs to be marked with %s", ReplicaHeader)
+		}
+		w.Write([]byte("a different chunk of the same size........"[:len(data)]))
+	}))
+	defer peer.Close()
+
+	t.Setenv("REPLICA_PEERS", peer.URL)
+	t.Run("bad copy", func(t *testing.T) {
+		sn, tempDir := setupTestStorageNode(t)
+		defer cleanupTestStorageNode(tempDir)
+		if err := sn.storeChunk("unrepairable", data, checksum); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+		corruptStoredChunk(t, sn, "unrepairable")
+
+		rr := httptest.NewRecorder()
+		sn.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/unrepairable", nil))
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("Expected 500 when the peer's copy doesn't verify, got %d", rr.Code)
+		}
+		if n := atomic.LoadInt64(&sn.readRepairFailures); n != 1 {
+			t.Errorf("Expected 1 read repair failure, got %d", n)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("READ_REPAIR", "false")
+		sn, tempDir := setupTestStorageNode(t)
+		defer cleanupTestStorageNode(tempDir)
+		if err := sn.storeChunk("unrepairable", data, checksum); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+		corruptStoredChunk(t, sn, "unrepairable")
+
+		before := atomic.LoadInt64(&requests)
+		rr := httptest.NewRecorder()
+		sn.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/unrepairable", nil))
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("Expected 500 with READ_REPAIR=false, got %d", rr.Code)
+		}
+		if atomic.LoadInt64(&requests) != before {
+			t.Error("Expected no peer to be asked with READ_REPAIR=false")
+		}
+	})
+
+	t.Run("slow peer", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer slow.Close()
+		t.Setenv("REPLICA_PEERS", slow.URL)
+		t.Setenv("READ_REPAIR_TIMEOUT", "50ms")
+		sn, tempDir := setupTestStorageNode(t)
+		defer cleanupTestStorageNode(tempDir)
+		if err := sn.storeChunk("unrepairable", data, checksum); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+		corruptStoredChunk(t, sn, "unrepairable")
+
+		start := time.Now()
+		rr := httptest.NewRecorder()
+		sn.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/unrepairable", nil))
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("Expected 500 when the peer times out, got %d", rr.Code)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected READ_REPAIR_TIMEOUT to bound the fallback, took %v", elapsed)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// errCorruptIndex means the index file exists but couldn't be decoded
+var errCorruptIndex = errors.New("index file is corrupt")
+
+// RebuildIndex reconstructs the index by scanning the chunk frames of every
+// superblock, for when the index file was lost or damaged. Where a chunk ID
+// was written more than once, e.g. by relocation, the most recently written
+// copy wins. Payloads failing their frame checksum are skipped.
+//
+// Only what the frames record is recovered: TTLs, content types, metadata
+// and stored-by are lost, and chunks deleted since their superblock was last
+// compacted come back. Deduplicated chunks, which have no frames, are
+// recovered from the dedup link log. Legacy superblocks have no frames and
+// are skipped.
+func (sn *StorageNode) RebuildIndex() error {
+	ids, err := sn.listSuperblocks()
+	if err != nil {
+		return err
+	}
+	if sn.fastTierDir != "" {
+		ids = append(ids, sn.fastTierSuperblocks()...)
+	}
+
+	sn.beginRebuild(len(ids))
+	defer sn.finishRebuild()
+
+	chunks := make(map[string]ChunkEntry)
+	for _, id := range ids {
+		found, err := sn.scanSuperblock(id, chunks)
+		if err != nil {
+			log.Printf("Warning: index rebuild: superblock %d: %v", id, err)
+		}
+		sn.advanceRebuild(found)
+	}
+	if restored := sn.restoreDedupLinks(chunks); restored > 0 {
+		log.Printf("Index rebuild: restored %d deduplicated chunks", restored)
+	}
+
+	sn.index.mu.Lock()
+	sn.index.replace(chunks)
+	sn.index.gen++
+	sn.index.mu.Unlock()
+
+	if err := sn.saveIndex(); err != nil {
+		return fmt.Errorf("rebuilt index of %d chunks but failed to persist it: %w", len(chunks), err)
+	}
+	return nil
+}
+
+// scanSuperblock adds the intact chunks framed in superblock id to chunks,
+// returning how many weren't already there. The scan stops at the first unreadable frame,
+// which is normally a torn append at the end of the file.
+func (sn *StorageNode) scanSuperblock(id int, chunks map[string]ChunkEntry) (int, error) {
+	file, err := os.Open(sn.getSuperblockPath(id))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if _, err := readHeaderFrom(file); err != nil {
+		if errors.Is(err, errNoSuperblockHeader) {
+			return 0, fmt.Errorf("legacy superblock has no chunk frames to scan")
+		}
+		log.Printf("Warning: index rebuild: superblock %d: %v; scanning anyway", id, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	found := 0
+	for off := int64(SuperblockHeaderSize); off < info.Size(); {
+		frame, err := readFrameAt(file, off)
+		if err != nil {
+			return found, err
+		}
+		payload := off + frameSize(frame.ChunkID)
+		if payload+int64(frame.Size) > info.Size() {
+			return found, fmt.Errorf("chunk %s at offset %d runs past the end of the file", frame.ChunkID, payload)
+		}
+		off = payload + int64(frame.Size)
+
+		hash, err := newChecksumHash(frame.ChecksumAlgo)
+		if err != nil {
+			return found, err
+		}
+		var data io.Reader = io.NewSectionReader(file, payload, int64(frame.Size))
+		var rawSize int32
+		if frame.Compression != "" || frame.Encrypted {
+			// Checksums are of the decoded data
+			stored, err := io.ReadAll(data)
+			if err != nil {
+				return found, fmt.Errorf("failed to read chunk %s: %w", frame.ChunkID, err)
+			}
+			raw, err := sn.decodeChunk(frame.Compression, frame.Encrypted, stored)
+			if errors.Is(err, errNoEncryptionKey) {
+				return found, fmt.Errorf("chunk %s: %w", frame.ChunkID, err)
+			}
+			if err != nil {
+				log.Printf("Warning: index rebuild: skipping corrupt chunk %s in superblock %d at offset %d: %v", frame.ChunkID, id, payload, err)
+				continue
+			}
+			data, rawSize = bytes.NewReader(raw), int32(len(raw))
+		}
+		if _, err := io.Copy(hash, data); err != nil {
+			return found, fmt.Errorf("failed to read chunk %s: %w", frame.ChunkID, err)
+		}
+		if sum := fmt.Sprintf("%x", hash.Sum(nil)); sum != frame.Checksum {
+			log.Printf("Warning: index rebuild: skipping corrupt chunk %s in superblock %d at offset %d", frame.ChunkID, id, payload)
+			continue
+		}
+
+		existing, seen := chunks[frame.ChunkID]
+		if seen && existing.StoredAt.After(frame.WrittenAt) {
+			continue
+		}
+		chunks[frame.ChunkID] = ChunkEntry{
+			ChunkID:      frame.ChunkID,
+			SuperblockID: id,
+			Offset:       payload,
+			Size:         frame.Size,
+			Checksum:     frame.Checksum,
+			ChecksumAlgo: frame.ChecksumAlgo,
+			StoredAt:     frame.WrittenAt,
+			Compression:  frame.Compression,
+			Encrypted:    frame.Encrypted,
+			RawSize:      rawSize,
+		}
+		if !seen {
+			found++
+		}
+	}
+	return found, nil
+}
+
+// hasSuperblockData reports whether any superblock holds chunks, i.e. a
+// missing index means lost data rather than a new node
+func (sn *StorageNode) hasSuperblockData() bool {
+	ids, _ := sn.listSuperblocks()
+	if sn.fastTierDir != "" {
+		ids = append(ids, sn.fastTierSuperblocks()...)
+	}
+	for _, id := range ids {
+		if size, err := sn.getSuperblockSize(id); err == nil && size > SuperblockHeaderSize {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// restartWithIndex shuts sn down, lets damage act on the index file and
+// starts a new node on the same data directory
+func restartWithIndex(t *testing.T, sn *StorageNode, tempDir string, damage func(path string)) *StorageNode {
+	t.Helper()
+	sn.Shutdown()
+	damage(sn.indexFile)
+
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage node: %v", err)
+	}
+	return sn2
+}
+
+func TestRebuildIndexFromCorruptIndex(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	stored := make(map[string][]byte)
+	for i := 0; i < 5; i++ {
+		chunkID := fmt.Sprintf("rebuild-%d", i)
+		data := []byte(fmt.Sprintf("rebuild chunk data %d", i))
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+		stored[chunkID] = data
+	}
+	streamed := bytes.Repeat([]byte("streamed "), 100)
+	if _, err := sn.storeChunkStream("rebuild-streamed", bytes.NewReader(streamed), int64(len(streamed))); err != nil {
+		t.Fatalf("Failed to stream chunk: %v", err)
+	}
+	stored["rebuild-streamed"] = streamed
+
+	// The relocated copy is the one that must be found
+	sn.mu.Lock()
+	sn.currentSuperblock++
+	target := sn.currentSuperblock
+	sn.mu.Unlock()
+	if _, _, err := sn.relocateChunk("rebuild-1", target); err != nil {
+		t.Fatalf("Failed to relocate chunk: %v", err)
+	}
+
+	// A deleted chunk whose bytes are still in place comes back
+	sn.deleteChunk("rebuild-0")
+
+	// A chunk whose payload rotted is not indexed
+	rotten, _ := sn.lookupChunk("rebuild-2")
+	file, err := os.OpenFile(sn.getSuperblockPath(rotten.SuperblockID), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open superblock: %v", err)
+	}
+	if _, err := file.WriteAt([]byte{'X'}, rotten.Offset); err != nil {
+		t.Fatalf("Failed to corrupt chunk: %v", err)
+	}
+	file.Close()
+	delete(stored, "rebuild-2")
+
+	sn2 := restartWithIndex(t, sn, tempDir, func(path string) {
+		os.WriteFile(path, []byte(`{"rebuild-0": {"chunk_id"`), 0644)
+	})
+
+	for chunkID, data := range stored {
+		entry, ok := sn2.lookupChunk(chunkID)
+		if !ok {
+			t.Errorf("Expected %s to be recovered", chunkID)
+			continue
+		}
+		if _, got, err := sn2.readVerifiedChunk(entry); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Recovered chunk %s unreadable: %v", chunkID, err)
+		}
+	}
+	if entry, _ := sn2.lookupChunk("rebuild-1"); entry.SuperblockID != target {
+		t.Errorf("Expected relocated chunk in superblock %d, got %d", target, entry.SuperblockID)
+	}
+	if _, ok := sn2.lookupChunk("rebuild-2"); ok {
+		t.Error("Expected the corrupt chunk to be left out of the index")
+	}
+
+	status := sn2.rebuildStatus()
+	if status == nil || status.State != RebuildStateCompleted || status.ChunksFound != int64(len(stored)) {
+		t.Errorf("Unexpected rebuild status %+v, want %d chunks found", status, len(stored))
+	}
+	if !sn2.isReady() {
+		t.Error("Expected node to be ready after the rebuild")
+	}
+
+	// The rebuilt index was persisted
+	sn3 := NewStorageNode(tempDir, "test-node")
+	if err := sn3.loadIndex(); err != nil {
+		t.Fatalf("Failed to load rebuilt index: %v", err)
+	}
+	if n := len(sn3.index.chunks); n != len(stored) {
+		t.Errorf("Expected %d chunks in the persisted index, got %d", len(stored), n)
+	}
+}
+
+func TestRebuildIndexWhenIndexMissing(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := []byte("survives a lost index")
+	if err := sn.storeChunk("lost-index", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+
+	sn2 := restartWithIndex(t, sn, tempDir, func(path string) { os.Remove(path) })
+
+	entry, ok := sn2.lookupChunk("lost-index")
+	if !ok {
+		t.Fatal("Expected chunk to be recovered from its superblock")
+	}
+	if got, err := sn2.readChunk(entry); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected to read back %q, got %q (%v)", data, got, err)
+	}
+}
+
+func TestNewNodeSkipsRebuild(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	if status := sn.rebuildStatus(); status != nil {
+		t.Errorf("Expected no rebuild for an empty data directory, got %+v", status)
+	}
+}
+
+func TestCompactionFramesLegacyChunks(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	// A legacy superblock: unframed data from offset 0
+	data := []byte("chunk from a legacy superblock")
+	if err := os.WriteFile(sn.getSuperblockPath(0), data, 0644); err != nil {
+		t.Fatalf("Failed to write legacy superblock: %v", err)
+	}
+	sn.index.mu.Lock()
+	sn.index.set(ChunkEntry{ChunkID: "legacy-chunk", SuperblockID: 0, Size: int32(len(data)), Checksum: fmt.Sprintf("%x", sha256.Sum256(data))})
+	sn.index.mu.Unlock()
+	sn.mu.Lock()
+	sn.currentSuperblock = 1
+	sn.mu.Unlock()
+
+	if _, err := sn.CompactSuperblock(0); err != nil {
+		t.Fatalf("Failed to compact legacy superblock: %v", err)
+	}
+
+	chunks := make(map[string]ChunkEntry)
+	if n, err := sn.scanSuperblock(0, chunks); err != nil || n != 1 {
+		t.Fatalf("Expected one framed chunk after compaction, got %d (%v)", n, err)
+	}
+	if entry, _ := sn.lookupChunk("legacy-chunk"); chunks["legacy-chunk"].Offset != entry.Offset {
+		t.Errorf("Expected scanned offset %d to match the index, got %d", entry.Offset, chunks["legacy-chunk"].Offset)
+	}
+}
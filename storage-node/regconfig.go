@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Bounds on coordinator-assigned settings; values outside them are ignored
+const (
+	MinAssignedHeartbeatInterval = time.Second
+	MaxAssignedHeartbeatInterval = 10 * time.Minute
+	MinAssignedSuperblockSizeMB  = 1
+	MaxAssignedSuperblockSizeMB  = 64 * 1024
+)
+
+// RegistrationResponse is the optional configuration a coordinator may return
+// from registration. Every field is optional and unknown fields are ignored.
+type RegistrationResponse struct {
+	HeartbeatIntervalSeconds *int   `json:"heartbeat_interval_seconds,omitempty"`
+	MaxSuperblockSizeMB      *int64 `json:"max_superblock_size_mb,omitempty"`
+	ClusterEpoch             *int64 `json:"cluster_epoch,omitempty"`
+}
+
+// heartbeatEvery returns the current heartbeat interval
+func (sn *StorageNode) heartbeatEvery() time.Duration {
+	sn.runtimeMu.RLock()
+	defer sn.runtimeMu.RUnlock()
+	return sn.heartbeatInterval
+}
+
+// applyRegistrationConfig adopts the runtime-adjustable settings from a
+// registration response. Settings that would be unsafe — out of bounds, or a
+// superblock too small for the configured max chunk size — are logged and
+// skipped rather than failing registration.
+func (sn *StorageNode) applyRegistrationConfig(cfg RegistrationResponse) {
+	if cfg.HeartbeatIntervalSeconds != nil {
+		interval := time.Duration(*cfg.HeartbeatIntervalSeconds) * time.Second
+		if interval < MinAssignedHeartbeatInterval || interval > MaxAssignedHeartbeatInterval {
+			log.Printf("Warning: ignoring assigned heartbeat interval %v (must be %v-%v)",
+				interval, MinAssignedHeartbeatInterval, MaxAssignedHeartbeatInterval)
+		} else {
+			sn.runtimeMu.Lock()
+			sn.heartbeatInterval = interval
+			sn.runtimeMu.Unlock()
+			log.Printf("Using coordinator-assigned heartbeat interval %v", interval)
+		}
+	}
+
+	if cfg.MaxSuperblockSizeMB != nil {
+		sizeMB := *cfg.MaxSuperblockSizeMB
+		size := sizeMB * 1024 * 1024
+		switch {
+		case sizeMB < MinAssignedSuperblockSizeMB || sizeMB > MaxAssignedSuperblockSizeMB:
+			log.Printf("Warning: ignoring assigned superblock size %d MB (must be %d-%d MB)",
+				sizeMB, MinAssignedSuperblockSizeMB, MaxAssignedSuperblockSizeMB)
+		case size < sn.maxChunkSize:
+			log.Printf("Warning: ignoring assigned superblock size %d MB, smaller than the max chunk size", sizeMB)
+		default:
+			// Only affects superblocks from here on; full ones stay as they are
+			sn.mu.Lock()
+			sn.maxSuperblockSize = size
+			sn.mu.Unlock()
+			log.Printf("Using coordinator-assigned superblock size %d MB", sizeMB)
+		}
+	}
+
+	if cfg.ClusterEpoch != nil {
+		atomic.StoreInt64(&sn.clusterEpoch, *cfg.ClusterEpoch)
+		log.Printf("Joined cluster epoch %d", *cfg.ClusterEpoch)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistrationAdoptsAssignedConfig(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	var beat HeartbeatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nodes/register" {
+			json.NewDecoder(r.Body).Decode(&beat)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"status": "registered",
+			"node_id": "test-node",
+			"shard_range": [0, 128],
+			"heartbeat_interval_seconds": 7,
+			"max_superblock_size_mb": 64,
+			"cluster_epoch": 42
+		}`))
+	}))
+	defer server.Close()
+
+	if err := sn.registerNode(context.Background(), server.URL, "http://node:8081"); err != nil {
+		t.Fatalf("Registration failed: %v", err)
+	}
+
+	if got := sn.heartbeatEvery(); got != 7*time.Second {
+		t.Errorf("Expected assigned heartbeat interval 7s, got %v", got)
+	}
+	if sn.maxSuperblockSize != 64*1024*1024 {
+		t.Errorf("Expected assigned superblock size 64MB, got %d", sn.maxSuperblockSize)
+	}
+
+	if err := sn.sendHeartbeat(context.Background(), server.URL); err != nil {
+		t.Fatalf("Heartbeat failed: %v", err)
+	}
+	if beat.ClusterEpoch != 42 {
+		t.Errorf("Expected heartbeat to echo cluster epoch 42, got %d", beat.ClusterEpoch)
+	}
+}
+
+func TestRegistrationIgnoresUnsafeConfig(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	interval, superblockSize := sn.heartbeatEvery(), sn.maxSuperblockSize
+
+	for _, body := range []string{
+		`{"heartbeat_interval_seconds": 0, "max_superblock_size_mb": 1}`,
+		`{"heartbeat_interval_seconds": "soon"}`,
+		`not json`,
+		``,
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		if err := sn.registerNode(context.Background(), server.URL, "http://node:8081"); err != nil {
+			t.Errorf("Expected registration to succeed with body %q, got %v", body, err)
+		}
+		server.Close()
+	}
+
+	// A 1MB superblock can't hold the default max chunk size, so it's rejected
+	if sn.heartbeatEvery() != interval || sn.maxSuperblockSize != superblockSize {
+		t.Errorf("Expected unsafe settings to be ignored, got interval %v, superblock size %d",
+			sn.heartbeatEvery(), sn.maxSuperblockSize)
+	}
+}
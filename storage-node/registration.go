@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DefaultRegistrationInitialDelay is how long to wait after the HTTP server
+// starts listening before the first registration attempt (see
+// REGISTRATION_INITIAL_DELAY). The node is reachable once listening, so
+// there's nothing to wait for by default.
+const DefaultRegistrationInitialDelay = 0
+
+// registerWhenReady waits for listening to close, then for the configured
+// initial delay, and registers with the metadata service, retrying until it
+// succeeds or ctx is done. It reports whether registration succeeded.
+func (sn *StorageNode) registerWhenReady(ctx context.Context, listening <-chan struct{}, metadataURL, nodeURL string) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-listening:
+	}
+
+	if sn.registrationDelay > 0 {
+		timer := time.NewTimer(sn.registrationDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+
+	// Create context with timeout for registration
+	regCtx, regCancel := context.WithTimeout(ctx, RegistrationTimeout)
+	defer regCancel()
+
+	for i := 0; i < MaxRegistrationRetries; i++ {
+		err := sn.registerNode(regCtx, metadataURL, nodeURL)
+		if err == nil {
+			log.Printf("Successfully registered node %s with metadata service at %s", sn.nodeID, metadataURL)
+			return true
+		}
+		log.Printf("Failed to register (attempt %d/%d): %v", i+1, MaxRegistrationRetries, err)
+		select {
+		case <-regCtx.Done():
+			log.Println("Registration timeout, continuing without registration")
+			return false
+		case <-time.After(jitter(RetryInterval, HeartbeatJitterFraction)):
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistrationStartsWhenServerListens(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	registered := make(chan time.Time, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registered <- time.Now()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	listening := make(chan struct{})
+	done := make(chan bool, 1)
+	go func() {
+		done <- sn.registerWhenReady(context.Background(), listening, server.URL, "http://node:8081")
+	}()
+
+	select {
+	case <-registered:
+		t.Fatal("Expected registration to wait until the server is listening")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ready := time.Now()
+	close(listening)
+	select {
+	case at := <-registered:
+		if delay := at.Sub(ready); delay > 500*time.Millisecond {
+			t.Errorf("Expected prompt registration after the server was ready, took %v", delay)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Registration never happened")
+	}
+	if !<-done {
+		t.Error("Expected registration to report success")
+	}
+}
+
+func TestRegistrationDelayIsCancelable(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.registrationDelay = time.Hour
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no registration attempt during the initial delay")
+	}))
+	defer server.Close()
+
+	listening := make(chan struct{})
+	close(listening)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool, 1)
+	go func() {
+		done <- sn.registerWhenReady(ctx, listening, server.URL, "http://node:8081")
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("Expected canceled registration to report failure")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected shutdown to cancel the initial registration delay")
+	}
+}
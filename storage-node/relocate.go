@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	errChunkNotFound  = errors.New(ErrChunkNotFound)
+	errInvalidTarget  = errors.New("target superblock does not exist")
+	errSameSuperblock = errors.New("chunk already lives in target superblock")
+	errTargetFull     = errors.New("target superblock has no room for chunk")
+	errChunkChanged   = errors.New("chunk changed during relocation")
+)
+
+// RelocateResponse represents the result of relocating a chunk
+type RelocateResponse struct {
+	ChunkID        string `json:"chunk_id"`
+	FromSuperblock int    `json:"from_superblock"`
+	ToSuperblock   int    `json:"to_superblock"`
+	Offset         int64  `json:"offset"`
+}
+
+// relocateChunk copies a chunk's bytes into the target superblock, atomically
+// repoints its index entry there and marks the old bytes dead once no
+// deduplicated chunk shares them.
+func (sn *StorageNode) relocateChunk(chunkID string, target int) (ChunkEntry, ChunkEntry, error) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	sn.index.mu.RLock()
+	old, exists := sn.index.chunks[chunkID]
+	sn.index.mu.RUnlock()
+	if !exists {
+		return ChunkEntry{}, ChunkEntry{}, errChunkNotFound
+	}
+
+	if target == old.SuperblockID {
+		return old, old, errSameSuperblock
+	}
+	info, err := os.Stat(sn.getSuperblockPath(target))
+	if err != nil && !(os.IsNotExist(err) && target == sn.currentSuperblock) {
+		return old, old, fmt.Errorf("%w: %d", errInvalidTarget, target)
+	}
+	targetSize := int64(SuperblockHeaderSize) // Written with the first chunk
+	if info != nil && info.Size() > 0 {
+		targetSize = info.Size()
+	}
+	if targetSize+frameSize(chunkID)+int64(old.Size) > sn.maxSuperblockSize {
+		return old, old, fmt.Errorf("%w: superblock %d is %d bytes", errTargetFull, target, targetSize)
+	}
+
+	// Never propagate corrupt data
+	stored, err := sn.readStoredChunk(old)
+	if err != nil {
+		return old, old, fmt.Errorf("failed to read chunk: %w", err)
+	}
+	pw := &pendingWrite{chunkID: chunkID, data: stored, checksum: old.Checksum, checksumAlgo: old.checksumAlgorithm()}
+	if old.encoded() {
+		// Moved as stored, without compressing or encrypting again
+		pw.compression, pw.encrypted, pw.stored = old.Compression, old.Encrypted, stored
+		if pw.data, err = sn.decodeChunk(old.Compression, old.Encrypted, stored); err != nil {
+			return old, old, fmt.Errorf("refusing to relocate chunk %s: %w", chunkID, err)
+		}
+	}
+	if sum, err := computeChecksum(old.checksumAlgorithm(), pw.data); err != nil || sum != old.Checksum {
+		return old, old, fmt.Errorf("refusing to relocate chunk %s: checksum verification failed", chunkID)
+	}
+
+	written, err := sn.writeToSuperblock(target, []*pendingWrite{pw})
+	if err != nil {
+		return old, old, err
+	}
+
+	// Swap the entry only if nobody replaced or deleted it meanwhile. Only
+	// its location changes, so metadata patched during the copy is kept.
+	sn.index.mu.Lock()
+	current, ok := sn.index.chunks[chunkID]
+	if !ok || current.SuperblockID != old.SuperblockID || current.Offset != old.Offset {
+		sn.index.mu.Unlock()
+		sn.markDead(target, sn.footprint(written[0]))
+		return old, old, errChunkChanged
+	}
+	moved := current
+	moved.SuperblockID = target
+	moved.Offset = written[0].Offset
+	moved.Size = written[0].Size
+	moved.Deduplicated = false // Framed under its own ID now
+	sn.index.set(moved)
+	shared := sn.index.referenced(old)
+	sn.index.mu.Unlock()
+
+	if !shared {
+		sn.markDead(old.SuperblockID, sn.footprint(old))
+	}
+
+	if err := sn.saveIndex(); err != nil {
+		log.Printf("Warning: failed to persist index after relocating chunk %s: %v", chunkID, err)
+	}
+
+	return old, moved, nil
+}
+
+// footprint returns the bytes a chunk's copy takes up in its superblock,
+// counting its frame unless the superblock predates framing. A deduplicated
+// chunk's frame belongs to the chunk it shares bytes with.
+func (sn *StorageNode) footprint(entry ChunkEntry) int64 {
+	size := int64(entry.Size)
+	if entry.Deduplicated {
+		return size
+	}
+	if hdr, err := sn.readSuperblockHeader(entry.SuperblockID); err == nil && hdr.Version >= SuperblockVersion {
+		size += frameSize(entry.ChunkID)
+	}
+	return size
+}
+
+func (sn *StorageNode) handleRelocateChunk(w http.ResponseWriter, r *http.Request) {
+	chunkID := mux.Vars(r)["chunk_id"]
+	if err := sn.validateChunkID(chunkID); err != nil {
+		writeChunkIDError(w, err)
+		return
+	}
+
+	sn.mu.Lock()
+	target := sn.currentSuperblock
+	sn.mu.Unlock()
+	if param := r.URL.Query().Get("superblock"); param != "" {
+		id, err := strconv.Atoi(param)
+		if err != nil || id < 0 {
+			http.Error(w, "Invalid superblock parameter", http.StatusBadRequest)
+			return
+		}
+		target = id
+	}
+
+	old, moved, err := sn.relocateChunk(chunkID, target)
+	switch {
+	case err == nil:
+	case errors.Is(err, errChunkNotFound):
+		http.Error(w, ErrChunkNotFound, http.StatusNotFound)
+		return
+	case errors.Is(err, errInvalidTarget), errors.Is(err, errSameSuperblock):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, errTargetFull), errors.Is(err, errChunkChanged):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		log.Printf("Failed to relocate chunk %s: %v", chunkID, err)
+		http.Error(w, "Failed to relocate chunk", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Relocated chunk %s from superblock %d to %d", chunkID, old.SuperblockID, moved.SuperblockID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(RelocateResponse{
+		ChunkID:        chunkID,
+		FromSuperblock: old.SuperblockID,
+		ToSuperblock:   moved.SuperblockID,
+		Offset:         moved.Offset,
+	}); err != nil {
+		log.Printf("Failed to encode relocate response: %v", err)
+	}
+}
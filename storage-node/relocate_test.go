@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRelocateChunk(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.maxSuperblockSize = 1024
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+	r.HandleFunc("/admin/chunk/{chunk_id}/relocate", sn.handleRelocateChunk).Methods("POST")
+
+	// Fill superblock 0, then rotate into superblock 1
+	data := bytes.Repeat([]byte("r"), 400)
+	for _, chunkID := range []string{"reloc-a", "reloc-b", "reloc-c"} {
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+	}
+
+	sn.index.mu.RLock()
+	before := sn.index.chunks["reloc-a"]
+	sn.index.mu.RUnlock()
+	if before.SuperblockID != 0 || sn.currentSuperblock != 1 {
+		t.Fatalf("Unexpected layout: reloc-a in %d, active %d", before.SuperblockID, sn.currentSuperblock)
+	}
+
+	t.Run("relocate_to_active", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/admin/chunk/reloc-a/relocate", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var resp RelocateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode relocate response: %v", err)
+		}
+		if resp.FromSuperblock != 0 || resp.ToSuperblock != 1 {
+			t.Errorf("Unexpected relocation %+v", resp)
+		}
+
+		getReq := httptest.NewRequest("GET", "/chunk/reloc-a", nil)
+		getW := httptest.NewRecorder()
+		r.ServeHTTP(getW, getReq)
+
+		if getW.Code != http.StatusOK || !bytes.Equal(getW.Body.Bytes(), data) {
+			t.Fatalf("Failed to read relocated chunk: %d", getW.Code)
+		}
+		if got := getW.Header().Get("X-Superblock-ID"); got != "1" {
+			t.Errorf("Expected chunk to be served from superblock 1, got %s", got)
+		}
+
+		// The old copy's frame is dead along with its data
+		if dead, want := sn.getDeadBytes(0), int64(len(data))+frameSize("reloc-a"); dead != want {
+			t.Errorf("Expected %d dead bytes in superblock 0, got %d", want, dead)
+		}
+	})
+
+	t.Run("full_target_rejected", func(t *testing.T) {
+		// Superblock 0 still holds the dead bytes of reloc-a
+		req := httptest.NewRequest("POST", "/admin/chunk/reloc-c/relocate?superblock=0", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+		}
+	})
+
+	t.Run("relocate_to_explicit_superblock", func(t *testing.T) {
+		sn.maxSuperblockSize = 4096
+
+		req := httptest.NewRequest("POST", "/admin/chunk/reloc-c/relocate?superblock=0", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		sn.index.mu.RLock()
+		entry := sn.index.chunks["reloc-c"]
+		sn.index.mu.RUnlock()
+		if entry.SuperblockID != 0 {
+			t.Errorf("Expected reloc-c in superblock 0, got %d", entry.SuperblockID)
+		}
+	})
+
+	t.Run("nonexistent_target_rejected", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/admin/chunk/reloc-b/relocate?superblock=42", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("same_superblock_rejected", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/admin/chunk/reloc-b/relocate?superblock=0", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		// reloc-b already lives in superblock 0
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for same-superblock relocation, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("missing_chunk_returns_404", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/admin/chunk/no-such-chunk/relocate", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestRelocateKeepsConcurrentMetaPatch(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.maxSuperblockSize = 1024
+
+	data := bytes.Repeat([]byte("m"), 400)
+	for _, chunkID := range []string{"patched", "filler-a", "filler-b"} {
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+	}
+
+	// A PATCH lands while the chunk's bytes are being copied
+	writeChunkData = func(file *os.File, buf []byte) (int, error) {
+		sn.index.mu.Lock()
+		entry := sn.index.chunks["patched"]
+		entry.Meta = map[string]string{"codec": "av1"}
+		sn.index.set(entry)
+		sn.index.mu.Unlock()
+		return file.Write(buf)
+	}
+	defer func() {
+		writeChunkData = func(file *os.File, buf []byte) (int, error) { return file.Write(buf) }
+	}()
+
+	if _, _, err := sn.relocateChunk("patched", sn.currentSuperblock); err != nil {
+		t.Fatalf("Failed to relocate chunk: %v", err)
+	}
+	entry, _ := sn.lookupChunk("patched")
+	if entry.SuperblockID != sn.currentSuperblock || entry.Meta["codec"] != "av1" {
+		t.Errorf("Expected the relocated entry to keep the patched metadata, got %+v", entry)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Read-repair copies (see serveAndReplicate)
+const (
+	ReplicateToHeader    = "X-Replicate-To"
+	ReplicaStatusTrailer = "X-Replica-Status"
+	ReplicaCopyTimeout   = 30 * time.Second
+)
+
+// replicationTarget returns the replica a GET asks the chunk to be copied
+// to, or "" for an ordinary read. Copying makes the node PUT to an address
+// chosen by the caller, so it is reserved for holders of ADMIN_TOKEN. It
+// writes the error response and returns false for a rejected request.
+func (sn *StorageNode) replicationTarget(w http.ResponseWriter, r *http.Request) (string, bool) {
+	target := r.Header.Get(ReplicateToHeader)
+	if target == "" {
+		return "", true
+	}
+	if !sn.authorizeAdmin(w, r) {
+		return "", false
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, ReplicateToHeader+" must be an http(s) base URL", http.StatusBadRequest)
+		return "", false
+	}
+	return strings.TrimSuffix(target, "/"), true
+}
+
+// startReplicaCopy PUTs a chunk held in memory to a replica in the
+// background, returning a channel that receives the outcome
+func (sn *StorageNode) startReplicaCopy(entry ChunkEntry, data []byte, replicaURL string) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), ReplicaCopyTimeout)
+		defer cancel()
+		done <- func() error {
+			req, err := http.NewRequestWithContext(ctx, "PUT", replicaURL+"/chunk/"+entry.ChunkID, bytes.NewReader(data))
+			if err != nil {
+				return fmt.Errorf("failed to create replica request: %w", err)
+			}
+			setReplicaHeaders(req, entry)
+			sn.authorizePeerRequest(req, entry.ChunkID)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return fmt.Errorf("replica request failed: %w", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("replica returned status %d", resp.StatusCode)
+			}
+			return nil
+		}()
+	}()
+	return done
+}
+
+// setReplicaHeaders describes a chunk on a PUT of it to another node, so
+// the copy is verified and keeps the original's attribution, TTL and metadata
+func setReplicaHeaders(req *http.Request, entry ChunkEntry) {
+	req.ContentLength = int64(entry.logicalSize())
+	req.Header.Set("X-Chunk-Checksum", entry.Checksum)
+	req.Header.Set("X-Chunk-Checksum-Algo", entry.checksumAlgorithm())
+	if entry.StoredBy != "" {
+		req.Header.Set("X-Stored-By", entry.StoredBy)
+	}
+	if entry.ExpiresAt != nil && !entry.Pinned {
+		if ttl := int64(time.Until(*entry.ExpiresAt).Seconds()); ttl > 0 {
+			req.Header.Set("X-Chunk-TTL", strconv.FormatInt(ttl, 10))
+		}
+	}
+	for key, value := range entry.Meta {
+		req.Header.Set(UserMetaHeaderPrefix+key, value)
+	}
+}
+
+// serveAndReplicate serves a whole chunk while copying it to a replica, so
+// read-repair and proactive replication read the chunk only once. The
+// client is served from memory while the replica copy runs in the
+// background, so a slow replica never slows the response body, and a client
+// going away doesn't stop the copy. Once the body is sent the response waits
+// for the copy, at most ReplicaCopyTimeout, to report its outcome in the
+// X-Replica-Status trailer ("ok" or the error); it is also counted in
+// metrics. Compression, Range and conditional headers don't apply, since
+// the replica needs the stored bytes.
+func (sn *StorageNode) serveAndReplicate(w http.ResponseWriter, entry ChunkEntry, replicaURL string) {
+	chunkID := entry.ChunkID
+	entry, data, err := sn.fetchChunk(entry)
+	if err != nil {
+		writeReadError(w, chunkID, err)
+		return
+	}
+
+	replica := sn.startReplicaCopy(entry, data, replicaURL)
+
+	w.Header().Set("Trailer", ReplicaStatusTrailer)
+	w.Header().Set("Content-Type", entry.contentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("ETag", entry.Checksum)
+	setSizeHeaders(w, entry)
+	w.Header().Set("X-Superblock-ID", strconv.Itoa(entry.SuperblockID))
+	sn.setCacheHeaders(w, entry)
+	setUserMetaHeaders(w, entry)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Failed to write response for chunk %s, finishing replica copy: %v", chunkID, err)
+	} else if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	if err := <-replica; err != nil {
+		atomic.AddInt64(&sn.replicaCopyFailures, 1)
+		log.Printf("Failed to copy chunk %s to replica %s: %v", chunkID, replicaURL, err)
+		w.Header().Set(ReplicaStatusTrailer, err.Error())
+		return
+	}
+	atomic.AddInt64(&sn.replicaCopies, 1)
+	log.Printf("Copied chunk %s to replica %s", chunkID, replicaURL)
+	w.Header().Set(ReplicaStatusTrailer, "ok")
+}
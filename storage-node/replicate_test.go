@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServeAndReplicate(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.adminToken = "secret"
+	router := sn.newRouter()
+
+	replica, replicaDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(replicaDir)
+	replicaServer := httptest.NewServer(replica.newRouter())
+	defer replicaServer.Close()
+
+	data := bytes.Repeat([]byte("repair me "), 20000)
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+	if err := sn.storeChunk("repaired", data, checksum); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+
+	get := func(target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/chunk/repaired", nil)
+		req.Header.Set(ReplicateToHeader, target)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("client_and_replica_get_chunk", func(t *testing.T) {
+		rr := get(replicaServer.URL, "secret")
+		if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), data) {
+			t.Fatalf("Expected the chunk, got %d with %d bytes", rr.Code, rr.Body.Len())
+		}
+		if status := rr.Result().Trailer.Get(ReplicaStatusTrailer); status != "ok" {
+			t.Errorf("Expected replica status ok, got %q", status)
+		}
+
+		entry, ok := replica.lookupChunk("repaired")
+		if !ok || entry.Checksum != checksum {
+			t.Fatalf("Expected replica to hold the chunk with checksum %s, got %+v", checksum, entry)
+		}
+		_, copied, err := replica.readVerifiedChunk(entry)
+		if err != nil || !bytes.Equal(copied, data) {
+			t.Errorf("Expected replica copy to match, got error %v", err)
+		}
+	})
+
+	t.Run("replica_failure_spares_client", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "disk full", http.StatusInsufficientStorage)
+		}))
+		defer failing.Close()
+
+		before := atomic.LoadInt64(&sn.replicaCopyFailures)
+		rr := get(failing.URL, "secret")
+		if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), data) {
+			t.Fatalf("Expected the chunk despite the failed replica, got %d with %d bytes", rr.Code, rr.Body.Len())
+		}
+		if status := rr.Result().Trailer.Get(ReplicaStatusTrailer); status == "" || status == "ok" {
+			t.Errorf("Expected a replica failure status, got %q", status)
+		}
+		if atomic.LoadInt64(&sn.replicaCopyFailures) != before+1 {
+			t.Error("Expected the replica copy failure to be counted")
+		}
+	})
+
+	t.Run("slow_replica_does_not_hold_body", func(t *testing.T) {
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer slow.Close()
+		node := httptest.NewServer(router)
+		defer node.Close()
+
+		req, _ := http.NewRequest("GET", node.URL+"/chunk/repaired", nil)
+		req.Header.Set(ReplicateToHeader, slow.URL)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		// The whole body arrives while the replica is still stalled
+		got := make([]byte, len(data))
+		read := make(chan error, 1)
+		go func() {
+			_, err := io.ReadFull(resp.Body, got)
+			read <- err
+		}()
+		select {
+		case err := <-read:
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("Expected the chunk, got error %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Response body held back by a stalled replica")
+		}
+		close(release)
+	})
+
+	t.Run("requires_admin_token", func(t *testing.T) {
+		if rr := get(replicaServer.URL, ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 without a token, got %d", rr.Code)
+		}
+		if rr := get("ftp://replica", "secret"); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for a non-http target, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Write replication to REPLICA_PEERS
+const (
+	ReplicaHeader                   = "X-Replica"
+	MaxReplicationRetries           = 5
+	DefaultReplicationRetryInterval = time.Second // see REPLICATION_RETRY_INTERVAL
+	MaxReplicationRetryWait         = 30 * time.Second
+	ReplicationJitterFraction       = 0.2
+	ReplicationWorkers              = 8    // concurrent forwards across all peers
+	ReplicationQueueSize            = 4096 // forwards waiting for a worker before new ones are dropped
+	ReplicaTokenTTL                 = time.Minute
+)
+
+// errPeerRejected marks a peer response that retrying won't change
+var errPeerRejected = errors.New("peer rejected chunk")
+
+// ReplicationHealth reports write replication in /health
+type ReplicationHealth struct {
+	Peers     int   `json:"peers"`
+	Factor    int   `json:"factor"`
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+	Pending   int64 `json:"pending"`
+}
+
+// parseReplicaPeers parses REPLICA_PEERS, a comma-separated list of peer
+// node base URLs
+func parseReplicaPeers(value string) ([]string, error) {
+	var peers []string
+	for _, peer := range strings.Split(value, ",") {
+		peer = strings.TrimSuffix(strings.TrimSpace(peer), "/")
+		if peer == "" {
+			continue
+		}
+		u, err := url.Parse(peer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%q is not an http(s) base URL", peer)
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// replicaPeersFor picks the peers a chunk is replicated to. Peers are ranked
+// by a hash of the chunk ID and peer URL, so each chunk always lands on the
+// same REPLICATION_FACTOR peers and chunks spread evenly across them.
+func (sn *StorageNode) replicaPeersFor(chunkID string) []string {
+	if sn.replicationFactor >= len(sn.replicaPeers) {
+		return sn.replicaPeers
+	}
+	return sn.rankReplicaPeers(chunkID)[:sn.replicationFactor]
+}
+
+// rankReplicaPeers orders all peers for a chunk, those replicaPeersFor
+// picks first
+func (sn *StorageNode) rankReplicaPeers(chunkID string) []string {
+	rank := func(peer string) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(chunkID))
+		h.Write([]byte{0})
+		h.Write([]byte(peer))
+		return h.Sum64()
+	}
+	peers := append([]string(nil), sn.replicaPeers...)
+	sort.Slice(peers, func(i, j int) bool { return rank(peers[i]) < rank(peers[j]) })
+	return peers
+}
+
+// replicationJob is a chunk awaiting a forward to one peer
+type replicationJob struct {
+	chunkID string
+	peer    string
+}
+
+// replicateWrite queues a newly stored chunk for its replica peers. Writes
+// that are themselves replicas, marked with X-Replica, are never forwarded
+// again, so peers listing each other don't loop. It never blocks the write
+// path: with ReplicationQueueSize forwards already waiting, the forward is
+// dropped and counted as failed.
+func (sn *StorageNode) replicateWrite(r *http.Request, chunkID string) {
+	if len(sn.replicaPeers) == 0 || r.Header.Get(ReplicaHeader) == "true" {
+		return
+	}
+	for _, peer := range sn.replicaPeersFor(chunkID) {
+		atomic.AddInt64(&sn.replicationPending, 1)
+		select {
+		case sn.replicationQueue <- replicationJob{chunkID: chunkID, peer: peer}:
+		default:
+			atomic.AddInt64(&sn.replicationPending, -1)
+			atomic.AddInt64(&sn.replicationFailures, 1)
+			log.Printf("Failed to replicate chunk %s to %s: replication queue full", chunkID, peer)
+		}
+	}
+}
+
+// runReplicationWorker forwards queued chunks until shutdown, when the
+// forwards still queued are abandoned and counted as failed
+func (sn *StorageNode) runReplicationWorker(ctx context.Context) {
+	for {
+		select {
+		case job := <-sn.replicationQueue:
+			sn.replicateToPeer(ctx, job.chunkID, job.peer)
+			atomic.AddInt64(&sn.replicationPending, -1)
+		case <-ctx.Done():
+			for {
+				select {
+				case job := <-sn.replicationQueue:
+					atomic.AddInt64(&sn.replicationPending, -1)
+					atomic.AddInt64(&sn.replicationFailures, 1)
+					log.Printf("Abandoning replication of chunk %s to %s at shutdown", job.chunkID, job.peer)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// replicateToPeer PUTs a chunk to one peer, retrying failures with jittered
+// exponential backoff up to MaxReplicationRetries attempts
+func (sn *StorageNode) replicateToPeer(ctx context.Context, chunkID, peer string) {
+	// Read back from disk rather than holding the request's buffer, which
+	// streamed chunks never had. A chunk deleted meanwhile needs no replica.
+	entry, exists := sn.lookupChunk(chunkID)
+	if !exists {
+		return
+	}
+	entry, data, err := sn.readVerifiedChunk(entry)
+	if errors.Is(err, errChunkGone) {
+		return
+	}
+	if err != nil {
+		atomic.AddInt64(&sn.replicationFailures, 1)
+		log.Printf("Failed to replicate chunk %s to %s: %v", chunkID, peer, err)
+		return
+	}
+
+	wait := sn.replicationRetryInterval
+	for i := 0; i < MaxReplicationRetries; i++ {
+		err = sn.putToPeer(ctx, entry, data, peer)
+		if err == nil {
+			atomic.AddInt64(&sn.replicationSuccesses, 1)
+			return
+		}
+		log.Printf("Failed to replicate chunk %s to %s (attempt %d/%d): %v", entry.ChunkID, peer, i+1, MaxReplicationRetries, err)
+		if errors.Is(err, errPeerRejected) || i == MaxReplicationRetries-1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			atomic.AddInt64(&sn.replicationFailures, 1)
+			log.Printf("Abandoning replication of chunk %s to %s at shutdown", chunkID, peer)
+			return
+		case <-time.After(jitter(wait, ReplicationJitterFraction)):
+		}
+		if wait *= 2; wait > MaxReplicationRetryWait {
+			wait = MaxReplicationRetryWait
+		}
+	}
+	atomic.AddInt64(&sn.replicationFailures, 1)
+	log.Printf("Giving up replicating chunk %s to %s", chunkID, peer)
+}
+
+// putToPeer makes one replica PUT of a chunk
+func (sn *StorageNode) putToPeer(ctx context.Context, entry ChunkEntry, data []byte, peer string) error {
+	ctx, cancel := context.WithTimeout(ctx, ReplicaCopyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", peer+"/chunk/"+entry.ChunkID, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create replica request: %w", err)
+	}
+	setReplicaHeaders(req, entry)
+	sn.authorizePeerRequest(req, entry.ChunkID)
+	req.Header.Set(ReplicaHeader, "true")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("replica request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: status %d", errPeerRejected, resp.StatusCode)
+	default:
+		return fmt.Errorf("peer returned status %d", resp.StatusCode)
+	}
+}
+
+// authorizePeerRequest lets a request for a chunk through a peer's auth:
+// ADMIN_TOKEN as a bearer token if set, otherwise, with CHUNK_TOKEN_SECRET,
+// a chunk token minted for the request. Peers share both settings.
+func (sn *StorageNode) authorizePeerRequest(req *http.Request, chunkID string) {
+	if sn.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+sn.adminToken)
+	} else if len(sn.chunkTokenSecret) > 0 {
+		req.Header.Set(ChunkTokenHeader, SignChunkToken(sn.chunkTokenSecret, req.Method, chunkID, time.Now().Add(ReplicaTokenTTL)))
+	}
+}
+
+// replicationHealth reports replication outcomes, nil without REPLICA_PEERS
+func (sn *StorageNode) replicationHealth() *ReplicationHealth {
+	if len(sn.replicaPeers) == 0 {
+		return nil
+	}
+	return &ReplicationHealth{
+		Peers:     len(sn.replicaPeers),
+		Factor:    sn.replicationFactor,
+		Succeeded: atomic.LoadInt64(&sn.replicationSuccesses),
+		Failed:    atomic.LoadInt64(&sn.replicationFailures),
+		Pending:   atomic.LoadInt64(&sn.replicationPending),
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForReplication waits until no replications are pending
+func waitForReplication(t *testing.T, sn *StorageNode) *ReplicationHealth {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&sn.replicationPending) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for replication")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return sn.replicationHealth()
+}
+
+func TestReplicateWrites(t *testing.T) {
+	var mu sync.Mutex
+	var received []byte
+	var header http.Header
+	recording := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received, header = body, r.Header.Clone()
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer recording.Close()
+
+	var attempts int64
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer flaky.Close()
+
+	t.Setenv("REPLICA_PEERS", recording.URL+", "+flaky.URL+"/")
+	t.Setenv("REPLICATION_RETRY_INTERVAL", "10ms")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	data := []byte("chunk to replicate")
+	req := httptest.NewRequest("PUT", "/chunk/replicated", bytes.NewReader(data))
+	req.Header.Set(UserMetaHeaderPrefix+"Codec", "h264")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", rr.Code)
+	}
+
+	health := waitForReplication(t, sn)
+	if health.Peers != 2 || health.Factor != 2 || health.Succeeded != 2 || health.Failed != 0 {
+		t.Errorf("Expected both peers to get the chunk, got %+v", health)
+	}
+	if n := atomic.LoadInt64(&attempts); n != 2 {
+		t.Errorf("Expected the flaky peer to be retried once, got %d attempts", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !bytes.Equal(received, data) {
+		t.Errorf("Expected the peer to receive the chunk data, got %q", received)
+	}
+	entry, _ := sn.lookupChunk("replicated")
+	if header.Get(ReplicaHeader) != "true" || header.Get("X-Chunk-Checksum") != entry.Checksum {
+		t.Errorf("Expected replica and checksum headers, got %v", header)
+	}
+	if header.Get(UserMetaHeaderPrefix+"Codec") != "h264" {
+		t.Errorf("Expected user metadata to be copied, got %v", header)
+	}
+}
+
+func TestReplicaWritesNotForwarded(t *testing.T) {
+	var requests int64
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer peer.Close()
+
+	t.Setenv("REPLICA_PEERS", peer.URL)
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	req := httptest.NewRequest("PUT", "/chunk/copy", bytes.NewReader([]byte("already a replica")))
+	req.Header.Set(ReplicaHeader, "true")
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", rr.Code)
+	}
+
+	waitForReplication(t, sn)
+	if n := atomic.LoadInt64(&requests); n != 0 {
+		t.Errorf("Expected a replica write not to be forwarded, got %d requests", n)
+	}
+}
+
+func TestReplicationRejectedByPeer(t *testing.T) {
+	var requests int64
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer peer.Close()
+
+	t.Setenv("REPLICA_PEERS", peer.URL)
+	t.Setenv("REPLICATION_RETRY_INTERVAL", "10ms")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("PUT", "/chunk/rejected", bytes.NewReader([]byte("data"))))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected the local write to succeed, got %d", rr.Code)
+	}
+
+	health := waitForReplication(t, sn)
+	if health.Succeeded != 0 || health.Failed != 1 {
+		t.Errorf("Expected one failed replication, got %+v", health)
+	}
+	if n := atomic.LoadInt64(&requests); n != 1 {
+		t.Errorf("Expected a rejected chunk not to be retried, got %d requests", n)
+	}
+}
+
+func TestReplicationAuthenticatesToPeers(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		env  string
+		ok   func(r *http.Request) bool
+	}{
+		{"admin_token", "ADMIN_TOKEN", func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer shared"
+		}},
+		{"chunk_token", "CHUNK_TOKEN_SECRET", func(r *http.Request) bool {
+			return verifyChunkToken([]byte("shared"), r.Header.Get(ChunkTokenHeader), r.Method, "authed", time.Now()) == nil
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !tc.ok(r) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer peer.Close()
+
+			t.Setenv("REPLICA_PEERS", peer.URL)
+			t.Setenv(tc.env, "shared")
+			sn, tempDir := setupTestStorageNode(t)
+			defer cleanupTestStorageNode(tempDir)
+
+			req := httptest.NewRequest("PUT", "/chunk/authed", bytes.NewReader([]byte("needs auth")))
+			req.Header.Set("Authorization", "Bearer shared")
+			req.Header.Set(ChunkTokenHeader, SignChunkToken([]byte("shared"), "PUT", "authed", time.Now().Add(time.Minute)))
+			rr := httptest.NewRecorder()
+			sn.newRouter().ServeHTTP(rr, req)
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("Expected 201, got %d", rr.Code)
+			}
+			if health := waitForReplication(t, sn); health.Succeeded != 1 || health.Failed != 0 {
+				t.Errorf("Expected the peer to accept the authenticated replica, got %+v", health)
+			}
+		})
+	}
+}
+
+func TestReplicationQueueFullCountsFailure(t *testing.T) {
+	t.Setenv("REPLICA_PEERS", "http://peer-a:8081")
+	sn := NewStorageNode(t.TempDir(), "test-node")
+	// No workers run without Initialize, so the queue only fills
+	sn.replicationQueue = make(chan replicationJob, 1)
+
+	req := httptest.NewRequest("PUT", "/chunk/queued", nil)
+	sn.replicateWrite(req, "queued")
+	sn.replicateWrite(req, "dropped")
+	if health := sn.replicationHealth(); health.Pending != 1 || health.Failed != 1 {
+		t.Errorf("Expected one forward queued and one dropped as failed, got %+v", health)
+	}
+}
+
+func TestReplicateBatchWrites(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]bool)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.URL.Path] = true
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer peer.Close()
+
+	t.Setenv("REPLICA_PEERS", peer.URL)
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i := 0; i < 2; i++ {
+		part, err := mw.CreateFormFile(fmt.Sprintf("batch-%d", i), "chunk")
+		if err != nil {
+			t.Fatalf("Failed to create part: %v", err)
+		}
+		fmt.Fprintf(part, "batch chunk %d", i)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/chunks/batch", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if health := waitForReplication(t, sn); health.Succeeded != 2 {
+		t.Errorf("Expected both batch chunks replicated, got %+v", health)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !received["/chunk/batch-0"] || !received["/chunk/batch-1"] {
+		t.Errorf("Expected the peer to receive both chunks, got %v", received)
+	}
+}
+
+func TestReplicaPeersFor(t *testing.T) {
+	t.Setenv("REPLICA_PEERS", "http://peer-a:8081,http://peer-b:8081,http://peer-c:8081")
+	t.Setenv("REPLICATION_FACTOR", "1")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	counts := make(map[string]int)
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+		peers := sn.replicaPeersFor(id)
+		if len(peers) != 1 {
+			t.Fatalf("Expected 1 peer for %s, got %v", id, peers)
+		}
+		if again := sn.replicaPeersFor(id); again[0] != peers[0] {
+			t.Errorf("Expected %s to always map to %s, got %s", id, peers[0], again[0])
+		}
+		counts[peers[0]]++
+	}
+	if len(counts) < 2 {
+		t.Errorf("Expected chunks to spread across peers, got %v", counts)
+	}
+	if health := sn.replicationHealth(); health.Peers != 3 || health.Factor != 1 {
+		t.Errorf("Expected 3 peers with factor 1, got %+v", health)
+	}
+}
+
+func TestInvalidReplicaPeers(t *testing.T) {
+	t.Setenv("REPLICA_PEERS", "storage-node-2:8081")
+	tempDir := t.TempDir()
+	sn := NewStorageNode(tempDir, "test-node")
+	if err := sn.Initialize(); err == nil {
+		t.Fatal("Expected Initialize to fail with an invalid REPLICA_PEERS")
+	}
+	if sn.replicationHealth() != nil {
+		t.Error("Expected no replication health without valid peers")
+	}
+}
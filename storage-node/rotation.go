@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Reasons the active superblock of a tier is rotated away from
+const (
+	RotationFull  = "full"  // the next write didn't fit
+	RotationAged  = "aged"  // it reached MAX_SUPERBLOCK_AGE
+	RotationDrain = "drain" // it is being drained
+)
+
+// rotationStats counts superblock rotations and mirrors the active
+// superblock of each tier, so /metrics and /stats can report them without
+// waiting on sn.mu, which streamed writes hold for their whole upload
+type rotationStats struct {
+	mu         sync.Mutex
+	byReason   map[string]int64
+	active     int
+	activeFast int
+}
+
+// SuperblockStats summarizes superblock rotation in /stats
+type SuperblockStats struct {
+	Active            int              `json:"active"`
+	ActiveFast        *int             `json:"active_fast,omitempty"` // Only with a fast tier
+	Rotations         int64            `json:"rotations"`
+	RotationsByReason map[string]int64 `json:"rotations_by_reason"`
+}
+
+// setActive records the active superblock of id's tier
+func (s *rotationStats) setActive(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if isFastTierSuperblock(id) {
+		s.activeFast = id
+	} else {
+		s.active = id
+	}
+}
+
+// rotateSuperblock moves current on to a new superblock, counting the
+// rotation and logging it as a structured event. size is the old
+// superblock's size at rotation. Caller must hold sn.mu.
+func (sn *StorageNode) rotateSuperblock(current *int, size int64, reason string) {
+	old := *current
+	*current++
+
+	s := &sn.rotations
+	s.mu.Lock()
+	if s.byReason == nil {
+		s.byReason = make(map[string]int64)
+	}
+	s.byReason[reason]++
+	s.mu.Unlock()
+	s.setActive(*current)
+
+	slog.Info("superblock rotated",
+		"tier", tierOf(old),
+		"old_id", old,
+		"new_id", *current,
+		"size_bytes", size,
+		"reason", reason)
+}
+
+// superblockStats returns rotation counts and the active superblocks
+func (sn *StorageNode) superblockStats() SuperblockStats {
+	s := &sn.rotations
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SuperblockStats{Active: s.active, RotationsByReason: make(map[string]int64)}
+	if sn.fastTierDir != "" {
+		activeFast := s.activeFast
+		stats.ActiveFast = &activeFast
+	}
+	for _, reason := range []string{RotationFull, RotationAged, RotationDrain} {
+		stats.RotationsByReason[reason] = s.byReason[reason]
+		stats.Rotations += s.byReason[reason]
+	}
+	return stats
+}
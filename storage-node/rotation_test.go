@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSuperblockRotationsCounted(t *testing.T) {
+	t.Setenv("DRAIN_RATE_LIMIT_MB", "0")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.maxSuperblockSize = 4096
+
+	// Five of these fit a superblock, so 18 fill three and start a fourth
+	used := make(map[int]bool)
+	for i := 0; i < 18; i++ {
+		chunkID := fmt.Sprintf("rotate-%02d", i)
+		data := bytes.Repeat([]byte{byte(i)}, 700)
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+		entry, _ := sn.lookupChunk(chunkID)
+		used[entry.SuperblockID] = true
+	}
+	if len(used) != 4 {
+		t.Fatalf("Expected the chunks to span 4 superblocks, got %d", len(used))
+	}
+
+	stats := sn.superblockStats()
+	if stats.Rotations != 3 || stats.RotationsByReason[RotationFull] != 3 {
+		t.Errorf("Expected 3 rotations for a full superblock, got %+v", stats)
+	}
+	if stats.Active != sn.currentSuperblock || stats.ActiveFast != nil {
+		t.Errorf("Expected active superblock %d and no fast tier, got %+v", sn.currentSuperblock, stats)
+	}
+
+	// Draining the active superblock rotates away from it too
+	drained := sn.currentSuperblock
+	if _, err := sn.startDrain(drained); err != nil {
+		t.Fatalf("Failed to start drain: %v", err)
+	}
+	if stats := sn.superblockStats(); stats.RotationsByReason[RotationDrain] != 1 || stats.Active == drained {
+		t.Errorf("Expected a drain rotation away from superblock %d, got %+v", drained, stats)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := sn.getDrainStatus(drained)
+		if err != nil || status.State == DrainCompleted {
+			break
+		}
+		if status.State == DrainFailed || time.Now().After(deadline) {
+			t.Fatalf("Drain did not complete: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	router := sn.newRouter()
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/stats", nil))
+	var resp StatsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	stats = sn.superblockStats()
+	if resp.Superblocks.Rotations != stats.Rotations || resp.Superblocks.Active != stats.Active {
+		t.Errorf("Expected /stats to report %+v, got %+v", stats, resp.Superblocks)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	metrics := rr.Body.String()
+	for _, want := range []string{
+		`vstack_superblock_rotations_total{reason="full"} 3`,
+		`vstack_superblock_rotations_total{reason="drain"} 1`,
+		fmt.Sprintf(`vstack_active_superblock_id{tier="primary"} %d`, stats.Active),
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("Expected /metrics to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the per-route latency
+// histogram
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// unmatchedRoute labels requests that matched no route, so arbitrary paths
+// can't create new series
+const unmatchedRoute = "unmatched"
+
+// routeStats accumulates request outcomes and latencies for one route
+type routeStats struct {
+	method       string
+	route        string
+	requests     int64
+	clientErrors int64 // 4xx responses
+	serverErrors int64 // 5xx responses
+	latencySum   time.Duration
+	latencyMax   time.Duration
+	buckets      []int64       // cumulative counts per latencyBuckets bound
+	statuses     map[int]int64 // responses by status code
+}
+
+// LatencyBucket is one cumulative histogram bucket
+type LatencyBucket struct {
+	LeMs  float64 `json:"le_ms"`
+	Count int64   `json:"count"`
+}
+
+// RouteStats summarizes requests to one method and route template
+type RouteStats struct {
+	Method         string          `json:"method"`
+	Route          string          `json:"route"`
+	Requests       int64           `json:"requests"`
+	ClientErrors   int64           `json:"client_errors"`
+	ServerErrors   int64           `json:"server_errors"`
+	MeanLatencyMs  float64         `json:"mean_latency_ms"`
+	TotalLatencyMs float64         `json:"total_latency_ms"`
+	MaxLatencyMs   float64         `json:"max_latency_ms"`
+	Latency        []LatencyBucket `json:"latency_histogram"`
+	Statuses       map[int]int64   `json:"statuses"`
+}
+
+// StatsResponse represents the /stats response
+type StatsResponse struct {
+	Routes      []RouteStats     `json:"routes"`
+	Index       IndexStats       `json:"index"`
+	Superblocks SuperblockStats  `json:"superblocks"`
+	Maintenance MaintenanceStats `json:"maintenance"`
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// routeMetricsMiddleware records latency and errors per method and mux route
+// template. Keying by template rather than path keeps chunk IDs from
+// exploding the number of series.
+func (sn *StorageNode) routeMetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			route := unmatchedRoute
+			if mux.CurrentRoute(r) != nil {
+				route = routeTemplate(r)
+			}
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			// A panic becomes a 500 in recoveryMiddleware further out
+			err := recover()
+			if err != nil {
+				status = http.StatusInternalServerError
+			}
+			sn.recordRequest(r.Method, route, status, time.Since(start))
+			if err != nil {
+				panic(err)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+func (sn *StorageNode) recordRequest(method, route string, status int, latency time.Duration) {
+	key := method + " " + route
+
+	sn.routeStatsMu.Lock()
+	defer sn.routeStatsMu.Unlock()
+
+	stats, ok := sn.routeStats[key]
+	if !ok {
+		stats = &routeStats{method: method, route: route, buckets: make([]int64, len(latencyBuckets)), statuses: make(map[int]int64)}
+		sn.routeStats[key] = stats
+	}
+	stats.requests++
+	stats.statuses[status]++
+	switch {
+	case status >= 500:
+		stats.serverErrors++
+	case status >= 400:
+		stats.clientErrors++
+	}
+	stats.latencySum += latency
+	if latency > stats.latencyMax {
+		stats.latencyMax = latency
+	}
+	for i, bound := range latencyBuckets {
+		if latency.Seconds() <= bound {
+			stats.buckets[i]++
+		}
+	}
+}
+
+// routeStatsSnapshot returns per-route stats sorted by route then method
+func (sn *StorageNode) routeStatsSnapshot() []RouteStats {
+	sn.routeStatsMu.Lock()
+	defer sn.routeStatsMu.Unlock()
+
+	snapshot := make([]RouteStats, 0, len(sn.routeStats))
+	for _, stats := range sn.routeStats {
+		rs := RouteStats{
+			Method:         stats.method,
+			Route:          stats.route,
+			Requests:       stats.requests,
+			ClientErrors:   stats.clientErrors,
+			ServerErrors:   stats.serverErrors,
+			TotalLatencyMs: float64(stats.latencySum) / float64(time.Millisecond),
+			MaxLatencyMs:   float64(stats.latencyMax) / float64(time.Millisecond),
+			Latency:        make([]LatencyBucket, len(latencyBuckets)),
+			Statuses:       make(map[int]int64, len(stats.statuses)),
+		}
+		for status, count := range stats.statuses {
+			rs.Statuses[status] = count
+		}
+		if stats.requests > 0 {
+			rs.MeanLatencyMs = float64(stats.latencySum) / float64(stats.requests) / float64(time.Millisecond)
+		}
+		for i, bound := range latencyBuckets {
+			rs.Latency[i] = LatencyBucket{LeMs: bound * 1000, Count: stats.buckets[i]}
+		}
+		snapshot = append(snapshot, rs)
+	}
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Route != snapshot[j].Route {
+			return snapshot[i].Route < snapshot[j].Route
+		}
+		return snapshot[i].Method < snapshot[j].Method
+	})
+	return snapshot
+}
+
+// writeRouteMetrics writes the per-route latency histograms and error
+// counters in the Prometheus text exposition format
+func writeRouteMetrics(w io.Writer, routes []RouteStats) {
+	fmt.Fprintf(w, "# HELP vstack_http_request_duration_seconds Request latency by method and route\n")
+	fmt.Fprintf(w, "# TYPE vstack_http_request_duration_seconds histogram\n")
+	for _, rs := range routes {
+		labels := fmt.Sprintf("method=%q,route=%q", rs.Method, rs.Route)
+		for _, bucket := range rs.Latency {
+			le := strconv.FormatFloat(bucket.LeMs/1000, 'g', -1, 64)
+			fmt.Fprintf(w, "vstack_http_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, le, bucket.Count)
+		}
+		fmt.Fprintf(w, "vstack_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, rs.Requests)
+		fmt.Fprintf(w, "vstack_http_request_duration_seconds_sum{%s} %g\n", labels, rs.TotalLatencyMs/1000)
+		fmt.Fprintf(w, "vstack_http_request_duration_seconds_count{%s} %d\n", labels, rs.Requests)
+	}
+
+	fmt.Fprintf(w, "# HELP vstack_http_requests_total Requests by method, route and status code\n")
+	fmt.Fprintf(w, "# TYPE vstack_http_requests_total counter\n")
+	for _, rs := range routes {
+		statuses := make([]int, 0, len(rs.Statuses))
+		for status := range rs.Statuses {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		for _, status := range statuses {
+			fmt.Fprintf(w, "vstack_http_requests_total{method=%q,route=%q,status=\"%d\"} %d\n", rs.Method, rs.Route, status, rs.Statuses[status])
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP vstack_http_request_errors_total Error responses by method, route and class\n")
+	fmt.Fprintf(w, "# TYPE vstack_http_request_errors_total counter\n")
+	for _, rs := range routes {
+		labels := fmt.Sprintf("method=%q,route=%q", rs.Method, rs.Route)
+		fmt.Fprintf(w, "vstack_http_request_errors_total{%s,class=\"4xx\"} %d\n", labels, rs.ClientErrors)
+		fmt.Fprintf(w, "vstack_http_request_errors_total{%s,class=\"5xx\"} %d\n", labels, rs.ServerErrors)
+	}
+}
+
+// handleStats reports per-route request counts, errors and latencies, the
+// size of the index, superblock rotations and running maintenance
+func (sn *StorageNode) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(StatsResponse{
+		Routes:      sn.routeStatsSnapshot(),
+		Index:       sn.indexStats(),
+		Superblocks: sn.superblockStats(),
+		Maintenance: sn.maintenance.stats(),
+	}); err != nil {
+		log.Printf("Failed to encode stats response: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPerRouteStats(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	r := sn.newRouter()
+
+	do := func(method, path string, body []byte) {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if body != nil {
+			req.Header.Set("X-Chunk-Checksum", fmt.Sprintf("%x", sha256.Sum256(body)))
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for i := 0; i < 3; i++ {
+		do("PUT", fmt.Sprintf("/chunk/stats-%d", i), []byte(fmt.Sprintf("stats chunk %d", i)))
+	}
+	do("GET", "/chunk/stats-0", nil)
+	do("GET", "/chunk/stats-1", nil)
+	do("GET", "/chunk/stats-missing", nil)
+	do("HEAD", "/chunk/stats-2", nil)
+	do("DELETE", "/chunk/stats-2", nil)
+	do("GET", "/health", nil)
+
+	req := httptest.NewRequest("GET", "/stats", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var stats StatsResponse
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats response: %v", err)
+	}
+
+	byKey := make(map[string]RouteStats)
+	for _, rs := range stats.Routes {
+		byKey[rs.Method+" "+rs.Route] = rs
+	}
+	tests := []struct {
+		key          string
+		requests     int64
+		clientErrors int64
+	}{
+		{"PUT /chunk/{chunk_id}", 3, 0},
+		{"GET /chunk/{chunk_id}", 3, 1},
+		{"HEAD /chunk/{chunk_id}", 1, 0},
+		{"DELETE /chunk/{chunk_id}", 1, 0},
+		{"GET /health", 1, 0},
+	}
+	for _, tt := range tests {
+		rs, ok := byKey[tt.key]
+		if !ok {
+			t.Errorf("Expected stats for %s, got %v", tt.key, stats.Routes)
+			continue
+		}
+		if rs.Requests != tt.requests || rs.ClientErrors != tt.clientErrors || rs.ServerErrors != 0 {
+			t.Errorf("%s: expected %d requests and %d client errors, got %+v", tt.key, tt.requests, tt.clientErrors, rs)
+		}
+		if rs.MeanLatencyMs <= 0 || rs.MaxLatencyMs < rs.MeanLatencyMs {
+			t.Errorf("%s: expected latencies to be recorded, got mean %v max %v", tt.key, rs.MeanLatencyMs, rs.MaxLatencyMs)
+		}
+		if last := rs.Latency[len(rs.Latency)-1]; last.Count != rs.Requests {
+			t.Errorf("%s: expected the largest bucket to hold all %d requests, got %d", tt.key, rs.Requests, last.Count)
+		}
+	}
+	for key := range byKey {
+		if strings.Contains(key, "stats-") {
+			t.Errorf("Expected stats keyed by route template, found %s", key)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	for _, line := range []string{
+		`vstack_http_request_duration_seconds_count{method="PUT",route="/chunk/{chunk_id}"} 3`,
+		`vstack_http_request_errors_total{method="GET",route="/chunk/{chunk_id}",class="4xx"} 1`,
+		`vstack_http_requests_total{method="GET",route="/chunk/{chunk_id}",status="200"} 2`,
+		`vstack_http_requests_total{method="GET",route="/chunk/{chunk_id}",status="404"} 1`,
+		`vstack_chunk_operations_total{op="put"} 3`,
+		`vstack_chunk_operations_total{op="get"} 2`,
+		`vstack_chunk_operations_total{op="delete"} 1`,
+		`vstack_stored_bytes 26`, // Two 13 byte chunks left
+		`vstack_index_save_failures_total 0`,
+	} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
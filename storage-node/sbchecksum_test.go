@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func getSuperblockChecksums(t *testing.T, sn *StorageNode) []SuperblockChecksum {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, adminRequest("GET", "/admin/superblocks/checksums", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp SuperblockChecksumsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.Superblocks
+}
+
+func TestSuperblockChecksumChangesAfterAppend(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.adminToken = "secret"
+
+	store := func(chunkID string) {
+		data := []byte("backup me: " + chunkID)
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store %s: %v", chunkID, err)
+		}
+	}
+
+	store("backup-1")
+	before := getSuperblockChecksums(t, sn)
+	if len(before) != 1 {
+		t.Fatalf("Expected 1 superblock, got %d", len(before))
+	}
+	contents, err := os.ReadFile(before[0].Path)
+	if err != nil {
+		t.Fatalf("Failed to read reported path: %v", err)
+	}
+	if sum := fmt.Sprintf("%x", sha256.Sum256(contents)); sum != before[0].Checksum || int64(len(contents)) != before[0].Size {
+		t.Errorf("Reported checksum %s/%d doesn't match file %s/%d", before[0].Checksum, before[0].Size, sum, len(contents))
+	}
+
+	// Unchanged files are served from the cache
+	if again := getSuperblockChecksums(t, sn); !again[0].ComputedAt.Equal(before[0].ComputedAt) {
+		t.Error("Expected the cached checksum to be reused for an unchanged superblock")
+	}
+
+	store("backup-2")
+	after := getSuperblockChecksums(t, sn)
+	if after[0].Checksum == before[0].Checksum {
+		t.Error("Expected the checksum to change after a chunk was appended")
+	}
+	if after[0].Size <= before[0].Size {
+		t.Errorf("Expected the size to grow, was %d now %d", before[0].Size, after[0].Size)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// DefaultTaskJitterFraction spreads background task runs so maintenance jobs
+// registered with similar intervals don't fire together
+const DefaultTaskJitterFraction = 0.1
+
+// scheduler runs periodic background tasks, each on its own jittered
+// interval. All tasks share one context, so stopping the scheduler stops
+// them uniformly, and a panicking run is logged without killing its task.
+type scheduler struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	runs    map[string]int64 // task name -> completed runs
+	panics  map[string]int64 // task name -> recovered panics
+	stopped bool
+}
+
+func newScheduler() *scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scheduler{
+		ctx:    ctx,
+		cancel: cancel,
+		runs:   make(map[string]int64),
+		panics: make(map[string]int64),
+	}
+}
+
+// every runs fn roughly every interval, spread by +/- jitterFraction, until
+// the scheduler is stopped. The first run happens after one interval.
+func (s *scheduler) every(name string, interval time.Duration, jitterFraction float64, fn func(ctx context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	if _, exists := s.runs[name]; exists {
+		log.Printf("Warning: background task %s already scheduled", name)
+		return
+	}
+	s.runs[name] = 0
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			timer := time.NewTimer(jitter(interval, jitterFraction))
+			select {
+			case <-s.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			s.run(name, fn)
+		}
+	}()
+}
+
+// start runs fn once in the background, counted under name like a periodic
+// run. It reports false if the scheduler has been stopped.
+func (s *scheduler) start(name string, fn func(ctx context.Context)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return false
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(name, fn)
+	}()
+	return true
+}
+
+func (s *scheduler) run(name string, fn func(ctx context.Context)) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("PANIC in background task %s: %v\n%s", name, err, debug.Stack())
+			s.mu.Lock()
+			s.panics[name]++
+			s.mu.Unlock()
+		}
+	}()
+	fn(s.ctx)
+
+	s.mu.Lock()
+	s.runs[name]++
+	s.mu.Unlock()
+}
+
+// stop cancels every task and waits for in-progress runs to return
+func (s *scheduler) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+}
+
+// stats returns copies of the per-task run and panic counts
+func (s *scheduler) stats() (runs, panics map[string]int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs = make(map[string]int64, len(s.runs))
+	for name, n := range s.runs {
+		runs[name] = n
+	}
+	panics = make(map[string]int64, len(s.panics))
+	for name, n := range s.panics {
+		panics[name] = n
+	}
+	return runs, panics
+}
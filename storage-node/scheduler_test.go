@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerRunsTasksAtIntervals(t *testing.T) {
+	s := newScheduler()
+
+	var fast, slow, panicking int64
+	s.every("fast", 10*time.Millisecond, 0, func(ctx context.Context) { atomic.AddInt64(&fast, 1) })
+	s.every("slow", 100*time.Millisecond, 0, func(ctx context.Context) { atomic.AddInt64(&slow, 1) })
+	s.every("panicking", 10*time.Millisecond, 0, func(ctx context.Context) {
+		atomic.AddInt64(&panicking, 1)
+		panic("task failure")
+	})
+
+	time.Sleep(250 * time.Millisecond)
+	s.stop()
+
+	if n := atomic.LoadInt64(&fast); n < 10 {
+		t.Errorf("Expected fast task to run at least 10 times, ran %d", n)
+	}
+	if n := atomic.LoadInt64(&slow); n < 1 || n > 3 {
+		t.Errorf("Expected slow task to run 1-3 times, ran %d", n)
+	}
+	if n := atomic.LoadInt64(&panicking); n < 2 {
+		t.Errorf("Expected panicking task to keep being scheduled, ran %d", n)
+	}
+
+	runs, panics := s.stats()
+	if runs["fast"] != atomic.LoadInt64(&fast) || panics["panicking"] != atomic.LoadInt64(&panicking) {
+		t.Errorf("Unexpected stats: runs %v, panics %v", runs, panics)
+	}
+
+	// Nothing runs after stop, and late registrations are ignored
+	stoppedAt := atomic.LoadInt64(&fast)
+	s.every("late", time.Millisecond, 0, func(ctx context.Context) { atomic.AddInt64(&fast, 1) })
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(&fast); n != stoppedAt {
+		t.Errorf("Expected no runs after stop, got %d more", n-stoppedAt)
+	}
+}
+
+func TestSchedulerStopCancelsRunningTask(t *testing.T) {
+	s := newScheduler()
+
+	started := make(chan struct{})
+	s.every("blocking", time.Millisecond, 0, func(ctx context.Context) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+	})
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		s.stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected stop to cancel the running task and return")
+	}
+}
+
+func TestShutdownStopsBackgroundTasks(t *testing.T) {
+	t.Setenv("CHUNK_FSYNC_POLICY", FsyncInterval)
+	t.Setenv("FSYNC_INTERVAL", "10ms")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	time.Sleep(50 * time.Millisecond)
+	sn.Shutdown()
+
+	runs, _ := sn.tasks.stats()
+	if runs["fsync"] == 0 {
+		t.Error("Expected the fsync flusher to run on the scheduler")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if after, _ := sn.tasks.stats(); after["fsync"] != runs["fsync"] {
+		t.Errorf("Expected no fsync runs after shutdown, got %d more", after["fsync"]-runs["fsync"])
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Background scrubbing (see SCRUB_INTERVAL)
+const DefaultScrubRate = 10 * 1024 * 1024 // bytes/sec read by the scrubber
+
+// scrubBatchBytes is how much a scrub pass reads per turn at the maintenance
+// gate; a var so tests can shrink it
+var scrubBatchBytes int64 = 64 * 1024 * 1024
+
+// ScrubStatus describes the running or most recent scrub pass
+type ScrubStatus struct {
+	Running       bool       `json:"running"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	ChunksScanned int        `json:"chunks_scanned"`
+	BytesScanned  int64      `json:"bytes_scanned"`
+	Corruptions   int        `json:"corruptions"`
+	ReadErrors    int        `json:"read_errors"`
+}
+
+// scrubber tracks scrub passes; only one runs at a time
+type scrubber struct {
+	mu      sync.Mutex
+	running bool
+	status  ScrubStatus // zero until the first pass starts
+
+	scanned     int64 // atomic count of chunks verified across passes
+	corruptions int64 // atomic count of chunks found corrupt across passes
+
+	// Stored bytes found corrupt and not yet repaired. Reads of them are
+	// always verified, so they fail or are repaired from a peer rather than
+	// being served damaged whatever VERIFY_SAMPLE_RATE.
+	corrupt map[blobRef]bool
+}
+
+func (s *scrubber) markCorrupt(ref blobRef) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.corrupt == nil {
+		s.corrupt = make(map[blobRef]bool)
+	}
+	s.corrupt[ref] = true
+}
+
+func (s *scrubber) clearCorrupt(ref blobRef) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.corrupt, ref)
+}
+
+func (s *scrubber) isCorrupt(ref blobRef) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.corrupt[ref]
+}
+
+// begin marks a pass as started, reporting false if one is already running
+func (s *scrubber) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return false
+	}
+	s.running = true
+	s.status = ScrubStatus{Running: true, StartedAt: time.Now()}
+	return true
+}
+
+func (s *scrubber) update(fn func(*ScrubStatus)) {
+	s.mu.Lock()
+	fn(&s.status)
+	s.mu.Unlock()
+}
+
+func (s *scrubber) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.running = false
+	s.status.Running = false
+	s.status.FinishedAt = &now
+}
+
+func (s *scrubber) current() ScrubStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// scrubPeriodically is the SCRUB_INTERVAL task. A pass still running from
+// POST /scrub counts as this interval's pass.
+func (sn *StorageNode) scrubPeriodically(ctx context.Context) {
+	if sn.scrub.begin() {
+		sn.runScrub(ctx)
+	}
+}
+
+// startScrub starts a pass in the background unless one is already running
+func (sn *StorageNode) startScrub() {
+	if !sn.scrub.begin() {
+		return
+	}
+	if !sn.tasks.start("scrub", sn.runScrub) {
+		sn.scrub.finish()
+	}
+}
+
+// runScrub reads every indexed chunk back and checks it against its
+// checksum, at most sn.scrubRate bytes/sec, in batches the maintenance
+// gate admits one at a time. Corrupt chunks are repaired from a replica peer when possible, and
+// otherwise stay indexed but marked so reads of them fail, or repair them,
+// rather than serve the damaged bytes. The caller must have called
+// sn.scrub.begin.
+func (sn *StorageNode) runScrub(ctx context.Context) {
+	defer sn.scrub.finish()
+
+	// The gate is held per batch, so other maintenance queued behind a
+	// long pass gets its turn in between
+	var release func()
+	defer func() {
+		if release != nil {
+			release()
+		}
+	}()
+
+	start := time.Now()
+	var read, batch int64
+	now := time.Now()
+	for _, entry := range sn.snapshotIndex().entries {
+		if ctx.Err() != nil {
+			log.Printf("Scrub interrupted after %d chunks", sn.scrub.current().ChunksScanned)
+			return
+		}
+		if entry.expired(now) {
+			continue
+		}
+		if release == nil {
+			var err error
+			if release, err = sn.maintenance.acquire(ctx, MaintenanceScrub); err != nil {
+				log.Printf("Scrub canceled while waiting for other maintenance after %d chunks: %v", sn.scrub.current().ChunksScanned, err)
+				return
+			}
+			batch = 0
+		}
+
+		err := sn.scrubChunk(ctx, entry)
+		sn.scrub.update(func(s *ScrubStatus) {
+			s.ChunksScanned++
+			s.BytesScanned += int64(entry.Size)
+			if errors.Is(err, errChunkCorrupt) {
+				s.Corruptions++
+			} else if err != nil {
+				s.ReadErrors++
+			}
+		})
+
+		read += int64(entry.Size)
+		if batch += int64(entry.Size); batch >= scrubBatchBytes {
+			release()
+			release = nil
+		}
+		if sn.scrubRate > 0 {
+			expected := time.Duration(float64(read) / float64(sn.scrubRate) * float64(time.Second))
+			if wait := expected - time.Since(start); wait > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(wait):
+				}
+			}
+		}
+	}
+
+	status := sn.scrub.current()
+	log.Printf("Scrub checked %d chunks (%d bytes) in %v: %d corrupt, %d unreadable",
+		status.ChunksScanned, status.BytesScanned, time.Since(start).Round(time.Millisecond), status.Corruptions, status.ReadErrors)
+}
+
+// scrubChunk verifies one chunk. A checksum mismatch marks the chunk
+// corrupt, repairs it from a replica peer if it can, and returns an error
+// wrapping errChunkCorrupt; a chunk deleted or moved since the pass started
+// is not an error.
+func (sn *StorageNode) scrubChunk(ctx context.Context, entry ChunkEntry) error {
+	data, err := sn.readChunk(entry)
+	if err == nil {
+		var computed string
+		if computed, err = computeChecksum(entry.checksumAlgorithm(), data); err == nil && computed != entry.Checksum {
+			err = fmt.Errorf("%w: expected %s, got %s", errChunkCorrupt, entry.Checksum, computed)
+		}
+	}
+	if err == nil {
+		atomic.AddInt64(&sn.scrub.scanned, 1)
+		sn.scrub.clearCorrupt(entry.blob())
+		return nil
+	}
+	if !sn.indexedAt(entry) {
+		return nil
+	}
+
+	if !errors.Is(err, errChunkCorrupt) {
+		log.Printf("Scrub could not read chunk %s: %v", entry.ChunkID, err)
+		return err
+	}
+	atomic.AddInt64(&sn.scrub.scanned, 1)
+	atomic.AddInt64(&sn.scrub.corruptions, 1)
+	sn.scrub.markCorrupt(entry.blob())
+	log.Printf("Scrub found chunk %s corrupt: %v", entry.ChunkID, err)
+
+	if sn.canRepair() {
+		repairCtx, cancel := context.WithTimeout(ctx, sn.readRepairTimeout)
+		data, ok := sn.fetchRepairCopy(repairCtx, entry)
+		cancel()
+		if ok {
+			sn.replaceCorruptChunk(entry, data)
+		} else {
+			atomic.AddInt64(&sn.readRepairFailures, 1)
+		}
+	}
+	return err
+}
+
+// handleScrub starts a full scrub pass, or reports the one already running
+func (sn *StorageNode) handleScrub(w http.ResponseWriter, r *http.Request) {
+	sn.startScrub()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(sn.scrub.current()); err != nil {
+		log.Printf("Failed to encode scrub status: %v", err)
+	}
+}
+
+func (sn *StorageNode) handleScrubStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sn.scrub.current()); err != nil {
+		log.Printf("Failed to encode scrub status: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestScrubMarksCorruptChunks(t *testing.T) {
+	t.Setenv("SCRUB_RATE_MB", "0")
+	t.Setenv("VERIFY_SAMPLE_RATE", "0")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	defer sn.Shutdown()
+
+	for i := 0; i < 3; i++ {
+		data := []byte(fmt.Sprintf("scrubbed chunk %d", i))
+		if err := sn.storeChunk(fmt.Sprintf("scrub-%d", i), data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	}
+
+	// Flip a byte of one chunk on disk behind the node's back
+	bad, _ := sn.lookupChunk("scrub-1")
+	file, err := os.OpenFile(sn.getSuperblockPath(bad.SuperblockID), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open superblock: %v", err)
+	}
+	file.WriteAt([]byte{'X'}, bad.Offset)
+	file.Close()
+
+	if !sn.scrub.begin() {
+		t.Fatal("Expected no scrub to be running")
+	}
+	sn.runScrub(context.Background())
+
+	status := sn.scrub.current()
+	if status.Running || status.ChunksScanned != 3 || status.Corruptions != 1 || status.ReadErrors != 0 {
+		t.Errorf("Expected a finished pass over 3 chunks with 1 corruption, got %+v", status)
+	}
+	if _, ok := sn.lookupChunk("scrub-1"); !ok {
+		t.Fatal("Expected the corrupt chunk to stay indexed for read repair")
+	}
+
+	// Reads of it are verified even with sampling off, so it isn't served
+	rr := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/chunk/scrub-1", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 reading the corrupt chunk, got %d", rr.Code)
+	}
+	for _, chunkID := range []string{"scrub-0", "scrub-2"} {
+		if _, ok := sn.lookupChunk(chunkID); !ok {
+			t.Errorf("Expected intact chunk %s to stay indexed", chunkID)
+		}
+	}
+
+	health := sn.health()
+	if health.ScrubCorruptions != 1 || health.Status != "warning" {
+		t.Errorf("Expected health to report 1 corruption as a warning, got %d (%s)", health.ScrubCorruptions, health.Status)
+	}
+}
+
+func TestScrubEndpoint(t *testing.T) {
+	t.Setenv("SCRUB_RATE_MB", "0")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	defer sn.Shutdown()
+
+	data := []byte("scrubbed on demand")
+	if err := sn.storeChunk("scrub-demand", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+
+	sn.adminToken = "secret"
+	router := sn.newRouter()
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, adminRequest("POST", "/scrub", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202 starting a scrub, got %d", rr.Code)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var status ScrubStatus
+	for {
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/scrub", nil))
+		if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+			t.Fatalf("Failed to decode scrub status: %v", err)
+		}
+		if !status.Running || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Running || status.FinishedAt == nil || status.ChunksScanned != 1 || status.Corruptions != 0 {
+		t.Errorf("Expected a finished clean pass over 1 chunk, got %+v", status)
+	}
+}
+
+func TestScrubRepairsFromPeer(t *testing.T) {
+	t.Setenv("SCRUB_RATE_MB", "0")
+	data := []byte("scrubbed chunk a peer still has intact")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	peer, peerDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(peerDir)
+	if err := peer.storeChunk("scrub-repair", data, checksum); err != nil {
+		t.Fatalf("Failed to store chunk on peer: %v", err)
+	}
+	server := httptest.NewServer(peer.newRouter())
+	defer server.Close()
+
+	t.Setenv("REPLICA_PEERS", server.URL)
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	defer sn.Shutdown()
+	if err := sn.storeChunk("scrub-repair", data, checksum); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	corrupted := corruptStoredChunk(t, sn, "scrub-repair")
+
+	if !sn.scrub.begin() {
+		t.Fatal("Expected no scrub to be running")
+	}
+	sn.runScrub(context.Background())
+
+	repaired, ok := sn.lookupChunk("scrub-repair")
+	if !ok || repaired.blob() == corrupted.blob() {
+		t.Fatalf("Expected the corrupt chunk to be replaced with the peer's copy, got %+v", repaired)
+	}
+	if _, got, err := sn.readVerifiedChunk(repaired); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected the repaired chunk to read back intact: %v", err)
+	}
+	if sn.scrub.isCorrupt(corrupted.blob()) {
+		t.Error("Expected the corrupt mark to be cleared once repaired")
+	}
+}
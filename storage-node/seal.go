@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// sealAgedSuperblocks rotates away from active superblocks older than
+// MAX_SUPERBLOCK_AGE, even if they aren't full, so every period's data ends
+// up in its own immutable superblock for incremental backups. Age is taken
+// from the header's CreatedAt; superblocks with nothing written yet are
+// left alone.
+func (sn *StorageNode) sealAgedSuperblocks(ctx context.Context) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	now := time.Now()
+	sn.sealIfAged(&sn.currentSuperblock, now)
+	if sn.fastTierDir != "" {
+		sn.sealIfAged(&sn.currentFastSuperblock, now)
+	}
+}
+
+// sealIfAged finalizes and rotates away from the superblock current points
+// at if it has reached MAX_SUPERBLOCK_AGE. Caller must hold sn.mu.
+func (sn *StorageNode) sealIfAged(current *int, now time.Time) {
+	id := *current
+	size, err := sn.getSuperblockSize(id)
+	if err != nil || size <= SuperblockHeaderSize {
+		return
+	}
+	hdr, err := sn.readSuperblockHeader(id)
+	if err != nil || hdr.CreatedAt.IsZero() {
+		return // No usable age; sealed by size as before
+	}
+	age := now.Sub(hdr.CreatedAt)
+	if age < sn.maxSuperblockAge {
+		return
+	}
+
+	if err := sn.finalizeSuperblock(id); err != nil {
+		log.Printf("Warning: failed to finalize superblock %d before sealing it: %v", id, err)
+		return
+	}
+	sn.rotateSuperblock(current, size, RotationAged)
+	atomic.AddInt64(&sn.superblocksSealedAge, 1)
+	log.Printf("Sealed %s tier superblock %d after %v, rotating to superblock %d", tierOf(id), id, age.Round(time.Second), *current)
+}
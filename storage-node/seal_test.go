@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSealAgedSuperblock(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	sn.maxSuperblockAge = time.Hour
+
+	store := func(chunkID string) ChunkEntry {
+		data := []byte("sealed by age: " + chunkID)
+		if err := sn.storeChunk(chunkID, data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+		entry, _ := sn.lookupChunk(chunkID)
+		return entry
+	}
+
+	// Nothing written yet: nothing to seal
+	sn.sealAgedSuperblocks(context.Background())
+	if sn.currentSuperblock != 0 {
+		t.Fatalf("Expected an empty superblock to stay active, now at %d", sn.currentSuperblock)
+	}
+
+	first := store("seal-0")
+	sn.sealAgedSuperblocks(context.Background())
+	if sn.currentSuperblock != first.SuperblockID {
+		t.Fatalf("Expected a young superblock to stay active, now at %d", sn.currentSuperblock)
+	}
+
+	// Age the active superblock past the limit
+	hdr, err := sn.readSuperblockHeader(first.SuperblockID)
+	if err != nil {
+		t.Fatalf("Failed to read superblock header: %v", err)
+	}
+	hdr.CreatedAt = time.Now().Add(-2 * time.Hour)
+	if err := sn.writeSuperblockHeader(first.SuperblockID, hdr); err != nil {
+		t.Fatalf("Failed to write superblock header: %v", err)
+	}
+
+	sn.sealAgedSuperblocks(context.Background())
+	if sn.currentSuperblock != first.SuperblockID+1 {
+		t.Fatalf("Expected aged superblock %d to be rotated, now at %d", first.SuperblockID, sn.currentSuperblock)
+	}
+	if next := store("seal-1"); next.SuperblockID != first.SuperblockID+1 {
+		t.Errorf("Expected the next chunk in superblock %d, got %d", first.SuperblockID+1, next.SuperblockID)
+	}
+	if n := sn.superblocksSealedAge; n != 1 {
+		t.Errorf("Expected 1 superblock sealed by age, got %d", n)
+	}
+
+	// The sealed superblock's header describes all of its data
+	hdr, _ = sn.readSuperblockHeader(first.SuperblockID)
+	if size, _ := sn.getSuperblockSize(first.SuperblockID); hdr.ChunkCount != 1 || hdr.NextOffset != size {
+		t.Errorf("Expected a finalized header for 1 chunk ending at %d, got %+v", size, hdr)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes for GET /chunks/search
+const (
+	DefaultSearchLimit = 1000
+	MaxSearchLimit     = 10000
+)
+
+// searchMetaPrefix marks query parameters filtering on user metadata
+const searchMetaPrefix = "meta."
+
+// chunkFilter selects chunks by attribution and user metadata. All set
+// fields must match.
+type chunkFilter struct {
+	storedBy    string
+	hasStoredBy bool
+	meta        map[string]string
+}
+
+func (f chunkFilter) matches(entry ChunkEntry) bool {
+	if f.hasStoredBy && entry.StoredBy != f.storedBy {
+		return false
+	}
+	for key, value := range f.meta {
+		if got, ok := entry.Meta[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchResponse is one page of chunk IDs matching a search, sorted by ID.
+// NextAfter is set when more matches remain; pass it as after= to continue.
+type SearchResponse struct {
+	ChunkIDs  []string `json:"chunk_ids"`
+	NextAfter string   `json:"next_after,omitempty"`
+}
+
+// searchChunks returns up to limit IDs of live chunks matching f that sort
+// after the given ID, and whether more remain. Pages start with a binary
+// search of the sorted listing entries, which may lag the index (see
+// listingEntries), but filtering can still scan the rest of them.
+func (sn *StorageNode) searchChunks(f chunkFilter, after string, limit int) ([]string, bool) {
+	now := time.Now()
+	entries := sn.listingEntries()
+	start := sort.Search(len(entries), func(i int) bool { return entries[i].ChunkID > after })
+
+	var ids []string
+	for _, entry := range entries[start:] {
+		if entry.expired(now) || !f.matches(entry) {
+			continue
+		}
+		if len(ids) == limit {
+			return ids, true
+		}
+		ids = append(ids, entry.ChunkID)
+	}
+	return ids, false
+}
+
+// handleSearchChunks serves GET /chunks/search?stored_by=X&meta.key=value,
+// e.g. to find everything a misbehaving producer wrote. Filters combine with
+// AND and at least one is required; use /admin/manifest to list everything.
+func (sn *StorageNode) handleSearchChunks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var f chunkFilter
+	after := ""
+	limit := DefaultSearchLimit
+
+	for name, values := range query {
+		value := values[0]
+		switch {
+		case name == "stored_by":
+			f.storedBy, f.hasStoredBy = value, true
+		case strings.HasPrefix(name, searchMetaPrefix) && len(name) > len(searchMetaPrefix):
+			if f.meta == nil {
+				f.meta = make(map[string]string)
+			}
+			f.meta[strings.ToLower(name[len(searchMetaPrefix):])] = value
+		case name == "after":
+			after = value
+		case name == "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			if n > MaxSearchLimit {
+				n = MaxSearchLimit
+			}
+			limit = n
+		default:
+			http.Error(w, fmt.Sprintf("Unknown search parameter %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+	if !f.hasStoredBy && len(f.meta) == 0 {
+		http.Error(w, "At least one of stored_by or meta.<key> is required", http.StatusBadRequest)
+		return
+	}
+
+	ids, more := sn.searchChunks(f, after, limit)
+	resp := SearchResponse{ChunkIDs: ids}
+	if resp.ChunkIDs == nil {
+		resp.ChunkIDs = []string{}
+	}
+	if more {
+		resp.NextAfter = ids[len(ids)-1]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode search response: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSearchChunks(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	store := func(chunkID, storedBy string, meta map[string]string) {
+		data := []byte("search data " + chunkID)
+		pw := &pendingWrite{chunkID: chunkID, data: data, checksum: fmt.Sprintf("%x", sha256.Sum256(data)), storedBy: storedBy, meta: meta}
+		if err := sn.storePending(pw); err != nil {
+			t.Fatalf("Failed to store chunk %s: %v", chunkID, err)
+		}
+	}
+	store("bad-1", "producer-bad", map[string]string{"video": "v1"})
+	store("bad-2", "producer-bad", map[string]string{"video": "v2"})
+	store("bad-3", "producer-bad", nil)
+	store("good-1", "producer-good", map[string]string{"video": "v1"})
+	store("anon-1", "", nil)
+
+	search := func(t *testing.T, query string) (int, SearchResponse) {
+		w := httptest.NewRecorder()
+		sn.handleSearchChunks(w, httptest.NewRequest("GET", "/chunks/search?"+query, nil))
+		var resp SearchResponse
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"by_stored_by", "stored_by=producer-bad", []string{"bad-1", "bad-2", "bad-3"}},
+		{"by_metadata", "meta.video=v1", []string{"bad-1", "good-1"}},
+		{"combined_with_and", "stored_by=producer-bad&meta.video=v1", []string{"bad-1"}},
+		{"no_matches", "stored_by=nobody", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := search(t, tt.query)
+			if code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+			}
+			if !reflect.DeepEqual(resp.ChunkIDs, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, resp.ChunkIDs)
+			}
+		})
+	}
+
+	t.Run("paginates", func(t *testing.T) {
+		var all []string
+		after := ""
+		for page := 0; page < 5; page++ {
+			code, resp := search(t, "stored_by=producer-bad&limit=2&after="+after)
+			if code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+			}
+			all = append(all, resp.ChunkIDs...)
+			if resp.NextAfter == "" {
+				break
+			}
+			after = resp.NextAfter
+		}
+		if want := []string{"bad-1", "bad-2", "bad-3"}; !reflect.DeepEqual(all, want) {
+			t.Errorf("Expected %v across pages, got %v", want, all)
+		}
+	})
+
+	t.Run("rejects_bad_queries", func(t *testing.T) {
+		for _, query := range []string{"", "limit=10", "stored_by=x&limit=0", "owner=x"} {
+			if code, _ := search(t, query); code != http.StatusBadRequest {
+				t.Errorf("Query %q: expected status %d, got %d", query, http.StatusBadRequest, code)
+			}
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultStreamThreshold is the largest chunk ever held in memory whole (see
+// STREAM_THRESHOLD_MB). PUTs above SmallChunkThreshold are always streamed;
+// batch PUT items above this are streamed or rejected.
+const DefaultStreamThreshold = 8 * 1024 * 1024
+
+var (
+	errChecksumMismatch = errors.New("checksum mismatch")
+	errShortBody        = errors.New("chunk body shorter than its declared size")
+)
+
+// expectedChecksum is a client-supplied checksum a streamed chunk must match.
+// An advisory checksum doesn't fail the write; mismatched records whether
+// the chunk matched it.
+type expectedChecksum struct {
+	algo       string
+	value      string
+	advisory   bool
+	mismatched bool
+}
+
+// storeChunkStream stores a chunk of expectedSize bytes read from r without
+// buffering it in memory
+func (sn *StorageNode) storeChunkStream(chunkID string, r io.Reader, expectedSize int64) (ChunkEntry, error) {
+	return sn.storeStream(&pendingWrite{chunkID: chunkID}, r, expectedSize, nil)
+}
+
+// storeStream stores a chunk of size bytes read from r, hashing it on the
+// way through, without buffering it in memory. Space for the chunk is
+// reserved at the end of the active superblock under sn.mu and the body is
+// copied into it with the lock released, so a slow client never holds up
+// other writes: they append after the reservation. A short body or data not
+// matching expect releases the reservation, as does finding the data
+// already stored under DEDUP; an advisory expect is only recorded as
+// mismatched. pw supplies the chunk's ID and metadata; its data and
+// checksum are ignored.
+func (sn *StorageNode) storeStream(pw *pendingWrite, r io.Reader, size int64, expect *expectedChecksum) (ChunkEntry, error) {
+	if sn.isReadOnly() {
+		return ChunkEntry{}, errReadOnly
+	}
+	if sn.chunkCipher != nil {
+		// Never reached with a valid configuration, which buffers every
+		// chunk when encrypting; refuse rather than write plaintext
+		return ChunkEntry{}, fmt.Errorf("%w: %d bytes can't be streamed with ENCRYPTION_KEY set", errChunkTooLarge, size)
+	}
+
+	nodeHash, err := newChecksumHash(sn.checksumAlgo)
+	if err != nil {
+		return ChunkEntry{}, err
+	}
+	hashes := []io.Writer{nodeHash}
+	clientHash := nodeHash
+	if expect != nil && expect.algo != sn.checksumAlgo {
+		if clientHash, err = newChecksumHash(expect.algo); err != nil {
+			return ChunkEntry{}, err
+		}
+		hashes = append(hashes, clientHash)
+	}
+
+	res, err := sn.reserveStream(pw.chunkID, size)
+	if err != nil {
+		return ChunkEntry{}, err
+	}
+
+	body := io.TeeReader(io.LimitReader(r, size), io.MultiWriter(hashes...))
+	src := &trackedReader{r: body}
+	n, err := io.Copy(io.NewOffsetWriter(res.file, res.payload), src)
+	switch {
+	case src.err != nil:
+		err = fmt.Errorf("%w: %v", errShortBody, src.err)
+	case err != nil:
+		err = fmt.Errorf("failed to write chunk data: %w", err)
+	case n != size:
+		err = fmt.Errorf("%w: expected %d bytes, got %d", errShortBody, size, n)
+	case expect != nil:
+		if computed := hex.EncodeToString(clientHash.Sum(nil)); computed != expect.value {
+			if !expect.advisory {
+				err = fmt.Errorf("%w: expected %s, got %s", errChecksumMismatch, expect.value, computed)
+			}
+			expect.mismatched = true
+		}
+	}
+	checksum := hex.EncodeToString(nodeHash.Sum(nil))
+
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	if err == nil {
+		if entry, ok := sn.storeStreamedDuplicate(pw, res, checksum); ok {
+			return entry, nil
+		}
+		err = sn.completeStream(res, checksum)
+	}
+	if err != nil {
+		sn.releaseStream(res)
+		sn.noteWriteError(err)
+		return ChunkEntry{}, err
+	}
+
+	entry := ChunkEntry{
+		ChunkID:      pw.chunkID,
+		SuperblockID: res.id,
+		Offset:       res.payload,
+		Size:         int32(size),
+		Checksum:     checksum,
+		ChecksumAlgo: sn.checksumAlgo,
+		StoredAt:     time.Now(),
+		StoredBy:     pw.storedBy,
+		ExpiresAt:    pw.expiresAt,
+		Meta:         pw.meta,
+	}
+	sn.commitEntries([]ChunkEntry{entry}, []*pendingWrite{pw})
+	return entry, nil
+}
+
+// checkStreamFits reports whether a streamed chunk of size bytes can be
+// stored at all. Caller must hold sn.mu, under which the coordinator can
+// reassign the superblock size.
+func (sn *StorageNode) checkStreamFits(chunkID string, size int64) error {
+	if SuperblockHeaderSize+frameSize(chunkID)+size > sn.maxSuperblockSize {
+		return fmt.Errorf("%w: %d bytes, superblock size is %d bytes", errChunkTooLarge, size, sn.maxSuperblockSize)
+	}
+	return sn.checkCapacity()
+}
+
+// streamReservation is space at the end of a superblock set aside for a
+// chunk whose body is still being read
+type streamReservation struct {
+	id      int
+	file    *os.File
+	hdr     *SuperblockHeader // nil for a legacy superblock, whose chunks have no frame
+	start   int64             // where the chunk's frame begins
+	payload int64             // where its data begins
+	end     int64
+}
+
+// reserveStream sets aside room for a streamed chunk of size bytes at the
+// end of the active superblock, writing its frame with a blank checksum.
+// Until the reservation is completed or released the superblock counts as
+// active, so it is neither compacted nor removed under the stream.
+func (sn *StorageNode) reserveStream(chunkID string, size int64) (*streamReservation, error) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	if err := sn.checkStreamFits(chunkID, size); err != nil {
+		return nil, err
+	}
+
+	// Streams can't be replayed, so unlike appendChunks there is no falling
+	// back to the primary tier after a fast tier failure
+	current := &sn.currentSuperblock
+	if sn.fastTierDir != "" {
+		current = &sn.currentFastSuperblock
+	}
+	for {
+		currentSize, err := sn.getSuperblockSize(*current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get superblock size: %w", err)
+		}
+		if currentSize == 0 {
+			currentSize = SuperblockHeaderSize // Written with the reservation
+		}
+		if currentSize+frameSize(chunkID)+size <= sn.maxSuperblockSize {
+			break
+		}
+		sn.rotateSuperblock(current, currentSize, RotationFull)
+	}
+
+	file, start, hdr, err := sn.openSuperblockForAppend(*current)
+	if err != nil {
+		sn.noteWriteError(err)
+		return nil, err
+	}
+	res := &streamReservation{id: *current, file: file, hdr: hdr, start: start, payload: start}
+	if hdr != nil {
+		res.payload += frameSize(chunkID)
+	}
+	res.end = res.payload + size
+
+	err = file.Truncate(res.end)
+	if err == nil && hdr != nil {
+		// The checksum is patched in by completeStream once known
+		frame := chunkFrame{ChunkID: chunkID, Size: int32(size), ChecksumAlgo: sn.checksumAlgo, WrittenAt: time.Now()}
+		var encoded []byte
+		if encoded, err = frame.encode(); err == nil {
+			_, err = file.WriteAt(encoded, start)
+		}
+	}
+	if err != nil {
+		sn.undoAppend(res.id, file, start, res.end-start)
+		file.Close()
+		err = fmt.Errorf("failed to reserve space for chunk: %w", err)
+		sn.noteWriteError(err)
+		return nil, err
+	}
+	sn.streaming[res.id]++
+	return res, nil
+}
+
+// completeStream back-patches the frame checksum of a streamed chunk once
+// all of it is written and advances the superblock header past it. On error
+// the caller releases the reservation. Caller must hold sn.mu.
+func (sn *StorageNode) completeStream(res *streamReservation, checksum string) error {
+	if res.hdr != nil {
+		if err := patchFrameChecksum(res.file, res.start, checksum); err != nil {
+			return fmt.Errorf("failed to write chunk checksum: %w", err)
+		}
+
+		// Chunks may have been appended after the reservation meanwhile
+		hdr, err := readHeaderFrom(res.file)
+		if err == nil {
+			err = recordAppend(res.file, &hdr, 1, max(hdr.NextOffset, res.end))
+		}
+		if err != nil {
+			log.Printf("Warning: failed to update superblock %d header: %v", res.id, err)
+		}
+	}
+
+	if sn.chunkFsync.due(sn.getSuperblockPath(res.id)) {
+		if err := res.file.Sync(); err != nil {
+			log.Printf("Warning: failed to sync superblock %d to disk: %v", res.id, err)
+		}
+	}
+	sn.finishStream(res)
+	return nil
+}
+
+// releaseStream gives up a streamed chunk's reservation. It is truncated
+// off the superblock if nothing was appended after it, and otherwise left
+// as dead bytes whose blank frame checksum keeps it out of rebuilds.
+// Caller must hold sn.mu.
+func (sn *StorageNode) releaseStream(res *streamReservation) {
+	if info, err := res.file.Stat(); err == nil && info.Size() == res.end {
+		sn.undoAppend(res.id, res.file, res.start, res.end-res.start)
+	} else {
+		sn.markDead(res.id, res.end-res.start)
+	}
+	sn.finishStream(res)
+}
+
+func (sn *StorageNode) finishStream(res *streamReservation) {
+	res.file.Close()
+	sn.invalidateSuperblockChecksum(res.id)
+	if sn.streaming[res.id]--; sn.streaming[res.id] == 0 {
+		delete(sn.streaming, res.id)
+	}
+}
+
+// undoAppend truncates a superblock back to offset, discarding n bytes of a
+// failed append. Bytes that can't be truncated are accounted as dead.
+func (sn *StorageNode) undoAppend(id int, file *os.File, offset, n int64) {
+	if err := file.Truncate(offset); err != nil {
+		log.Printf("Warning: failed to truncate superblock %d to %d after a failed write; %d bytes left dead: %v", id, offset, n, err)
+		sn.markDead(id, n)
+	}
+}
+
+// trackedReader records a read error so it can be told apart from a write
+// error when copying
+type trackedReader struct {
+	r   io.Reader
+	err error
+}
+
+func (t *trackedReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if err != nil && err != io.EOF {
+		t.err = err
+	}
+	return n, err
+}
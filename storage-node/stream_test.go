@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestStreamingPut(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	data := bytes.Repeat([]byte("streamed chunk data "), 1024) // above SmallChunkThreshold
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	put := func(chunkID string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader(body))
+		req.ContentLength = int64(len(data))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	superblockSize := func() int64 {
+		size, err := sn.getCurrentSuperblockSize()
+		if err != nil {
+			t.Fatalf("Failed to get superblock size: %v", err)
+		}
+		return size
+	}
+
+	t.Run("stores_and_serves", func(t *testing.T) {
+		rr := put("streamed", data, map[string]string{"X-Chunk-Checksum": checksum})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("ETag") != checksum {
+			t.Errorf("Expected ETag %s, got %s", checksum, rr.Header().Get("ETag"))
+		}
+
+		req := httptest.NewRequest("GET", "/chunk/streamed", nil)
+		get := httptest.NewRecorder()
+		router.ServeHTTP(get, req)
+		if get.Code != http.StatusOK || !bytes.Equal(get.Body.Bytes(), data) {
+			t.Errorf("Expected the stored chunk back, got %d with %d bytes", get.Code, get.Body.Len())
+		}
+	})
+
+	t.Run("checksum_mismatch_truncates", func(t *testing.T) {
+		before := superblockSize()
+		rr := put("mismatched", data, map[string]string{"X-Chunk-Checksum": fmt.Sprintf("%x", sha256.Sum256(nil))})
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400, got %d", rr.Code)
+		}
+		if after := superblockSize(); after != before {
+			t.Errorf("Expected superblock to stay at %d bytes, got %d", before, after)
+		}
+		if _, ok := sn.lookupChunk("mismatched"); ok {
+			t.Error("Expected mismatched chunk not to be indexed")
+		}
+	})
+
+	t.Run("short_body_truncates", func(t *testing.T) {
+		before := superblockSize()
+		rr := put("short", data[:len(data)/2], nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400, got %d", rr.Code)
+		}
+		if after := superblockSize(); after != before {
+			t.Errorf("Expected superblock to stay at %d bytes, got %d", before, after)
+		}
+
+		_, err := sn.storeChunkStream("short-direct", bytes.NewReader(data[:10]), int64(len(data)))
+		if !errors.Is(err, errShortBody) {
+			t.Errorf("Expected errShortBody, got %v", err)
+		}
+		if after := superblockSize(); after != before {
+			t.Errorf("Expected superblock to stay at %d bytes, got %d", before, after)
+		}
+	})
+
+	t.Run("client_algorithm", func(t *testing.T) {
+		var sum [4]byte
+		binary.BigEndian.PutUint32(sum[:], crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+		rr := put("streamed-crc", data, map[string]string{
+			"X-Chunk-Checksum":      hex.EncodeToString(sum[:]),
+			"X-Chunk-Checksum-Algo": "crc32c",
+		})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if entry, _ := sn.lookupChunk("streamed-crc"); entry.Checksum != checksum {
+			t.Errorf("Expected chunk stored with sha256 %s, got %s", checksum, entry.Checksum)
+		}
+	})
+}
+
+// allocatedDuring returns the bytes allocated while fn runs
+func allocatedDuring(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestStreamingPutBeyondMemoryBudget(t *testing.T) {
+	const size = 32 * 1024 * 1024
+	t.Setenv("MAX_CHUNK_SIZE_MB", "64")
+	t.Setenv("STREAM_THRESHOLD_MB", "1")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	router := sn.newRouter()
+
+	// The payload is generated as it's read, so only the node could buffer it
+	hasher := sha256.New()
+	body := io.TeeReader(io.LimitReader(rand.New(rand.NewSource(1)), size), hasher)
+	req := httptest.NewRequest("PUT", "/chunk/huge", body)
+	req.ContentLength = size
+	rr := httptest.NewRecorder()
+	allocated := allocatedDuring(func() { router.ServeHTTP(rr, req) })
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if allocated > size/4 {
+		t.Errorf("Expected the chunk to be streamed, but storing it allocated %d bytes", allocated)
+	}
+
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+	entry, _ := sn.lookupChunk("huge")
+	if entry.Checksum != checksum || entry.Size != size {
+		t.Fatalf("Expected a %d byte chunk with checksum %s, got %d bytes with %s", size, checksum, entry.Size, entry.Checksum)
+	}
+
+	// The frame's checksum was filled in once the payload was through
+	file, err := os.Open(sn.getSuperblockPath(entry.SuperblockID))
+	if err != nil {
+		t.Fatalf("Failed to open superblock: %v", err)
+	}
+	defer file.Close()
+	frame, err := readFrameAt(file, entry.Offset-frameSize(entry.ChunkID))
+	if err != nil {
+		t.Fatalf("Failed to read chunk frame: %v", err)
+	}
+	if frame.Checksum != checksum || frame.Size != size {
+		t.Errorf("Expected the frame to record checksum %s, got %s", checksum, frame.Checksum)
+	}
+
+	stored := sha256.New()
+	if _, err := io.Copy(stored, io.NewSectionReader(file, entry.Offset, int64(entry.Size))); err != nil {
+		t.Fatalf("Failed to read chunk back: %v", err)
+	}
+	if hex.EncodeToString(stored.Sum(nil)) != checksum {
+		t.Error("Expected the stored payload to match its checksum")
+	}
+
+	// A chunk as large that fails its checksum is truncated away, frame and all
+	before, _ := sn.getSuperblockSize(entry.SuperblockID)
+	req = httptest.NewRequest("PUT", "/chunk/huge-bad", io.LimitReader(rand.New(rand.NewSource(2)), size))
+	req.ContentLength = size
+	req.Header.Set("X-Chunk-Checksum", checksum)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a checksum mismatch, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if after, _ := sn.getSuperblockSize(entry.SuperblockID); after != before {
+		t.Errorf("Expected the superblock to stay at %d bytes, got %d", before, after)
+	}
+}
+
+func TestBatchPutStreamsLargeItems(t *testing.T) {
+	const size = 4 * 1024 * 1024
+	t.Setenv("MAX_CHUNK_SIZE_MB", "8")
+	t.Setenv("STREAM_THRESHOLD_MB", "1")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+	r := newBatchTestRouter(sn)
+
+	large := make([]byte, size)
+	rand.New(rand.NewSource(2)).Read(large)
+	var body bytes.Buffer
+	writeBatchFrame(&body, "batch-large", large)
+	writeBatchFrame(&body, "batch-small", []byte("buffered"))
+	writeBatchFrame(&body, "batch-large", large)
+
+	req := httptest.NewRequest("POST", "/chunks/batch", &body)
+	req.Header.Set("Content-Type", BatchContentType)
+	w := httptest.NewRecorder()
+	allocated := allocatedDuring(func() { r.ServeHTTP(w, req) })
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected 207 with a duplicate in the batch, got %d: %s", w.Code, w.Body.String())
+	}
+	if allocated > size/2 {
+		t.Errorf("Expected the large frame to be streamed, but the batch allocated %d bytes", allocated)
+	}
+	var resp BatchPutResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode batch response: %v", err)
+	}
+	statuses := make([]int, len(resp.Results))
+	for i, result := range resp.Results {
+		statuses[i] = result.Status
+	}
+	if fmt.Sprint(statuses) != "[201 201 409]" {
+		t.Errorf("Expected statuses [201 201 409], got %v", statuses)
+	}
+	if entry, _ := sn.lookupChunk("batch-large"); entry.Checksum != fmt.Sprintf("%x", sha256.Sum256(large)) {
+		t.Errorf("Expected the streamed chunk to be stored with its checksum, got %q", entry.Checksum)
+	}
+
+	// A multipart part's length isn't known up front, so it can't be streamed
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+	part, _ := mw.CreateFormFile("multipart-large", "multipart-large")
+	part.Write(large)
+	mw.Close()
+	req = httptest.NewRequest("POST", "/chunks/batch", &parts)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a multipart part over the stream threshold, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A frame cut short mid-stream is undone and fails the batch
+	body.Reset()
+	writeBatchFrame(&body, "batch-cut", large)
+	before, _ := sn.getCurrentSuperblockSize()
+	req = httptest.NewRequest("POST", "/chunks/batch", bytes.NewReader(body.Bytes()[:body.Len()/2]))
+	req.Header.Set("Content-Type", BatchContentType)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a truncated frame, got %d", w.Code)
+	}
+	if after, _ := sn.getCurrentSuperblockSize(); after != before {
+		t.Errorf("Expected the superblock to stay at %d bytes, got %d", before, after)
+	}
+	if _, ok := sn.lookupChunk("batch-cut"); ok {
+		t.Error("Expected the truncated chunk not to be indexed")
+	}
+}
+
+func TestSlowStreamDoesNotBlockWrites(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := bytes.Repeat([]byte("slow upload "), 8192)
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := sn.storeChunkStream("slow", pr, int64(len(data)))
+		done <- err
+	}()
+	pw.Write(data[:len(data)/2])
+
+	// The upload is stalled mid-body; other writes go through meanwhile
+	written := make(chan error, 1)
+	go func() {
+		other := []byte("written while the stream stalls")
+		written <- sn.storeChunk("other", other, fmt.Sprintf("%x", sha256.Sum256(other)))
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write blocked behind a stalled streamed upload")
+	}
+
+	pw.Write(data[len(data)/2:])
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Streamed upload failed: %v", err)
+	}
+	entry, _ := sn.lookupChunk("slow")
+	if _, got, err := sn.readVerifiedChunk(entry); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Failed to read streamed chunk back: %v", err)
+	}
+	// The other write appended after the stream's reservation
+	if other, _ := sn.lookupChunk("other"); other.Offset < entry.Offset+int64(entry.Size) {
+		t.Errorf("Expected the other chunk after the streamed one at %d, got %d", entry.Offset, other.Offset)
+	}
+}
+
+func TestAbortedStreamLeavesLaterWrites(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := bytes.Repeat([]byte("aborted upload "), 8192)
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := sn.storeChunkStream("aborted", pr, int64(len(data)))
+		done <- err
+	}()
+	pw.Write(data[:len(data)/2])
+
+	other := []byte("written after the reservation")
+	if err := sn.storeChunk("other", other, fmt.Sprintf("%x", sha256.Sum256(other))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	pw.CloseWithError(io.ErrUnexpectedEOF)
+	if err := <-done; !errors.Is(err, errShortBody) {
+		t.Fatalf("Expected a short body error, got %v", err)
+	}
+
+	// The reservation can't be truncated away from under the other chunk,
+	// so it is left dead
+	if _, ok := sn.lookupChunk("aborted"); ok {
+		t.Error("Expected the aborted chunk not to be indexed")
+	}
+	if dead := sn.getDeadBytes(sn.currentSuperblock); dead < int64(len(data)) {
+		t.Errorf("Expected the reservation to be counted dead, got %d dead bytes", dead)
+	}
+	entry, _ := sn.lookupChunk("other")
+	if _, got, err := sn.readVerifiedChunk(entry); err != nil || !bytes.Equal(got, other) {
+		t.Errorf("Failed to read the later chunk back: %v", err)
+	}
+
+	// Nor is the aborted chunk resurrected by a rebuild
+	if err := sn.RebuildIndex(); err != nil {
+		t.Fatalf("Failed to rebuild index: %v", err)
+	}
+	if _, ok := sn.lookupChunk("aborted"); ok {
+		t.Error("Expected a rebuild to skip the aborted chunk")
+	}
+}
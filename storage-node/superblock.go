@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Superblock format versions
+const (
+	LegacySuperblockVersion = 1 // headerless data, header kept in superblock_<id>.hdr
+	SuperblockVersion       = 2 // header at the front of the file, framed chunks
+)
+
+// On-disk layout of a superblock file (version 2):
+//
+//	offset  size  field
+//	0       8     magic "VSTACKSB"
+//	8       4     version (uint32, little-endian)
+//	12      4     chunk count: chunks appended, less any reclaimed from the tail
+//	16      8     next offset: end of the last complete append (int64)
+//	24      8     created at, Unix nanoseconds (int64)
+//	32      4     CRC-32C of bytes 0-31
+//	36      28    reserved, zero
+//	64      ...   chunks, back to back, each preceded by its frame (frame.go)
+//
+// Index offsets are absolute within the file and point past the frame at the
+// chunk's payload. The header is rewritten in place after every append, so a
+// next offset that disagrees with the file size means an append or its
+// header update was torn by a crash. Startup reconciles the active
+// superblock's header with a scan of its records before accepting writes
+// (see reconcileSuperblockHeader). When fsck repairs such a header the chunk
+// count is reset to the chunks the index still references.
+//
+// Superblocks written before version 2 have no header and unframed chunks:
+// their data starts at offset 0 and their header is a JSON sidecar finalized
+// on shutdown. They keep working as they are, but can't be scanned by
+// RebuildIndex; compaction rewrites them in the current format.
+const (
+	SuperblockMagic      = "VSTACKSB"
+	SuperblockHeaderSize = 64
+)
+
+// errNoSuperblockHeader means a superblock file doesn't start with a header,
+// i.e. it predates version 2
+var errNoSuperblockHeader = errors.New("superblock has no header")
+
+// encode returns the header's on-disk form
+func (h SuperblockHeader) encode() []byte {
+	buf := make([]byte, SuperblockHeaderSize)
+	copy(buf, SuperblockMagic)
+	binary.LittleEndian.PutUint32(buf[8:], h.Version)
+	binary.LittleEndian.PutUint32(buf[12:], h.ChunkCount)
+	binary.LittleEndian.PutUint64(buf[16:], uint64(h.NextOffset))
+	binary.LittleEndian.PutUint64(buf[24:], uint64(h.CreatedAt.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[32:], crc32.Checksum(buf[:32], crc32cTable))
+	return buf
+}
+
+// readHeaderFrom decodes the header at the front of a superblock file
+func readHeaderFrom(file io.ReaderAt) (SuperblockHeader, error) {
+	buf := make([]byte, SuperblockHeaderSize)
+	if _, err := file.ReadAt(buf, 0); err != nil || string(buf[:8]) != SuperblockMagic {
+		return SuperblockHeader{}, errNoSuperblockHeader
+	}
+	if crc32.Checksum(buf[:32], crc32cTable) != binary.LittleEndian.Uint32(buf[32:]) {
+		return SuperblockHeader{Version: SuperblockVersion}, fmt.Errorf("superblock header checksum mismatch")
+	}
+	return SuperblockHeader{
+		Version:    binary.LittleEndian.Uint32(buf[8:]),
+		ChunkCount: binary.LittleEndian.Uint32(buf[12:]),
+		NextOffset: int64(binary.LittleEndian.Uint64(buf[16:])),
+		CreatedAt:  time.Unix(0, int64(binary.LittleEndian.Uint64(buf[24:]))),
+	}, nil
+}
+
+func (sn *StorageNode) getSuperblockHeaderPath(id int) string {
+	return filepath.Join(sn.dataDir, "data", fmt.Sprintf("superblock_%d.hdr", id))
+}
+
+// readSuperblockHeader loads a superblock's header from the front of the
+// file, or from the sidecar of a legacy superblock
+func (sn *StorageNode) readSuperblockHeader(id int) (SuperblockHeader, error) {
+	file, err := os.Open(sn.getSuperblockPath(id))
+	if err != nil {
+		return SuperblockHeader{}, err
+	}
+	hdr, err := readHeaderFrom(file)
+	file.Close()
+	if !errors.Is(err, errNoSuperblockHeader) {
+		return hdr, err
+	}
+
+	data, err := os.ReadFile(sn.getSuperblockHeaderPath(id))
+	if err != nil {
+		return hdr, err
+	}
+	if err := json.Unmarshal(data, &hdr); err != nil {
+		return hdr, fmt.Errorf("failed to decode superblock header: %w", err)
+	}
+	return hdr, nil
+}
+
+// writeSuperblockHeader durably replaces the header for a superblock, in
+// place for the current format or as the sidecar of a legacy superblock
+func (sn *StorageNode) writeSuperblockHeader(id int, hdr SuperblockHeader) error {
+	if hdr.Version >= SuperblockVersion {
+		file, err := os.OpenFile(sn.getSuperblockPath(id), os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open superblock: %w", err)
+		}
+		defer file.Close()
+		if _, err := file.WriteAt(hdr.encode(), 0); err != nil {
+			return fmt.Errorf("failed to write superblock header: %w", err)
+		}
+		sn.invalidateSuperblockChecksum(id)
+		return file.Sync()
+	}
+
+	data, err := json.Marshal(hdr)
+	if err != nil {
+		return fmt.Errorf("failed to encode superblock header: %w", err)
+	}
+
+	path := sn.getSuperblockHeaderPath(id)
+	tempFile := sn.tempPath(path)
+	file, err := os.Create(tempFile)
+	if err != nil {
+		return fmt.Errorf("failed to create temp header file: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write superblock header: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to sync superblock header: %w", err)
+	}
+	file.Close()
+
+	if err := sn.replaceFile(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename superblock header: %w", err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// openSuperblockForAppend opens a superblock to append chunks to, creating
+// it with a header if it is new or empty. It returns the offset to append at
+// and the header to advance with recordAppend, nil for a legacy superblock.
+// A damaged header is rebuilt rather than failing writes. Caller must hold
+// sn.mu.
+func (sn *StorageNode) openSuperblockForAppend(id int) (*os.File, int64, *SuperblockHeader, error) {
+	path := sn.getSuperblockPath(id)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to open superblock file %s: %w", path, err)
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, 0, nil, fmt.Errorf("failed to seek to end of superblock: %w", err)
+	}
+
+	if size == 0 {
+		hdr := SuperblockHeader{Version: SuperblockVersion, NextOffset: SuperblockHeaderSize, CreatedAt: time.Now()}
+		if _, err := file.Write(hdr.encode()); err != nil {
+			file.Close()
+			return nil, 0, nil, fmt.Errorf("failed to write superblock header: %w", err)
+		}
+		return file, SuperblockHeaderSize, &hdr, nil
+	}
+
+	hdr, err := readHeaderFrom(file)
+	switch {
+	case errors.Is(err, errNoSuperblockHeader):
+		return file, size, nil, nil
+	case err != nil:
+		log.Printf("Warning: rebuilding damaged header of superblock %d: %v", id, err)
+		if hdr, err = sn.currentSuperblockHeader(id); err != nil {
+			file.Close()
+			return nil, 0, nil, err
+		}
+	}
+	return file, size, &hdr, nil
+}
+
+// recordAppend advances a superblock's header past chunks just appended,
+// ending at end. Legacy superblocks (nil header) have nothing to update.
+func recordAppend(file *os.File, hdr *SuperblockHeader, chunks int, end int64) error {
+	if hdr == nil {
+		return nil
+	}
+	hdr.ChunkCount += uint32(chunks)
+	hdr.NextOffset = end
+	_, err := file.WriteAt(hdr.encode(), 0)
+	return err
+}
+
+// currentSuperblockHeader computes an up-to-date header for a superblock from
+// the file size and the index, counting the chunks the index references.
+// CreatedAt and the format version are preserved from any existing header.
+func (sn *StorageNode) currentSuperblockHeader(id int) (SuperblockHeader, error) {
+	info, err := os.Stat(sn.getSuperblockPath(id))
+	if err != nil {
+		return SuperblockHeader{}, fmt.Errorf("failed to stat superblock: %w", err)
+	}
+
+	// Deduplicated chunks sharing stored bytes count once
+	offsets := make(map[int64]struct{})
+	sn.index.mu.RLock()
+	for _, entry := range sn.index.chunks {
+		if entry.SuperblockID == id {
+			offsets[entry.Offset] = struct{}{}
+		}
+	}
+	sn.index.mu.RUnlock()
+	count := uint32(len(offsets))
+
+	createdAt, version := time.Now(), uint32(LegacySuperblockVersion)
+	old, err := sn.readSuperblockHeader(id)
+	if err == nil && !old.CreatedAt.IsZero() {
+		createdAt = old.CreatedAt
+	}
+	if old.Version >= SuperblockVersion {
+		version = old.Version
+	}
+
+	return SuperblockHeader{
+		Version:    version,
+		ChunkCount: count,
+		NextOffset: info.Size(),
+		CreatedAt:  createdAt,
+	}, nil
+}
+
+// finalizeActiveSuperblock writes and fsyncs the header of the active
+// superblock so a clean restart can trust it without scanning.
+func (sn *StorageNode) finalizeActiveSuperblock() error {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	return sn.finalizeSuperblock(sn.currentSuperblock)
+}
+
+// finalizeSuperblock makes a superblock and its header durable. Caller must
+// hold sn.mu.
+func (sn *StorageNode) finalizeSuperblock(id int) error {
+	if _, err := os.Stat(sn.getSuperblockPath(id)); os.IsNotExist(err) {
+		return nil // Nothing written yet
+	}
+
+	// Make sure the data the header describes is durable too
+	if file, err := os.OpenFile(sn.getSuperblockPath(id), os.O_WRONLY, 0644); err == nil {
+		if err := file.Sync(); err != nil {
+			log.Printf("Warning: failed to sync superblock %d: %v", id, err)
+		}
+		file.Close()
+	}
+
+	// Headers in the file are kept current by every append
+	if hdr, err := sn.readSuperblockHeader(id); err == nil && hdr.Version >= SuperblockVersion {
+		if size, err := sn.getSuperblockSize(id); err == nil && hdr.NextOffset == size {
+			return nil
+		}
+	}
+
+	hdr, err := sn.currentSuperblockHeader(id)
+	if err != nil {
+		return err
+	}
+	if err := sn.writeSuperblockHeader(id, hdr); err != nil {
+		return err
+	}
+	log.Printf("Finalized superblock %d header (chunks: %d, next offset: %d)", id, hdr.ChunkCount, hdr.NextOffset)
+	return nil
+}
+
+// validateActiveSuperblockHeader compares the active superblock's header
+// against the file on startup and reports whether it can be trusted.
+func (sn *StorageNode) validateActiveSuperblockHeader() bool {
+	id := sn.currentSuperblock
+	info, err := os.Stat(sn.getSuperblockPath(id))
+	if err != nil {
+		return false
+	}
+
+	hdr, err := sn.readSuperblockHeader(id)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: unreadable header for superblock %d: %v", id, err)
+		}
+		return false
+	}
+
+	if hdr.NextOffset != info.Size() {
+		log.Printf("Warning: superblock %d header is stale (next offset %d, file size %d)", id, hdr.NextOffset, info.Size())
+		return false
+	}
+	return true
+}
+
+// syncDir fsyncs a directory so renames within it are durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory for sync: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
+
+// markDead records bytes in a superblock that are no longer referenced by
+// any index entry (deleted or relocated chunks) so they can be reclaimed later
+func (sn *StorageNode) markDead(id int, size int64) {
+	sn.deadMu.Lock()
+	sn.deadBytes[id] += size
+	sn.deadMu.Unlock()
+}
+
+// getDeadBytes returns the dead byte count recorded for a superblock
+func (sn *StorageNode) getDeadBytes(id int) int64 {
+	sn.deadMu.Lock()
+	defer sn.deadMu.Unlock()
+	return sn.deadBytes[id]
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestShutdownFinalizesSuperblockHeader(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	for i := 0; i < 3; i++ {
+		data := []byte(fmt.Sprintf("header test chunk %d", i))
+		checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+		if err := sn.storeChunk(fmt.Sprintf("hdr-%d", i), data, checksum); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	}
+
+	sn.Shutdown()
+
+	hdr, err := sn.readSuperblockHeader(sn.currentSuperblock)
+	if err != nil {
+		t.Fatalf("Failed to read superblock header: %v", err)
+	}
+
+	info, err := os.Stat(sn.getSuperblockPath(sn.currentSuperblock))
+	if err != nil {
+		t.Fatalf("Failed to stat superblock: %v", err)
+	}
+
+	if hdr.ChunkCount != 3 {
+		t.Errorf("Expected header chunk count 3, got %d", hdr.ChunkCount)
+	}
+	if hdr.NextOffset != info.Size() {
+		t.Errorf("Expected header next offset %d, got %d", info.Size(), hdr.NextOffset)
+	}
+	if hdr.Version != SuperblockVersion {
+		t.Errorf("Expected header version %d, got %d", SuperblockVersion, hdr.Version)
+	}
+
+	// A clean restart trusts the header
+	sn2 := NewStorageNode(tempDir, "test-node")
+	if err := sn2.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage node after restart: %v", err)
+	}
+	if !sn2.validateActiveSuperblockHeader() {
+		t.Error("Expected finalized header to validate after clean restart")
+	}
+
+	// The in-file header is kept current by every append
+	data := []byte("written after restart")
+	if err := sn2.storeChunk("hdr-late", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	if !sn2.validateActiveSuperblockHeader() {
+		t.Error("Expected header to stay valid after append")
+	}
+	if hdr, err := sn2.readSuperblockHeader(sn2.currentSuperblock); err != nil || hdr.ChunkCount != 4 {
+		t.Errorf("Expected header chunk count 4 after append, got %+v (%v)", hdr, err)
+	}
+}
+
+func TestNewSuperblockStartsWithHeader(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	data := []byte("first chunk after the header")
+	if err := sn.storeChunk("hdr-first", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	entry, ok := sn.lookupChunk("hdr-first")
+	if !ok {
+		t.Fatal("Stored chunk missing from index")
+	}
+	if want := SuperblockHeaderSize + frameSize(entry.ChunkID); entry.Offset != want {
+		t.Errorf("Expected first chunk's payload at offset %d, got %d", want, entry.Offset)
+	}
+
+	raw, err := os.ReadFile(sn.getSuperblockPath(entry.SuperblockID))
+	if err != nil {
+		t.Fatalf("Failed to read superblock: %v", err)
+	}
+	if string(raw[:8]) != SuperblockMagic {
+		t.Errorf("Expected superblock to start with %q, got %q", SuperblockMagic, raw[:8])
+	}
+	if _, err := os.Stat(sn.getSuperblockHeaderPath(entry.SuperblockID)); !os.IsNotExist(err) {
+		t.Error("Expected no header sidecar for a current-format superblock")
+	}
+
+	hdr, err := sn.readSuperblockHeader(entry.SuperblockID)
+	if err != nil {
+		t.Fatalf("Failed to read superblock header: %v", err)
+	}
+	if hdr.Version != SuperblockVersion || hdr.ChunkCount != 1 || hdr.NextOffset != int64(len(raw)) {
+		t.Errorf("Unexpected header %+v for a %d byte superblock", hdr, len(raw))
+	}
+
+	got, err := sn.readChunk(entry)
+	if err != nil || string(got) != string(data) {
+		t.Errorf("Expected to read back %q, got %q (%v)", data, got, err)
+	}
+
+	// Deleting the tail chunk rewinds the header with the file
+	sn.deleteChunk("hdr-first")
+	hdr, err = sn.readSuperblockHeader(entry.SuperblockID)
+	if err != nil {
+		t.Fatalf("Failed to read superblock header after delete: %v", err)
+	}
+	if hdr.ChunkCount != 0 || hdr.NextOffset != SuperblockHeaderSize {
+		t.Errorf("Expected header rewound to the empty superblock, got %+v", hdr)
+	}
+}
+
+func TestLegacySuperblockStaysHeaderless(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	// A superblock written before the in-file header: data from offset 0
+	// and a JSON sidecar
+	old := []byte("chunk from a legacy superblock")
+	if err := os.WriteFile(sn.getSuperblockPath(sn.currentSuperblock), old, 0644); err != nil {
+		t.Fatalf("Failed to write legacy superblock: %v", err)
+	}
+	legacy := SuperblockHeader{Version: LegacySuperblockVersion, ChunkCount: 1, NextOffset: int64(len(old))}
+	if err := sn.writeSuperblockHeader(sn.currentSuperblock, legacy); err != nil {
+		t.Fatalf("Failed to write legacy header: %v", err)
+	}
+	sn.index.mu.Lock()
+	sn.index.set(ChunkEntry{ChunkID: "legacy-old", SuperblockID: sn.currentSuperblock, Size: int32(len(old)), Checksum: fmt.Sprintf("%x", sha256.Sum256(old))})
+	sn.index.mu.Unlock()
+
+	data := []byte("appended to a legacy superblock")
+	if err := sn.storeChunk("legacy-new", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+		t.Fatalf("Failed to store chunk: %v", err)
+	}
+	entry, _ := sn.lookupChunk("legacy-new")
+	if entry.SuperblockID != sn.currentSuperblock || entry.Offset != int64(len(old)) {
+		t.Errorf("Expected chunk appended at offset %d, got %+v", len(old), entry)
+	}
+
+	for id, want := range map[string][]byte{"legacy-old": old, "legacy-new": data} {
+		entry, _ := sn.lookupChunk(id)
+		if got, err := sn.readChunk(entry); err != nil || string(got) != string(want) {
+			t.Errorf("Expected %s to read %q, got %q (%v)", id, want, got, err)
+		}
+	}
+
+	if hdr, err := sn.readSuperblockHeader(sn.currentSuperblock); err != nil || hdr.Version != LegacySuperblockVersion {
+		t.Errorf("Expected legacy sidecar header, got %+v (%v)", hdr, err)
+	}
+}
+
+func TestStaleHeaderReconciledOnRestart(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		shift int64 // from the end of the last record
+	}{
+		{"past the end of the file", 4096},
+		{"inside a record", -5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sn, tempDir := setupTestStorageNode(t)
+			defer cleanupTestStorageNode(tempDir)
+
+			for i := 0; i < 3; i++ {
+				data := []byte(fmt.Sprintf("reconcile test chunk %d", i))
+				if err := sn.storeChunk(fmt.Sprintf("rec-%d", i), data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+					t.Fatalf("Failed to store chunk: %v", err)
+				}
+			}
+			sn.Shutdown()
+			id := sn.currentSuperblock
+			size, _ := sn.getSuperblockSize(id)
+
+			// A crash left the header disagreeing with the records
+			hdr, err := sn.readSuperblockHeader(id)
+			if err != nil {
+				t.Fatalf("Failed to read superblock header: %v", err)
+			}
+			hdr.ChunkCount, hdr.NextOffset = 1, size+tc.shift
+			if err := sn.writeSuperblockHeader(id, hdr); err != nil {
+				t.Fatalf("Failed to write superblock header: %v", err)
+			}
+
+			sn2 := NewStorageNode(tempDir, "test-node")
+			if err := sn2.Initialize(); err != nil {
+				t.Fatalf("Failed to initialize storage node: %v", err)
+			}
+
+			hdr, err = sn2.readSuperblockHeader(id)
+			if err != nil || hdr.NextOffset != size || hdr.ChunkCount != 3 {
+				t.Fatalf("Expected header for 3 chunks ending at %d, got %+v (%v)", size, hdr, err)
+			}
+			if !sn2.validateActiveSuperblockHeader() {
+				t.Error("Expected the reconciled header to validate")
+			}
+			if got, _ := sn2.getSuperblockSize(id); got != size {
+				t.Errorf("Expected no data trimmed, superblock is %d bytes instead of %d", got, size)
+			}
+			for i := 0; i < 3; i++ {
+				entry, _ := sn2.lookupChunk(fmt.Sprintf("rec-%d", i))
+				if _, _, err := sn2.readVerifiedChunk(entry); err != nil {
+					t.Errorf("Chunk rec-%d unreadable after reconciling: %v", i, err)
+				}
+			}
+
+			// The next write appends after the last record
+			data := []byte("written after reconciling")
+			if err := sn2.storeChunk("rec-next", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+				t.Fatalf("Failed to store chunk: %v", err)
+			}
+			if entry, _ := sn2.lookupChunk("rec-next"); entry.Offset != size+frameSize("rec-next") {
+				t.Errorf("Expected new chunk's payload at %d, got %d", size+frameSize("rec-next"), entry.Offset)
+			}
+			if hdr, err := sn2.readSuperblockHeader(id); err != nil || hdr.ChunkCount != 4 {
+				t.Errorf("Expected header chunk count 4 after append, got %+v (%v)", hdr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// tempPath returns where to stage a new version of target before it is
+// atomically moved into place. Without TEMP_DIR the temp file lives next to
+// the target.
+func (sn *StorageNode) tempPath(target string) string {
+	if sn.tempDir == "" {
+		return target + ".tmp"
+	}
+	return filepath.Join(sn.tempDir, filepath.Base(target)+".tmp")
+}
+
+// renameFile is os.Rename, swappable so tests can simulate cross-device errors
+var renameFile = os.Rename
+
+// replaceFile atomically replaces target with the staged file at tempFile.
+// A rename across filesystems (TEMP_DIR on another mount, overlay data dirs)
+// fails with EXDEV; the staged file is then copied and fsynced next to the
+// target so the final rename stays atomic and durable.
+func (sn *StorageNode) replaceFile(tempFile, target string) error {
+	err := renameFile(tempFile, target)
+	if err == nil {
+		sn.renameStrategyOnce.Do(func() {
+			log.Printf("Replacing files with atomic rename")
+		})
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	sn.copyStrategyOnce.Do(func() {
+		log.Printf("Cross-device rename from %s, falling back to copy+fsync+rename", filepath.Dir(tempFile))
+	})
+
+	local := target + ".tmp"
+	if err := copyFileSync(tempFile, local); err != nil {
+		os.Remove(local)
+		return err
+	}
+	os.Remove(tempFile)
+
+	if err := renameFile(local, target); err != nil {
+		os.Remove(local)
+		return err
+	}
+	return syncDir(filepath.Dir(target))
+}
+
+// copyFileSync copies src to dst and fsyncs dst
+func copyFileSync(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy to %s: %w", dst, err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to sync %s: %w", dst, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// simulateCrossDeviceRename makes renames between directories fail with
+// EXDEV, as they would if TEMP_DIR were on another filesystem. It returns a
+// counter of the renames that were refused.
+func simulateCrossDeviceRename(t *testing.T) *int {
+	refused := new(int)
+	renameFile = func(oldpath, newpath string) error {
+		if filepath.Dir(oldpath) != filepath.Dir(newpath) {
+			*refused++
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+		}
+		return os.Rename(oldpath, newpath)
+	}
+	t.Cleanup(func() { renameFile = os.Rename })
+	return refused
+}
+
+func TestSeparateTempDir(t *testing.T) {
+	for _, crossDevice := range []bool{false, true} {
+		t.Run(fmt.Sprintf("cross_device_%v", crossDevice), func(t *testing.T) {
+			dataDir, err := os.MkdirTemp("", "storage_node_test_*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer cleanupTestStorageNode(dataDir)
+			scratchDir, err := os.MkdirTemp("", "storage_node_scratch_*")
+			if err != nil {
+				t.Fatalf("Failed to create scratch dir: %v", err)
+			}
+			defer os.RemoveAll(scratchDir)
+
+			t.Setenv("TEMP_DIR", scratchDir)
+			sn := NewStorageNode(dataDir, "test-node")
+			if err := sn.Initialize(); err != nil {
+				t.Fatalf("Failed to initialize storage node: %v", err)
+			}
+			if crossDevice {
+				simulateCrossDeviceRename(t)
+			}
+
+			data := []byte("chunk stored with a separate temp dir")
+			if err := sn.storeChunk("temp-dir-chunk", data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+				t.Fatalf("Failed to store chunk: %v", err)
+			}
+			if err := sn.finalizeActiveSuperblock(); err != nil {
+				t.Fatalf("Failed to finalize superblock header: %v", err)
+			}
+
+			// Nothing is left behind in the scratch dir or next to the targets
+			if entries, _ := os.ReadDir(scratchDir); len(entries) != 0 {
+				t.Errorf("Expected empty temp dir, found %d file(s)", len(entries))
+			}
+			if _, err := os.Stat(sn.indexFile + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf("Expected no temp index file next to the index, stat error: %v", err)
+			}
+
+			restarted := NewStorageNode(dataDir, "test-node")
+			if err := restarted.Initialize(); err != nil {
+				t.Fatalf("Failed to restart storage node: %v", err)
+			}
+			if _, exists := restarted.index.chunks["temp-dir-chunk"]; !exists {
+				t.Error("Expected chunk to survive restart")
+			}
+			if _, err := restarted.readSuperblockHeader(0); err != nil {
+				t.Errorf("Expected superblock header to be persisted: %v", err)
+			}
+		})
+	}
+}
+
+func TestCrossDeviceIndexReplacement(t *testing.T) {
+	t.Setenv("INDEX_SAVE_DELAY", "0") // one index save per write
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	scratchDir, err := os.MkdirTemp("", "storage_node_scratch_*")
+	if err != nil {
+		t.Fatalf("Failed to create scratch dir: %v", err)
+	}
+	defer os.RemoveAll(scratchDir)
+	sn.tempDir = scratchDir
+
+	crossDeviceRenames := simulateCrossDeviceRename(t)
+
+	for i := 0; i < 3; i++ {
+		data := []byte(fmt.Sprintf("exdev chunk %d", i))
+		if err := sn.storeChunk(fmt.Sprintf("exdev-%d", i), data, fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			t.Fatalf("Failed to store chunk: %v", err)
+		}
+	}
+
+	if *crossDeviceRenames == 0 {
+		t.Fatal("Expected index saves to hit a cross-device rename")
+	}
+	if failed := sn.failedIndexSaves; failed != 0 {
+		t.Errorf("Expected no failed index saves, got %d", failed)
+	}
+
+	restarted := NewStorageNode(tempDir, "test-node")
+	if err := restarted.loadIndex(); err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	if len(restarted.index.chunks) != 3 {
+		t.Errorf("Expected 3 chunks in persisted index, got %d", len(restarted.index.chunks))
+	}
+}
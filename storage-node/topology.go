@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// NodeVersion is reported to the metadata service and on /version
+const NodeVersion = "1.0.0"
+
+// labelKeyPattern restricts label keys to identifier-like names
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// NodeTopology describes the node's failure domain. The node only reports
+// it; replica placement across zones and racks is the coordinator's job.
+type NodeTopology struct {
+	Zone   string            `json:"zone,omitempty"`
+	Rack   string            `json:"rack,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// VersionResponse represents the /version response
+type VersionResponse struct {
+	NodeID  string `json:"node_id"`
+	Version string `json:"version"`
+	NodeTopology
+}
+
+// parseNodeLabels parses NODE_LABELS, a comma-separated list of key=value
+// pairs such as "disk=ssd,tier=hot"
+func parseNodeLabels(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok {
+			return nil, fmt.Errorf("label %q is not a key=value pair", pair)
+		}
+		if !labelKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid label key %q", key)
+		}
+		if _, dup := labels[key]; dup {
+			return nil, fmt.Errorf("duplicate label key %q", key)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// handleVersion reports the node's version and topology labels
+func (sn *StorageNode) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	resp := VersionResponse{
+		NodeID:       sn.nodeID,
+		Version:      NodeVersion,
+		NodeTopology: sn.topology,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode version response: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseNodeLabels(t *testing.T) {
+	labels, err := parseNodeLabels(" disk=ssd, tier=hot ,power=feed-a")
+	if err != nil {
+		t.Fatalf("Failed to parse labels: %v", err)
+	}
+	if len(labels) != 3 || labels["disk"] != "ssd" || labels["tier"] != "hot" || labels["power"] != "feed-a" {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+
+	for _, invalid := range []string{"disk", "=ssd", "disk=ssd,disk=hdd", "bad key=1"} {
+		if _, err := parseNodeLabels(invalid); err == nil {
+			t.Errorf("Expected NODE_LABELS %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestInvalidNodeLabelsFailStartup(t *testing.T) {
+	t.Setenv("NODE_LABELS", "not-a-pair")
+	sn := NewStorageNode(t.TempDir(), "test-node")
+	if err := sn.Initialize(); err == nil {
+		t.Error("Expected Initialize to fail with invalid NODE_LABELS")
+	}
+}
+
+func TestTopologyInRegistration(t *testing.T) {
+	t.Setenv("NODE_ZONE", "us-east-1a")
+	t.Setenv("NODE_RACK", "r42")
+	t.Setenv("NODE_LABELS", "disk=ssd,tier=hot")
+	sn := NewStorageNode(t.TempDir(), "test-node")
+	if err := sn.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize storage node: %v", err)
+	}
+
+	var reg RegistrationRequest
+	var beat HeartbeatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var target interface{} = &beat
+		if r.URL.Path == "/nodes/register" {
+			target = &reg
+		}
+		if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+			t.Errorf("Failed to decode %s body: %v", r.URL.Path, err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	if err := sn.registerNode(context.Background(), server.URL, "http://node:8081"); err != nil {
+		t.Fatalf("Registration failed: %v", err)
+	}
+	if err := sn.sendHeartbeat(context.Background(), server.URL); err != nil {
+		t.Fatalf("Heartbeat failed: %v", err)
+	}
+
+	for name, got := range map[string]NodeTopology{"registration": reg.NodeTopology, "heartbeat": beat.NodeTopology} {
+		if got.Zone != "us-east-1a" || got.Rack != "r42" || got.Labels["disk"] != "ssd" || got.Labels["tier"] != "hot" {
+			t.Errorf("Expected topology labels in %s body, got %+v", name, got)
+		}
+	}
+	if reg.NodeID != "test-node" || reg.NodeURL != "http://node:8081" {
+		t.Errorf("Unexpected registration body %+v", reg)
+	}
+
+	req := httptest.NewRequest("GET", "/version", nil)
+	w := httptest.NewRecorder()
+	sn.newRouter().ServeHTTP(w, req)
+	var version VersionResponse
+	if err := json.NewDecoder(w.Body).Decode(&version); err != nil {
+		t.Fatalf("Failed to decode version response: %v", err)
+	}
+	if version.Zone != "us-east-1a" || version.Rack != "r42" || version.Version != NodeVersion {
+		t.Errorf("Unexpected version response %+v", version)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultUnixSocketMode lets the owner and group connect (see UNIX_SOCKET_MODE)
+const DefaultUnixSocketMode os.FileMode = 0660
+
+// unixSocketConfig reads UNIX_SOCKET, UNIX_SOCKET_MODE (octal) and
+// UNIX_SOCKET_ONLY, which turns off the TCP listener. An empty path means no
+// Unix socket.
+func unixSocketConfig() (path string, mode os.FileMode, only bool, err error) {
+	path = os.Getenv("UNIX_SOCKET")
+	mode = DefaultUnixSocketMode
+	if envMode := os.Getenv("UNIX_SOCKET_MODE"); envMode != "" {
+		m, err := strconv.ParseUint(envMode, 8, 32)
+		if err != nil || m > 0777 {
+			return "", 0, false, fmt.Errorf("invalid UNIX_SOCKET_MODE '%s': want octal permissions like 0660", envMode)
+		}
+		mode = os.FileMode(m)
+	}
+	only = os.Getenv("UNIX_SOCKET_ONLY") == "true"
+	if only && path == "" {
+		return "", 0, false, fmt.Errorf("UNIX_SOCKET_ONLY requires UNIX_SOCKET")
+	}
+	return path, mode, only, nil
+}
+
+// UnixSocketProbeTimeout bounds the dial that checks whether an existing
+// socket file still has a server behind it
+const UnixSocketProbeTimeout = time.Second
+
+// staleSocket reports whether path holds a socket left behind by an unclean
+// shutdown. It fails if path is some other kind of file, or if a server
+// accepts connections on it: removing a live socket would silently take it
+// away from the process serving it, such as a second node started on the
+// same data directory.
+func staleSocket(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return false, fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, UnixSocketProbeTimeout); err == nil {
+		conn.Close()
+		return false, fmt.Errorf("%s is in use by another server", path)
+	}
+	return true, nil
+}
+
+// listenUnix listens on a Unix domain socket with the given permissions,
+// replacing a socket left behind by an unclean shutdown. The socket file is
+// removed when the listener is closed.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	stale, err := staleSocket(path)
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocketListener(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	// Socket paths are limited to ~108 bytes, so keep this one short
+	sockDir, err := os.MkdirTemp("", "vstack-sock")
+	if err != nil {
+		t.Fatalf("Failed to create socket dir: %v", err)
+	}
+	defer os.RemoveAll(sockDir)
+	path := filepath.Join(sockDir, "node.sock")
+
+	// A socket left behind by a crash is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenUnix(path, 0600)
+	if err != nil {
+		t.Fatalf("Failed to listen on Unix socket: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected socket mode 0600, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	srv := newHTTPServer("", sn.newRouter())
+	go srv.Serve(ln)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+
+	data := []byte("chunk over a unix socket")
+	req, _ := http.NewRequest("PUT", "http://unix/chunk/unix-chunk", bytes.NewReader(data))
+	req.Header.Set("X-Chunk-Checksum", fmt.Sprintf("%x", sha256.Sum256(data)))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("PUT over Unix socket failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected PUT status %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	resp, err = client.Get("http://unix/chunk/unix-chunk")
+	if err != nil {
+		t.Fatalf("GET over Unix socket failed: %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(got, data) {
+		t.Errorf("Expected the stored chunk back, got status %d and %q", resp.StatusCode, got)
+	}
+
+	// Shutting down removes the socket file
+	client.CloseIdleConnections()
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Failed to shut down server: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket file to be removed, got %v", err)
+	}
+}
+
+func TestListenUnixRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if _, err := listenUnix(path, DefaultUnixSocketMode); err == nil {
+		t.Error("Expected listenUnix to refuse to replace a regular file")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the file to be left alone: %v", err)
+	}
+}
+
+func TestListenUnixRefusesLiveSocket(t *testing.T) {
+	sockDir, err := os.MkdirTemp("", "vstack-sock")
+	if err != nil {
+		t.Fatalf("Failed to create socket dir: %v", err)
+	}
+	defer os.RemoveAll(sockDir)
+	path := filepath.Join(sockDir, "node.sock")
+
+	live, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer live.Close()
+
+	if _, err := listenUnix(path, DefaultUnixSocketMode); err == nil {
+		t.Error("Expected listenUnix to refuse a socket another server is listening on")
+	}
+	if err := validateListeners([]listenerConfig{{name: "UNIX_SOCKET", network: "unix", address: path}}); err == nil {
+		t.Error("Expected startup validation to reject a socket in use")
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Expected the live socket to be left in place: %v", err)
+	}
+	conn.Close()
+}
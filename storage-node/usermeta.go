@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// UserMetaHeaderPrefix marks request headers stored with a chunk and echoed
+// back on GET/HEAD, like S3's x-amz-meta-*
+const UserMetaHeaderPrefix = "X-Chunk-Meta-"
+
+// Limits on user metadata per chunk, to keep the index small
+const (
+	MaxUserMetaEntries = 16
+	MaxUserMetaBytes   = 2048 // Sum of key and value lengths
+)
+
+// parseUserMeta collects the X-Chunk-Meta-* headers of a PUT. Keys are stored
+// lowercased without the prefix; repeated headers are joined with commas.
+func parseUserMeta(h http.Header) (map[string]string, error) {
+	var meta map[string]string
+	total := 0
+	for name, values := range h {
+		if len(name) <= len(UserMetaHeaderPrefix) || !strings.EqualFold(name[:len(UserMetaHeaderPrefix)], UserMetaHeaderPrefix) {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		key := strings.ToLower(name[len(UserMetaHeaderPrefix):])
+		value := strings.Join(values, ",")
+		meta[key] = value
+		total += len(key) + len(value)
+	}
+
+	if len(meta) > MaxUserMetaEntries {
+		return nil, fmt.Errorf("too many %s* headers: %d (max %d)", UserMetaHeaderPrefix, len(meta), MaxUserMetaEntries)
+	}
+	if total > MaxUserMetaBytes {
+		return nil, fmt.Errorf("%s* headers exceed %d bytes", UserMetaHeaderPrefix, MaxUserMetaBytes)
+	}
+	return meta, nil
+}
+
+// setUserMetaHeaders echoes a chunk's user metadata as X-Chunk-Meta-* headers
+func setUserMetaHeaders(w http.ResponseWriter, entry ChunkEntry) {
+	keys := make([]string, 0, len(entry.Meta))
+	for key := range entry.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		w.Header().Set(UserMetaHeaderPrefix+key, entry.Meta[key])
+	}
+}
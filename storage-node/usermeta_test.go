@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestUserMetadataRoundTrip(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleGetChunk).Methods("GET")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleHeadChunk).Methods("HEAD")
+
+	data := []byte("chunk with user metadata")
+	put := func(chunkID string, meta map[string]string) int {
+		req := httptest.NewRequest("PUT", "/chunk/"+chunkID, bytes.NewReader(data))
+		req.Header.Set("X-Chunk-Checksum", fmt.Sprintf("%x", sha256.Sum256(data)))
+		for key, value := range meta {
+			req.Header.Set(UserMetaHeaderPrefix+key, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	meta := map[string]string{
+		"Owner":        "alice",
+		"Content-Hint": "thumbnail",
+		"Video-Id":     "v-123",
+	}
+	if code := put("meta-chunk", meta); code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, code)
+	}
+
+	for _, method := range []string{"GET", "HEAD"} {
+		t.Run(strings.ToLower(method)+"_echoes_metadata", func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(method, "/chunk/meta-chunk", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			for key, value := range meta {
+				if got := w.Header().Get(UserMetaHeaderPrefix + key); got != value {
+					t.Errorf("Expected %s%s: %q, got %q", UserMetaHeaderPrefix, key, value, got)
+				}
+			}
+		})
+	}
+
+	t.Run("metadata_survives_restart", func(t *testing.T) {
+		if err := sn.saveIndex(); err != nil {
+			t.Fatalf("Failed to save index: %v", err)
+		}
+		sn2 := NewStorageNode(tempDir, "test-node")
+		if err := sn2.loadIndex(); err != nil {
+			t.Fatalf("Failed to load index: %v", err)
+		}
+		entry, ok := sn2.lookupChunk("meta-chunk")
+		if !ok || entry.Meta["owner"] != "alice" || len(entry.Meta) != len(meta) {
+			t.Errorf("Expected metadata after reload, got %v (found=%v)", entry.Meta, ok)
+		}
+	})
+
+	t.Run("too_many_entries_rejected", func(t *testing.T) {
+		many := make(map[string]string)
+		for i := 0; i <= MaxUserMetaEntries; i++ {
+			many[fmt.Sprintf("Key-%d", i)] = "v"
+		}
+		if code := put("too-many-meta", many); code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+		}
+	})
+
+	t.Run("oversized_metadata_rejected", func(t *testing.T) {
+		big := map[string]string{"Blob": strings.Repeat("x", MaxUserMetaBytes)}
+		if code := put("big-meta", big); code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+		}
+		if _, ok := sn.lookupChunk("big-meta"); ok {
+			t.Error("Expected rejected chunk not to be stored")
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultDeleteWaitTimeout bounds how long a DELETE waits for an in-progress
+// PUT of the same chunk (see DELETE_WAIT_TIMEOUT)
+const DefaultDeleteWaitTimeout = 10 * time.Second
+
+var errWriteInProgress = errors.New("chunk is being written")
+
+// activeWrite tracks the PUTs of one chunk ID currently being handled
+type activeWrite struct {
+	refs int
+	done chan struct{} // closed when the last of them finishes
+}
+
+// beginWrite marks chunkID as being written until the returned func is
+// called. It should be called before the PUT checks whether the chunk exists.
+func (sn *StorageNode) beginWrite(chunkID string) (end func()) {
+	sn.activeWritesMu.Lock()
+	aw, ok := sn.activeWrites[chunkID]
+	if !ok {
+		aw = &activeWrite{done: make(chan struct{})}
+		sn.activeWrites[chunkID] = aw
+	}
+	aw.refs++
+	sn.activeWritesMu.Unlock()
+
+	return func() {
+		sn.activeWritesMu.Lock()
+		defer sn.activeWritesMu.Unlock()
+		if aw.refs--; aw.refs == 0 {
+			delete(sn.activeWrites, chunkID)
+			close(aw.done)
+		}
+	}
+}
+
+// writeInProgress reports whether a PUT of chunkID is being handled
+func (sn *StorageNode) writeInProgress(chunkID string) bool {
+	sn.activeWritesMu.Lock()
+	defer sn.activeWritesMu.Unlock()
+	_, ok := sn.activeWrites[chunkID]
+	return ok
+}
+
+// awaitWrite blocks until no PUT of chunkID is in progress. It returns
+// errWriteInProgress if ctx ends first.
+func (sn *StorageNode) awaitWrite(ctx context.Context, chunkID string) error {
+	for {
+		sn.activeWritesMu.Lock()
+		aw, ok := sn.activeWrites[chunkID]
+		sn.activeWritesMu.Unlock()
+		if !ok {
+			return nil
+		}
+		select {
+		case <-aw.done:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: still in progress after waiting", errWriteInProgress)
+		}
+	}
+}
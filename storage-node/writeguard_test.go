@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDeleteDuringPut(t *testing.T) {
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/chunk/{chunk_id}", sn.handlePutChunk).Methods("PUT")
+	r.HandleFunc("/chunk/{chunk_id}", sn.handleDeleteChunk).Methods("DELETE")
+
+	data := []byte("slowly uploaded chunk data")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	// startSlowPut issues a PUT whose body is only half sent until the
+	// returned writer is finished
+	startSlowPut := func(chunkID string) (*io.PipeWriter, <-chan int) {
+		pr, pw := io.Pipe()
+		req := httptest.NewRequest("PUT", "/chunk/"+chunkID, pr)
+		req.Header.Set("X-Chunk-Checksum", checksum)
+		req.Header.Set("Content-Length", strconv.Itoa(len(data)))
+		req.ContentLength = int64(len(data))
+
+		done := make(chan int, 1)
+		go func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			done <- w.Code
+		}()
+		if _, err := pw.Write(data[:len(data)/2]); err != nil {
+			t.Fatalf("Failed to write first half of body: %v", err)
+		}
+		return pw, done
+	}
+
+	startDelete := func(chunkID string) <-chan int {
+		done := make(chan int, 1)
+		go func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("DELETE", "/chunk/"+chunkID, nil))
+			done <- w.Code
+		}()
+		return done
+	}
+
+	t.Run("delete_waits_for_put", func(t *testing.T) {
+		pw, putDone := startSlowPut("racy-chunk")
+		delDone := startDelete("racy-chunk")
+
+		select {
+		case code := <-delDone:
+			t.Fatalf("DELETE returned %d while the PUT was still in progress", code)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		pw.Write(data[len(data)/2:])
+		pw.Close()
+
+		if code := <-putDone; code != http.StatusCreated {
+			t.Fatalf("Expected PUT status %d, got %d", http.StatusCreated, code)
+		}
+		if code := <-delDone; code != http.StatusNoContent {
+			t.Fatalf("Expected DELETE status %d, got %d", http.StatusNoContent, code)
+		}
+		if _, ok := sn.lookupChunk("racy-chunk"); ok {
+			t.Error("Expected chunk to be gone after the DELETE")
+		}
+	})
+
+	t.Run("delete_times_out_with_409", func(t *testing.T) {
+		sn.deleteWaitTimeout = 50 * time.Millisecond
+		defer func() { sn.deleteWaitTimeout = DefaultDeleteWaitTimeout }()
+
+		pw, putDone := startSlowPut("stuck-chunk")
+		if code := <-startDelete("stuck-chunk"); code != http.StatusConflict {
+			t.Errorf("Expected DELETE status %d, got %d", http.StatusConflict, code)
+		}
+
+		pw.Write(data[len(data)/2:])
+		pw.Close()
+		if code := <-putDone; code != http.StatusCreated {
+			t.Fatalf("Expected PUT status %d, got %d", http.StatusCreated, code)
+		}
+		// The rejected DELETE must not have taken effect
+		if _, ok := sn.lookupChunk("stuck-chunk"); !ok {
+			t.Error("Expected chunk to survive the rejected DELETE")
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// WriteRetryAfter is the Retry-After hint for writes shed under
+// MAX_CONCURRENT_WRITES
+const WriteRetryAfter = time.Second
+
+// limitWrites bounds the number of concurrently executing write requests
+// across all clients. With MAX_CONCURRENT_WRITES unset the count is only
+// tracked; once saturated further writes are shed with 503 instead of
+// queueing, so request bodies don't pile up in memory.
+func (sn *StorageNode) limitWrites(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sn.writeSlots != nil {
+			select {
+			case sn.writeSlots <- struct{}{}:
+				defer func() { <-sn.writeSlots }()
+			default:
+				atomic.AddInt64(&sn.writesShed, 1)
+				w.Header().Set("Retry-After", strconv.Itoa(int(WriteRetryAfter/time.Second)))
+				http.Error(w, "Too many concurrent writes", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		atomic.AddInt64(&sn.inflightWrites, 1)
+		defer atomic.AddInt64(&sn.inflightWrites, -1)
+		next(w, r)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrentWritesAreShed(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_WRITES", "2")
+	sn, tempDir := setupTestStorageNode(t)
+	defer cleanupTestStorageNode(tempDir)
+
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(2)
+	slow := sn.limitWrites(func(w http.ResponseWriter, r *http.Request) {
+		started.Done()
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	const writers = 6
+	codes := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			slow(w, httptest.NewRequest("PUT", "/chunk/slow", nil))
+			codes <- w.Code
+			if w.Code == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+				t.Error("Expected Retry-After on shed write")
+			}
+		}()
+	}
+
+	// Wait for the two admitted writes, then let the shed ones finish
+	started.Wait()
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt64(&sn.writesShed) < writers-2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// A real PUT through the router is shed too while the limit is saturated
+	r := sn.newRouter()
+	req := httptest.NewRequest("PUT", "/chunk/shed-put", bytes.NewReader([]byte("data")))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d for PUT at the limit, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	metricsReq := httptest.NewRequest("GET", "/metrics", nil)
+	metricsW := httptest.NewRecorder()
+	r.ServeHTTP(metricsW, metricsReq)
+	for _, line := range []string{"vstack_inflight_writes 2", "vstack_write_concurrency_limit 2"} {
+		if !strings.Contains(metricsW.Body.String(), line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusCreated] != 2 || counts[http.StatusServiceUnavailable] != writers-2 {
+		t.Errorf("Expected 2 admitted and %d shed writes, got %v", writers-2, counts)
+	}
+	if got := atomic.LoadInt64(&sn.inflightWrites); got != 0 {
+		t.Errorf("Expected no in-flight writes after completion, got %d", got)
+	}
+}